@@ -11,23 +11,29 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 const defaultPort = "8081"
 const defaultSecret = "carrier-grade-webrtc-secret-change-in-production"
+const defaultTURNCredentialTTL = 12 * time.Hour
+const defaultSTUNURL = "stun:stun.l.google.com:19302"
 
 func main() {
 	port := getEnv("AUTH_PORT", defaultPort)
 	secret := getEnv("AUTH_SECRET", defaultSecret)
 	validator := auth.NewJWTValidator(secret)
+	directory, issuer := loadICEConfig()
+	clients := loadAPIClients()
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /auth/token", handleIssueToken(secret))
+	mux.HandleFunc("POST /auth/token", handleIssueToken(secret, clients))
 	mux.HandleFunc("GET /auth/validate", handleValidate(validator))
+	mux.HandleFunc("GET /auth/ice-servers", handleICEServers(validator, directory, issuer))
 	mux.HandleFunc("GET /health/live", handleLiveness)
 	mux.HandleFunc("GET /health/ready", handleReadiness)
 
@@ -50,8 +56,81 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func handleIssueToken(secret string) http.HandlerFunc {
+// loadICEConfig builds the ICE server directory from ICE_SERVERS_FILE, or from
+// STUN_URLS/TURN_URLS for a single default region. TURN credentials are only
+// issued when TURN_SECRET (shared with coturn's static-auth-secret) is set.
+func loadICEConfig() (*auth.ICEServerDirectory, *auth.TURNCredentialIssuer) {
+	var directory *auth.ICEServerDirectory
+	if path := os.Getenv("ICE_SERVERS_FILE"); path != "" {
+		dir, err := auth.LoadICEServerDirectory(path)
+		if err != nil {
+			log.Fatalf("Failed to load ICE servers: %v", err)
+		}
+		directory = dir
+	} else {
+		directory = &auth.ICEServerDirectory{
+			DefaultRegion: "default",
+			Regions: map[string]auth.RegionServers{
+				"default": {
+					STUN: splitList(getEnv("STUN_URLS", defaultSTUNURL)),
+					TURN: splitList(os.Getenv("TURN_URLS")),
+				},
+			},
+		}
+	}
+	var issuer *auth.TURNCredentialIssuer
+	if turnSecret := os.Getenv("TURN_SECRET"); turnSecret != "" {
+		ttl := defaultTURNCredentialTTL
+		if v := os.Getenv("TURN_CREDENTIAL_TTL"); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				log.Fatalf("Invalid TURN_CREDENTIAL_TTL: %v", err)
+			}
+			ttl = parsed
+		}
+		issuer = auth.NewTURNCredentialIssuer(turnSecret, ttl)
+	}
+	return directory, issuer
+}
+
+// loadAPIClients reads AUTH_CLIENTS_FILE. Without it any caller may mint
+// tokens, always in the default tenant, which suits development only.
+func loadAPIClients() auth.APIClients {
+	path := os.Getenv("AUTH_CLIENTS_FILE")
+	if path == "" {
+		log.Printf("AUTH_CLIENTS_FILE unset: /auth/token is open and issues default-tenant tokens only")
+		return nil
+	}
+	clients, err := auth.LoadAPIClients(path)
+	if err != nil {
+		log.Fatalf("Failed to load API clients: %v", err)
+	}
+	return clients
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// handleIssueToken mints a token for the body's userId. With API clients
+// configured the request must carry a known X-API-Key, whose client decides
+// the tenant and grants roles; claims in the body are never trusted.
+func handleIssueToken(secret string, clients auth.APIClients) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		var client auth.APIClient
+		if clients != nil {
+			var ok bool
+			if client, ok = clients.Lookup(r.Header.Get("X-API-Key")); !ok {
+				http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+				return
+			}
+		}
 		var req struct {
 			UserID string `json:"userId"`
 		}
@@ -60,10 +139,16 @@ func handleIssueToken(secret string) http.HandlerFunc {
 			return
 		}
 		claims := jwt.MapClaims{
-			"sub":         req.UserID,
-			"session_id":  generateSessionID(),
-			"exp":         time.Now().Add(24 * time.Hour).Unix(),
-			"iat":         time.Now().Unix(),
+			"sub":        req.UserID,
+			"session_id": generateSessionID(),
+			"exp":        time.Now().Add(24 * time.Hour).Unix(),
+			"iat":        time.Now().Unix(),
+		}
+		if client.Tenant != "" {
+			claims["tenant"] = client.Tenant
+		}
+		if role := client.Roles[req.UserID]; role != "" {
+			claims["role"] = role
 		}
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 		signed, err := token.SignedString([]byte(secret))
@@ -76,15 +161,20 @@ func handleIssueToken(secret string) http.HandlerFunc {
 	}
 }
 
+func requestToken(r *http.Request) string {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get("Authorization")
+		if len(token) > 7 && token[:7] == "Bearer " {
+			token = token[7:]
+		}
+	}
+	return token
+}
+
 func handleValidate(validator *auth.JWTValidator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.URL.Query().Get("token")
-		if token == "" {
-			token = r.Header.Get("Authorization")
-			if len(token) > 7 && token[:7] == "Bearer " {
-				token = token[7:]
-			}
-		}
+		token := requestToken(r)
 		if token == "" {
 			http.Error(w, `{"error":"token required"}`, http.StatusUnauthorized)
 			return
@@ -96,13 +186,54 @@ func handleValidate(validator *auth.JWTValidator) http.HandlerFunc {
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"sub":         claims.Subject,
-			"session_id":  claims.SessionID,
-			"expires_at":  claims.ExpiresAt,
+			"sub":        claims.Subject,
+			"session_id": claims.SessionID,
+			"expires_at": claims.ExpiresAt,
+			"tenant":     claims.Tenant,
+			"role":       claims.Role,
 		})
 	}
 }
 
+// handleICEServers returns an RTCIceServer list for the caller's tenant and
+// requested region, with TURN REST credentials that expire no later than the JWT.
+func handleICEServers(validator *auth.JWTValidator, directory *auth.ICEServerDirectory, issuer *auth.TURNCredentialIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		if token == "" {
+			http.Error(w, `{"error":"token required"}`, http.StatusUnauthorized)
+			return
+		}
+		claims, err := validator.Validate(r.Context(), token)
+		if err != nil {
+			http.Error(w, `{"error":"invalid token"}`, http.StatusUnauthorized)
+			return
+		}
+		servers := directory.Lookup(claims.Tenant, r.URL.Query().Get("region"))
+		resp := map[string]interface{}{}
+		var creds *auth.TURNCredentials
+		if issuer != nil && len(servers.TURN) > 0 {
+			user := claims.Subject
+			if claims.Tenant != "" {
+				user = claims.Tenant + "/" + claims.Subject
+			}
+			// Tokens without an expiry get the issuer's full TTL.
+			var notAfter time.Time
+			if claims.ExpiresAt > 0 {
+				notAfter = time.Unix(claims.ExpiresAt, 0)
+			}
+			issued := issuer.Issue(user, notAfter)
+			creds = &issued
+			resp["expiresAt"] = issued.ExpiresAt.Unix()
+			resp["ttl"] = int64(time.Until(issued.ExpiresAt).Seconds())
+		}
+		resp["iceServers"] = auth.BuildICEServers(servers, creds)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
 func handleLiveness(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
@@ -0,0 +1,73 @@
+// Command auth — Token issuance tests.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+)
+
+const testSecret = "test-secret"
+
+// issue posts body to the token handler with apiKey and returns the status
+// and, on success, the token's claims.
+func issue(t *testing.T, clients auth.APIClients, apiKey, body string) (int, *contracts.Claims) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	rec := httptest.NewRecorder()
+	handleIssueToken(testSecret, clients)(rec, req)
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+	var out struct{ Token string }
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := auth.NewJWTValidator(testSecret).Validate(context.Background(), out.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, claims
+}
+
+func TestIssueTokenBindsTenantToAPIKey(t *testing.T) {
+	clients := auth.APIClients{"acme-key": {Tenant: "acme"}}
+	code, claims := issue(t, clients, "acme-key", `{"userId":"alice","tenant":"globex"}`)
+	if code != http.StatusOK || claims.Subject != "alice" || claims.Tenant != "acme" {
+		t.Fatalf("got %d %+v, want alice in acme", code, claims)
+	}
+	for _, key := range []string{"", "globex-key"} {
+		if code, _ := issue(t, clients, key, `{"userId":"alice"}`); code != http.StatusUnauthorized {
+			t.Errorf("key %q: got %d, want 401", key, code)
+		}
+	}
+	// Without API clients tokens are only issued for the default tenant.
+	if _, claims := issue(t, nil, "", `{"userId":"alice","tenant":"globex"}`); claims.Tenant != "" {
+		t.Errorf("open endpoint issued tenant %q", claims.Tenant)
+	}
+}
+
+func TestIssueTokenIgnoresBodyRole(t *testing.T) {
+	clients := auth.APIClients{"acme-key": {Tenant: "acme", Roles: map[string]string{"alice": "host"}}}
+	if _, claims := issue(t, clients, "acme-key", `{"userId":"alice","role":"moderator"}`); claims.Role != "host" {
+		t.Errorf("alice got role %q, want her grant", claims.Role)
+	}
+	if _, claims := issue(t, clients, "acme-key", `{"userId":"mallory","role":"host"}`); claims.Role != "" {
+		t.Errorf("mallory got role %q from the request body", claims.Role)
+	}
+	if _, claims := issue(t, nil, "", `{"userId":"mallory","role":"host"}`); claims.Role != "" {
+		t.Errorf("open endpoint issued role %q", claims.Role)
+	}
+}
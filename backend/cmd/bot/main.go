@@ -0,0 +1,98 @@
+// Command bot — Headless echo or test-tone bot.
+//
+// Joins a room through the signaling service and either echoes every peer's
+// media and data back to it, or plays a 440 Hz tone to every peer that joins.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/loadgen"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/client"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/headless"
+	"github.com/pion/webrtc/v4"
+)
+
+const defaultSecret = "carrier-grade-webrtc-secret-change-in-production"
+
+func main() {
+	signalingURL := flag.String("url", "http://localhost:8080", "signaling service base URL")
+	authURL := flag.String("auth-url", "", "mint the token via the auth service at this base URL")
+	secret := flag.String("secret", getEnv("AUTH_SECRET", defaultSecret), "JWT secret for a locally minted token")
+	user := flag.String("user", "bot", "user ID")
+	apiKey := flag.String("api-key", os.Getenv("AUTH_API_KEY"), "auth service API key, which decides the tenant")
+	tenant := flag.String("tenant", "", "tenant claim of a locally minted token")
+	room := flag.String("room", "lobby", "room to join")
+	mode := flag.String("mode", "echo", "echo or tone")
+	video := flag.Bool("video", false, "tone mode: also send synthetic VP8")
+	stunURL := flag.String("stun", "stun:stun.l.google.com:19302", "STUN server (empty for none)")
+	flag.Parse()
+
+	var tokens client.TokenSource
+	if *authURL != "" {
+		tokens = client.AuthServiceToken(*authURL, *user, *apiKey, nil)
+	} else {
+		mint := loadgen.LocalTokens(*secret, *tenant, 24*time.Hour)
+		tokens = func(ctx context.Context) (string, error) { return mint(ctx, *user) }
+	}
+
+	cfg := headless.Config{DataChannel: true}
+	switch *mode {
+	case "echo":
+		cfg.Echo = true
+	case "tone":
+		cfg.Audio, cfg.Video, cfg.OfferOnJoin = true, *video, true
+	default:
+		log.Fatalf("unknown mode %q", *mode)
+	}
+	if *stunURL != "" {
+		cfg.ICEServers = []webrtc.ICEServer{{URLs: []string{*stunURL}}}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	peer, err := headless.New(*signalingURL, tokens, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer peer.Close()
+	if err := peer.Connect(ctx); err != nil {
+		log.Fatalf("Signaling connect failed: %v", err)
+	}
+	joined, err := peer.Join(ctx, *room)
+	if err != nil {
+		log.Fatalf("Join failed: %v", err)
+	}
+	log.Printf("Bot %s (%s) joined %s with %d peer(s)", joined.PeerID, *mode, *room, len(joined.Peers))
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, id := range peer.Sessions() {
+				if st, err := peer.Stats(id); err == nil {
+					log.Printf("%s: %s audio=%d video=%d data=%d", id, st.State, st.AudioPackets, st.VideoPackets, st.DataMessages)
+				}
+			}
+		}
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
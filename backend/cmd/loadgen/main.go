@@ -0,0 +1,73 @@
+// Command loadgen — Load generator for the signaling service.
+//
+// Opens many WebSocket peers, joins them to rooms and exchanges synthetic
+// offer/answer/ICE traffic, then reports connection success, relay latency
+// percentiles and drops. Tokens are signed locally with AUTH_SECRET unless
+// -auth-url points at the auth service.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/loadgen"
+)
+
+const defaultSecret = "carrier-grade-webrtc-secret-change-in-production"
+
+func main() {
+	var cfg loadgen.Config
+	flag.StringVar(&cfg.URL, "url", "ws://localhost:8080/ws/signal", "signaling WebSocket URL")
+	secret := flag.String("secret", getEnv("AUTH_SECRET", defaultSecret), "JWT secret for locally minted tokens")
+	authURL := flag.String("auth-url", "", "mint tokens via the auth service at this base URL instead")
+	apiKey := flag.String("api-key", os.Getenv("AUTH_API_KEY"), "auth service API key, which decides the tenant")
+	tenant := flag.String("tenant", "", "tenant claim for every locally minted token")
+	flag.IntVar(&cfg.Peers, "peers", 1000, "number of peers")
+	flag.IntVar(&cfg.RoomSize, "room-size", 2, "peers per room")
+	flag.StringVar(&cfg.Pattern, "pattern", loadgen.PatternRooms, "room pattern: rooms, single or random")
+	flag.StringVar(&cfg.RoomPrefix, "room-prefix", "loadgen", "room ID prefix")
+	flag.Float64Var(&cfg.ConnectRate, "rate", 200, "new connections per second (0 = unlimited)")
+	flag.DurationVar(&cfg.Duration, "duration", 30*time.Second, "traffic phase length")
+	flag.DurationVar(&cfg.ExchangeInterval, "interval", time.Second, "per-peer offer interval")
+	flag.IntVar(&cfg.Candidates, "candidates", 2, "ICE candidates per offer and answer")
+	flag.DurationVar(&cfg.Timeout, "timeout", 5*time.Second, "handshake/join timeout and drain grace")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if *authURL != "" {
+		cfg.Tokens = loadgen.AuthServiceTokens(*authURL, *apiKey, nil)
+	} else {
+		cfg.Tokens = loadgen.LocalTokens(*secret, *tenant, 24*time.Hour)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("loadgen: %d peers -> %s (%s, room size %d)", cfg.Peers, cfg.URL, cfg.Pattern, cfg.RoomSize)
+	report, err := loadgen.Run(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
+	report.WriteText(os.Stdout)
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -1,6 +1,10 @@
 // Command signaling — WebRTC signaling service over WebSocket.
 //
-// Handles SDP/ICE relay, room management, and JWT-authenticated connections.
+// Handles SDP/ICE relay, room management, and JWT-authenticated connections,
+// plus WHIP/WHEP over HTTP when the SFU is enabled, SIP over WebSocket
+// when a SIP domain is set, and a gRPC API when a gRPC port is set.
+// SIGINT or SIGTERM drains connections, so open rooms and calls end and
+// their CDRs, audit entries and webhooks are flushed before exit.
 // By:- Faisal Hanif | imfanee@gmail.com
 
 package main
@@ -9,30 +13,55 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/audit"
 	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
 	"github.com/faisalhanif/carrier-grade-webrtc/internal/cache"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/cdr"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/grpcapi"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/recording"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/sfu"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/candidate"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/fallback"
 	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/sdp"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/sipgw"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/stun"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/telemetry"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/webhook"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/whip"
 	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/gorilla/websocket"
 )
 
 const defaultPort = "8080"
 const defaultRedisAddr = "localhost:6379"
 const defaultSecret = "carrier-grade-webrtc-secret-change-in-production"
+const defaultCDRMaxBytes = 100 << 20
+const shutdownTimeout = 10 * time.Second
+const defaultAllowedOrigins = "http://localhost:3000"
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	Subprotocols: wire.Subprotocols,
 }
 
 func main() {
 	port := getEnv("SIGNALING_PORT", defaultPort)
 	redisAddr := getEnv("REDIS_ADDR", defaultRedisAddr)
 	secret := getEnv("AUTH_SECRET", defaultSecret)
+	// Browser origins allowed on /ws/signal and the HTTP fallback.
+	origins := strings.Split(getEnv("ALLOWED_ORIGINS", defaultAllowedOrigins), ",")
+	upgrader.CheckOrigin = fallback.CheckOrigin(origins)
 
 	var store contracts.SessionStore
 	var redisStore *cache.RedisStore
@@ -45,24 +74,237 @@ func main() {
 		store = redisStore
 	}
 
+	// shutdownCtx bounds shutdown, including the flushes deferred below; it
+	// is cancelled shutdownTimeout after the service starts shutting down.
+	shutdownCtx, cancelShutdown := context.WithCancel(context.Background())
+	defer cancelShutdown()
+
+	registry := telemetry.NewRegistry()
+	metrics := telemetry.New(4096, 100, 10*time.Second, registry.Flush)
+	defer func() { metrics.Shutdown(shutdownCtx) }()
+
+	hubOpts := []hub.Option{hub.WithTelemetry(metrics)}
+	if path := os.Getenv("SDP_POLICY_FILE"); path != "" {
+		policies, err := sdp.LoadPolicySet(path)
+		if err != nil {
+			log.Fatalf("Failed to load SDP policy: %v", err)
+		}
+		hubOpts = append(hubOpts, hub.WithSDPPolicies(policies))
+	}
+	if path := os.Getenv("ICE_POLICY_FILE"); path != "" {
+		policies, err := candidate.LoadPolicySet(path)
+		if err != nil {
+			log.Fatalf("Failed to load ICE policy: %v", err)
+		}
+		hubOpts = append(hubOpts, hub.WithICEPolicies(policies))
+	}
+	if path := os.Getenv("TENANT_QUOTA_FILE"); path != "" {
+		quotas, err := hub.LoadTenantQuotas(path)
+		if err != nil {
+			log.Fatalf("Failed to load tenant quotas: %v", err)
+		}
+		hubOpts = append(hubOpts, hub.WithTenantQuotas(quotas))
+	}
+	compressMin := getEnvInt("WS_COMPRESSION_THRESHOLD", hub.DefaultCompressionThreshold)
+	upgrader.EnableCompression = compressMin > 0
+	hubOpts = append(hubOpts, hub.WithCompressionThreshold(compressMin))
+	if v := os.Getenv("ICE_BATCH_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid ICE_BATCH_WINDOW: %v", err)
+		}
+		hubOpts = append(hubOpts, hub.WithCandidateBatching(d))
+	}
+	if v := os.Getenv("CALL_RING_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid CALL_RING_TIMEOUT: %v", err)
+		}
+		hubOpts = append(hubOpts, hub.WithRingTimeout(d))
+	}
+	if v := os.Getenv("LOBBY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid LOBBY_TIMEOUT: %v", err)
+		}
+		hubOpts = append(hubOpts, hub.WithLobbyTimeout(d))
+	}
+	if v := os.Getenv("LOBBY_BY_DEFAULT"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid LOBBY_BY_DEFAULT: %v", err)
+		}
+		if on {
+			hubOpts = append(hubOpts, hub.WithLobbyByDefault())
+		}
+	}
+	cdrSink, err := loadCDRSink()
+	if err != nil {
+		log.Fatalf("Failed to open CDR sink: %v", err)
+	}
+	if cdrSink != nil {
+		exporter := cdr.NewExporter(cdrSink, 8192, 100, 5*time.Second)
+		defer func() { exporter.Shutdown(shutdownCtx) }()
+		hubOpts = append(hubOpts, hub.WithCDR(exporter))
+	}
+	if path := os.Getenv("AUDIT_LOG_FILE"); path != "" {
+		auditLog, err := audit.Open(path, 1024)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+		hubOpts = append(hubOpts, hub.WithAudit(auditLog))
+	}
+	if path := os.Getenv("WEBHOOK_CONFIG_FILE"); path != "" {
+		cfg, err := webhook.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load webhook config: %v", err)
+		}
+		var dlq webhook.DeadLetterQueue
+		if cfg.DeadLetterFile != "" {
+			fileDLQ, err := webhook.NewFileDLQ(cfg.DeadLetterFile)
+			if err != nil {
+				log.Fatalf("Failed to open webhook dead-letter file: %v", err)
+			}
+			defer fileDLQ.Close()
+			dlq = fileDLQ
+		}
+		dispatcher := webhook.NewDispatcher(*cfg, dlq)
+		defer func() { dispatcher.Shutdown(shutdownCtx) }()
+		hubOpts = append(hubOpts, hub.WithWebhooks(dispatcher))
+	}
+
+	// The SFU signals through the hub, which is built after it.
+	var signalHub *hub.SignalHub
+	var mediaServer *sfu.SFU
+	if threshold := getEnvInt("SFU_THRESHOLD", 0); threshold > 0 {
+		mediaServer, err = newSFU(func(tenant, peerID string, msg sfu.Message) {
+			signalHub.Deliver(tenant, peerID, hub.SignalMessage{Type: msg.Type, RoomID: msg.RoomID, PeerID: msg.PeerID, SDP: msg.SDP})
+		})
+		if err != nil {
+			log.Fatalf("Failed to start SFU: %v", err)
+		}
+		defer mediaServer.Close()
+		hubOpts = append(hubOpts, hub.WithSFU(mediaServer, threshold))
+		log.Printf("SFU enabled for rooms of %d or more peers", threshold)
+	}
+
+	if dir := os.Getenv("RECORDING_DIR"); dir != "" {
+		hubOpts = append(hubOpts, hub.WithRecorder(func(h *hub.SignalHub) hub.Recorder {
+			cfg := recording.Config{Dir: dir}
+			if ip := os.Getenv("RECORDING_PUBLIC_IP"); ip != "" {
+				cfg.PublicIPs = []string{ip}
+			}
+			recorder, err := recording.New(h, cfg)
+			if err != nil {
+				log.Fatalf("Failed to start recorder: %v", err)
+			}
+			return recorder
+		}))
+		log.Printf("Recording enabled, writing to %s", dir)
+	}
+
 	validator := auth.NewJWTValidator(secret)
-	signalHub := hub.NewSignalHub(store)
+	signalHub = hub.NewSignalHub(store, hubOpts...)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /ws/signal", handleWebSocket(signalHub, validator))
+	var sockets sync.WaitGroup
+	mux.HandleFunc("GET /ws/signal", handleWebSocket(signalHub, validator, &sockets))
 	mux.HandleFunc("GET /health/live", handleLiveness)
 	mux.HandleFunc("GET /health/ready", handleReadiness(redisStore))
+	mux.Handle("GET /metrics", registry.Handler())
+	if mediaServer != nil {
+		ingest := whip.New(signalHub, validator)
+		defer ingest.Close()
+		mux.Handle("/whip/", ingest)
+		mux.Handle("/whep/", ingest)
+	}
+	// HTTP fallback for clients behind proxies that strip WebSocket upgrades.
+	httpSignal := fallback.New(signalHub, validator, fallback.Config{AllowedOrigins: origins})
+	defer httpSignal.Close()
+	mux.Handle("/signal/", httpSignal)
+	if domain := os.Getenv("SIP_DOMAIN"); domain != "" {
+		mux.Handle("/sip", sipgw.New(signalHub, validator, sipgw.Config{
+			Domain:     domain,
+			RoomPrefix: os.Getenv("SIP_ROOM_PREFIX"),
+		}))
+		log.Printf("SIP over WebSocket enabled for domain %s", domain)
+	}
+	if grpcPort := os.Getenv("GRPC_PORT"); grpcPort != "" {
+		lis, err := net.Listen("tcp", ":"+grpcPort)
+		if err != nil {
+			log.Fatalf("gRPC listener failed: %v", err)
+		}
+		var operators []string
+		if v := os.Getenv("GRPC_OPERATORS"); v != "" {
+			operators = strings.Split(v, ",")
+		}
+		grpcServer := grpcapi.New(signalHub, validator, grpcapi.Config{Operators: operators}).NewGRPCServer()
+		defer grpcServer.Stop()
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalf("gRPC server failed: %v", err)
+			}
+		}()
+		log.Printf("gRPC signaling API listening on :%s", grpcPort)
+	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Optional embedded STUN responder, advertised via /ice-servers; it
+	// stops on the shutdown signal.
+	stunPort := os.Getenv("STUN_PORT")
+	if stunPort != "" {
+		go func() {
+			if err := stun.ListenAndServe(ctx, ":"+stunPort, stun.DefaultConfig(), registry); err != nil {
+				log.Fatalf("STUN responder failed: %v", err)
+			}
+		}()
+		log.Printf("STUN responder listening on udp :%s", stunPort)
+	}
+	mux.HandleFunc("GET /ice-servers", handleICEServers(stunPort, os.Getenv("STUN_ADVERTISE_HOST")))
+
+	// Cancelling the base context closes hijacked WebSocket connections,
+	// which Shutdown leaves alone.
+	baseCtx, closeSockets := context.WithCancel(context.Background())
+	defer closeSockets()
 	server := &http.Server{
 		Addr:         ":" + port,
 		Handler:      mux,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
 	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
 	log.Printf("Signaling service listening on :%s", port)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	select {
+	case err := <-serveErr:
 		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("Signaling service shutting down")
+	time.AfterFunc(shutdownTimeout, cancelShutdown)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown: %v", err)
 	}
+	closeSockets()
+	drained := make(chan struct{})
+	go func() {
+		sockets.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-shutdownCtx.Done():
+		log.Printf("WebSocket peers still connected at shutdown")
+	}
+	// The deferred closes now run in reverse order: gRPC, transports and
+	// the SFU stop, then the webhook dispatcher, audit log and CDR exporter
+	// flush what the departing peers produced, within what is left of
+	// shutdownTimeout.
 }
 
 func getEnv(key, fallback string) string {
@@ -72,8 +314,64 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func handleWebSocket(signalHub *hub.SignalHub, validator *auth.JWTValidator) http.HandlerFunc {
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return n
+}
+
+// newSFU configures the embedded SFU from SFU_PUBLIC_IP and
+// SFU_UDP_PORT_MIN/SFU_UDP_PORT_MAX.
+func newSFU(signal sfu.Signal) (*sfu.SFU, error) {
+	cfg := sfu.Config{
+		PortMin: uint16(getEnvInt("SFU_UDP_PORT_MIN", 0)),
+		PortMax: uint16(getEnvInt("SFU_UDP_PORT_MAX", 0)),
+	}
+	if ip := os.Getenv("SFU_PUBLIC_IP"); ip != "" {
+		cfg.PublicIPs = []string{ip}
+	}
+	return sfu.New(cfg, signal)
+}
+
+// loadCDRSink combines every configured CDR destination; nil when none is set.
+func loadCDRSink() (cdr.Sink, error) {
+	maxBytes := int64(getEnvInt("CDR_MAX_BYTES", defaultCDRMaxBytes))
+	var sinks cdr.MultiSink
+	if path := os.Getenv("CDR_JSONL_FILE"); path != "" {
+		sink, err := cdr.NewJSONLinesSink(path, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if path := os.Getenv("CDR_CSV_FILE"); path != "" {
+		sink, err := cdr.NewCSVSink(path, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if url := os.Getenv("CDR_WEBHOOK_URL"); url != "" {
+		sinks = append(sinks, cdr.NewHTTPSink(url, nil))
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return sinks, nil
+}
+
+// handleWebSocket serves /ws/signal. sockets counts open connections so
+// shutdown can wait for their peers to unregister.
+func handleWebSocket(signalHub *hub.SignalHub, validator *auth.JWTValidator, sockets *sync.WaitGroup) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		sockets.Add(1)
+		defer sockets.Done()
 		token := r.URL.Query().Get("token")
 		if token == "" {
 			http.Error(w, "token required", http.StatusUnauthorized)
@@ -85,16 +383,24 @@ func handleWebSocket(signalHub *hub.SignalHub, validator *auth.JWTValidator) htt
 			return
 		}
 
-		conn, err := upgrader.Upgrade(w, r, nil)
+		conn, err := upgrader.Upgrade(hub.CountBytes(w), r, nil)
 		if err != nil {
 			log.Printf("WebSocket upgrade failed: %v", err)
 			return
 		}
 		defer conn.Close()
 
-		peerID := claims.Subject + "-" + claims.SessionID
-		signalHub.Register(peerID, conn)
-		defer signalHub.Unregister(peerID)
+		peer, err := signalHub.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+			return
+		}
+		defer signalHub.Unregister(peer)
+		stopClose := context.AfterFunc(r.Context(), func() {
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(time.Second))
+			conn.Close()
+		})
+		defer stopClose()
 
 		for {
 			_, raw, err := conn.ReadMessage()
@@ -102,17 +408,41 @@ func handleWebSocket(signalHub *hub.SignalHub, validator *auth.JWTValidator) htt
 				break
 			}
 			var msg hub.SignalMessage
-			if err := json.Unmarshal(raw, &msg); err != nil {
-				sendError(conn, "invalid message")
+			if err := peer.Codec().Unmarshal(raw, &msg); err != nil {
+				sendError(conn, peer.Codec(), "invalid message")
 				continue
 			}
-			signalHub.HandleMessage(peerID, msg)
+			signalHub.HandleMessage(peer, msg)
 		}
 	}
 }
 
-func sendError(conn *websocket.Conn, message string) {
-	conn.WriteJSON(map[string]string{"type": "error", "message": message})
+func sendError(conn *websocket.Conn, codec wire.Codec, message string) {
+	if data, err := codec.Marshal(hub.SignalMessage{Type: "error", Message: message}); err == nil {
+		conn.WriteMessage(codec.FrameType(), data)
+	}
+}
+
+// handleICEServers advertises the embedded STUN responder, using the request's
+// host when no explicit advertise host is configured.
+func handleICEServers(stunPort, advertiseHost string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		servers := []map[string]interface{}{}
+		if stunPort != "" {
+			host := advertiseHost
+			if host == "" {
+				host = r.Host
+				if h, _, err := net.SplitHostPort(r.Host); err == nil {
+					host = h
+				}
+			}
+			servers = append(servers, map[string]interface{}{
+				"urls": []string{"stun:" + net.JoinHostPort(host, stunPort)},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"iceServers": servers})
+	}
 }
 
 func handleLiveness(w http.ResponseWriter, _ *http.Request) {
@@ -0,0 +1,94 @@
+// Command turn — TURN relay service for clients behind symmetric NAT.
+//
+// Accepts TURN REST credentials minted by the auth service, enforces per-user
+// allocation quotas, and exports relay bandwidth as Prometheus metrics.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/telemetry"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/turnserver"
+)
+
+const defaultPort = "3478"
+const defaultMetricsPort = "9478"
+const defaultRealm = "carrier-grade-webrtc"
+const defaultSecret = "carrier-grade-webrtc-secret-change-in-production"
+
+func main() {
+	port := getEnv("TURN_PORT", defaultPort)
+	metricsPort := getEnv("TURN_METRICS_PORT", defaultMetricsPort)
+	// Credentials are verified against TURN_SECRET, falling back to the JWT
+	// secret so a single AUTH_SECRET can drive both services.
+	secret := getEnv("TURN_SECRET", getEnv("AUTH_SECRET", defaultSecret))
+	relayIP := net.ParseIP(getEnv("TURN_PUBLIC_IP", "127.0.0.1"))
+	if relayIP == nil {
+		log.Fatal("TURN_PUBLIC_IP must be an IP address")
+	}
+
+	conn, err := net.ListenPacket("udp", ":"+port)
+	if err != nil {
+		log.Fatalf("TURN listen failed: %v", err)
+	}
+	registry := telemetry.NewRegistry()
+	server, err := turnserver.New(conn, turnserver.Config{
+		Realm:                 getEnv("TURN_REALM", defaultRealm),
+		Secret:                secret,
+		RelayIP:               relayIP,
+		RelayBind:             getEnv("TURN_RELAY_BIND", "0.0.0.0"),
+		RelayMinPort:          uint16(getEnvInt("TURN_RELAY_MIN_PORT", 49152)),
+		RelayMaxPort:          uint16(getEnvInt("TURN_RELAY_MAX_PORT", 65535)),
+		MaxAllocationsPerUser: getEnvInt("TURN_MAX_ALLOCATIONS_PER_USER", 10),
+	}, registry)
+	if err != nil {
+		log.Fatalf("TURN server failed: %v", err)
+	}
+	defer server.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry.Handler())
+	mux.HandleFunc("GET /health/live", handleLiveness)
+	mux.HandleFunc("GET /health/ready", handleLiveness)
+	httpServer := &http.Server{
+		Addr:         ":" + metricsPort,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	log.Printf("TURN relay listening on udp :%s (relay %s), metrics on :%s", port, relayIP, metricsPort)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return n
+}
+
+func handleLiveness(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
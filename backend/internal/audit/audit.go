@@ -0,0 +1,134 @@
+// Package audit — Audit trail of moderation actions.
+//
+// The signaling hub records one Entry per moderator action (kick, ban, mute
+// request, room lock, ending a room). Entries are written off the
+// signaling path, in order, as JSON lines; a full buffer drops entries
+// rather than delay relay.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is one audited action.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Tenant string    `json:"tenant,omitempty"`
+	RoomID string    `json:"roomId"`
+	Action string    `json:"action"`
+	// Actor and ActorPeer are the subject and peer that acted.
+	Actor     string `json:"actor"`
+	ActorPeer string `json:"actorPeer"`
+	// Target and TargetPeer are the subject and peer acted on, if any.
+	Target     string `json:"target,omitempty"`
+	TargetPeer string `json:"targetPeer,omitempty"`
+	// Media is the track kind of a mute request.
+	Media  string `json:"media,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Recorder is the write side used by the hub.
+type Recorder interface {
+	Record(entry Entry)
+}
+
+// Nop discards entries; used when no audit log is configured.
+type Nop struct{}
+
+// Record implements Recorder.
+func (Nop) Record(Entry) {}
+
+// Log appends entries to a file as JSON lines.
+type Log struct {
+	file    *os.File
+	buffer  chan Entry
+	stopCh  chan struct{}
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// Open starts a log appending to path, creating it if needed.
+func Open(path string, bufferSize int) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{
+		file:   f,
+		buffer: make(chan Entry, bufferSize),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go l.writeLoop()
+	return l, nil
+}
+
+// Record enqueues entry without blocking, stamping it with the current time
+// if unset. Drops if the buffer is full.
+func (l *Log) Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	select {
+	case l.buffer <- entry:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of entries discarded because the buffer was
+// full.
+func (l *Log) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close writes buffered entries and closes the file.
+func (l *Log) Close() error {
+	close(l.stopCh)
+	<-l.done
+	return l.file.Close()
+}
+
+func (l *Log) writeLoop() {
+	defer close(l.done)
+	w := bufio.NewWriter(l.file)
+	enc := json.NewEncoder(w)
+	write := func(e Entry) {
+		if err := enc.Encode(e); err != nil {
+			log.Printf("audit: encode entry: %v", err)
+		}
+	}
+	flush := func() {
+		if err := w.Flush(); err != nil {
+			log.Printf("audit: write: %v", err)
+		}
+	}
+	for {
+		select {
+		case e := <-l.buffer:
+			write(e)
+			// Flush once the burst is written, so entries reach the file
+			// promptly without a write per entry.
+			if len(l.buffer) == 0 {
+				flush()
+			}
+		case <-l.stopCh:
+			for {
+				select {
+				case e := <-l.buffer:
+					write(e)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
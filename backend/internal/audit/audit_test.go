@@ -0,0 +1,48 @@
+// Package audit — Log tests.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for _, action := range []string{"kick", "ban"} {
+		l, err := Open(path, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Record(Entry{RoomID: "r1", Action: action, Actor: "host", ActorPeer: "host-1", Target: "bob", TargetPeer: "bob-1"})
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 2 || got[0].Action != "kick" || got[1].Action != "ban" {
+		t.Fatalf("got %+v", got)
+	}
+	if got[0].Time.IsZero() || got[0].TargetPeer != "bob-1" {
+		t.Fatalf("entry not recorded in full: %+v", got[0])
+	}
+}
@@ -0,0 +1,58 @@
+// Package auth — API clients allowed to mint signaling tokens.
+//
+// Token requests authenticate with an API key, and the key, not the request,
+// decides the tenant and role claims of the tokens it mints.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// APIClient is what an API key may mint tokens for.
+type APIClient struct {
+	// Tenant is the tenant claim of every token; empty for the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+	// Roles grants role claims ("host", "moderator", "operator") to user IDs.
+	Roles map[string]string `json:"roles,omitempty"`
+}
+
+// APIClients maps API keys to their clients.
+type APIClients map[string]APIClient
+
+// LoadAPIClients reads a JSON object of API keys to clients from disk.
+func LoadAPIClients(path string) (APIClients, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var clients APIClients
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return nil, fmt.Errorf("api clients %s: %w", path, err)
+	}
+	for key, c := range clients {
+		if key == "" {
+			return nil, fmt.Errorf("api clients %s: empty key", path)
+		}
+		if !ValidTenant(c.Tenant) {
+			return nil, fmt.Errorf("api clients %s: tenant %q: %w", path, c.Tenant, ErrInvalidTenant)
+		}
+	}
+	return clients, nil
+}
+
+// Lookup returns the client for key, comparing every key in constant time.
+func (c APIClients) Lookup(key string) (APIClient, bool) {
+	var found APIClient
+	ok := false
+	for k, client := range c {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found, ok = client, true
+		}
+	}
+	return found, ok && key != ""
+}
@@ -0,0 +1,35 @@
+// Package auth — Tests for API client lookup.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAPIClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.json")
+	os.WriteFile(path, []byte(`{"k1": {"tenant": "acme", "roles": {"alice": "host"}}, "k2": {}}`), 0o600)
+	clients, err := LoadAPIClients(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := clients.Lookup("k1"); !ok || c.Tenant != "acme" || c.Roles["alice"] != "host" {
+		t.Errorf("k1: %+v %v", c, ok)
+	}
+	if c, ok := clients.Lookup("k2"); !ok || c.Tenant != "" {
+		t.Errorf("k2: %+v %v", c, ok)
+	}
+	for _, key := range []string{"", "k3", "k"} {
+		if _, ok := clients.Lookup(key); ok {
+			t.Errorf("unknown key %q accepted", key)
+		}
+	}
+	os.WriteFile(path, []byte(`{"": {"tenant": "acme"}}`), 0o600)
+	if _, err := LoadAPIClients(path); err == nil {
+		t.Error("expected an error for an empty key")
+	}
+}
@@ -7,12 +7,22 @@ package auth
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/golang-jwt/jwt/v5"
 )
 
+// ErrInvalidTenant is returned for tenant names containing a separator that
+// services use in tenant-scoped keys.
+var ErrInvalidTenant = errors.New("tenant must not contain '/' or ':'")
+
+// ValidTenant reports whether tenant may be used as a tenant claim.
+func ValidTenant(tenant string) bool {
+	return !strings.ContainsAny(tenant, "/:")
+}
+
 // JWTValidator implements contracts.TokenValidator.
 type JWTValidator struct {
 	secretKey []byte
@@ -44,9 +54,14 @@ func (j *JWTValidator) Validate(ctx context.Context, tokenString string) (*contr
 	exp, _ := claims["exp"].(float64)
 	sub, _ := claims["sub"].(string)
 	sid, _ := claims["session_id"].(string)
+	tenant, _ := claims["tenant"].(string)
+	role, _ := claims["role"].(string)
 	if sub == "" {
 		return nil, errors.New("missing subject")
 	}
+	if !ValidTenant(tenant) {
+		return nil, ErrInvalidTenant
+	}
 	if time.Now().Unix() > int64(exp) {
 		return nil, errors.New("token expired")
 	}
@@ -54,5 +69,7 @@ func (j *JWTValidator) Validate(ctx context.Context, tokenString string) (*contr
 		Subject:   sub,
 		SessionID: sid,
 		ExpiresAt: int64(exp),
+		Tenant:    tenant,
+		Role:      role,
 	}, nil
 }
@@ -0,0 +1,32 @@
+// Package auth — Tests for JWT validation.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateRejectsSeparatorsInTenant(t *testing.T) {
+	v := NewJWTValidator("secret")
+	sign := func(tenant string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": "alice", "tenant": tenant, "exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte("secret"))
+		return token
+	}
+	if claims, err := v.Validate(context.Background(), sign("acme")); err != nil || claims.Tenant != "acme" {
+		t.Fatalf("acme: %+v, %v", claims, err)
+	}
+	for _, tenant := range []string{"a/b", "a:call:b"} {
+		if _, err := v.Validate(context.Background(), sign(tenant)); !errors.Is(err, ErrInvalidTenant) {
+			t.Errorf("tenant %q: got %v", tenant, err)
+		}
+	}
+}
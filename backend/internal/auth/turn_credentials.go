@@ -0,0 +1,141 @@
+// Package auth — TURN REST API time-limited credentials.
+//
+// Implements the coturn "use-auth-secret" scheme: username is
+// "<expiry-unix>:<user>", password is base64(HMAC-SHA1(secret, username)).
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ICEServer mirrors the browser RTCIceServer dictionary.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// TURNCredentials is a time-limited username/password pair.
+type TURNCredentials struct {
+	Username  string
+	Password  string
+	ExpiresAt time.Time
+}
+
+// TURNCredentialIssuer mints and verifies TURN REST credentials.
+type TURNCredentialIssuer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTURNCredentialIssuer creates an issuer sharing secret with the TURN server.
+func NewTURNCredentialIssuer(secret string, ttl time.Duration) *TURNCredentialIssuer {
+	return &TURNCredentialIssuer{secret: []byte(secret), ttl: ttl}
+}
+
+// Issue returns credentials for user valid for the configured TTL, but never
+// beyond notAfter (typically the caller's JWT expiry).
+func (i *TURNCredentialIssuer) Issue(user string, notAfter time.Time) TURNCredentials {
+	expires := time.Now().Add(i.ttl)
+	if !notAfter.IsZero() && notAfter.Before(expires) {
+		expires = notAfter
+	}
+	username := strconv.FormatInt(expires.Unix(), 10) + ":" + user
+	return TURNCredentials{
+		Username:  username,
+		Password:  i.Password(username),
+		ExpiresAt: time.Unix(expires.Unix(), 0),
+	}
+}
+
+// Password derives the long-term credential for a REST username.
+func (i *TURNCredentialIssuer) Password(username string) string {
+	mac := hmac.New(sha1.New, i.secret)
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a REST username's expiry and returns the embedded user.
+func (i *TURNCredentialIssuer) Verify(username string) (string, error) {
+	ts, user, found := strings.Cut(username, ":")
+	if !found || user == "" {
+		return "", errors.New("malformed turn username")
+	}
+	expiry, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", errors.New("malformed turn username")
+	}
+	if time.Now().Unix() > expiry {
+		return "", errors.New("turn credentials expired")
+	}
+	return user, nil
+}
+
+// RegionServers lists the STUN and TURN URLs for one region.
+type RegionServers struct {
+	STUN []string `json:"stun,omitempty"`
+	TURN []string `json:"turn,omitempty"`
+}
+
+// ICEServerDirectory maps regions (optionally per tenant) to ICE servers.
+type ICEServerDirectory struct {
+	DefaultRegion string                              `json:"defaultRegion"`
+	Regions       map[string]RegionServers            `json:"regions"`
+	Tenants       map[string]map[string]RegionServers `json:"tenants,omitempty"`
+}
+
+// LoadICEServerDirectory reads a JSON directory from disk.
+func LoadICEServerDirectory(path string) (*ICEServerDirectory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var dir ICEServerDirectory
+	if err := json.Unmarshal(data, &dir); err != nil {
+		return nil, fmt.Errorf("ice servers %s: %w", path, err)
+	}
+	return &dir, nil
+}
+
+// Lookup returns the servers for tenant and region, falling back to the
+// global region table and then the default region.
+func (d *ICEServerDirectory) Lookup(tenant, region string) RegionServers {
+	if region == "" {
+		region = d.DefaultRegion
+	}
+	if regions, ok := d.Tenants[tenant]; ok && tenant != "" {
+		if servers, ok := regions[region]; ok {
+			return servers
+		}
+		if servers, ok := regions[d.DefaultRegion]; ok {
+			return servers
+		}
+	}
+	if servers, ok := d.Regions[region]; ok {
+		return servers
+	}
+	return d.Regions[d.DefaultRegion]
+}
+
+// BuildICEServers builds the RTCIceServer list, attaching credentials to TURN URLs.
+func BuildICEServers(servers RegionServers, creds *TURNCredentials) []ICEServer {
+	list := make([]ICEServer, 0, 2)
+	if len(servers.STUN) > 0 {
+		list = append(list, ICEServer{URLs: servers.STUN})
+	}
+	if len(servers.TURN) > 0 && creds != nil {
+		list = append(list, ICEServer{URLs: servers.TURN, Username: creds.Username, Credential: creds.Password})
+	}
+	return list
+}
@@ -0,0 +1,73 @@
+// Package auth — Tests for TURN REST credential issuance.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTURNPasswordMatchesCoturnScheme(t *testing.T) {
+	issuer := NewTURNCredentialIssuer("north", time.Hour)
+	if got := issuer.Password("1700000000:alice"); got != "Cd/49soE35ICqcJF/bCTn8Z4OyE=" {
+		t.Errorf("unexpected password %s", got)
+	}
+}
+
+func TestTURNCredentialsCappedByJWTExpiry(t *testing.T) {
+	issuer := NewTURNCredentialIssuer("north", 24*time.Hour)
+	jwtExpiry := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	creds := issuer.Issue("acme/alice", jwtExpiry)
+	if !creds.ExpiresAt.Equal(jwtExpiry) {
+		t.Errorf("expected expiry %v, got %v", jwtExpiry, creds.ExpiresAt)
+	}
+	if !strings.HasSuffix(creds.Username, ":acme/alice") {
+		t.Errorf("unexpected username %s", creds.Username)
+	}
+	user, err := issuer.Verify(creds.Username)
+	if err != nil || user != "acme/alice" {
+		t.Errorf("verify: user=%q err=%v", user, err)
+	}
+}
+
+func TestTURNVerifyRejectsExpired(t *testing.T) {
+	issuer := NewTURNCredentialIssuer("north", time.Hour)
+	if _, err := issuer.Verify("1000:alice"); err == nil {
+		t.Error("expected expired username to be rejected")
+	}
+	if _, err := issuer.Verify("alice"); err == nil {
+		t.Error("expected malformed username to be rejected")
+	}
+}
+
+func TestICEServerDirectoryLookup(t *testing.T) {
+	dir := &ICEServerDirectory{
+		DefaultRegion: "eu",
+		Regions: map[string]RegionServers{
+			"eu": {STUN: []string{"stun:eu.example.net"}, TURN: []string{"turn:eu.example.net"}},
+			"us": {TURN: []string{"turn:us.example.net"}},
+		},
+		Tenants: map[string]map[string]RegionServers{
+			"acme": {"eu": {TURN: []string{"turns:acme.example.net"}}},
+		},
+	}
+	if got := dir.Lookup("", "us").TURN[0]; got != "turn:us.example.net" {
+		t.Errorf("expected us region, got %s", got)
+	}
+	if got := dir.Lookup("", "apac").TURN[0]; got != "turn:eu.example.net" {
+		t.Errorf("expected default region fallback, got %s", got)
+	}
+	if got := dir.Lookup("acme", "").TURN[0]; got != "turns:acme.example.net" {
+		t.Errorf("expected tenant override, got %s", got)
+	}
+	servers := BuildICEServers(dir.Lookup("", "eu"), &TURNCredentials{Username: "u", Password: "p"})
+	if len(servers) != 2 || servers[1].Username != "u" || servers[1].Credential != "p" {
+		t.Errorf("unexpected ice servers %+v", servers)
+	}
+	if servers := BuildICEServers(dir.Lookup("", "eu"), nil); len(servers) != 1 {
+		t.Errorf("expected TURN to be omitted without credentials, got %+v", servers)
+	}
+}
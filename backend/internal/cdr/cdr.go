@@ -0,0 +1,207 @@
+// Package cdr — Call Detail Records for billing and audit.
+//
+// The signaling hub emits one Record per call or room session. Records are
+// buffered and written to pluggable sinks off the signaling path, so a slow
+// disk or webhook never delays message relay.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package cdr
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Record kinds.
+const (
+	KindCall = "call"
+	KindRoom = "room"
+)
+
+// Participant is one leg of a call or one stay in a room. A peer that leaves
+// and rejoins the same room session appears twice.
+type Participant struct {
+	PeerID     string    `json:"peerId"`
+	Subject    string    `json:"subject,omitempty"`
+	Role       string    `json:"role"`
+	JoinedAt   time.Time `json:"joinedAt"`
+	LeftAt     time.Time `json:"leftAt"`
+	DurationMs int64     `json:"durationMs"`
+	Cause      string    `json:"cause,omitempty"`
+}
+
+// Record is a single CDR. For calls DurationMs is the answered (billable)
+// time; for rooms it is the length of the session.
+type Record struct {
+	ID           string        `json:"id"`
+	Kind         string        `json:"kind"`
+	Tenant       string        `json:"tenant,omitempty"`
+	RoomID       string        `json:"roomId,omitempty"`
+	CallID       string        `json:"callId,omitempty"`
+	StartedAt    time.Time     `json:"startedAt"`
+	AnsweredAt   *time.Time    `json:"answeredAt,omitempty"`
+	EndedAt      time.Time     `json:"endedAt"`
+	DurationMs   int64         `json:"durationMs"`
+	Cause        string        `json:"cause"`
+	Participants []Participant `json:"participants"`
+}
+
+// Millis returns the whole milliseconds between two instants.
+func Millis(from, to time.Time) int64 {
+	if from.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from).Milliseconds()
+}
+
+// Sink persists batches of records. Sinks are called from a single goroutine.
+type Sink interface {
+	Write(records []Record) error
+	Close() error
+}
+
+// Recorder is the write side used by the hub.
+type Recorder interface {
+	Emit(record Record)
+}
+
+// Nop discards records; used when no sink is configured.
+type Nop struct{}
+
+// Emit implements Recorder.
+func (Nop) Emit(Record) {}
+
+// Exporter buffers records and writes them to a sink asynchronously.
+type Exporter struct {
+	sink      Sink
+	buffer    chan Record
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	batchSize int
+	interval  time.Duration
+	dropped   atomic.Uint64
+	failed    atomic.Uint64
+}
+
+// NewExporter starts an exporter that never blocks Emit.
+func NewExporter(sink Sink, bufferSize, batchSize int, flushInterval time.Duration) *Exporter {
+	e := &Exporter{
+		sink:      sink,
+		buffer:    make(chan Record, bufferSize),
+		stopCh:    make(chan struct{}),
+		batchSize: batchSize,
+		interval:  flushInterval,
+	}
+	e.wg.Add(1)
+	go e.flushLoop()
+	return e
+}
+
+// Emit enqueues a record without blocking. Drops if the buffer is full.
+func (e *Exporter) Emit(record Record) {
+	select {
+	case e.buffer <- record:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of records discarded because the buffer was full.
+func (e *Exporter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Failed returns the number of records the sink failed to write.
+func (e *Exporter) Failed() uint64 {
+	return e.failed.Load()
+}
+
+// Shutdown drains buffered records and closes the sink.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	close(e.stopCh)
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return e.sink.Close()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Exporter) flushLoop() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	batch := make([]Record, 0, e.batchSize)
+
+	// Writes stay on this goroutine so file sinks see records in order.
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.sink.Write(batch); err != nil {
+			e.failed.Add(uint64(len(batch)))
+			log.Printf("cdr: write %d records: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-e.stopCh:
+			for {
+				select {
+				case r := <-e.buffer:
+					batch = append(batch, r)
+					if len(batch) >= e.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case r := <-e.buffer:
+			batch = append(batch, r)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// MultiSink fans a batch out to several sinks, writing to all of them even
+// when one fails.
+type MultiSink []Sink
+
+// Write implements Sink.
+func (m MultiSink) Write(records []Record) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(records); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close implements Sink.
+func (m MultiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
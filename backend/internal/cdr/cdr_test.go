@@ -0,0 +1,216 @@
+// Package cdr — Tests for the exporter and sinks.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package cdr
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func sampleRecord(id string) Record {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := start.Add(90 * time.Second)
+	return Record{
+		ID: id, Kind: KindRoom, Tenant: "acme", RoomID: "lobby",
+		StartedAt: start, EndedAt: end, DurationMs: Millis(start, end), Cause: "empty",
+		Participants: []Participant{
+			{PeerID: "a-1", Subject: "alice", Role: "member", JoinedAt: start, LeftAt: end, DurationMs: 90000, Cause: "left"},
+			{PeerID: "b-1", Subject: "bob", Role: "member", JoinedAt: start.Add(30 * time.Second), LeftAt: end, DurationMs: 60000, Cause: "disconnected"},
+		},
+	}
+}
+
+func TestJSONLinesSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cdr.jsonl")
+	line, _ := json.Marshal(sampleRecord("r1"))
+	sink, err := NewJSONLinesSink(path, int64(len(line)+1)*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"r1", "r2", "r3"} {
+		if err := sink.Write([]Record{sampleRecord(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Close()
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("expected current + one rotated file, got %d", len(entries))
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var got []Record
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if len(got) != 1 || got[0].ID != "r3" || len(got[0].Participants) != 2 {
+		t.Errorf("unexpected current file contents %+v", got)
+	}
+}
+
+func TestCSVSinkWritesRowPerParticipant(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cdr.csv")
+	sink, err := NewCSVSink(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unanswered := Record{ID: "c1", Kind: KindCall, CallID: "c1", Cause: "timeout"}
+	if err := sink.Write([]Record{sampleRecord("r1"), unanswered}); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	// Reopening must not repeat the header.
+	sink, _ = NewCSVSink(path, 0)
+	sink.Close()
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected header + 3 rows, got %d", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(CSVColumns, ",") {
+		t.Errorf("unexpected header %v", rows[0])
+	}
+	if rows[2][11] != "bob" || rows[2][15] != "60000" || rows[2][8] != "90000" {
+		t.Errorf("unexpected participant row %v", rows[2])
+	}
+	if rows[3][0] != "c1" || rows[3][10] != "" {
+		t.Errorf("unexpected empty-participant row %v", rows[3])
+	}
+}
+
+func TestHTTPSinkPostsBatch(t *testing.T) {
+	var got []Record
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	if err := NewHTTPSink(srv.URL, nil).Write([]Record{sampleRecord("r1"), sampleRecord("r2")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].ID != "r2" {
+		t.Errorf("unexpected posted batch %+v", got)
+	}
+
+	var calls atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	sink := NewHTTPSink(failing.URL, nil)
+	sink.backoff = time.Millisecond
+	if err := sink.Write([]Record{sampleRecord("r1")}); err == nil {
+		t.Error("expected non-2xx response to fail")
+	}
+	if n := calls.Load(); n != httpSinkAttempts {
+		t.Errorf("got %d attempts, want %d", n, httpSinkAttempts)
+	}
+}
+
+func TestHTTPSinkRetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+	sink := NewHTTPSink(srv.URL, nil)
+	sink.backoff = time.Millisecond
+	if err := sink.Write([]Record{sampleRecord("r1")}); err != nil || calls.Load() != 3 {
+		t.Fatalf("got %v after %d attempts, want success on the third", err, calls.Load())
+	}
+
+	// Client errors are permanent.
+	calls.Store(0)
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+	sink = NewHTTPSink(rejecting.URL, nil)
+	sink.backoff = time.Millisecond
+	if err := sink.Write([]Record{sampleRecord("r1")}); err == nil || calls.Load() != 1 {
+		t.Errorf("got %v after %d attempts, want one failed attempt", err, calls.Load())
+	}
+}
+
+// blockingSink holds every write until released.
+type blockingSink struct {
+	release chan struct{}
+	mu      sync.Mutex
+	written []Record
+}
+
+func (s *blockingSink) Write(records []Record) error {
+	<-s.release
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = append(s.written, records...)
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestExporterNeverBlocksAndDrainsOnShutdown(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	exp := NewExporter(sink, 2, 1, time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 50; i++ {
+			exp.Emit(sampleRecord("r"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Emit blocked on a stalled sink")
+	}
+	if exp.Dropped() == 0 {
+		t.Error("expected records to be dropped while the sink is stalled")
+	}
+
+	close(sink.release)
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := uint64(len(sink.written)) + exp.Dropped(); got != 50 {
+		t.Errorf("written + dropped = %d, want 50", got)
+	}
+}
@@ -0,0 +1,258 @@
+// Package cdr — File, CSV and HTTP sinks.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package cdr
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// rotatingFile appends to path and renames it aside once it would exceed
+// maxBytes. A maxBytes of 0 disables rotation.
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	file     *os.File
+	size     int64
+	header   []byte
+}
+
+func openRotating(path string, maxBytes int64, header []byte) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxBytes: maxBytes, header: header}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	if r.size == 0 && len(r.header) > 0 {
+		return r.append(r.header)
+	}
+	return nil
+}
+
+func (r *rotatingFile) write(p []byte) error {
+	if r.maxBytes > 0 && r.size > int64(len(r.header)) && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	return r.append(p)
+}
+
+func (r *rotatingFile) append(p []byte) error {
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	rotated := r.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(r.path, rotated); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
+
+// JSONLinesSink writes one JSON record per line.
+type JSONLinesSink struct {
+	out *rotatingFile
+}
+
+// NewJSONLinesSink opens (or appends to) a JSON-lines file.
+func NewJSONLinesSink(path string, maxBytes int64) (*JSONLinesSink, error) {
+	out, err := openRotating(path, maxBytes, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesSink{out: out}, nil
+}
+
+// Write implements Sink.
+func (s *JSONLinesSink) Write(records []Record) error {
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if err := s.out.write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *JSONLinesSink) Close() error {
+	return s.out.Close()
+}
+
+// CSVColumns is the header row written by CSVSink. Each participant is one
+// row; records without participants produce a single row with those columns
+// empty.
+var CSVColumns = []string{
+	"record_id", "kind", "tenant", "room_id", "call_id",
+	"started_at", "answered_at", "ended_at", "duration_ms", "cause",
+	"peer_id", "subject", "role", "joined_at", "left_at", "participant_duration_ms", "participant_cause",
+}
+
+// CSVSink writes records as CSV, one row per participant.
+type CSVSink struct {
+	out *rotatingFile
+}
+
+// NewCSVSink opens (or appends to) a CSV file; new files start with CSVColumns.
+func NewCSVSink(path string, maxBytes int64) (*CSVSink, error) {
+	var header bytes.Buffer
+	w := csv.NewWriter(&header)
+	w.Write(CSVColumns)
+	w.Flush()
+	out, err := openRotating(path, maxBytes, header.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &CSVSink{out: out}, nil
+}
+
+// Write implements Sink.
+func (s *CSVSink) Write(records []Record) error {
+	for _, r := range records {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		for _, row := range csvRows(r) {
+			w.Write(row)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		// A record's rows are never split across rotated files.
+		if err := s.out.write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *CSVSink) Close() error {
+	return s.out.Close()
+}
+
+func csvRows(r Record) [][]string {
+	answered := ""
+	if r.AnsweredAt != nil {
+		answered = formatTime(*r.AnsweredAt)
+	}
+	base := []string{
+		r.ID, r.Kind, r.Tenant, r.RoomID, r.CallID,
+		formatTime(r.StartedAt), answered, formatTime(r.EndedAt), strconv.FormatInt(r.DurationMs, 10), r.Cause,
+	}
+	if len(r.Participants) == 0 {
+		return [][]string{append(base, "", "", "", "", "", "", "")}
+	}
+	rows := make([][]string, 0, len(r.Participants))
+	for _, p := range r.Participants {
+		row := append(append([]string(nil), base...),
+			p.PeerID, p.Subject, p.Role, formatTime(p.JoinedAt), formatTime(p.LeftAt),
+			strconv.FormatInt(p.DurationMs, 10), p.Cause)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// HTTP sink retry defaults.
+const (
+	httpSinkAttempts = 4
+	httpSinkBackoff  = 500 * time.Millisecond
+)
+
+// HTTPSink POSTs each batch as a JSON array, retrying network errors, 408,
+// 429 and 5xx responses with exponential backoff. A retried batch may be
+// delivered twice; receivers deduplicate by record ID.
+type HTTPSink struct {
+	url      string
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+// NewHTTPSink creates a sink for url; a nil client uses a 10s timeout.
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &HTTPSink{url: url, client: client, attempts: httpSinkAttempts, backoff: httpSinkBackoff}
+}
+
+// Write implements Sink.
+func (s *HTTPSink) Write(records []Record) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(body)
+		if !retry || attempt >= s.attempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post performs one delivery and reports whether a failure is retryable.
+func (s *HTTPSink) post(body []byte) (bool, error) {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("cdr: webhook returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("cdr: webhook returned %s", resp.Status)
+	}
+}
+
+// Close implements Sink.
+func (s *HTTPSink) Close() error {
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package grpcapi — gRPC signaling and room control for backend integrations.
+//
+// Serves the signaling.v1.Signaling service (proto/signaling/v1) against the
+// hub: Signal streams a peer's messages in both directions, and the control
+// RPCs create and close rooms, kick peers and stream room events. Calls are
+// authenticated like /ws/signal, with the JWT as bearer metadata, and act
+// within the token's tenant. Control RPCs are refused unless the token
+// carries the operator role or its subject is a configured operator.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	pb "github.com/faisalhanif/carrier-grade-webrtc/pkg/signalingpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// OperatorRole is the role claim that grants the control RPCs.
+const OperatorRole = "operator"
+
+// Config configures a Server.
+type Config struct {
+	// Operators are subjects allowed to call the control RPCs (CreateRoom,
+	// CloseRoom, KickPeer, WatchRooms) besides tokens with OperatorRole.
+	Operators []string
+}
+
+// Server implements the Signaling service.
+type Server struct {
+	pb.UnimplementedSignalingServer
+
+	hub       *hub.SignalHub
+	validator contracts.TokenValidator
+	operators map[string]bool
+}
+
+// New creates a server for h that authenticates calls with validator.
+func New(h *hub.SignalHub, validator contracts.TokenValidator, cfg Config) *Server {
+	s := &Server{hub: h, validator: validator, operators: make(map[string]bool, len(cfg.Operators))}
+	for _, subject := range cfg.Operators {
+		s.operators[subject] = true
+	}
+	return s
+}
+
+// NewGRPCServer returns a gRPC server with s registered and its
+// authentication installed.
+func (s *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.authorizeUnary),
+		grpc.ChainStreamInterceptor(s.authorizeStream),
+	)
+	srv := grpc.NewServer(opts...)
+	pb.RegisterSignalingServer(srv, s)
+	return srv
+}
+
+type claimsKey struct{}
+
+// claimsFrom returns the claims authorize stored in ctx.
+func claimsFrom(ctx context.Context) *contracts.Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*contracts.Claims)
+	return claims
+}
+
+// authorize validates the bearer token in ctx's metadata and, for control
+// RPCs, that it belongs to an operator.
+func (s *Server) authorize(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 {
+		token, _ = strings.CutPrefix(values[0], "Bearer ")
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "token required")
+	}
+	claims, err := s.validator.Validate(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if method != pb.Signaling_Signal_FullMethodName && claims.Role != OperatorRole && !s.operators[claims.Subject] {
+		return nil, status.Error(codes.PermissionDenied, "not an operator")
+	}
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
+
+func (s *Server) authorizeUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authorizeStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorizedStream carries the authorized context to stream handlers.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context { return s.ctx }
+
+// CreateRoom opens an empty room.
+func (s *Server) CreateRoom(ctx context.Context, req *pb.CreateRoomRequest) (*pb.CreateRoomResponse, error) {
+	if req.RoomId == "" {
+		return nil, status.Error(codes.InvalidArgument, "room_id required")
+	}
+	if err := s.hub.CreateRoom(claimsFrom(ctx).Tenant, req.RoomId); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CreateRoomResponse{}, nil
+}
+
+// CloseRoom removes a room's members.
+func (s *Server) CloseRoom(ctx context.Context, req *pb.CloseRoomRequest) (*pb.CloseRoomResponse, error) {
+	n, err := s.hub.CloseRoom(claimsFrom(ctx).Tenant, req.RoomId, req.Reason)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.CloseRoomResponse{Peers: int32(n)}, nil
+}
+
+// KickPeer disconnects a peer.
+func (s *Server) KickPeer(ctx context.Context, req *pb.KickPeerRequest) (*pb.KickPeerResponse, error) {
+	if err := s.hub.Kick(claimsFrom(ctx).Tenant, req.PeerId, req.Reason); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.KickPeerResponse{}, nil
+}
+
+// WatchRooms streams room events until the call ends.
+func (s *Server) WatchRooms(req *pb.WatchRoomsRequest, stream pb.Signaling_WatchRoomsServer) error {
+	events, stop := s.hub.WatchRooms(claimsFrom(stream.Context()).Tenant, req.RoomId)
+	defer stop()
+	// Headers tell the caller the watch is in place before any event.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	for {
+		select {
+		case e := <-events:
+			err := stream.Send(&pb.RoomEvent{
+				Type:      e.Type,
+				Timestamp: timestamppb.New(e.Timestamp),
+				RoomId:    e.RoomID,
+				PeerId:    e.PeerID,
+				Subject:   e.Subject,
+				Reason:    e.Reason,
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// toStatus maps hub errors to gRPC status codes.
+func toStatus(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, hub.ErrNoSuchRoom), errors.Is(err, hub.ErrNoSuchPeer):
+		code = codes.NotFound
+	case errors.Is(err, hub.ErrRoomExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, hub.ErrRoomQuota), errors.Is(err, hub.ErrPeerQuota):
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,306 @@
+// Package grpcapi — gRPC peers and room control against a live hub
+// alongside WebSocket peers.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	pb "github.com/faisalhanif/carrier-grade-webrtc/pkg/signalingpb"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testSecret = "grpc-test-secret"
+
+func token(user string) string {
+	return roleToken(user, "")
+}
+
+func roleToken(user, role string) string {
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user, "session_id": "1", "role": role, "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testSecret))
+	return signed
+}
+
+// newServer serves /ws/signal like cmd/signaling and the gRPC API over an
+// in-memory listener, returning the WebSocket base URL and a client.
+func newServer(t *testing.T, cfg Config) (string, pb.SignalingClient) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	h := hub.NewSignalHub(nil)
+	validator := auth.NewJWTValidator(testSecret)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := New(h, validator, cfg).NewGRPCServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	upgrader := websocket.Upgrader{}
+	ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.Validate(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			var msg hub.SignalMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			h.HandleMessage(peer, msg)
+		}
+	}))
+	t.Cleanup(ws.Close)
+	return ws.URL, pb.NewSignalingClient(conn)
+}
+
+// as returns a context authenticated as user.
+func as(t *testing.T, user string) context.Context {
+	return asRole(t, user, "")
+}
+
+func asRole(t *testing.T, user, role string) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+roleToken(user, role))
+}
+
+type wsPeer struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialWS(t *testing.T, base, user string) *wsPeer {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(base, "http")+"/?token="+token(user), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsPeer{t: t, conn: conn}
+}
+
+func (p *wsPeer) send(msg hub.SignalMessage) {
+	p.t.Helper()
+	if err := p.conn.WriteJSON(msg); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func (p *wsPeer) expect(msgType string) hub.SignalMessage {
+	p.t.Helper()
+	p.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg hub.SignalMessage
+	if err := p.conn.ReadJSON(&msg); err != nil {
+		p.t.Fatalf("waiting for %s: %v", msgType, err)
+	}
+	if msg.Type != msgType {
+		p.t.Fatalf("expected %s, got %+v", msgType, msg)
+	}
+	return msg
+}
+
+func expect(t *testing.T, stream pb.Signaling_SignalClient, msgType string) *pb.SignalMessage {
+	t.Helper()
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("waiting for %s: %v", msgType, err)
+	}
+	if msg.Type != msgType {
+		t.Fatalf("expected %s, got %v", msgType, msg)
+	}
+	return msg
+}
+
+func TestSignalInteropsWithWebSocket(t *testing.T) {
+	base, client := newServer(t, Config{})
+	alice := dialWS(t, base, "alice")
+	bob, err := client.Signal(as(t, "bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice.send(hub.SignalMessage{Type: "join", RoomID: "r1", Metadata: &hub.PeerMetadata{DisplayName: "Alice"}})
+	alice.expect("joined")
+	bob.Send(&pb.SignalMessage{Type: "join", RoomId: "r1", Metadata: &pb.PeerMetadata{Device: "server", App: map[string]string{"k": "v"}}})
+	joined := expect(t, bob, "joined")
+	if joined.PeerId != "bob-1" || len(joined.Peers) != 1 || joined.Peers[0] != "alice-1" {
+		t.Fatalf("bob joined as %v", joined)
+	}
+	if len(joined.Members) != 1 || joined.Members[0].GetMetadata().GetDisplayName() != "Alice" {
+		t.Fatalf("bob joined with members %v", joined.Members)
+	}
+	if pj := alice.expect("peer_joined"); pj.Metadata == nil || pj.Metadata.Device != "server" || pj.Metadata.App["k"] != "v" {
+		t.Fatalf("alice got %+v", pj)
+	}
+
+	alice.send(hub.SignalMessage{Type: "ice-candidate", PeerID: "bob-1", Candidate: []byte(`{"candidate":"candidate:1 1 udp 1 10.0.0.1 9 typ host","sdpMid":"0"}`)})
+	if c := expect(t, bob, "ice-candidate"); c.PeerId != "alice-1" || !strings.Contains(c.Candidate, "10.0.0.1") {
+		t.Fatalf("bob got %v", c)
+	}
+	bob.Send(&pb.SignalMessage{Type: "offer", PeerId: "alice-1", Sdp: "v=0 bob"})
+	if offer := alice.expect("offer"); offer.PeerID != "bob-1" || offer.SDP != "v=0 bob" {
+		t.Fatalf("alice got %+v", offer)
+	}
+	bob.Send(&pb.SignalMessage{Type: "ice-candidate", PeerId: "alice-1", Candidate: "not json", Id: "c1"})
+	if e := expect(t, bob, "error"); e.Id != "c1" {
+		t.Fatalf("bob got %v", e)
+	}
+}
+
+func TestRoomControl(t *testing.T) {
+	base, client := newServer(t, Config{})
+	ops := asRole(t, "ops", OperatorRole)
+	watch, err := client.WatchRooms(ops, &pb.WatchRoomsRequest{RoomId: "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watch.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.CreateRoom(ops, &pb.CreateRoomRequest{RoomId: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateRoom(ops, &pb.CreateRoomRequest{RoomId: "r1"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("second create: %v", err)
+	}
+	alice := dialWS(t, base, "alice")
+	alice.send(hub.SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("joined")
+	bob, err := client.Signal(as(t, "bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob.Send(&pb.SignalMessage{Type: "join", RoomId: "r1"})
+	expect(t, bob, "joined")
+	alice.expect("peer_joined")
+
+	if _, err := client.KickPeer(ops, &pb.KickPeerRequest{PeerId: "bob-1", Reason: "abusive"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Recv(); status.Code(err) != codes.Aborted || status.Convert(err).Message() != "abusive" {
+		t.Fatalf("kicked stream ended with %v", err)
+	}
+	if code := bob.Trailer().Get(CloseCodeTrailer); len(code) != 1 || code[0] != "4002" {
+		t.Fatalf("close code trailer %v", code)
+	}
+	if _, err := client.KickPeer(ops, &pb.KickPeerRequest{PeerId: "bob-1"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("second kick: %v", err)
+	}
+
+	resp, err := client.CloseRoom(ops, &pb.CloseRoomRequest{RoomId: "r1", Reason: "shift over"})
+	if err != nil || resp.Peers != 1 {
+		t.Fatalf("close: %v, %v", resp, err)
+	}
+	if closed := alice.expect("room-closed"); closed.RoomID != "r1" || closed.Reason != "shift over" {
+		t.Fatalf("alice got %+v", closed)
+	}
+	// alice is still connected and may join again.
+	alice.send(hub.SignalMessage{Type: "join", RoomID: "r2"})
+	alice.expect("joined")
+
+	want := []string{
+		"room.created:", "peer.joined:alice-1", "peer.joined:bob-1", "peer.left:bob-1:kicked",
+		"peer.left:alice-1:closed", "room.emptied:alice-1:closed",
+	}
+	for _, w := range want {
+		e, err := watch.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := e.Type + ":" + e.PeerId
+		if e.Reason != "" {
+			got += ":" + e.Reason
+		}
+		if got != w || e.RoomId != "r1" || e.Timestamp == nil {
+			t.Fatalf("got event %s (%v), want %s", got, e, w)
+		}
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	_, client := newServer(t, Config{Operators: []string{"ops"}})
+	if _, err := client.CreateRoom(context.Background(), &pb.CreateRoomRequest{RoomId: "r1"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("create without token: %v", err)
+	}
+	if _, err := client.CreateRoom(as(t, "alice"), &pb.CreateRoomRequest{RoomId: "r1"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("create as non-operator: %v", err)
+	}
+	if _, err := client.CreateRoom(as(t, "ops"), &pb.CreateRoomRequest{RoomId: "r1"}); err != nil {
+		t.Fatalf("create as operator: %v", err)
+	}
+	if _, err := client.CloseRoom(asRole(t, "bot", OperatorRole), &pb.CloseRoomRequest{RoomId: "r1"}); err != nil {
+		t.Fatalf("close with operator role: %v", err)
+	}
+	// Anyone may signal.
+	alice, err := client.Signal(as(t, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.Send(&pb.SignalMessage{Type: "join", RoomId: "r1"})
+	expect(t, alice, "joined")
+}
+
+func TestControlDeniedWithoutOperators(t *testing.T) {
+	_, client := newServer(t, Config{})
+	alice := as(t, "alice")
+	if _, err := client.CreateRoom(alice, &pb.CreateRoomRequest{RoomId: "r1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("create: %v", err)
+	}
+	if _, err := client.CloseRoom(alice, &pb.CloseRoomRequest{RoomId: "r1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("close: %v", err)
+	}
+	if _, err := client.KickPeer(alice, &pb.KickPeerRequest{PeerId: "bob-1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("kick: %v", err)
+	}
+	watch, err := client.WatchRooms(alice, &pb.WatchRoomsRequest{})
+	if err == nil {
+		_, err = watch.Recv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("watch: %v", err)
+	}
+	if _, err := client.CreateRoom(asRole(t, "alice", "host"), &pb.CreateRoomRequest{RoomId: "r1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("create as host: %v", err)
+	}
+}
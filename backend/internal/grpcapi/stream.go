@@ -0,0 +1,240 @@
+// Package grpcapi — The Signal stream: a hub peer over a gRPC call.
+//
+// The call's transport hands the hub's messages to the handler goroutine,
+// which alone sends on the stream, so nothing is sent after the handler
+// returns. The hub ending the peer ends the call with ABORTED and the
+// close code in the signal-close-code trailer.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package grpcapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	pb "github.com/faisalhanif/carrier-grade-webrtc/pkg/signalingpb"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// CloseCodeTrailer is the trailer carrying the close code of a Signal call
+// the hub ended.
+const CloseCodeTrailer = "signal-close-code"
+
+var (
+	errCallEnded        = errors.New("grpcapi: call ended")
+	errInvalidCandidate = errors.New("candidate must be JSON")
+)
+
+// Signal connects the caller as a hub peer for the duration of the call.
+func (s *Server) Signal(stream pb.Signaling_SignalServer) error {
+	claims := claimsFrom(stream.Context())
+	t := newStreamTransport()
+	peer, err := s.hub.RegisterTransport(claims.Subject+"-"+claims.SessionID, claims, t)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer s.hub.Unregister(peer)
+	defer close(t.returned)
+
+	received := make(chan error, 1)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				received <- err
+				return
+			}
+			msg, err := fromProto(in)
+			if err != nil {
+				s.hub.Deliver(peer.Tenant, peer.ID, hub.SignalMessage{Type: "error", ID: in.Id, Message: err.Error()})
+				continue
+			}
+			s.hub.HandleMessage(peer, msg)
+		}
+	}()
+	for {
+		select {
+		case data := <-t.out:
+			var msg hub.SignalMessage
+			if json.Unmarshal(data, &msg) != nil {
+				continue
+			}
+			if err := stream.Send(toProto(msg)); err != nil {
+				return err
+			}
+		case <-t.ended:
+			code, reason := t.closed()
+			stream.SetTrailer(metadata.Pairs(CloseCodeTrailer, strconv.Itoa(code)))
+			return status.Error(codes.Aborted, reason)
+		case err := <-received:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// streamTransport is a Signal call's hub.Transport. Messages are encoded as
+// JSON for the hand-off and converted to SignalMessage by the handler.
+type streamTransport struct {
+	out      chan []byte
+	returned chan struct{}
+	ended    chan struct{}
+
+	once   sync.Once
+	code   int
+	reason string
+}
+
+func newStreamTransport() *streamTransport {
+	return &streamTransport{
+		out:      make(chan []byte),
+		returned: make(chan struct{}),
+		ended:    make(chan struct{}),
+	}
+}
+
+func (t *streamTransport) Codec() wire.Codec { return wire.JSON }
+
+func (t *streamTransport) Write(data []byte) (int, error) {
+	select {
+	case t.out <- data:
+		return 0, nil
+	case <-t.ended:
+	case <-t.returned:
+	}
+	return 0, errCallEnded
+}
+
+// Ping is a no-op: gRPC keepalives cover idle calls.
+func (t *streamTransport) Ping() error { return nil }
+
+func (t *streamTransport) CloseWith(code int, reason string) error {
+	t.once.Do(func() {
+		t.code, t.reason = code, reason
+		close(t.ended)
+	})
+	return nil
+}
+
+func (t *streamTransport) Close() error {
+	return t.CloseWith(websocket.CloseGoingAway, "connection closed")
+}
+
+// closed returns the close code and reason once ended is closed.
+func (t *streamTransport) closed() (int, string) {
+	<-t.ended
+	return t.code, t.reason
+}
+
+func toProto(m hub.SignalMessage) *pb.SignalMessage {
+	out := &pb.SignalMessage{
+		Type:        m.Type,
+		RoomId:      m.RoomID,
+		PeerId:      m.PeerID,
+		Peers:       m.Peers,
+		Sdp:         m.SDP,
+		Candidate:   string(m.Candidate),
+		Message:     m.Message,
+		CallId:      m.CallID,
+		To:          m.To,
+		From:        m.From,
+		Reason:      m.Reason,
+		Mode:        m.Mode,
+		Layer:       m.Layer,
+		Role:        m.Role,
+		RecordingId: m.RecordingID,
+		State:       m.State,
+		Id:          m.ID,
+		Version:     int32(m.Version),
+		Types:       m.Types,
+		Features:    m.Features,
+		Position:    int32(m.Position),
+		Timeout:     int32(m.Timeout),
+		Metadata:    metadataToProto(m.Metadata),
+		Users:       m.Users,
+		Presence:    m.Presence,
+	}
+	for _, member := range m.Members {
+		out.Members = append(out.Members, &pb.Member{PeerId: member.PeerID, Metadata: metadataToProto(member.Metadata)})
+	}
+	for _, c := range m.Candidates {
+		out.Candidates = append(out.Candidates, string(c))
+	}
+	if m.Policy != nil {
+		if policy, err := json.Marshal(m.Policy); err == nil {
+			out.Policy = string(policy)
+		}
+	}
+	return out
+}
+
+// fromProto converts a client message; policy reports only flow to
+// clients and are ignored.
+func fromProto(m *pb.SignalMessage) (hub.SignalMessage, error) {
+	out := hub.SignalMessage{
+		Type:        m.Type,
+		RoomID:      m.RoomId,
+		PeerID:      m.PeerId,
+		Peers:       m.Peers,
+		SDP:         m.Sdp,
+		Message:     m.Message,
+		CallID:      m.CallId,
+		To:          m.To,
+		From:        m.From,
+		Reason:      m.Reason,
+		Mode:        m.Mode,
+		Layer:       m.Layer,
+		Role:        m.Role,
+		RecordingID: m.RecordingId,
+		State:       m.State,
+		ID:          m.Id,
+		Version:     int(m.Version),
+		Types:       m.Types,
+		Features:    m.Features,
+		Position:    int(m.Position),
+		Timeout:     int(m.Timeout),
+		Metadata:    metadataFromProto(m.Metadata),
+		Users:       m.Users,
+		Presence:    m.Presence,
+	}
+	for _, member := range m.Members {
+		out.Members = append(out.Members, hub.Member{PeerID: member.PeerId, Metadata: metadataFromProto(member.Metadata)})
+	}
+	if m.Candidate != "" {
+		if !json.Valid([]byte(m.Candidate)) {
+			return out, errInvalidCandidate
+		}
+		out.Candidate = json.RawMessage(m.Candidate)
+	}
+	for _, c := range m.Candidates {
+		if !json.Valid([]byte(c)) {
+			return out, errInvalidCandidate
+		}
+		out.Candidates = append(out.Candidates, json.RawMessage(c))
+	}
+	return out, nil
+}
+
+func metadataToProto(m *hub.PeerMetadata) *pb.PeerMetadata {
+	if m == nil {
+		return nil
+	}
+	return &pb.PeerMetadata{DisplayName: m.DisplayName, AvatarUrl: m.AvatarURL, Device: m.Device, App: m.App}
+}
+
+func metadataFromProto(m *pb.PeerMetadata) *hub.PeerMetadata {
+	if m == nil {
+		return nil
+	}
+	return &hub.PeerMetadata{DisplayName: m.DisplayName, AvatarURL: m.AvatarUrl, Device: m.Device, App: m.App}
+}
@@ -0,0 +1,391 @@
+// Package loadgen — Synthetic signaling load for capacity testing.
+//
+// Opens many WebSocket peers against /ws/signal, seats them in rooms and
+// exchanges synthetic offer/answer/ICE traffic. Every relayed message carries
+// its send time (in the SDP origin line or the candidate foundation), so relay
+// latency is measured end to end through the hub without shared bookkeeping.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Room patterns.
+const (
+	// PatternRooms seats peers in consecutive rooms of RoomSize.
+	PatternRooms = "rooms"
+	// PatternSingle puts every peer in one room.
+	PatternSingle = "single"
+	// PatternRandom assigns each peer one of Peers/RoomSize rooms at random.
+	PatternRandom = "random"
+)
+
+// Config describes one load run.
+type Config struct {
+	// URL is the signaling WebSocket endpoint, e.g. ws://localhost:8080/ws/signal.
+	URL    string
+	Tokens TokenSource
+
+	Peers      int
+	RoomSize   int
+	Pattern    string
+	RoomPrefix string
+
+	// ConnectRate limits new connections per second; 0 dials as fast as possible.
+	ConnectRate float64
+	// Duration is the length of the traffic phase after every peer has joined.
+	Duration time.Duration
+	// ExchangeInterval is how often each peer sends an offer to a room mate.
+	ExchangeInterval time.Duration
+	// Candidates is the number of ICE candidates trickled after each offer or answer.
+	Candidates int
+	// Timeout bounds the handshake and join, and is the grace period for
+	// in-flight messages before undelivered ones are counted as dropped.
+	Timeout time.Duration
+}
+
+func (c *Config) withDefaults() {
+	if c.RoomSize < 1 {
+		c.RoomSize = 2
+	}
+	if c.Pattern == "" {
+		c.Pattern = PatternRooms
+	}
+	if c.RoomPrefix == "" {
+		c.RoomPrefix = "loadgen"
+	}
+	if c.Duration <= 0 {
+		c.Duration = 30 * time.Second
+	}
+	if c.ExchangeInterval <= 0 {
+		c.ExchangeInterval = time.Second
+	}
+	if c.Candidates < 0 {
+		c.Candidates = 0
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+}
+
+// Run connects cfg.Peers peers, drives traffic for cfg.Duration and reports.
+// Cancelling ctx ends the run early; the report covers what happened so far.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	cfg.withDefaults()
+	if cfg.URL == "" || cfg.Tokens == nil || cfg.Peers < 1 {
+		return nil, errors.New("loadgen: URL, Tokens and Peers are required")
+	}
+	switch cfg.Pattern {
+	case PatternRooms, PatternSingle, PatternRandom:
+	default:
+		return nil, fmt.Errorf("loadgen: unknown pattern %q", cfg.Pattern)
+	}
+
+	st := &stats{}
+	started := time.Now()
+	var active atomic.Bool
+	active.Store(true)
+
+	clients := connectAll(ctx, cfg, st, &active)
+	defer func() {
+		for _, c := range clients {
+			c.conn.Close()
+		}
+	}()
+
+	traffic, stop := context.WithTimeout(ctx, cfg.Duration)
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *client) {
+			defer wg.Done()
+			c.drive(traffic, cfg)
+		}(c)
+	}
+	wg.Wait()
+	stop()
+
+	// Stop answering and give in-flight messages time to land.
+	active.Store(false)
+	select {
+	case <-time.After(cfg.Timeout):
+	case <-ctx.Done():
+	}
+	return st.report(cfg.Peers, time.Since(started)), nil
+}
+
+// connectAll dials and joins every peer, honouring ConnectRate, and returns
+// the peers that joined.
+func connectAll(ctx context.Context, cfg Config, st *stats, active *atomic.Bool) []*client {
+	var (
+		mu      sync.Mutex
+		clients []*client
+		wg      sync.WaitGroup
+	)
+	var tick <-chan time.Time
+	if cfg.ConnectRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.ConnectRate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	rooms := (cfg.Peers + cfg.RoomSize - 1) / cfg.RoomSize
+	for i := 0; i < cfg.Peers; i++ {
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		room := cfg.RoomPrefix + "-" + strconv.Itoa(roomFor(cfg.Pattern, i, cfg.RoomSize, rooms))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := connect(ctx, cfg, st, active, "loadgen-"+strconv.Itoa(i), room)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			clients = append(clients, c)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return clients
+}
+
+func roomFor(pattern string, i, size, rooms int) int {
+	switch pattern {
+	case PatternSingle:
+		return 0
+	case PatternRandom:
+		return rand.Intn(rooms)
+	default:
+		return i / size
+	}
+}
+
+// client is one synthetic peer. Writes are serialised by writeMu; the read
+// loop owns everything else.
+type client struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	st      *stats
+	active  *atomic.Bool
+	cands   int
+
+	mu    sync.Mutex
+	mates []string
+
+	joined chan struct{}
+}
+
+func connect(ctx context.Context, cfg Config, st *stats, active *atomic.Bool, userID, room string) (*client, error) {
+	st.attempted.Add(1)
+	token, err := cfg.Tokens(ctx, userID)
+	if err != nil {
+		st.connectFailure(err)
+		return nil, err
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		st.connectFailure(err)
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	dialer := websocket.Dialer{HandshakeTimeout: cfg.Timeout}
+	conn, _, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		st.connectFailure(err)
+		return nil, err
+	}
+	st.connected.Add(1)
+
+	c := &client{conn: conn, st: st, active: active, cands: cfg.Candidates, joined: make(chan struct{})}
+	go c.readLoop()
+	if err := c.write(message{Type: "join", RoomID: room}); err != nil {
+		conn.Close()
+		st.connectFailure(err)
+		return nil, err
+	}
+	select {
+	case <-c.joined:
+		st.joined.Add(1)
+		return c, nil
+	case <-time.After(cfg.Timeout):
+	case <-ctx.Done():
+	}
+	conn.Close()
+	err = errors.New("loadgen: join timed out")
+	st.connectFailure(err)
+	return nil, err
+}
+
+// message is the subset of the signaling envelope loadgen speaks.
+type message struct {
+	Type      string          `json:"type"`
+	RoomID    string          `json:"roomId,omitempty"`
+	PeerID    string          `json:"peerId,omitempty"`
+	Peers     []string        `json:"peers,omitempty"`
+	SDP       string          `json:"sdp,omitempty"`
+	Candidate json.RawMessage `json:"candidate,omitempty"`
+}
+
+func (c *client) write(msg message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(msg)
+}
+
+// relay sends an SDP message followed by the configured candidates to peerID.
+func (c *client) relay(kind, peerID string) {
+	if c.write(message{Type: kind, PeerID: peerID, SDP: syntheticSDP(time.Now())}) != nil {
+		return
+	}
+	c.st.sent.Add(1)
+	for i := 0; i < c.cands; i++ {
+		if c.write(message{Type: "ice-candidate", PeerID: peerID, Candidate: syntheticCandidate(time.Now(), i)}) != nil {
+			return
+		}
+		c.st.sent.Add(1)
+	}
+}
+
+// drive sends an offer to a random room mate every ExchangeInterval until
+// ctx is done. The first offer is jittered so peers do not fire in lockstep.
+func (c *client) drive(ctx context.Context, cfg Config) {
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(cfg.ExchangeInterval))))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		if mate := c.randomMate(); mate != "" {
+			c.relay("offer", mate)
+		}
+		timer.Reset(cfg.ExchangeInterval)
+	}
+}
+
+func (c *client) randomMate() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.mates) == 0 {
+		return ""
+	}
+	return c.mates[rand.Intn(len(c.mates))]
+}
+
+func (c *client) readLoop() {
+	joined := false
+	for {
+		var msg message
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case "joined":
+			c.mu.Lock()
+			c.mates = append(c.mates, msg.Peers...)
+			c.mu.Unlock()
+			if !joined {
+				joined = true
+				close(c.joined)
+			}
+		case "peer_joined":
+			c.mu.Lock()
+			c.mates = append(c.mates, msg.PeerID)
+			c.mu.Unlock()
+		case "offer":
+			c.st.receive(sdpSentAt(msg.SDP))
+			if c.active.Load() {
+				go c.relay("answer", msg.PeerID)
+			}
+		case "answer":
+			c.st.receive(sdpSentAt(msg.SDP))
+		case "ice-candidate":
+			c.st.receive(candidateSentAt(msg.Candidate))
+		case "error":
+			c.st.errors.Add(1)
+		}
+	}
+}
+
+// syntheticSDP is a minimal audio offer whose origin session-version is the
+// send time in Unix nanoseconds.
+func syntheticSDP(at time.Time) string {
+	return "v=0\r\n" +
+		"o=loadgen 1 " + strconv.FormatInt(at.UnixNano(), 10) + " IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:0\r\n" +
+		"a=rtpmap:111 opus/48000/2\r\n"
+}
+
+func sdpSentAt(sdp string) time.Time {
+	i := strings.Index(sdp, "o=loadgen ")
+	if i < 0 {
+		return time.Time{}
+	}
+	fields := strings.Fields(sdp[i:])
+	if len(fields) < 3 {
+		return time.Time{}
+	}
+	return unixNano(fields[2])
+}
+
+// syntheticCandidate is a TEST-NET host candidate whose foundation is the
+// send time in Unix nanoseconds.
+func syntheticCandidate(at time.Time, n int) json.RawMessage {
+	raw, _ := json.Marshal(map[string]interface{}{
+		"candidate":     fmt.Sprintf("candidate:%d 1 udp 2122260223 192.0.2.%d %d typ host", at.UnixNano(), n%254+1, 50000+n),
+		"sdpMid":        "0",
+		"sdpMLineIndex": 0,
+	})
+	return raw
+}
+
+func candidateSentAt(raw json.RawMessage) time.Time {
+	var init struct {
+		Candidate string `json:"candidate"`
+	}
+	if json.Unmarshal(raw, &init) != nil {
+		return time.Time{}
+	}
+	fields := strings.Fields(strings.TrimPrefix(init.Candidate, "candidate:"))
+	if len(fields) == 0 {
+		return time.Time{}
+	}
+	return unixNano(fields[0])
+}
+
+func unixNano(s string) time.Time {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
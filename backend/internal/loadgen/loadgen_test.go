@@ -0,0 +1,150 @@
+// Package loadgen — Tests against an in-process signaling hub.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/gorilla/websocket"
+)
+
+const testSecret = "loadgen-test-secret"
+
+// newSignalingServer mirrors cmd/signaling's /ws/signal handler.
+func newSignalingServer(t *testing.T) string {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	h := hub.NewSignalHub(nil)
+	validator := auth.NewJWTValidator(testSecret)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.Validate(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			var msg hub.SignalMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			h.HandleMessage(peer, msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/signal"
+}
+
+func TestRunExchangesTrafficWithoutDrops(t *testing.T) {
+	report, err := Run(context.Background(), Config{
+		URL:              newSignalingServer(t),
+		Tokens:           LocalTokens(testSecret, "acme", time.Hour),
+		Peers:            24,
+		RoomSize:         4,
+		ConnectRate:      500,
+		Duration:         400 * time.Millisecond,
+		ExchangeInterval: 50 * time.Millisecond,
+		Candidates:       2,
+		Timeout:          time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Joined != 24 || report.ConnectSuccessRate != 1 {
+		t.Errorf("expected every peer to join: %+v", report)
+	}
+	if report.Sent == 0 || report.Dropped != 0 || report.Errors != 0 {
+		t.Errorf("unexpected relay counts: %+v", report)
+	}
+	if report.Latency.Samples != int(report.Received) || report.Latency.P99 <= 0 {
+		t.Errorf("missing latency samples: %+v", report.Latency)
+	}
+}
+
+func TestRunCountsRejectedConnections(t *testing.T) {
+	report, err := Run(context.Background(), Config{
+		URL:      newSignalingServer(t),
+		Tokens:   LocalTokens("wrong-secret", "", time.Hour),
+		Peers:    3,
+		Pattern:  PatternSingle,
+		Duration: 10 * time.Millisecond,
+		Timeout:  100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ConnectFailed != 3 || report.Joined != 0 || report.FirstConnectError == "" {
+		t.Errorf("expected all connections to fail: %+v", report)
+	}
+}
+
+func TestAuthServiceTokens(t *testing.T) {
+	mint := LocalTokens(testSecret, "", time.Hour)
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ UserID string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/auth/token" || req.UserID != "loadgen-0" || r.Header.Get("X-API-Key") != "acme-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		token, _ := mint(r.Context(), req.UserID)
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+	}))
+	defer auth.Close()
+
+	token, err := AuthServiceTokens(auth.URL, "acme-key", nil)(context.Background(), "loadgen-0")
+	if err != nil || token == "" {
+		t.Fatalf("token %q, err %v", token, err)
+	}
+	if _, err := AuthServiceTokens(auth.URL, "other", nil)(context.Background(), "loadgen-0"); err == nil {
+		t.Error("expected an error for a rejected request")
+	}
+}
+
+func TestSentAtRoundTrips(t *testing.T) {
+	at := time.Unix(0, 1_700_000_000_123_456_789)
+	if got := sdpSentAt(syntheticSDP(at)); !got.Equal(at) {
+		t.Errorf("sdp: got %v", got)
+	}
+	if got := candidateSentAt(syntheticCandidate(at, 3)); !got.Equal(at) {
+		t.Errorf("candidate: got %v", got)
+	}
+	if !sdpSentAt("v=0\r\n").IsZero() {
+		t.Error("foreign sdp should carry no send time")
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	l := percentiles(samples)
+	if l.Samples != 100 || l.P50 != 50 || l.P90 != 90 || l.P99 != 99 || l.Max != 100 {
+		t.Errorf("unexpected percentiles %+v", l)
+	}
+}
@@ -0,0 +1,145 @@
+// Package loadgen — Run statistics and the final report.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stats is shared by every client of a run.
+type stats struct {
+	attempted     atomic.Int64
+	connected     atomic.Int64
+	connectFailed atomic.Int64
+	joined        atomic.Int64
+	sent          atomic.Int64
+	received      atomic.Int64
+	errors        atomic.Int64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	firstErr  error
+}
+
+// connectFailure counts a failed connection and keeps the first cause.
+func (s *stats) connectFailure(err error) {
+	s.connectFailed.Add(1)
+	s.mu.Lock()
+	if s.firstErr == nil {
+		s.firstErr = err
+	}
+	s.mu.Unlock()
+}
+
+// receive counts a relayed message; sentAt is zero when the message did not
+// carry a parseable send time (e.g. a policy rewrote it).
+func (s *stats) receive(sentAt time.Time) {
+	s.received.Add(1)
+	if sentAt.IsZero() {
+		return
+	}
+	d := time.Since(sentAt)
+	s.mu.Lock()
+	s.latencies = append(s.latencies, d)
+	s.mu.Unlock()
+}
+
+// Report summarises a load run.
+type Report struct {
+	Peers              int     `json:"peers"`
+	Attempted          int64   `json:"attempted"`
+	Connected          int64   `json:"connected"`
+	ConnectFailed      int64   `json:"connectFailed"`
+	Joined             int64   `json:"joined"`
+	ConnectSuccessRate float64 `json:"connectSuccessRate"`
+	FirstConnectError  string  `json:"firstConnectError,omitempty"`
+
+	Sent     int64   `json:"sent"`
+	Received int64   `json:"received"`
+	Dropped  int64   `json:"dropped"`
+	DropRate float64 `json:"dropRate"`
+	Errors   int64   `json:"errors"`
+
+	Latency Latency `json:"relayLatency"`
+	Elapsed float64 `json:"elapsedSeconds"`
+}
+
+// Latency holds relay latency percentiles in milliseconds.
+type Latency struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50Ms"`
+	P90     float64 `json:"p90Ms"`
+	P99     float64 `json:"p99Ms"`
+	Max     float64 `json:"maxMs"`
+}
+
+func (s *stats) report(peers int, elapsed time.Duration) *Report {
+	r := &Report{
+		Peers:         peers,
+		Attempted:     s.attempted.Load(),
+		Connected:     s.connected.Load(),
+		ConnectFailed: s.connectFailed.Load(),
+		Joined:        s.joined.Load(),
+		Sent:          s.sent.Load(),
+		Received:      s.received.Load(),
+		Errors:        s.errors.Load(),
+		Elapsed:       elapsed.Seconds(),
+	}
+	if r.Attempted > 0 {
+		r.ConnectSuccessRate = float64(r.Joined) / float64(r.Attempted)
+	}
+	if r.Sent > r.Received {
+		r.Dropped = r.Sent - r.Received
+	}
+	if r.Sent > 0 {
+		r.DropRate = float64(r.Dropped) / float64(r.Sent)
+	}
+	s.mu.Lock()
+	r.Latency = percentiles(s.latencies)
+	if s.firstErr != nil {
+		r.FirstConnectError = s.firstErr.Error()
+	}
+	s.mu.Unlock()
+	return r
+}
+
+// percentiles sorts samples in place.
+func percentiles(samples []time.Duration) Latency {
+	l := Latency{Samples: len(samples)}
+	if len(samples) == 0 {
+		return l
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	at := func(p float64) float64 {
+		i := int(p * float64(len(samples)-1))
+		return ms(samples[i])
+	}
+	l.P50, l.P90, l.P99 = at(0.50), at(0.90), at(0.99)
+	l.Max = ms(samples[len(samples)-1])
+	return l
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteText prints the report in a human-readable form.
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "connections  %d/%d joined (%.2f%%), %d connected, %d failed\n",
+		r.Joined, r.Attempted, r.ConnectSuccessRate*100, r.Connected, r.ConnectFailed)
+	if r.FirstConnectError != "" {
+		fmt.Fprintf(w, "first error  %s\n", r.FirstConnectError)
+	}
+	fmt.Fprintf(w, "relays       %d sent, %d received, %d dropped (%.2f%%), %d errors\n",
+		r.Sent, r.Received, r.Dropped, r.DropRate*100, r.Errors)
+	fmt.Fprintf(w, "latency ms   p50 %.2f  p90 %.2f  p99 %.2f  max %.2f  (%d samples)\n",
+		r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max, r.Latency.Samples)
+	fmt.Fprintf(w, "elapsed      %.1fs\n", r.Elapsed)
+}
@@ -0,0 +1,76 @@
+// Package loadgen — Token sources for synthetic peers.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenSource mints a signaling token for a synthetic user.
+type TokenSource func(ctx context.Context, userID string) (string, error)
+
+// LocalTokens signs tokens with the shared AUTH_SECRET, in the same shape as
+// the auth service, so no auth round trip is needed per peer.
+func LocalTokens(secret, tenant string, ttl time.Duration) TokenSource {
+	var seq atomic.Int64
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return func(_ context.Context, userID string) (string, error) {
+		now := time.Now()
+		claims := jwt.MapClaims{
+			"sub":        userID,
+			"session_id": run + "-" + strconv.FormatInt(seq.Add(1), 36),
+			"exp":        now.Add(ttl).Unix(),
+			"iat":        now.Unix(),
+		}
+		if tenant != "" {
+			claims["tenant"] = tenant
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	}
+}
+
+// AuthServiceTokens requests each token from the auth service's
+// POST /auth/token endpoint at authURL (e.g. http://localhost:8081),
+// authenticating with apiKey, which decides the tokens' tenant.
+func AuthServiceTokens(authURL, apiKey string, client *http.Client) TokenSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context, userID string) (string, error) {
+		body, _ := json.Marshal(map[string]string{"userId": userID})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, authURL+"/auth/token", bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("auth token: status %d", resp.StatusCode)
+		}
+		var out struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return "", err
+		}
+		return out.Token, nil
+	}
+}
@@ -0,0 +1,396 @@
+// Package recording — Server-side room recording.
+//
+// A Recorder joins a room through the signaling hub as a hidden participant
+// and offers every member a receive-only connection. Each received track is
+// written under <Dir>/<tenant>/<room>/<recording ID>/: Opus to OGG, VP8 and
+// VP9 to IVF, alongside a metadata.json describing the recording.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package recording
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/pion/ice/v4"
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+)
+
+// Errors returned by Start and Stop.
+var (
+	ErrAlreadyRecording = errors.New("recording: room is already being recorded")
+	ErrNotRecording     = errors.New("recording: room is not being recorded")
+)
+
+// Subject is the JWT subject of recorder participants.
+const Subject = "recorder"
+
+// Config tunes where and how rooms are recorded.
+type Config struct {
+	// Dir is the root directory for recordings.
+	Dir        string
+	ICEServers []webrtc.ICEServer
+	// PublicIPs are advertised as host candidates (1:1 NAT).
+	PublicIPs []string
+	// Loopback restricts ICE to loopback candidates, for tests on one host.
+	Loopback bool
+}
+
+// Recorder records rooms on one hub; it implements hub.Recorder.
+type Recorder struct {
+	hub *hub.SignalHub
+	cfg Config
+	api *webrtc.API
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// New creates a recorder joining rooms through h.
+func New(h *hub.SignalHub, cfg Config) (*Recorder, error) {
+	m := &webrtc.MediaEngine{}
+	for _, codec := range []struct {
+		params webrtc.RTPCodecParameters
+		kind   webrtc.RTPCodecType
+	}{
+		{webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}, PayloadType: 111}, webrtc.RTPCodecTypeAudio},
+		{webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}, PayloadType: 96}, webrtc.RTPCodecTypeVideo},
+		{webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9, ClockRate: 90000, SDPFmtpLine: "profile-id=0"}, PayloadType: 98}, webrtc.RTPCodecTypeVideo},
+	} {
+		if err := m.RegisterCodec(codec.params, codec.kind); err != nil {
+			return nil, err
+		}
+	}
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, registry); err != nil {
+		return nil, err
+	}
+	s := webrtc.SettingEngine{}
+	if len(cfg.PublicIPs) > 0 {
+		s.SetNAT1To1IPs(cfg.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+	if cfg.Loopback {
+		s.SetIncludeLoopbackCandidate(true)
+		s.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+		s.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+		s.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	}
+	return &Recorder{
+		hub:      h,
+		cfg:      cfg,
+		api:      webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(registry), webrtc.WithSettingEngine(s)),
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+func sessionKey(tenant, roomID string) string { return tenant + "/" + roomID }
+
+// Start joins roomID and records it until Stop.
+func (r *Recorder) Start(tenant, roomID, startedBy string) (string, error) {
+	key := sessionKey(tenant, roomID)
+	r.mu.Lock()
+	if r.sessions[key] != nil {
+		r.mu.Unlock()
+		return "", ErrAlreadyRecording
+	}
+	s := &session{
+		rec:   r,
+		conns: make(map[string]*remote),
+		done:  make(chan struct{}),
+		meta: Metadata{
+			ID:        newID(),
+			Tenant:    tenant,
+			RoomID:    roomID,
+			StartedBy: startedBy,
+			StartedAt: time.Now().UTC(),
+			Tracks:    []TrackInfo{},
+		},
+	}
+	r.sessions[key] = s
+	r.mu.Unlock()
+
+	if err := s.start(); err != nil {
+		r.mu.Lock()
+		delete(r.sessions, key)
+		r.mu.Unlock()
+		return "", err
+	}
+	return s.meta.ID, nil
+}
+
+// Stop leaves the room, closes every file and finalises metadata.json.
+func (r *Recorder) Stop(tenant, roomID string) error {
+	key := sessionKey(tenant, roomID)
+	r.mu.Lock()
+	s := r.sessions[key]
+	delete(r.sessions, key)
+	r.mu.Unlock()
+	if s == nil {
+		return ErrNotRecording
+	}
+	return s.stop()
+}
+
+// Close stops every recording.
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	sessions := r.sessions
+	r.sessions = make(map[string]*session)
+	r.mu.Unlock()
+	for _, s := range sessions {
+		s.stop()
+	}
+}
+
+// Metadata is written to metadata.json when a recording starts, whenever a
+// track starts, and when it stops.
+type Metadata struct {
+	ID        string      `json:"id"`
+	Tenant    string      `json:"tenant"`
+	RoomID    string      `json:"roomId"`
+	StartedBy string      `json:"startedBy"`
+	StartedAt time.Time   `json:"startedAt"`
+	StoppedAt *time.Time  `json:"stoppedAt,omitempty"`
+	Tracks    []TrackInfo `json:"tracks"`
+}
+
+// TrackInfo describes one recorded track file.
+type TrackInfo struct {
+	PeerID    string     `json:"peerId"`
+	Kind      string     `json:"kind"`
+	Codec     string     `json:"codec"`
+	File      string     `json:"file"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	Packets   uint64     `json:"packets"`
+	Bytes     uint64     `json:"bytes"`
+}
+
+// session is one room's recording.
+type session struct {
+	rec  *Recorder
+	dir  string
+	peer *hub.Peer
+	done chan struct{}
+
+	mu     sync.Mutex
+	meta   Metadata
+	conns  map[string]*remote
+	tracks sync.WaitGroup
+	closed bool
+}
+
+// remote is the receive-only connection to one member.
+type remote struct {
+	pc      *webrtc.PeerConnection
+	pending []webrtc.ICECandidateInit
+}
+
+func (s *session) start() error {
+	s.dir = filepath.Join(s.rec.cfg.Dir, safeName(s.meta.Tenant), safeName(s.meta.RoomID), s.meta.ID)
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+	if err := s.writeMetadata(); err != nil {
+		return err
+	}
+	peer, err := s.rec.hub.RegisterHidden(Subject+"-"+s.meta.ID, &contracts.Claims{
+		Subject:   Subject,
+		SessionID: s.meta.ID,
+		Tenant:    s.meta.Tenant,
+	})
+	if err != nil {
+		return err
+	}
+	s.peer = peer
+	go s.run()
+	s.rec.hub.HandleMessage(peer, hub.SignalMessage{Type: "join", RoomID: s.meta.RoomID})
+	return nil
+}
+
+// run handles the hub's messages to the recorder until it is unregistered.
+func (s *session) run() {
+	defer close(s.done)
+	for data := range s.peer.Send {
+		var msg hub.SignalMessage
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch msg.Type {
+		case "joined":
+			for _, id := range msg.Peers {
+				s.call(id)
+			}
+		case "peer_joined":
+			s.call(msg.PeerID)
+		case "answer":
+			s.answer(msg.PeerID, msg.SDP)
+		case "ice-candidate":
+			s.candidate(msg.PeerID, msg.Candidate)
+		case "error":
+			log.Printf("Recording %s: %s", s.meta.ID, msg.Message)
+		}
+	}
+}
+
+func (s *session) send(msg hub.SignalMessage) {
+	s.rec.hub.HandleMessage(s.peer, msg)
+}
+
+// call offers peerID a receive-only audio and video connection, replacing
+// any earlier one (the member rejoined).
+func (s *session) call(peerID string) {
+	pc, err := s.rec.api.NewPeerConnection(webrtc.Configuration{ICEServers: s.rec.cfg.ICEServers})
+	if err != nil {
+		log.Printf("Recording %s: %v", s.meta.ID, err)
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		pc.Close()
+		return
+	}
+	old := s.conns[peerID]
+	s.conns[peerID] = &remote{pc: pc}
+	s.mu.Unlock()
+	if old != nil {
+		old.pc.Close()
+	}
+
+	recvonly := webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if _, err := pc.AddTransceiverFromKind(kind, recvonly); err != nil {
+			log.Printf("Recording %s: %v", s.meta.ID, err)
+			return
+		}
+	}
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		if raw, err := json.Marshal(c.ToJSON()); err == nil {
+			s.send(hub.SignalMessage{Type: "ice-candidate", PeerID: peerID, Candidate: raw})
+		}
+	})
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		s.record(peerID, pc, track)
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed {
+			pc.Close()
+		}
+	})
+	offer, err := pc.CreateOffer(nil)
+	if err == nil {
+		err = pc.SetLocalDescription(offer)
+	}
+	if err != nil {
+		log.Printf("Recording %s: offer to %s: %v", s.meta.ID, peerID, err)
+		return
+	}
+	s.send(hub.SignalMessage{Type: "offer", PeerID: peerID, SDP: offer.SDP})
+}
+
+func (s *session) answer(peerID, sdp string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rm := s.conns[peerID]
+	if rm == nil {
+		return
+	}
+	if err := rm.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: sdp}); err != nil {
+		log.Printf("Recording %s: answer from %s: %v", s.meta.ID, peerID, err)
+		return
+	}
+	for _, c := range rm.pending {
+		rm.pc.AddICECandidate(c)
+	}
+	rm.pending = nil
+}
+
+func (s *session) candidate(peerID string, raw json.RawMessage) {
+	var init webrtc.ICECandidateInit
+	if json.Unmarshal(raw, &init) != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rm := s.conns[peerID]
+	if rm == nil {
+		return
+	}
+	if rm.pc.RemoteDescription() == nil {
+		rm.pending = append(rm.pending, init)
+		return
+	}
+	rm.pc.AddICECandidate(init)
+}
+
+// stop leaves the room and waits for every track file to be closed.
+func (s *session) stop() error {
+	s.rec.hub.Unregister(s.peer)
+	<-s.done
+	s.mu.Lock()
+	s.closed = true
+	conns := s.conns
+	s.conns = map[string]*remote{}
+	s.mu.Unlock()
+	for _, rm := range conns {
+		rm.pc.Close()
+	}
+	s.tracks.Wait()
+	s.mu.Lock()
+	stopped := time.Now().UTC()
+	s.meta.StoppedAt = &stopped
+	s.mu.Unlock()
+	return s.writeMetadata()
+}
+
+// writeMetadata atomically replaces metadata.json.
+func (s *session) writeMetadata() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.meta, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, "metadata.json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// safeName maps an ID to a single path element.
+func safeName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, id)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
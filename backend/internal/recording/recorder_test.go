@@ -0,0 +1,329 @@
+// Package recording — End-to-end recording over loopback through an
+// in-process hub.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/client"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/pion/ice/v4"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const testSecret = "recording-test-secret"
+
+// newSignalingServer mirrors cmd/signaling's /ws/signal handler with a
+// recorder writing to dir.
+func newSignalingServer(t *testing.T, dir string) string {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	var recorder *Recorder
+	h := hub.NewSignalHub(nil, hub.WithRecorder(func(h *hub.SignalHub) hub.Recorder {
+		var err error
+		if recorder, err = New(h, Config{Dir: dir, Loopback: true}); err != nil {
+			t.Fatal(err)
+		}
+		return recorder
+	}))
+	t.Cleanup(recorder.Close)
+	validator := auth.NewJWTValidator(testSecret)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.Validate(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			var msg hub.SignalMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			h.HandleMessage(peer, msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// participant answers the recorder's offer with Opus-ish audio and VP8
+// video, sending a keyframe whenever one is requested.
+type participant struct {
+	c       *client.Client
+	events  chan client.Message
+	notices chan client.Message
+	pli     atomic.Bool
+}
+
+func join(t *testing.T, ctx context.Context, url, user, room string) *participant {
+	t.Helper()
+	p := &participant{events: make(chan client.Message, 64), notices: make(chan client.Message, 16)}
+	p.c = client.New(url, func(context.Context) (string, error) {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": user, "session_id": "1", "exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(testSecret))
+	}, client.WithoutReconnect(), client.WithHandlers(client.Handlers{
+		OnMessage: func(msg client.Message) {
+			switch msg.Type {
+			case "offer", "ice-candidate":
+				p.events <- msg
+			case "recording":
+				p.notices <- msg
+			}
+		},
+	}))
+	t.Cleanup(func() { p.c.Close() })
+	if err := p.c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.c.Join(ctx, room); err != nil {
+		t.Fatal(err)
+	}
+	go p.run(ctx)
+	return p
+}
+
+func (p *participant) run(ctx context.Context) {
+	se := webrtc.SettingEngine{}
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	api := webrtc.NewAPI(webrtc.WithSettingEngine(se))
+	var pc *webrtc.PeerConnection
+	var pending []webrtc.ICECandidateInit
+	defer func() {
+		if pc != nil {
+			pc.Close()
+		}
+	}()
+	for {
+		var msg client.Message
+		select {
+		case <-ctx.Done():
+			return
+		case msg = <-p.events:
+		}
+		if msg.Type == "ice-candidate" {
+			var init webrtc.ICECandidateInit
+			json.Unmarshal(msg.Candidate, &init)
+			if pc == nil || pc.RemoteDescription() == nil {
+				pending = append(pending, init)
+			} else {
+				pc.AddICECandidate(init)
+			}
+			continue
+		}
+		var err error
+		if pc, err = api.NewPeerConnection(webrtc.Configuration{}); err != nil {
+			return
+		}
+		from := msg.PeerID
+		pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+			if c != nil {
+				init := c.ToJSON()
+				p.c.Candidate(from, client.ICECandidate{Candidate: init.Candidate, SDPMid: init.SDPMid, SDPMLineIndex: init.SDPMLineIndex})
+			}
+		})
+		audio, _ := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "p")
+		video, _ := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "p")
+		pc.AddTrack(audio)
+		sender, _ := pc.AddTrack(video)
+		go func() {
+			for {
+				pkts, _, err := sender.ReadRTCP()
+				if err != nil {
+					return
+				}
+				for _, pkt := range pkts {
+					if _, ok := pkt.(*rtcp.PictureLossIndication); ok {
+						p.pli.Store(true)
+					}
+				}
+			}
+		}()
+		if pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: msg.SDP}) != nil {
+			return
+		}
+		for _, c := range pending {
+			pc.AddICECandidate(c)
+		}
+		pending = nil
+		answer, err := pc.CreateAnswer(nil)
+		if err != nil || pc.SetLocalDescription(answer) != nil {
+			return
+		}
+		p.c.Answer(from, answer.SDP)
+		go p.pump(ctx, audio, video)
+	}
+}
+
+func (p *participant) pump(ctx context.Context, audio, video *webrtc.TrackLocalStaticRTP) {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for seq := uint16(1); ; seq++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		audio.WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960}, Payload: []byte{0xf8, 0xff, 0xfe}})
+		frame := byte(0x01)
+		if p.pli.Swap(false) {
+			frame = 0x00
+		}
+		video.WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 1800, Marker: true}, Payload: []byte{0x10, frame, 0x9d, 0x01, 0x2a}})
+	}
+}
+
+func (p *participant) notice(t *testing.T, state string) client.Message {
+	t.Helper()
+	select {
+	case msg := <-p.notices:
+		if msg.State != state {
+			t.Fatalf("expected recording %s, got %+v", state, msg)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no recording %s notice", state)
+	}
+	return client.Message{}
+}
+
+func TestRecordRoom(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	dir := t.TempDir()
+	url := newSignalingServer(t, dir)
+	alice := join(t, ctx, url, "alice", "standup")
+	bob := join(t, ctx, url, "bob", "standup")
+
+	id, err := alice.c.StartRecording(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*participant{alice, bob} {
+		if msg := p.notice(t, "started"); msg.RecordingID != id || msg.From != "alice" {
+			t.Fatalf("unexpected consent notice %+v", msg)
+		}
+	}
+	var serr *client.ServerError
+	if _, err := bob.c.StartRecording(ctx); !errors.As(err, &serr) || serr.Message != hub.ErrAlreadyRecording.Error() {
+		t.Fatalf("second start: %v", err)
+	}
+
+	// Late joiners are told the room is being recorded.
+	carol := join(t, ctx, url, "carol", "standup")
+	carol.notice(t, "started")
+
+	recDir := filepath.Join(dir, hub.DefaultTenant, "standup", id)
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		// Past the 32-byte IVF header means a keyframe was written.
+		if sizeOf(recDir, "alice-1-video-*.ivf") > 32 && sizeOf(recDir, "bob-1-video-*.ivf") > 32 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if _, err := bob.c.StopRecording(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*participant{alice, bob, carol} {
+		if msg := p.notice(t, "stopped"); msg.From != "bob" {
+			t.Fatalf("unexpected stop notice %+v", msg)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(recDir, "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.ID != id || meta.RoomID != "standup" || meta.StartedBy != "alice" || meta.StoppedAt == nil {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+	recorded := map[string]TrackInfo{}
+	for _, tr := range meta.Tracks {
+		if tr.EndedAt == nil {
+			t.Errorf("track %s not finalised", tr.File)
+		}
+		recorded[tr.PeerID+"/"+tr.Kind] = tr
+	}
+	for _, key := range []string{"alice-1/audio", "alice-1/video", "bob-1/audio", "bob-1/video"} {
+		tr, ok := recorded[key]
+		if !ok || tr.Packets == 0 {
+			t.Fatalf("%s not recorded: %+v", key, meta.Tracks)
+		}
+		head := make([]byte, 4)
+		f, err := os.Open(filepath.Join(recDir, tr.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadFull(f, head)
+		f.Close()
+		want := []byte("DKIF")
+		if tr.Kind == "audio" {
+			want = []byte("OggS")
+		}
+		if !bytes.Equal(head, want) {
+			t.Errorf("%s starts with %q, want %q", tr.File, head, want)
+		}
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	for in, want := range map[string]string{"room-1": "room-1", "../etc": ".._etc", "..": "_", "": "_", "a/b c": "a_b_c"} {
+		if got := safeName(in); got != want {
+			t.Errorf("safeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func sizeOf(dir, pattern string) int64 {
+	matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+	if len(matches) == 0 {
+		return 0
+	}
+	info, err := os.Stat(matches[0])
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,138 @@
+// Package recording — Per-track writers.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package recording
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+// keyframeInterval is how often a keyframe is requested until the first one
+// arrives; IVF files must start with one.
+const keyframeInterval = 2 * time.Second
+
+type mediaWriter interface {
+	WriteRTP(*rtp.Packet) error
+	Close() error
+}
+
+// record writes track to its own file until the track ends.
+func (s *session) record(peerID string, pc *webrtc.PeerConnection, track *webrtc.TrackRemote) {
+	mime := track.Codec().MimeType
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	index := len(s.meta.Tracks)
+	file := fmt.Sprintf("%s-%s-%d%s", safeName(peerID), track.Kind(), index, extension(mime))
+	s.meta.Tracks = append(s.meta.Tracks, TrackInfo{
+		PeerID:    peerID,
+		Kind:      track.Kind().String(),
+		Codec:     mime,
+		File:      file,
+		StartedAt: time.Now().UTC(),
+	})
+	s.tracks.Add(1)
+	s.mu.Unlock()
+	defer s.tracks.Done()
+
+	w, err := newWriter(filepath.Join(s.dir, file), mime)
+	if err != nil {
+		log.Printf("Recording %s: %s: %v", s.meta.ID, file, err)
+		return
+	}
+	if err := s.writeMetadata(); err != nil {
+		log.Printf("Recording %s: metadata: %v", s.meta.ID, err)
+	}
+
+	var keyframe atomic.Bool
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		go requestKeyframes(pc, track, &keyframe)
+	} else {
+		keyframe.Store(true)
+	}
+	var packets, bytes uint64
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			break
+		}
+		if !keyframe.Load() && isKeyframe(mime, pkt.Payload) {
+			keyframe.Store(true)
+		}
+		if err := w.WriteRTP(pkt); err != nil {
+			log.Printf("Recording %s: %s: %v", s.meta.ID, file, err)
+			break
+		}
+		packets++
+		bytes += uint64(len(pkt.Payload))
+	}
+	keyframe.Store(true)
+	w.Close()
+
+	ended := time.Now().UTC()
+	s.mu.Lock()
+	info := &s.meta.Tracks[index]
+	info.EndedAt, info.Packets, info.Bytes = &ended, packets, bytes
+	s.mu.Unlock()
+}
+
+// requestKeyframes sends PLIs until the first keyframe or the track ends.
+func requestKeyframes(pc *webrtc.PeerConnection, track *webrtc.TrackRemote, keyframe *atomic.Bool) {
+	ticker := time.NewTicker(keyframeInterval)
+	defer ticker.Stop()
+	for !keyframe.Load() {
+		if err := pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}}); err != nil {
+			return
+		}
+		<-ticker.C
+	}
+}
+
+func newWriter(path, mime string) (mediaWriter, error) {
+	switch {
+	case strings.EqualFold(mime, webrtc.MimeTypeOpus):
+		return oggwriter.New(path, 48000, 2)
+	case strings.EqualFold(mime, webrtc.MimeTypeVP8):
+		return ivfwriter.New(path, ivfwriter.WithCodec(webrtc.MimeTypeVP8))
+	case strings.EqualFold(mime, webrtc.MimeTypeVP9):
+		return ivfwriter.New(path, ivfwriter.WithCodec(webrtc.MimeTypeVP9))
+	}
+	return nil, fmt.Errorf("unsupported codec %s", mime)
+}
+
+func extension(mime string) string {
+	if strings.EqualFold(mime, webrtc.MimeTypeOpus) {
+		return ".ogg"
+	}
+	return ".ivf"
+}
+
+// isKeyframe reports whether payload starts a VP8 or VP9 keyframe.
+func isKeyframe(mime string, payload []byte) bool {
+	switch {
+	case strings.EqualFold(mime, webrtc.MimeTypeVP8):
+		var vp8 codecs.VP8Packet
+		frame, err := vp8.Unmarshal(payload)
+		return err == nil && len(frame) > 0 && vp8.S == 1 && frame[0]&0x01 == 0
+	case strings.EqualFold(mime, webrtc.MimeTypeVP9):
+		var vp9 codecs.VP9Packet
+		_, err := vp9.Unmarshal(payload)
+		return err == nil && vp9.B && !vp9.P
+	}
+	return false
+}
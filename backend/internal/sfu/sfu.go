@@ -0,0 +1,386 @@
+// Package sfu — Selective forwarding unit for large rooms.
+//
+// Each participant publishes over one client-offered peer connection and
+// receives everything it subscribed to over a second, SFU-offered one that is
+// renegotiated as subscriptions change. Video publishers may send simulcast;
+// subscribers pick a layer (RID) and the SFU switches on the next keyframe.
+// The SFU gathers its ICE candidates before answering or offering, so only
+// clients trickle. Rooms are keyed by tenant and room ID.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+)
+
+// Errors returned to the hub and reported to clients.
+var (
+	ErrNotPublishing  = errors.New("sfu: peer is not publishing")
+	ErrNoSubscription = errors.New("sfu: not subscribed")
+	ErrUnknownRole    = errors.New("sfu: candidate role must be publish or subscribe")
+	ErrNotInRoom      = errors.New("sfu: peer has no session in room")
+)
+
+// Candidate roles select which of a participant's peer connections a
+// trickled client candidate belongs to.
+const (
+	RolePublish   = "publish"
+	RoleSubscribe = "subscribe"
+)
+
+// Message is an SFU-initiated signaling message for one peer.
+type Message struct {
+	Type   string
+	RoomID string
+	PeerID string
+	SDP    string
+}
+
+// TypeSubscribeOffer is the only message type sent through Signal.
+const TypeSubscribeOffer = "subscribe-offer"
+
+// Signal delivers msg to peerID in tenant.
+type Signal func(tenant, peerID string, msg Message)
+
+// Config tunes the SFU's media transport.
+type Config struct {
+	ICEServers []webrtc.ICEServer
+	// PublicIPs are advertised as host candidates (1:1 NAT), e.g. a node's
+	// external address.
+	PublicIPs []string
+	// PortMin and PortMax bound the UDP ports used for media; zero means any.
+	PortMin, PortMax uint16
+	// Loopback restricts ICE to loopback candidates, for tests on one host.
+	Loopback bool
+	// GatherTimeout bounds candidate gathering per offer or answer (default 5s).
+	GatherTimeout time.Duration
+}
+
+// SFU forwards media between the participants of each room.
+type SFU struct {
+	cfg    Config
+	api    *webrtc.API
+	signal Signal
+
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+// New creates an SFU that sends renegotiation offers and notices via signal.
+func New(cfg Config, signal Signal) (*SFU, error) {
+	if cfg.GatherTimeout <= 0 {
+		cfg.GatherTimeout = 5 * time.Second
+	}
+	m, err := newMediaEngine()
+	if err != nil {
+		return nil, err
+	}
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, registry); err != nil {
+		return nil, err
+	}
+	s := webrtc.SettingEngine{}
+	if len(cfg.PublicIPs) > 0 {
+		s.SetNAT1To1IPs(cfg.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+	if cfg.PortMin > 0 && cfg.PortMax >= cfg.PortMin {
+		if err := s.SetEphemeralUDPPortRange(cfg.PortMin, cfg.PortMax); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Loopback {
+		s.SetIncludeLoopbackCandidate(true)
+		s.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+		s.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+		s.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	}
+	return &SFU{
+		cfg:    cfg,
+		api:    webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(registry), webrtc.WithSettingEngine(s)),
+		signal: signal,
+		rooms:  make(map[string]*room),
+	}, nil
+}
+
+// newMediaEngine registers Opus and VP8 with the header extensions simulcast
+// needs. VP8 is the only video codec so keyframes can be detected on switch.
+func newMediaEngine() (*webrtc.MediaEngine, error) {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1"},
+		PayloadType:        111,
+	}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
+	feedback := []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000, RTCPFeedback: feedback},
+		PayloadType:        96,
+	}, webrtc.RTPCodecTypeVideo); err != nil {
+		return nil, err
+	}
+	return m, webrtc.ConfigureSimulcastExtensionHeaders(m)
+}
+
+// room is one tenant room's participants; mu guards the participant map and
+// every participant's subscription map.
+type room struct {
+	sfu    *SFU
+	tenant string
+	id     string
+
+	mu           sync.Mutex
+	participants map[string]*participant
+}
+
+func roomKey(tenant, roomID string) string { return tenant + "/" + roomID }
+
+func (s *SFU) room(tenant, roomID string, create bool) *room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := roomKey(tenant, roomID)
+	r := s.rooms[key]
+	if r == nil && create {
+		r = &room{sfu: s, tenant: tenant, id: roomID, participants: make(map[string]*participant)}
+		s.rooms[key] = r
+	}
+	return r
+}
+
+// participantLocked returns (creating) peerID's participant. Caller holds r.mu.
+func (r *room) participantLocked(peerID string) *participant {
+	p := r.participants[peerID]
+	if p == nil {
+		p = &participant{room: r, id: peerID, subs: make(map[string]*subscription)}
+		r.participants[peerID] = p
+	}
+	return p
+}
+
+func (r *room) lookup(peerID string) *participant {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.participants[peerID]
+}
+
+// Publish applies a client offer to peerID's publishing connection (creating
+// it on first use) and returns the SFU's answer with candidates included.
+// Later offers renegotiate, e.g. when the client adds a track.
+func (s *SFU) Publish(tenant, roomID, peerID, offer string) (string, error) {
+	r := s.room(tenant, roomID, true)
+	r.mu.Lock()
+	p := r.participantLocked(peerID)
+	r.mu.Unlock()
+
+	p.pubMu.Lock()
+	defer p.pubMu.Unlock()
+	if p.pubPC == nil {
+		if err := p.startPublishingLocked(); err != nil {
+			return "", err
+		}
+	}
+	if err := p.pubPC.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	for _, c := range p.pubPending {
+		p.pubPC.AddICECandidate(c)
+	}
+	p.pubPending = nil
+	answer, err := p.pubPC.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	if err := s.setLocal(p.pubPC, answer); err != nil {
+		return "", err
+	}
+	return p.pubPC.LocalDescription().SDP, nil
+}
+
+// startPublishingLocked creates p's publishing connection and publication.
+// Caller holds p.pubMu.
+func (p *participant) startPublishingLocked() error {
+	s := p.room.sfu
+	pc, err := s.api.NewPeerConnection(webrtc.Configuration{ICEServers: s.cfg.ICEServers})
+	if err != nil {
+		return err
+	}
+	pub := &publication{owner: p, pc: pc, video: make(map[string]*webrtc.TrackRemote), subscribers: make(map[*subscription]struct{})}
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) { pub.addTrack(track) })
+	p.pubPC = pc
+	p.room.mu.Lock()
+	p.pub = pub
+	p.room.mu.Unlock()
+	return nil
+}
+
+// setLocal applies desc and waits for candidate gathering to finish.
+func (s *SFU) setLocal(pc *webrtc.PeerConnection, desc webrtc.SessionDescription) error {
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(desc); err != nil {
+		return err
+	}
+	select {
+	case <-gathered:
+		return nil
+	case <-time.After(s.cfg.GatherTimeout):
+		return errors.New("sfu: ICE gathering timed out")
+	}
+}
+
+// Publishers lists the peers publishing in a room.
+func (s *SFU) Publishers(tenant, roomID string) []string {
+	r := s.room(tenant, roomID, false)
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for id, p := range r.participants {
+		if p.pub != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// AddCandidate adds a client's trickled candidate to the peer connection for
+// role, holding it until that connection has a remote description.
+func (s *SFU) AddCandidate(tenant, roomID, peerID, role string, candidate json.RawMessage) error {
+	var init webrtc.ICECandidateInit
+	if err := json.Unmarshal(candidate, &init); err != nil {
+		return err
+	}
+	r := s.room(tenant, roomID, false)
+	if r == nil {
+		return ErrNotInRoom
+	}
+	p := r.lookup(peerID)
+	if p == nil {
+		return ErrNotInRoom
+	}
+	switch role {
+	case RolePublish:
+		p.pubMu.Lock()
+		defer p.pubMu.Unlock()
+		if p.pubPC == nil || p.pubPC.RemoteDescription() == nil {
+			p.pubPending = append(p.pubPending, init)
+			return nil
+		}
+		return p.pubPC.AddICECandidate(init)
+	case RoleSubscribe:
+		p.subMu.Lock()
+		defer p.subMu.Unlock()
+		if p.subPC == nil || p.subPC.RemoteDescription() == nil {
+			p.subPending = append(p.subPending, init)
+			return nil
+		}
+		return p.subPC.AddICECandidate(init)
+	}
+	return ErrUnknownRole
+}
+
+// Leave tears down peerID's connections in the room and renegotiates its
+// subscribers without its tracks. It reports whether peerID was publishing,
+// so the caller can announce that to the room.
+func (s *SFU) Leave(tenant, roomID, peerID string) bool {
+	r := s.room(tenant, roomID, false)
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	p := r.participants[peerID]
+	if p == nil {
+		r.mu.Unlock()
+		return false
+	}
+	published := p.pub != nil
+	delete(r.participants, peerID)
+	for _, sub := range p.subs {
+		sub.publication.removeSubscriber(sub)
+	}
+	p.subs = nil
+	var orphaned []*subscription
+	if p.pub != nil {
+		orphaned = p.pub.takeSubscribers()
+		for _, sub := range orphaned {
+			delete(sub.subscriber.subs, peerID)
+		}
+	}
+	empty := len(r.participants) == 0
+	r.mu.Unlock()
+
+	if empty {
+		s.mu.Lock()
+		if s.rooms[roomKey(tenant, roomID)] == r {
+			delete(s.rooms, roomKey(tenant, roomID))
+		}
+		s.mu.Unlock()
+	}
+	for _, sub := range orphaned {
+		go sub.detach()
+	}
+	p.close()
+	return published
+}
+
+// Close tears down every room.
+func (s *SFU) Close() {
+	s.mu.Lock()
+	rooms := s.rooms
+	s.rooms = make(map[string]*room)
+	s.mu.Unlock()
+	for _, r := range rooms {
+		r.mu.Lock()
+		for _, p := range r.participants {
+			p.close()
+		}
+		r.mu.Unlock()
+	}
+}
+
+// participant is one peer's publishing and subscribing connections.
+type participant struct {
+	room *room
+	id   string
+
+	// pubMu serialises negotiation of pubPC; pub is also written under
+	// room.mu so room-level reads need only that lock.
+	pubMu      sync.Mutex
+	pubPC      *webrtc.PeerConnection
+	pub        *publication
+	pubPending []webrtc.ICECandidateInit
+
+	// subMu serialises negotiation of subPC; subs is guarded by room.mu.
+	subMu          sync.Mutex
+	subPC          *webrtc.PeerConnection
+	subPending     []webrtc.ICECandidateInit
+	awaitingAnswer bool
+	renegotiate    bool
+	subs           map[string]*subscription
+	// viewer marks a client-offered subscribing connection; see view.go.
+	viewer      bool
+	viewSenders map[webrtc.RTPCodecType]*webrtc.RTPSender
+}
+
+func (p *participant) close() {
+	p.pubMu.Lock()
+	if p.pubPC != nil {
+		p.pubPC.Close()
+	}
+	p.pubMu.Unlock()
+	p.subMu.Lock()
+	if p.subPC != nil {
+		p.subPC.Close()
+	}
+	p.subMu.Unlock()
+}
@@ -0,0 +1,356 @@
+// Package sfu — Loopback tests for publishing, subscribing and layer switching.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sfu
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// inbox collects the SFU's signaling per peer.
+type inbox struct {
+	mu   sync.Mutex
+	msgs map[string]chan Message
+}
+
+func (b *inbox) signal(_, peerID string, msg Message) { b.ch(peerID) <- msg }
+
+func (b *inbox) ch(peerID string) chan Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.msgs[peerID] == nil {
+		b.msgs[peerID] = make(chan Message, 16)
+	}
+	return b.msgs[peerID]
+}
+
+func newTestSFU(t *testing.T) (*SFU, *inbox) {
+	t.Helper()
+	box := &inbox{msgs: make(map[string]chan Message)}
+	s, err := New(Config{Loopback: true}, box.signal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s, box
+}
+
+func newClientPC(t *testing.T) *webrtc.PeerConnection {
+	t.Helper()
+	m, err := newMediaEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, registry); err != nil {
+		t.Fatal(err)
+	}
+	se := webrtc.SettingEngine{}
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(registry), webrtc.WithSettingEngine(se))
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+func gathered(t *testing.T, pc *webrtc.PeerConnection, desc webrtc.SessionDescription) string {
+	t.Helper()
+	done := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(desc); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	return pc.LocalDescription().SDP
+}
+
+// publisher sends Opus-ish audio and three VP8 simulcast layers whose
+// payloads carry the layer's RID, with a keyframe on every PLI.
+type publisher struct {
+	audio  *webrtc.TrackLocalStaticRTP
+	layers []*webrtc.TrackLocalStaticRTP
+	midExt uint8
+	ridExt uint8
+	mid    string
+	pli    atomic.Bool
+	stop   chan struct{}
+}
+
+func publish(t *testing.T, s *SFU, room, peerID string) *publisher {
+	t.Helper()
+	pc := newClientPC(t)
+	p := &publisher{stop: make(chan struct{})}
+	var err error
+	if p.audio, err = webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", peerID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.AddTrack(p.audio); err != nil {
+		t.Fatal(err)
+	}
+	for _, rid := range []string{"q", "h", "f"} {
+		track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", peerID, webrtc.WithRTPStreamID(rid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.layers = append(p.layers, track)
+	}
+	sender, err := pc.AddTrack(p.layers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, track := range p.layers[1:] {
+		if err := sender.AddEncoding(track); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ext := range sender.GetParameters().HeaderExtensions {
+		switch ext.URI {
+		case sdp.SDESMidURI:
+			p.midExt = uint8(ext.ID)
+		case sdp.SDESRTPStreamIDURI:
+			p.ridExt = uint8(ext.ID)
+		}
+	}
+	go func() {
+		for {
+			pkts, _, err := sender.ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, pkt := range pkts {
+				if _, ok := pkt.(*rtcp.PictureLossIndication); ok {
+					p.pli.Store(true)
+				}
+			}
+		}
+	}()
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := s.Publish("", room, peerID, gathered(t, pc, offer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range pc.GetTransceivers() {
+		if tr.Sender() == sender {
+			p.mid = tr.Mid()
+		}
+	}
+	go p.run()
+	t.Cleanup(func() { close(p.stop) })
+	return p
+}
+
+func (p *publisher) run() {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	var seq uint16
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		seq++
+		p.audio.WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960}, Payload: []byte{0xf8, 0xff, 0xfe}})
+		keyframe := p.pli.Swap(false) || seq%100 == 0
+		for _, track := range p.layers {
+			frame := byte(0x01)
+			if keyframe {
+				frame = 0x00
+			}
+			pkt := &rtp.Packet{
+				Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 1800, Marker: true},
+				Payload: []byte{0x10, frame, track.RID()[0]},
+			}
+			pkt.Header.SetExtension(p.midExt, []byte(p.mid))
+			pkt.Header.SetExtension(p.ridExt, []byte(track.RID()))
+			track.WriteRTP(pkt)
+		}
+	}
+}
+
+// subscriber answers subscribe-offers and reports received video packets.
+type subscriber struct {
+	video chan *rtp.Packet
+	audio atomic.Int64
+}
+
+func subscribe(t *testing.T, s *SFU, box *inbox, room, peerID string) *subscriber {
+	t.Helper()
+	pc := newClientPC(t)
+	sub := &subscriber{video: make(chan *rtp.Packet, 1024)}
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			pkt, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			if track.Kind() == webrtc.RTPCodecTypeAudio {
+				sub.audio.Add(1)
+				continue
+			}
+			select {
+			case sub.video <- pkt:
+			default:
+			}
+		}
+	})
+	// Errors here surface as missing media in the test body.
+	go func() {
+		for msg := range box.ch(peerID) {
+			if pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: msg.SDP}) != nil {
+				return
+			}
+			answer, err := pc.CreateAnswer(nil)
+			if err != nil {
+				return
+			}
+			done := webrtc.GatheringCompletePromise(pc)
+			if pc.SetLocalDescription(answer) != nil {
+				return
+			}
+			<-done
+			s.SubscriberAnswer("", room, peerID, pc.LocalDescription().SDP)
+		}
+	}()
+	return sub
+}
+
+// waitLayer waits for video from layer and returns the last packet seen
+// before it plus the first packet of it.
+func (sub *subscriber) waitLayer(t *testing.T, layer byte) (prev, first *rtp.Packet) {
+	t.Helper()
+	timeout := time.After(15 * time.Second)
+	for {
+		select {
+		case pkt := <-sub.video:
+			if len(pkt.Payload) == 3 && pkt.Payload[2] == layer {
+				return prev, pkt
+			}
+			prev = pkt
+		case <-timeout:
+			t.Fatalf("no video from layer %c", layer)
+		}
+	}
+}
+
+func TestSimulcastLayerSwitch(t *testing.T) {
+	s, box := newTestSFU(t)
+	publish(t, s, "big", "alice")
+	if got := s.Publishers("", "big"); len(got) != 1 || got[0] != "alice" {
+		t.Fatalf("publishers %v", got)
+	}
+
+	sub := subscribe(t, s, box, "big", "bob")
+	if err := s.Subscribe("", "big", "bob", "alice", "q"); err != nil {
+		t.Fatal(err)
+	}
+	// The keyframe that starts forwarding may be sent before the subscriber's
+	// transport is up, so only check that the requested layer arrives.
+	sub.waitLayer(t, 'q')
+
+	if err := s.Subscribe("", "big", "bob", "alice", "f"); err != nil {
+		t.Fatal(err)
+	}
+	prev, first := sub.waitLayer(t, 'f')
+	if first.Payload[1]&0x01 != 0 {
+		t.Error("layer switch did not happen on a keyframe")
+	}
+	if prev != nil && first.SequenceNumber != prev.SequenceNumber+1 {
+		t.Errorf("sequence jumped across switch: %d -> %d", prev.SequenceNumber, first.SequenceNumber)
+	}
+	for i := 0; i < 10; i++ {
+		if prev, _ := sub.waitLayer(t, 'f'); prev != nil {
+			t.Fatalf("layer %c forwarded after switch", prev.Payload[2])
+		}
+	}
+	if sub.audio.Load() == 0 {
+		t.Error("no audio forwarded")
+	}
+}
+
+func TestPublisherLeave(t *testing.T) {
+	s, box := newTestSFU(t)
+	publish(t, s, "big", "alice")
+	sub := subscribe(t, s, box, "big", "bob")
+	if err := s.Subscribe("", "big", "bob", "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	sub.waitLayer(t, 'f')
+
+	if !s.Leave("", "big", "alice") {
+		t.Fatal("Leave did not report alice as a publisher")
+	}
+	if s.Leave("", "big", "bob") {
+		t.Fatal("Leave reported bob as a publisher")
+	}
+	if got := s.Publishers("", "big"); len(got) != 0 {
+		t.Fatalf("publishers after leave %v", got)
+	}
+	if err := s.Subscribe("", "big", "bob", "alice", ""); err != ErrNotPublishing {
+		t.Fatalf("subscribe to departed publisher: %v", err)
+	}
+	if err := s.Unsubscribe("", "big", "bob", "alice"); err != ErrNoSubscription {
+		t.Fatalf("unsubscribe after leave: %v", err)
+	}
+}
+
+func TestResolveLayer(t *testing.T) {
+	cases := []struct {
+		requested string
+		available []string
+		want      string
+		ok        bool
+	}{
+		{"h", []string{"f", "h", "q"}, "h", true},
+		{"", []string{"f", "h", "q"}, "f", true},
+		{"x", []string{"h", "q"}, "h", true},
+		{"", []string{""}, "", true},
+		{"q", nil, "", false},
+	}
+	for _, c := range cases {
+		if got, ok := resolveLayer(c.requested, c.available); got != c.want || ok != c.ok {
+			t.Errorf("resolveLayer(%q, %v) = %q, %v", c.requested, c.available, got, ok)
+		}
+	}
+}
+
+func TestRewriterContinuesAcrossSwitch(t *testing.T) {
+	var r rewriter
+	h := rtp.Header{SequenceNumber: 100, Timestamp: 9000}
+	r.rewrite(&h)
+	r.switched = true
+	h = rtp.Header{SequenceNumber: 5000, Timestamp: 700000}
+	r.rewrite(&h)
+	if h.SequenceNumber != 101 || h.Timestamp != 9000+switchTimestampGap {
+		t.Fatalf("after switch got seq %d ts %d", h.SequenceNumber, h.Timestamp)
+	}
+	h = rtp.Header{SequenceNumber: 5001, Timestamp: 703000}
+	r.rewrite(&h)
+	if h.SequenceNumber != 102 || h.Timestamp != 9000+switchTimestampGap+3000 {
+		t.Fatalf("next packet got seq %d ts %d", h.SequenceNumber, h.Timestamp)
+	}
+}
@@ -0,0 +1,473 @@
+// Package sfu — Subscriptions, forwarding and simulcast layer switching.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sfu
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+// ErrNoOfferPending is returned for a subscribe-answer the SFU did not ask for.
+var ErrNoOfferPending = errors.New("sfu: no subscribe offer pending")
+
+// layerPreference orders common simulcast RIDs from best to worst; "" means
+// the best available layer.
+var layerPreference = []string{"f", "h", "q", "high", "mid", "low"}
+
+const (
+	// keyframeRetry is how often a keyframe is re-requested while a layer
+	// switch is waiting for one.
+	keyframeRetry = time.Second
+	// switchTimestampGap advances the video timestamp by one 30 fps frame at
+	// 90 kHz across a layer switch.
+	switchTimestampGap = 3000
+)
+
+// Subscribe forwards publisherID's tracks to peerID over its subscribing
+// connection, sending peerID a subscribe-offer. Subscribing again only
+// changes the simulcast layer (RID; "" for the best available).
+func (s *SFU) Subscribe(tenant, roomID, peerID, publisherID, layer string) error {
+	r := s.room(tenant, roomID, false)
+	if r == nil {
+		return ErrNotPublishing
+	}
+	r.mu.Lock()
+	owner := r.participants[publisherID]
+	if owner == nil || owner.pub == nil {
+		r.mu.Unlock()
+		return ErrNotPublishing
+	}
+	p := r.participantLocked(peerID)
+	if sub := p.subs[publisherID]; sub != nil {
+		r.mu.Unlock()
+		sub.selectLayer(layer)
+		return nil
+	}
+	sub := &subscription{subscriber: p, publication: owner.pub, requested: layer}
+	p.subs[publisherID] = sub
+	owner.pub.addSubscriber(sub)
+	r.mu.Unlock()
+	return sub.sync()
+}
+
+// Unsubscribe stops forwarding publisherID to peerID and renegotiates.
+func (s *SFU) Unsubscribe(tenant, roomID, peerID, publisherID string) error {
+	r := s.room(tenant, roomID, false)
+	if r == nil {
+		return ErrNoSubscription
+	}
+	r.mu.Lock()
+	p := r.participants[peerID]
+	var sub *subscription
+	if p != nil {
+		sub = p.subs[publisherID]
+		delete(p.subs, publisherID)
+	}
+	r.mu.Unlock()
+	if sub == nil {
+		return ErrNoSubscription
+	}
+	sub.publication.removeSubscriber(sub)
+	return sub.detach()
+}
+
+// SubscriberAnswer completes a subscribe-offer, renegotiating again if
+// subscriptions changed in the meantime.
+func (s *SFU) SubscriberAnswer(tenant, roomID, peerID, answer string) error {
+	r := s.room(tenant, roomID, false)
+	if r == nil {
+		return ErrNotInRoom
+	}
+	p := r.lookup(peerID)
+	if p == nil {
+		return ErrNotInRoom
+	}
+	p.subMu.Lock()
+	if p.subPC == nil || !p.awaitingAnswer {
+		p.subMu.Unlock()
+		return ErrNoOfferPending
+	}
+	err := p.subPC.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer})
+	if err == nil {
+		for _, c := range p.subPending {
+			p.subPC.AddICECandidate(c)
+		}
+		p.subPending = nil
+	}
+	p.awaitingAnswer = false
+	again := p.renegotiate
+	p.renegotiate = false
+	p.subMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if again {
+		return p.negotiate()
+	}
+	return nil
+}
+
+// negotiate sends a fresh subscribe-offer, or defers it until the
+// outstanding one is answered. Viewers are never renegotiated.
+func (p *participant) negotiate() error {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	if p.subPC == nil || p.viewer {
+		return nil
+	}
+	if p.awaitingAnswer {
+		p.renegotiate = true
+		return nil
+	}
+	offer, err := p.subPC.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	sfu := p.room.sfu
+	if err := sfu.setLocal(p.subPC, offer); err != nil {
+		return err
+	}
+	p.awaitingAnswer = true
+	sfu.signal(p.room.tenant, p.id, Message{Type: TypeSubscribeOffer, RoomID: p.room.id, SDP: p.subPC.LocalDescription().SDP})
+	return nil
+}
+
+// addTrack adds a forwarded track to the subscribing connection, creating it
+// on first use. A viewer's track replaces the placeholder for its kind.
+func (p *participant) addTrack(track webrtc.TrackLocal) (*webrtc.RTPSender, error) {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	if p.viewer {
+		return p.replaceViewTrack(track)
+	}
+	if p.subPC == nil {
+		pc, err := p.room.sfu.api.NewPeerConnection(webrtc.Configuration{ICEServers: p.room.sfu.cfg.ICEServers})
+		if err != nil {
+			return nil, err
+		}
+		p.subPC = pc
+	}
+	return p.subPC.AddTrack(track)
+}
+
+func (p *participant) removeSenders(senders ...*webrtc.RTPSender) {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	for _, sender := range senders {
+		switch {
+		case sender == nil || p.subPC == nil:
+		case p.viewer:
+			sender.ReplaceTrack(nil)
+		default:
+			p.subPC.RemoveTrack(sender)
+		}
+	}
+}
+
+// publication is one participant's published tracks and their subscribers.
+type publication struct {
+	owner *participant
+	pc    *webrtc.PeerConnection
+
+	mu          sync.RWMutex
+	audio       *webrtc.TrackRemote
+	video       map[string]*webrtc.TrackRemote // by RID; "" without simulcast
+	subscribers map[*subscription]struct{}
+}
+
+func (pb *publication) addSubscriber(sub *subscription) {
+	pb.mu.Lock()
+	pb.subscribers[sub] = struct{}{}
+	pb.mu.Unlock()
+}
+
+func (pb *publication) removeSubscriber(sub *subscription) {
+	pb.mu.Lock()
+	delete(pb.subscribers, sub)
+	pb.mu.Unlock()
+}
+
+func (pb *publication) takeSubscribers() []*subscription {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	subs := make([]*subscription, 0, len(pb.subscribers))
+	for sub := range pb.subscribers {
+		subs = append(subs, sub)
+	}
+	pb.subscribers = make(map[*subscription]struct{})
+	return subs
+}
+
+// layers lists the available video RIDs.
+func (pb *publication) layers() []string {
+	pb.mu.RLock()
+	defer pb.mu.RUnlock()
+	rids := make([]string, 0, len(pb.video))
+	for rid := range pb.video {
+		rids = append(rids, rid)
+	}
+	sort.Strings(rids)
+	return rids
+}
+
+// addTrack registers a newly received track, brings existing subscribers up
+// to date, and forwards its packets until the track ends.
+func (pb *publication) addTrack(track *webrtc.TrackRemote) {
+	pb.mu.Lock()
+	if track.Kind() == webrtc.RTPCodecTypeAudio {
+		pb.audio = track
+	} else {
+		pb.video[track.RID()] = track
+	}
+	subs := make([]*subscription, 0, len(pb.subscribers))
+	for sub := range pb.subscribers {
+		subs = append(subs, sub)
+	}
+	pb.mu.Unlock()
+	for _, sub := range subs {
+		go sub.sync()
+	}
+
+	kind, rid := track.Kind(), track.RID()
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		pb.mu.RLock()
+		for sub := range pb.subscribers {
+			sub.write(kind, rid, pkt)
+		}
+		pb.mu.RUnlock()
+	}
+}
+
+// requestKeyframe sends a PLI for the video layer rid to the publisher.
+func (pb *publication) requestKeyframe(rid string) {
+	pb.mu.RLock()
+	track := pb.video[rid]
+	pb.mu.RUnlock()
+	if track != nil {
+		pb.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}})
+	}
+}
+
+// subscription forwards one publication to one subscriber.
+type subscription struct {
+	subscriber  *participant
+	publication *publication
+
+	mu                       sync.Mutex
+	audio, video             *webrtc.TrackLocalStaticRTP
+	audioSender, videoSender *webrtc.RTPSender
+	requested                string
+	layer, pending           string
+	hasLayer, hasPending     bool
+	lastPLI                  time.Time
+	seq                      rewriter
+}
+
+// sync creates local tracks for every kind the publisher now sends,
+// re-resolves the requested layer and renegotiates if tracks were added.
+func (sub *subscription) sync() error {
+	pb := sub.publication
+	pb.mu.RLock()
+	audio := pb.audio
+	var video *webrtc.TrackRemote
+	for _, t := range pb.video {
+		video = t
+		break
+	}
+	pb.mu.RUnlock()
+
+	streamID := pb.owner.id
+	added := false
+	sub.mu.Lock()
+	if audio != nil && sub.audio == nil {
+		track, err := webrtc.NewTrackLocalStaticRTP(audio.Codec().RTPCodecCapability, "audio", streamID)
+		if err != nil {
+			sub.mu.Unlock()
+			return err
+		}
+		sender, err := sub.subscriber.addTrack(track)
+		if err != nil && err != errNotOffered {
+			sub.mu.Unlock()
+			return err
+		}
+		sub.audio, sub.audioSender, added = track, sender, true
+		if sender != nil {
+			go sub.readRTCP(sender)
+		}
+	}
+	if video != nil && sub.video == nil {
+		track, err := webrtc.NewTrackLocalStaticRTP(video.Codec().RTPCodecCapability, "video", streamID)
+		if err != nil {
+			sub.mu.Unlock()
+			return err
+		}
+		sender, err := sub.subscriber.addTrack(track)
+		if err != nil && err != errNotOffered {
+			sub.mu.Unlock()
+			return err
+		}
+		sub.video, sub.videoSender, added = track, sender, true
+		if sender != nil {
+			go sub.readRTCP(sender)
+		}
+	}
+	requested := sub.requested
+	sub.mu.Unlock()
+
+	sub.selectLayer(requested)
+	if added {
+		return sub.subscriber.negotiate()
+	}
+	return nil
+}
+
+// detach removes the forwarded tracks from the subscriber's connection.
+func (sub *subscription) detach() error {
+	sub.mu.Lock()
+	senders := []*webrtc.RTPSender{sub.audioSender, sub.videoSender}
+	sub.audio, sub.video, sub.audioSender, sub.videoSender = nil, nil, nil, nil
+	sub.mu.Unlock()
+	sub.subscriber.removeSenders(senders...)
+	return sub.subscriber.negotiate()
+}
+
+// selectLayer requests a switch to the layer resolved from requested. The
+// switch happens on the new layer's next keyframe.
+func (sub *subscription) selectLayer(requested string) {
+	rid, ok := resolveLayer(requested, sub.publication.layers())
+	sub.mu.Lock()
+	sub.requested = requested
+	if !ok || (sub.hasPending && sub.pending == rid) {
+		sub.mu.Unlock()
+		return
+	}
+	if sub.hasLayer && sub.layer == rid {
+		sub.hasPending = false
+		sub.mu.Unlock()
+		return
+	}
+	sub.pending, sub.hasPending = rid, true
+	sub.lastPLI = time.Now()
+	sub.mu.Unlock()
+	sub.publication.requestKeyframe(rid)
+}
+
+// resolveLayer picks requested if available, else the best available layer.
+func resolveLayer(requested string, available []string) (string, bool) {
+	if len(available) == 0 {
+		return "", false
+	}
+	for _, rid := range available {
+		if rid == requested {
+			return rid, true
+		}
+	}
+	for _, pref := range layerPreference {
+		for _, rid := range available {
+			if rid == pref {
+				return rid, true
+			}
+		}
+	}
+	return available[0], true
+}
+
+// write forwards one packet from layer rid if this subscription wants it.
+func (sub *subscription) write(kind webrtc.RTPCodecType, rid string, pkt *rtp.Packet) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	out := *pkt
+	// Header extension IDs are negotiated per connection; drop the publisher's.
+	out.Header.Extension, out.Header.Extensions = false, nil
+	if kind == webrtc.RTPCodecTypeAudio {
+		if sub.audio != nil {
+			sub.audio.WriteRTP(&out)
+		}
+		return
+	}
+	if sub.video == nil {
+		return
+	}
+	if sub.hasPending && rid == sub.pending {
+		if isVP8Keyframe(pkt.Payload) {
+			sub.layer, sub.hasLayer, sub.hasPending = rid, true, false
+			sub.seq.switched = true
+		} else if time.Since(sub.lastPLI) > keyframeRetry {
+			sub.lastPLI = time.Now()
+			go sub.publication.requestKeyframe(rid)
+		}
+	}
+	if !sub.hasLayer || rid != sub.layer {
+		return
+	}
+	sub.seq.rewrite(&out.Header)
+	sub.video.WriteRTP(&out)
+}
+
+// readRTCP drains a sender's RTCP, relaying keyframe requests for video to
+// the publisher's current layer.
+func (sub *subscription) readRTCP(sender *webrtc.RTPSender) {
+	for {
+		pkts, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, p := range pkts {
+			switch p.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				sub.mu.Lock()
+				layer, ok := sub.layer, sub.hasLayer
+				sub.mu.Unlock()
+				if ok {
+					sub.publication.requestKeyframe(layer)
+				}
+			}
+		}
+	}
+}
+
+// rewriter keeps a subscriber's video sequence numbers and timestamps
+// continuous across simulcast layer switches.
+type rewriter struct {
+	started, switched bool
+	seqOffset         uint16
+	tsOffset          uint32
+	lastSeq           uint16
+	lastTS            uint32
+}
+
+func (r *rewriter) rewrite(h *rtp.Header) {
+	if r.switched {
+		if r.started {
+			r.seqOffset = r.lastSeq + 1 - h.SequenceNumber
+			r.tsOffset = r.lastTS + switchTimestampGap - h.Timestamp
+		}
+		r.switched = false
+	}
+	h.SequenceNumber += r.seqOffset
+	h.Timestamp += r.tsOffset
+	r.lastSeq, r.lastTS, r.started = h.SequenceNumber, h.Timestamp, true
+}
+
+// isVP8Keyframe reports whether payload starts a VP8 keyframe.
+func isVP8Keyframe(payload []byte) bool {
+	var vp8 codecs.VP8Packet
+	frame, err := vp8.Unmarshal(payload)
+	if err != nil || len(frame) == 0 {
+		return false
+	}
+	return vp8.S == 1 && vp8.PID == 0 && frame[0]&0x01 == 0
+}
@@ -0,0 +1,184 @@
+// Package sfu — Client-offered connections that receive forwarded media.
+//
+// WHEP-style players offer recvonly transceivers and expect an answer, and
+// cannot be renegotiated by the server. A viewer's forwarded tracks are
+// therefore swapped onto the senders created for its offer instead of being
+// added as new transceivers. Duplex participants, such as SIP endpoints,
+// publish and view over one such connection.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sfu
+
+import (
+	"errors"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ErrNotViewer is returned when View is called for a peer that already
+// subscribes over an SFU-offered connection.
+var ErrNotViewer = errors.New("sfu: peer already subscribes over an sfu-offered connection")
+
+// errNotOffered means a viewer did not offer to receive a track's kind; the
+// track is then not forwarded to it.
+var errNotOffered = errors.New("sfu: viewer did not offer this kind")
+
+// viewerCodecs are the placeholder capabilities bound to a viewer's senders
+// until the publisher's tracks arrive.
+var viewerCodecs = map[webrtc.RTPCodecType]webrtc.RTPCodecCapability{
+	webrtc.RTPCodecTypeAudio: {MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+	webrtc.RTPCodecTypeVideo: {MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+}
+
+// View answers peerID's offer to receive publisherID's audio and video at
+// layer ("" for the best available). Offering again renegotiates the same
+// connection, which is how viewers restart ICE; the layer is then updated.
+func (s *SFU) View(tenant, roomID, peerID, publisherID, layer, offer string) (string, error) {
+	r := s.room(tenant, roomID, false)
+	if r == nil {
+		return "", ErrNotPublishing
+	}
+	r.mu.Lock()
+	owner := r.participants[publisherID]
+	if owner == nil || owner.pub == nil {
+		r.mu.Unlock()
+		return "", ErrNotPublishing
+	}
+	p := r.participantLocked(peerID)
+	r.mu.Unlock()
+
+	answer, err := p.answerView(offer, publisherID)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	if owner.pub == nil || r.participants[peerID] != p {
+		r.mu.Unlock()
+		return answer, nil
+	}
+	if sub := p.subs[publisherID]; sub != nil {
+		r.mu.Unlock()
+		sub.selectLayer(layer)
+		return answer, nil
+	}
+	sub := &subscription{subscriber: p, publication: owner.pub, requested: layer}
+	p.subs[publisherID] = sub
+	owner.pub.addSubscriber(sub)
+	r.mu.Unlock()
+	return answer, sub.sync()
+}
+
+// answerView applies a viewer's offer to its subscribing connection,
+// creating it and a placeholder sender per offered kind on first use.
+func (p *participant) answerView(offer, streamID string) (string, error) {
+	sfu := p.room.sfu
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	if p.subPC == nil {
+		pc, err := sfu.api.NewPeerConnection(webrtc.Configuration{ICEServers: sfu.cfg.ICEServers})
+		if err != nil {
+			return "", err
+		}
+		p.subPC, p.viewer = pc, true
+		p.viewSenders = make(map[webrtc.RTPCodecType]*webrtc.RTPSender)
+	} else if !p.viewer {
+		return "", ErrNotViewer
+	}
+	if err := p.subPC.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	for _, c := range p.subPending {
+		p.subPC.AddICECandidate(c)
+	}
+	p.subPending = nil
+	if err := p.addViewSendersLocked(streamID); err != nil {
+		return "", err
+	}
+	answer, err := p.subPC.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	if err := sfu.setLocal(p.subPC, answer); err != nil {
+		return "", err
+	}
+	return p.subPC.LocalDescription().SDP, nil
+}
+
+// Duplex answers one sendrecv offer, as SIP endpoints send: the offer's
+// tracks are published to the room as with Publish, and the same
+// transceivers carry back the publisher peerID subscribes to. Each
+// subscription replaces the last on those senders, so callers keep at most
+// one. Offering again renegotiates.
+func (s *SFU) Duplex(tenant, roomID, peerID, offer string) (string, error) {
+	r := s.room(tenant, roomID, true)
+	r.mu.Lock()
+	p := r.participantLocked(peerID)
+	r.mu.Unlock()
+
+	p.pubMu.Lock()
+	defer p.pubMu.Unlock()
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	switch {
+	case p.pubPC == nil && p.subPC == nil:
+		if err := p.startPublishingLocked(); err != nil {
+			return "", err
+		}
+		p.subPC, p.viewer = p.pubPC, true
+		p.viewSenders = make(map[webrtc.RTPCodecType]*webrtc.RTPSender)
+	case p.pubPC != p.subPC:
+		return "", ErrNotViewer
+	}
+	pc := p.pubPC
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	for _, c := range append(p.pubPending, p.subPending...) {
+		pc.AddICECandidate(c)
+	}
+	p.pubPending, p.subPending = nil, nil
+	if err := p.addViewSendersLocked(peerID); err != nil {
+		return "", err
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	if err := s.setLocal(pc, answer); err != nil {
+		return "", err
+	}
+	return pc.LocalDescription().SDP, nil
+}
+
+// addViewSendersLocked adds a placeholder sender for each offered kind
+// that has none yet. Caller holds p.subMu.
+func (p *participant) addViewSendersLocked(streamID string) error {
+	for _, t := range p.subPC.GetTransceivers() {
+		kind := t.Kind()
+		codec, ok := viewerCodecs[kind]
+		if !ok || p.viewSenders[kind] != nil {
+			continue
+		}
+		track, err := webrtc.NewTrackLocalStaticRTP(codec, kind.String(), streamID)
+		if err != nil {
+			return err
+		}
+		sender, err := p.subPC.AddTrack(track)
+		if err != nil {
+			return err
+		}
+		p.viewSenders[kind] = sender
+	}
+	return nil
+}
+
+// replaceViewTrack swaps track onto the viewer's sender for its kind.
+// Caller holds p.subMu.
+func (p *participant) replaceViewTrack(track webrtc.TrackLocal) (*webrtc.RTPSender, error) {
+	sender := p.viewSenders[track.Kind()]
+	if sender == nil {
+		return nil, errNotOffered
+	}
+	return sender, sender.ReplaceTrack(track)
+}
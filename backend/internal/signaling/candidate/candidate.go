@@ -0,0 +1,115 @@
+// Package candidate — ICE candidate parsing and privacy policy.
+//
+// Parses RFC 8839 candidate attributes carried in trickle ICE messages and
+// SDP bodies so the hub can filter them before they reach other peers.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package candidate
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Init mirrors the browser RTCIceCandidateInit dictionary.
+type Init struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *int    `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// Candidate is a parsed candidate attribute.
+type Candidate struct {
+	Foundation     string
+	Component      int
+	Transport      string
+	Priority       uint32
+	Address        string
+	Port           int
+	Type           string
+	RelatedAddress string
+	RelatedPort    int
+	// Extensions holds trailing name/value pairs (generation, ufrag, ...).
+	Extensions [][2]string
+}
+
+// ParseInit decodes a trickle ICE payload.
+func ParseInit(raw json.RawMessage) (*Init, error) {
+	var init Init
+	if err := json.Unmarshal(raw, &init); err != nil {
+		return nil, err
+	}
+	return &init, nil
+}
+
+// Parse decodes a candidate attribute value, with or without the
+// "candidate:" or "a=candidate:" prefix.
+func Parse(value string) (*Candidate, error) {
+	value = strings.TrimPrefix(value, "a=")
+	value = strings.TrimPrefix(value, "candidate:")
+	fields := strings.Fields(value)
+	if len(fields) < 8 || fields[6] != "typ" {
+		return nil, errors.New("candidate: malformed attribute")
+	}
+	component, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, errors.New("candidate: invalid component")
+	}
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return nil, errors.New("candidate: invalid priority")
+	}
+	port, err := strconv.Atoi(fields[5])
+	if err != nil {
+		return nil, errors.New("candidate: invalid port")
+	}
+	c := &Candidate{
+		Foundation: fields[0],
+		Component:  component,
+		Transport:  strings.ToLower(fields[2]),
+		Priority:   uint32(priority),
+		Address:    fields[4],
+		Port:       port,
+		Type:       fields[7],
+	}
+	rest := fields[8:]
+	for i := 0; i+1 < len(rest); i += 2 {
+		switch rest[i] {
+		case "raddr":
+			c.RelatedAddress = rest[i+1]
+		case "rport":
+			c.RelatedPort, _ = strconv.Atoi(rest[i+1])
+		default:
+			c.Extensions = append(c.Extensions, [2]string{rest[i], rest[i+1]})
+		}
+	}
+	return c, nil
+}
+
+// String serialises the candidate with the "candidate:" prefix.
+func (c *Candidate) String() string {
+	parts := []string{
+		"candidate:" + c.Foundation,
+		strconv.Itoa(c.Component),
+		c.Transport,
+		strconv.FormatUint(uint64(c.Priority), 10),
+		c.Address,
+		strconv.Itoa(c.Port),
+		"typ", c.Type,
+	}
+	if c.RelatedAddress != "" {
+		parts = append(parts, "raddr", c.RelatedAddress, "rport", strconv.Itoa(c.RelatedPort))
+	}
+	for _, ext := range c.Extensions {
+		parts = append(parts, ext[0], ext[1])
+	}
+	return strings.Join(parts, " ")
+}
+
+// IsMDNS reports whether the address is an mDNS-obfuscated hostname.
+func (c *Candidate) IsMDNS() bool {
+	return strings.HasSuffix(strings.ToLower(c.Address), ".local")
+}
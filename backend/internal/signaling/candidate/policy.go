@@ -0,0 +1,172 @@
+// Package candidate — Per-room candidate filtering policy.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package candidate
+
+import (
+	"net"
+	"strings"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/policyset"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/sdp"
+)
+
+// Decision reasons recorded in telemetry.
+const (
+	ReasonAllowed          = "allowed"
+	ReasonRelayOnly        = "relay_only"
+	ReasonPrivateAddress   = "private_address"
+	ReasonMDNS             = "mdns"
+	ReasonBlockedTransport = "blocked_transport"
+	ReasonMalformed        = "malformed"
+	ReasonEndOfCandidates  = "end_of_candidates"
+)
+
+// Policy controls which candidates may be forwarded to other peers.
+type Policy struct {
+	// RelayOnly forwards TURN relay candidates only, hiding every peer address:
+	// it implies RedactRelated, and FilterSDP also blanks the c=, m= port and
+	// a=rtcp addresses.
+	RelayOnly bool `json:"relayOnly,omitempty"`
+	// DropPrivateHost drops host candidates on RFC 1918, ULA, loopback or
+	// link-local addresses.
+	DropPrivateHost bool `json:"dropPrivateHost,omitempty"`
+	// DropMDNS drops host candidates obfuscated as <uuid>.local hostnames.
+	DropMDNS bool `json:"dropMdns,omitempty"`
+	// RedactRelated zeroes raddr/rport on forwarded srflx/prflx/relay candidates.
+	RedactRelated bool `json:"redactRelated,omitempty"`
+	// BlockedTransports lists transports ("udp", "tcp") that are never forwarded.
+	BlockedTransports []string `json:"blockedTransports,omitempty"`
+}
+
+// Decision is the outcome of evaluating one candidate.
+type Decision struct {
+	Allow  bool
+	Reason string
+	Type   string
+	// Candidate is the attribute to forward, possibly rewritten.
+	Candidate string
+}
+
+// Evaluate decides whether a candidate attribute may be forwarded.
+func (p *Policy) Evaluate(value string) Decision {
+	if strings.TrimSpace(value) == "" {
+		return Decision{Allow: true, Reason: ReasonEndOfCandidates}
+	}
+	c, err := Parse(value)
+	if err != nil {
+		return Decision{Reason: ReasonMalformed}
+	}
+	d := Decision{Type: c.Type}
+	switch {
+	case p.RelayOnly && c.Type != "relay":
+		d.Reason = ReasonRelayOnly
+	case p.blocksTransport(c.Transport):
+		d.Reason = ReasonBlockedTransport
+	case c.Type == "host" && c.IsMDNS() && p.DropMDNS:
+		d.Reason = ReasonMDNS
+	case c.Type == "host" && p.DropPrivateHost && isPrivate(c.Address):
+		d.Reason = ReasonPrivateAddress
+	default:
+		d.Allow = true
+		d.Reason = ReasonAllowed
+		if (p.RelayOnly || p.RedactRelated) && c.RelatedAddress != "" {
+			c.RelatedAddress = "0.0.0.0"
+			c.RelatedPort = 0
+			if strings.Contains(c.Address, ":") {
+				c.RelatedAddress = "::"
+			}
+		}
+		d.Candidate = c.String()
+		if !strings.HasPrefix(strings.TrimPrefix(value, "a="), "candidate:") {
+			d.Candidate = strings.TrimPrefix(d.Candidate, "candidate:")
+		}
+	}
+	return d
+}
+
+// FilterSDP removes or rewrites a=candidate lines embedded in an SDP body.
+// In relay-only mode it also replaces the connection addresses and ports
+// with the 0.0.0.0 / 9 placeholders of trickle ICE.
+func (p *Policy) FilterSDP(body string) (string, []Decision, error) {
+	desc, err := sdp.Parse(body)
+	if err != nil {
+		return "", nil, err
+	}
+	if p.RelayOnly {
+		for i, line := range desc.Session {
+			desc.Session[i] = blankAddress(line)
+		}
+	}
+	var decisions []Decision
+	for _, m := range desc.Media {
+		lines := m.Lines[:0]
+		for _, line := range m.Lines {
+			if p.RelayOnly {
+				line = blankAddress(line)
+			}
+			if !strings.HasPrefix(line, "a=candidate:") {
+				lines = append(lines, line)
+				continue
+			}
+			d := p.Evaluate(line)
+			decisions = append(decisions, d)
+			if d.Allow {
+				lines = append(lines, "a="+d.Candidate)
+			}
+		}
+		m.Lines = lines
+	}
+	return desc.String(), decisions, nil
+}
+
+// blankAddress replaces the address of a c= or a=rtcp line, and the port
+// of an m= line, with placeholders. Rejected (port 0) sections keep their
+// port.
+func blankAddress(line string) string {
+	switch {
+	case strings.HasPrefix(line, "c="):
+		if strings.Contains(line, " IP6 ") {
+			return "c=IN IP6 ::"
+		}
+		return "c=IN IP4 0.0.0.0"
+	case strings.HasPrefix(line, "a=rtcp:"):
+		if strings.Contains(line, " IP6 ") {
+			return "a=rtcp:9 IN IP6 ::"
+		}
+		return "a=rtcp:9 IN IP4 0.0.0.0"
+	case strings.HasPrefix(line, "m="):
+		fields := strings.Fields(line[2:])
+		if len(fields) > 1 && fields[1] != "0" {
+			fields[1] = "9"
+			return "m=" + strings.Join(fields, " ")
+		}
+	}
+	return line
+}
+
+func (p *Policy) blocksTransport(transport string) bool {
+	for _, t := range p.BlockedTransports {
+		if strings.EqualFold(t, transport) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrivate(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
+
+// PolicySet resolves policies per room, falling back to tenant then default.
+type PolicySet = policyset.Set[Policy]
+
+// LoadPolicySet reads a JSON policy set from disk.
+func LoadPolicySet(path string) (*PolicySet, error) {
+	return policyset.Load[Policy](path, "ice policy")
+}
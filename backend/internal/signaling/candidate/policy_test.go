@@ -0,0 +1,99 @@
+// Package candidate — Tests for candidate parsing and filtering.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package candidate
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	hostPrivate = "candidate:1 1 udp 2122260223 192.168.1.20 54321 typ host generation 0 ufrag abcd"
+	hostMDNS    = "candidate:2 1 udp 2122260223 6f1c2e1a-3c2b-4d2e-9a51-0f0b6a1b2c3d.local 54322 typ host generation 0"
+	hostTCP     = "candidate:3 1 tcp 1518280447 203.0.113.7 9 typ host tcptype active generation 0"
+	srflx       = "candidate:4 1 udp 1686052607 203.0.113.7 54321 typ srflx raddr 192.168.1.20 rport 54321 generation 0"
+	relay       = "candidate:5 1 udp 41885439 198.51.100.9 3478 typ relay raddr 203.0.113.7 rport 54321 generation 0"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	for _, value := range []string{hostPrivate, hostTCP, srflx, relay} {
+		c, err := Parse(value)
+		if err != nil {
+			t.Fatalf("parse %q: %v", value, err)
+		}
+		if got := c.String(); got != value {
+			t.Errorf("round trip mismatch:\n got %q\nwant %q", got, value)
+		}
+	}
+	if _, err := Parse("candidate:garbage"); err == nil {
+		t.Error("expected error for malformed candidate")
+	}
+}
+
+func TestRelayOnly(t *testing.T) {
+	p := &Policy{RelayOnly: true}
+	for _, value := range []string{hostPrivate, hostMDNS, srflx} {
+		if d := p.Evaluate(value); d.Allow || d.Reason != ReasonRelayOnly {
+			t.Errorf("expected %q to be dropped as relay_only, got %+v", value, d)
+		}
+	}
+	if d := p.Evaluate(relay); !d.Allow || strings.Contains(d.Candidate, "203.0.113.7") {
+		t.Errorf("expected relay candidate to pass with its related address hidden, got %+v", d)
+	}
+	if d := p.Evaluate(""); !d.Allow || d.Reason != ReasonEndOfCandidates {
+		t.Errorf("expected end-of-candidates to pass, got %+v", d)
+	}
+}
+
+func TestPrivateMDNSAndTransport(t *testing.T) {
+	p := &Policy{DropPrivateHost: true, DropMDNS: true, BlockedTransports: []string{"TCP"}}
+	cases := map[string]string{
+		hostPrivate: ReasonPrivateAddress,
+		hostMDNS:    ReasonMDNS,
+		hostTCP:     ReasonBlockedTransport,
+		srflx:       ReasonAllowed,
+	}
+	for value, reason := range cases {
+		if d := p.Evaluate(value); d.Reason != reason {
+			t.Errorf("%q: expected %s, got %s", value, reason, d.Reason)
+		}
+	}
+}
+
+func TestRedactRelated(t *testing.T) {
+	p := &Policy{RedactRelated: true}
+	d := p.Evaluate(srflx)
+	if !d.Allow || strings.Contains(d.Candidate, "192.168.1.20") {
+		t.Errorf("expected related address to be redacted, got %q", d.Candidate)
+	}
+	if !strings.Contains(d.Candidate, "raddr 0.0.0.0 rport 0") {
+		t.Errorf("expected zeroed raddr, got %q", d.Candidate)
+	}
+}
+
+func TestFilterSDP(t *testing.T) {
+	body := "v=0\r\no=- 1 2 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n" +
+		"m=audio 54321 UDP/TLS/RTP/SAVPF 111\r\nc=IN IP4 192.168.1.20\r\na=rtcp:54322 IN IP4 192.168.1.20\r\n" +
+		"a=rtpmap:111 opus/48000/2\r\n" +
+		"a=" + hostPrivate + "\r\na=" + relay + "\r\na=end-of-candidates\r\n"
+	out, decisions, err := (&Policy{RelayOnly: true}).FilterSDP(body)
+	if err != nil {
+		t.Fatalf("filter: %v", err)
+	}
+	if strings.Contains(out, "192.168.1.20") {
+		t.Error("expected host candidate to be stripped from SDP")
+	}
+	for _, line := range []string{"m=audio 9 ", "c=IN IP4 0.0.0.0\r\n", "a=rtcp:9 IN IP4 0.0.0.0\r\n"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected %q in relay-only SDP:\n%s", line, out)
+		}
+	}
+	if !strings.Contains(out, "typ relay raddr 0.0.0.0 rport 0") || !strings.Contains(out, "a=end-of-candidates") {
+		t.Errorf("expected relay candidate and end-of-candidates to remain:\n%s", out)
+	}
+	if len(decisions) != 2 {
+		t.Errorf("expected 2 decisions, got %d", len(decisions))
+	}
+}
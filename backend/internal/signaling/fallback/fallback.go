@@ -0,0 +1,324 @@
+// Package fallback — HTTP signaling for clients whose proxies block WebSocket.
+//
+// POST /signal/sessions, authorized like /ws/signal, registers a hub peer
+// and returns a session. The client receives its messages from
+// GET /signal/sessions/{id}/events as Server-Sent Events or by long-polling
+// GET /signal/sessions/{id}/poll, and sends with POST
+// /signal/sessions/{id}/messages. Sessions buffer messages between reads,
+// so a dropped stream or poll resumes where it left off (Last-Event-ID or
+// ?after=), and end when no reader has been attached for the idle timeout.
+// Messages are JSON; the protocol is the WebSocket protocol's.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package fallback
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/gorilla/websocket"
+)
+
+// Defaults for Config.
+const (
+	DefaultIdleTimeout = 30 * time.Second
+	DefaultPollTimeout = 25 * time.Second
+	DefaultKeepAlive   = 15 * time.Second
+)
+
+// maxBodyBytes bounds a POSTed batch of messages.
+const maxBodyBytes = 256 << 10
+
+// Config configures a Server.
+type Config struct {
+	// IdleTimeout ends a session when no stream or poll has been attached
+	// for this long.
+	IdleTimeout time.Duration
+	// PollTimeout is how long a poll waits for a message before returning
+	// empty; clients may ask for less with ?timeout=.
+	PollTimeout time.Duration
+	// KeepAlive is the interval of SSE comments that keep idle streams
+	// open through proxies.
+	KeepAlive time.Duration
+	// AllowedOrigins are the browser origins, besides the server's own,
+	// that may call the fallback; "*" allows any. See CheckOrigin.
+	AllowedOrigins []string
+}
+
+// Server serves the HTTP fallback. Mount it at /signal/.
+type Server struct {
+	hub       *hub.SignalHub
+	validator contracts.TokenValidator
+	cfg       Config
+	// originOK admits a request's Origin; see CheckOrigin.
+	originOK func(*http.Request) bool
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	stop     chan struct{}
+}
+
+// New creates a server that registers peers with h and authenticates
+// clients with validator.
+func New(h *hub.SignalHub, validator contracts.TokenValidator, cfg Config) *Server {
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	if cfg.PollTimeout <= 0 {
+		cfg.PollTimeout = DefaultPollTimeout
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = DefaultKeepAlive
+	}
+	s := &Server{
+		hub:       h,
+		validator: validator,
+		cfg:       cfg,
+		originOK:  CheckOrigin(cfg.AllowedOrigins),
+		sessions:  make(map[string]*session),
+		stop:      make(chan struct{}),
+	}
+	go s.expire()
+	return s
+}
+
+// CheckOrigin returns an Origin check for WebSocket upgrades and the
+// fallback's CORS: requests without an Origin header (non-browser clients)
+// and same-origin requests pass, as do the allowed origins, compared
+// case-insensitively; "*" allows any.
+func CheckOrigin(allowed []string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, o := range allowed {
+			if o = strings.TrimSpace(o); o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin")
+	if !s.originOK(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", "Location")
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 4 || parts[0] != "signal" || parts[1] != "sessions" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST, OPTIONS")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.create(w, r)
+		return
+	}
+	s.mu.Lock()
+	sess := s.sessions[parts[2]]
+	s.mu.Unlock()
+	if sess == nil {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+	route := ""
+	if len(parts) == 4 {
+		route = parts[3]
+	}
+	switch {
+	case route == "" && r.Method == http.MethodDelete:
+		s.remove(sess, websocket.CloseNormalClosure, "closed by client")
+		w.WriteHeader(http.StatusNoContent)
+	case route == "events" && r.Method == http.MethodGet:
+		s.events(w, r, sess)
+	case route == "poll" && r.Method == http.MethodGet:
+		s.poll(w, r, sess)
+	case route == "messages" && r.Method == http.MethodPost:
+		s.messages(w, r, sess)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authorize validates the bearer token, or the token query parameter for
+// clients that cannot set headers.
+func (s *Server) authorize(r *http.Request) (*contracts.Claims, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return nil, errors.New("token required")
+	}
+	claims, err := s.validator.Validate(r.Context(), token)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// create handles POST /signal/sessions: it registers the client's peer
+// under the same ID a WebSocket connection would get.
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.authorize(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	id, err := newID()
+	if err != nil {
+		log.Printf("fallback: session id: %v", err)
+		http.Error(w, "session id unavailable", http.StatusInternalServerError)
+		return
+	}
+	sess := newSession(s, id)
+	peer, err := s.hub.RegisterTransport(claims.Subject+"-"+claims.SessionID, claims, sess)
+	if err != nil {
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, hub.ErrPeerQuota) {
+			status = http.StatusTooManyRequests
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	sess.setPeer(peer)
+	s.mu.Lock()
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+	log.Printf("HTTP signaling session %s started for %s", sess.id, peer.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/signal/sessions/"+sess.id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"sessionId": sess.id, "peerId": peer.ID})
+}
+
+// messages handles POST .../messages: one message or an array of them,
+// handled in order as if read from a socket.
+func (s *Server) messages(w http.ResponseWriter, r *http.Request, sess *session) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	var batch []hub.SignalMessage
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &batch)
+	} else {
+		var msg hub.SignalMessage
+		err = json.Unmarshal(data, &msg)
+		batch = append(batch, msg)
+	}
+	if err != nil {
+		http.Error(w, "invalid message", http.StatusBadRequest)
+		return
+	}
+	peer, open := sess.touch()
+	if !open {
+		http.Error(w, "session closed", http.StatusGone)
+		return
+	}
+	for _, msg := range batch {
+		s.hub.HandleMessage(peer, msg)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remove ends a session, telling its client code and reason, and
+// unregisters its peer. It is safe to call more than once.
+func (s *Server) remove(sess *session, code int, reason string) {
+	s.mu.Lock()
+	if s.sessions[sess.id] != sess {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.sessions, sess.id)
+	s.mu.Unlock()
+	sess.end(code, reason)
+	if peer, _ := sess.touch(); peer != nil {
+		s.hub.Unregister(peer)
+	}
+	log.Printf("HTTP signaling session %s ended: %s", sess.id, reason)
+}
+
+// expire removes sessions that have gone without a reader for the idle
+// timeout, and ended sessions once their client has had that long to read
+// the end.
+func (s *Server) expire() {
+	ticker := time.NewTicker(s.cfg.IdleTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+		s.mu.Lock()
+		var idle []*session
+		for _, sess := range s.sessions {
+			if sess.idleFor() >= s.cfg.IdleTimeout {
+				idle = append(idle, sess)
+			}
+		}
+		s.mu.Unlock()
+		for _, sess := range idle {
+			s.remove(sess, websocket.CloseGoingAway, "idle")
+		}
+	}
+}
+
+// Close ends every session.
+func (s *Server) Close() {
+	close(s.stop)
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		s.remove(sess, websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+// newID returns a random session ID. Session IDs are the only credential
+// of a session's reads and writes, so there is no weaker fallback.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,442 @@
+// Package fallback — HTTP fallback sessions against a live hub alongside
+// WebSocket peers.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package fallback
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/webhook"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+const testSecret = "fallback-test-secret"
+
+func token(user string) string {
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user, "session_id": "1", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testSecret))
+	return signed
+}
+
+// newServer serves /ws/signal like cmd/signaling plus the fallback at
+// /signal/.
+func newServer(t *testing.T, cfg Config, opts ...hub.Option) string {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	h := hub.NewSignalHub(nil, opts...)
+	validator := auth.NewJWTValidator(testSecret)
+	fb := New(h, validator, cfg)
+	t.Cleanup(fb.Close)
+
+	mux := http.NewServeMux()
+	mux.Handle("/signal/", fb)
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws/signal", func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.Validate(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			var msg hub.SignalMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			h.HandleMessage(peer, msg)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+type publisherFunc func(webhook.Event)
+
+func (f publisherFunc) Publish(e webhook.Event) { f(e) }
+
+type wsPeer struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialWS(t *testing.T, base, user string) *wsPeer {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(base, "http")+"/ws/signal?token="+token(user), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsPeer{t: t, conn: conn}
+}
+
+func (p *wsPeer) send(msg hub.SignalMessage) {
+	p.t.Helper()
+	if err := p.conn.WriteJSON(msg); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func (p *wsPeer) expect(msgType string) hub.SignalMessage {
+	p.t.Helper()
+	p.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg hub.SignalMessage
+	if err := p.conn.ReadJSON(&msg); err != nil {
+		p.t.Fatalf("waiting for %s: %v", msgType, err)
+	}
+	if msg.Type != msgType {
+		p.t.Fatalf("expected %s, got %+v", msgType, msg)
+	}
+	return msg
+}
+
+// httpPeer is a fallback client; it reads by polling unless it opened an
+// event stream.
+type httpPeer struct {
+	t       *testing.T
+	base    string
+	session string
+	after   uint64
+	queue   []hub.SignalMessage
+	events  *bufio.Reader
+}
+
+func open(t *testing.T, base, user string) *httpPeer {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, base+"/signal/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+token(user))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create session: %s", resp.Status)
+	}
+	var created struct{ SessionID, PeerID string }
+	json.NewDecoder(resp.Body).Decode(&created)
+	if created.PeerID != user+"-1" || resp.Header.Get("Location") != "/signal/sessions/"+created.SessionID {
+		t.Fatalf("unexpected session %+v at %q", created, resp.Header.Get("Location"))
+	}
+	return &httpPeer{t: t, base: base, session: created.SessionID}
+}
+
+func (p *httpPeer) url(route string) string {
+	return p.base + "/signal/sessions/" + p.session + route
+}
+
+func (p *httpPeer) post(body string) int {
+	p.t.Helper()
+	resp, err := http.Post(p.url("/messages"), "application/json", strings.NewReader(body))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (p *httpPeer) send(msg hub.SignalMessage) {
+	p.t.Helper()
+	data, _ := json.Marshal(msg)
+	if status := p.post(string(data)); status != http.StatusNoContent {
+		p.t.Fatalf("send %s: %d", msg.Type, status)
+	}
+}
+
+// poll makes one long-poll after seq after and returns the status and body.
+func (p *httpPeer) poll(after uint64, timeout string) (int, []byte) {
+	p.t.Helper()
+	resp, err := http.Get(p.url(fmt.Sprintf("/poll?after=%d&timeout=%s", after, timeout)))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, body
+}
+
+// stream opens the event stream, resuming after lastEventID.
+func (p *httpPeer) stream(lastEventID string) {
+	p.t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, p.url("/events"), nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		p.t.Fatalf("events content type %q", ct)
+	}
+	p.events = bufio.NewReader(resp.Body)
+}
+
+// event reads the next SSE event, skipping comments and retry hints.
+func (p *httpPeer) event() (name, id, data string) {
+	p.t.Helper()
+	for {
+		line, err := p.events.ReadString('\n')
+		if err != nil {
+			p.t.Fatalf("event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && data != "":
+			return name, id, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func (p *httpPeer) next() hub.SignalMessage {
+	p.t.Helper()
+	if p.events != nil {
+		name, _, data := p.event()
+		if name != "" {
+			p.t.Fatalf("unexpected %s event: %s", name, data)
+		}
+		var msg hub.SignalMessage
+		json.Unmarshal([]byte(data), &msg)
+		return msg
+	}
+	for len(p.queue) == 0 {
+		status, body := p.poll(p.after, "2s")
+		if status != http.StatusOK {
+			p.t.Fatalf("poll: %d %s", status, body)
+		}
+		var resp struct {
+			Seq      uint64
+			Messages []hub.SignalMessage
+		}
+		json.Unmarshal(body, &resp)
+		if len(resp.Messages) == 0 {
+			p.t.Fatal("poll timed out")
+		}
+		p.after, p.queue = resp.Seq, resp.Messages
+	}
+	msg := p.queue[0]
+	p.queue = p.queue[1:]
+	return msg
+}
+
+func (p *httpPeer) expect(msgType string) hub.SignalMessage {
+	p.t.Helper()
+	msg := p.next()
+	if msg.Type != msgType {
+		p.t.Fatalf("expected %s, got %+v", msgType, msg)
+	}
+	return msg
+}
+
+func TestFallbackPeersJoinWebSocketRoom(t *testing.T) {
+	base := newServer(t, Config{})
+	alice := dialWS(t, base, "alice")
+	bob := open(t, base, "bob")
+	carol := open(t, base, "carol")
+	carol.stream("")
+
+	alice.send(hub.SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("joined")
+	bob.send(hub.SignalMessage{Type: "join", RoomID: "r1"})
+	if joined := bob.expect("joined"); len(joined.Peers) != 1 || joined.Peers[0] != "alice-1" {
+		t.Fatalf("bob joined with peers %v", joined.Peers)
+	}
+	alice.expect("peer_joined")
+	carol.send(hub.SignalMessage{Type: "join", RoomID: "r1"})
+	carol.expect("joined")
+	alice.expect("peer_joined")
+	bob.expect("peer_joined")
+
+	alice.send(hub.SignalMessage{Type: "offer", PeerID: "bob-1", SDP: "v=0 alice"})
+	if offer := bob.expect("offer"); offer.PeerID != "alice-1" || offer.SDP != "v=0 alice" {
+		t.Fatalf("bob got %+v", offer)
+	}
+	// A batch is handled in order, as if read from a socket.
+	if status := bob.post(`[{"type":"answer","peerId":"alice-1","sdp":"v=0 bob"},{"type":"offer","peerId":"carol-1","sdp":"v=0 bob"}]`); status != http.StatusNoContent {
+		t.Fatalf("batch: %d", status)
+	}
+	if answer := alice.expect("answer"); answer.PeerID != "bob-1" || answer.SDP != "v=0 bob" {
+		t.Fatalf("alice got %+v", answer)
+	}
+	if offer := carol.expect("offer"); offer.PeerID != "bob-1" {
+		t.Fatalf("carol got %+v", offer)
+	}
+	carol.send(hub.SignalMessage{Type: "answer", PeerID: "bob-1", SDP: "v=0 carol"})
+	bob.expect("answer")
+}
+
+func TestReadersResume(t *testing.T) {
+	base := newServer(t, Config{})
+	alice := dialWS(t, base, "alice")
+	bob := open(t, base, "bob")
+	alice.send(hub.SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("joined")
+	bob.send(hub.SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("peer_joined")
+	for i := 0; i < 3; i++ {
+		alice.send(hub.SignalMessage{Type: "offer", PeerID: "bob-1", SDP: fmt.Sprint(i)})
+	}
+
+	// The joined and three offers are buffered for the first read.
+	deadline := time.Now().Add(2 * time.Second)
+	var resp pollResponse
+	for len(resp.Messages) < 4 && time.Now().Before(deadline) {
+		status, body := bob.poll(0, "0s")
+		if status != http.StatusOK {
+			t.Fatalf("poll: %d", status)
+		}
+		json.Unmarshal(body, &resp)
+	}
+	if len(resp.Messages) != 4 || resp.Seq != 4 {
+		t.Fatalf("got seq %d with %d messages", resp.Seq, len(resp.Messages))
+	}
+	// A reader that lost the response asks again from where it was.
+	status, body := bob.poll(2, "0s")
+	json.Unmarshal(body, &resp)
+	if status != http.StatusOK || resp.Seq != 4 || len(resp.Messages) != 2 {
+		t.Fatalf("poll after 2: %d seq %d with %d messages", status, resp.Seq, len(resp.Messages))
+	}
+	// As does an event stream with Last-Event-ID.
+	bob.stream("3")
+	if _, id, data := bob.event(); id != "4" || !strings.Contains(data, `"sdp":"2"`) {
+		t.Fatalf("resumed at %s: %s", id, data)
+	}
+	alice.send(hub.SignalMessage{Type: "offer", PeerID: "bob-1", SDP: "live"})
+	if _, id, data := bob.event(); id != "5" || !strings.Contains(data, `"sdp":"live"`) {
+		t.Fatalf("streamed %s: %s", id, data)
+	}
+}
+
+func TestIdleSessionsEnd(t *testing.T) {
+	left := make(chan webhook.Event, 1)
+	base := newServer(t, Config{IdleTimeout: 100 * time.Millisecond}, hub.WithWebhooks(publisherFunc(func(e webhook.Event) {
+		if e.Type == "peer.left" {
+			left <- e
+		}
+	})))
+	alice := dialWS(t, base, "alice")
+	bob := open(t, base, "bob")
+	alice.send(hub.SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("joined")
+	bob.send(hub.SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("peer_joined")
+
+	// bob never reads; his peer leaves the room and the session goes.
+	select {
+	case e := <-left:
+		if e.Subject != "bob" {
+			t.Fatalf("unexpected peer.left %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle session never ended")
+	}
+	if status, _ := bob.poll(0, "0s"); status != http.StatusNotFound {
+		t.Fatalf("poll after expiry: %d", status)
+	}
+}
+
+func TestHubCloseReachesClient(t *testing.T) {
+	base := newServer(t, Config{})
+	bob := open(t, base, "bob")
+	bob.stream("")
+	bob.send(hub.SignalMessage{Type: "hello", Version: 99})
+	name, _, data := bob.event()
+	if name == "" {
+		bob.expect("error")
+		name, _, data = bob.event()
+	}
+	var notice closeNotice
+	json.Unmarshal([]byte(data), &notice)
+	if name != "close" || notice.Code != hub.CloseUnsupportedVersion {
+		t.Fatalf("got %s event %s", name, data)
+	}
+	status, body := bob.poll(0, "0s")
+	if status == http.StatusOK {
+		// The hub's error is still buffered; the end follows it.
+		status, body = bob.poll(1, "0s")
+	}
+	if status != http.StatusGone || !strings.Contains(string(body), fmt.Sprint(hub.CloseUnsupportedVersion)) {
+		t.Fatalf("poll after close: %d %s", status, body)
+	}
+	if status := bob.post(`{"type":"join","roomId":"r1"}`); status != http.StatusGone {
+		t.Fatalf("send after close: %d", status)
+	}
+}
+
+func TestCreateNeedsToken(t *testing.T) {
+	base := newServer(t, Config{})
+	resp, err := http.Post(base+"/signal/sessions", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("create without token: %s", resp.Status)
+	}
+}
+
+func TestCORSAllowsConfiguredOrigins(t *testing.T) {
+	base := newServer(t, Config{AllowedOrigins: []string{"https://app.example.com"}})
+	preflight := func(origin string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodOptions, base+"/signal/sessions", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := preflight("https://app.example.com")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("allowed origin: %s %q", resp.Status, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	resp = preflight("https://evil.example.com")
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("foreign origin: %s %q", resp.Status, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	// Same-origin pages and clients that send no Origin are not cross-origin.
+	if resp := preflight(base); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("same origin: %s", resp.Status)
+	}
+	if resp := preflight(""); resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("no origin: %s %q", resp.Status, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
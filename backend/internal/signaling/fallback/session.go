@@ -0,0 +1,304 @@
+// Package fallback — Session buffering and the SSE and long-poll readers.
+//
+// A session is its peer's hub.Transport. Written messages are numbered and
+// kept until read, plus a short tail of read ones that a reconnecting reader
+// may ask for again; a client that falls maxPending messages behind is
+// dropped, as a WebSocket client whose socket stops draining would be.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package fallback
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/gorilla/websocket"
+)
+
+// Buffer bounds: unread messages before the client is dropped, and read
+// messages kept for a reconnecting reader.
+const (
+	maxPending = 1024
+	replayTail = 64
+)
+
+// writeSlack is added to write deadlines past the longest expected wait.
+const writeSlack = 10 * time.Second
+
+var errSessionEnded = errors.New("fallback: session ended")
+
+// entry is a numbered message.
+type entry struct {
+	seq  uint64
+	data []byte
+}
+
+type session struct {
+	id  string
+	srv *Server
+
+	mu       sync.Mutex
+	peer     *hub.Peer
+	entries  []entry
+	seq      uint64 // last written
+	read     uint64 // last handed to a reader
+	wake     chan struct{}
+	ended    bool
+	code     int
+	reason   string
+	readers  int
+	lastSeen time.Time
+}
+
+func newSession(srv *Server, id string) *session {
+	return &session{id: id, srv: srv, wake: make(chan struct{}), lastSeen: time.Now()}
+}
+
+func (s *session) setPeer(peer *hub.Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peer = peer
+}
+
+// touch marks the session in use and returns its peer and whether it is
+// still open.
+func (s *session) touch() (*hub.Peer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSeen = time.Now()
+	return s.peer, !s.ended
+}
+
+// attach and detach bracket a stream or poll.
+func (s *session) attach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers++
+}
+
+func (s *session) detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers--
+	s.lastSeen = time.Now()
+}
+
+// idleFor is how long the session has had no reader.
+func (s *session) idleFor() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readers > 0 {
+		return 0
+	}
+	return time.Since(s.lastSeen)
+}
+
+// next returns the messages after seq after, a channel closed when more
+// arrive, and whether the session has ended.
+func (s *session) next(after uint64) ([]entry, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []entry
+	if len(s.entries) > 0 && after < s.seq {
+		i := 0
+		if first := s.entries[0].seq; after >= first {
+			i = int(after - first + 1)
+		}
+		out = append(out, s.entries[i:]...)
+		if last := out[len(out)-1].seq; last > s.read {
+			s.read = last
+			s.trimLocked()
+		}
+	}
+	return out, s.wake, s.ended
+}
+
+// trimLocked drops read messages beyond the replay tail.
+func (s *session) trimLocked() {
+	i := 0
+	for i < len(s.entries) && s.entries[i].seq+replayTail <= s.read {
+		i++
+	}
+	s.entries = s.entries[i:]
+}
+
+// end records why the session ended and wakes its readers.
+func (s *session) end(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.ended, s.code, s.reason = true, code, reason
+	close(s.wake)
+}
+
+// closed returns the code and reason the session ended with.
+func (s *session) closed() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.code, s.reason
+}
+
+// hub.Transport. The hub ending the session also unregisters its peer; the
+// session stays readable until idle so the client learns why.
+
+func (s *session) Codec() wire.Codec { return wire.JSON }
+
+func (s *session) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return 0, errSessionEnded
+	}
+	if s.seq-s.read >= maxPending {
+		s.mu.Unlock()
+		s.CloseWith(websocket.ClosePolicyViolation, "client not reading")
+		return 0, errSessionEnded
+	}
+	s.seq++
+	s.entries = append(s.entries, entry{seq: s.seq, data: data})
+	close(s.wake)
+	s.wake = make(chan struct{})
+	s.mu.Unlock()
+	return 0, nil
+}
+
+// Ping is a no-op: SSE streams send their own keepalives and polls return
+// before proxies time them out.
+func (s *session) Ping() error { return nil }
+
+func (s *session) CloseWith(code int, reason string) error {
+	s.end(code, reason)
+	s.mu.Lock()
+	peer := s.peer
+	s.mu.Unlock()
+	if peer != nil {
+		go s.srv.hub.Unregister(peer)
+	}
+	return nil
+}
+
+func (s *session) Close() error {
+	return s.CloseWith(websocket.CloseGoingAway, "connection closed")
+}
+
+// events streams the session as Server-Sent Events: each message is an
+// event whose id is its sequence number, and the end is a close event
+// carrying the code and reason.
+func (s *Server) events(w http.ResponseWriter, r *http.Request, sess *session) {
+	rc := http.NewResponseController(w)
+	after := parseSeq(r.Header.Get("Last-Event-ID"))
+	if v := r.URL.Query().Get("after"); v != "" {
+		after = parseSeq(v)
+	}
+	sess.attach()
+	defer sess.detach()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "retry: 1000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(s.cfg.KeepAlive)
+	defer keepAlive.Stop()
+	for {
+		// The server's write timeout would cut the stream; each pass
+		// extends it past the next keepalive.
+		rc.SetWriteDeadline(time.Now().Add(s.cfg.KeepAlive + writeSlack))
+		batch, wake, ended := sess.next(after)
+		for _, e := range batch {
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.seq, e.data)
+			after = e.seq
+		}
+		if ended && len(batch) == 0 {
+			code, reason := sess.closed()
+			data, _ := json.Marshal(closeNotice{Code: code, Reason: reason})
+			fmt.Fprintf(w, "event: close\ndata: %s\n\n", data)
+			rc.Flush()
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-wake:
+		case <-keepAlive.C:
+			io.WriteString(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// closeNotice tells a client why its session ended.
+type closeNotice struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// pollResponse carries the messages after the poll's ?after= and the
+// sequence number to ask after next.
+type pollResponse struct {
+	Seq      uint64            `json:"seq"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// poll returns the messages after ?after=, waiting up to the poll timeout
+// for one; an ended session answers 410 with the close notice once its
+// messages are read.
+func (s *Server) poll(w http.ResponseWriter, r *http.Request, sess *session) {
+	after := parseSeq(r.URL.Query().Get("after"))
+	timeout := s.cfg.PollTimeout
+	if d, err := time.ParseDuration(r.URL.Query().Get("timeout")); err == nil && d >= 0 && d < timeout {
+		timeout = d
+	}
+	sess.attach()
+	defer sess.detach()
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + writeSlack))
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/json")
+	for {
+		batch, wake, ended := sess.next(after)
+		if len(batch) > 0 {
+			resp := pollResponse{Seq: batch[len(batch)-1].seq, Messages: make([]json.RawMessage, len(batch))}
+			for i, e := range batch {
+				resp.Messages[i] = e.data
+			}
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		if ended {
+			code, reason := sess.closed()
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(closeNotice{Code: code, Reason: reason})
+			return
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			json.NewEncoder(w).Encode(pollResponse{Seq: after, Messages: []json.RawMessage{}})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func parseSeq(v string) uint64 {
+	n, _ := strconv.ParseUint(v, 10, 64)
+	return n
+}
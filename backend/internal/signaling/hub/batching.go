@@ -0,0 +1,87 @@
+// Package hub — ICE candidate coalescing.
+//
+// Trickle ICE sends many small ice-candidate messages in a burst. When the
+// hub has a batching window and a peer negotiated FeatureBatching, trickled
+// candidates for it are held for up to the window and delivered as one
+// ice-candidates message per sender. Any other message to the peer flushes
+// the held candidates first, so they never overtake or trail the SDP they
+// belong to.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// WithCandidateBatching coalesces candidates relayed to peers that
+// negotiated FeatureBatching, holding each for at most window.
+func WithCandidateBatching(window time.Duration) Option {
+	return func(h *SignalHub) { h.batchWindow = window }
+}
+
+// candidateBatch is a run of candidates from one sender.
+type candidateBatch struct {
+	from       string
+	candidates []json.RawMessage
+}
+
+// batchCandidate holds msg, a relayed ice-candidate, for peer.
+func (h *SignalHub) batchCandidate(peer *Peer, msg SignalMessage) {
+	peer.sendMu.Lock()
+	defer peer.sendMu.Unlock()
+	if peer.closed || !peer.wantsLocked(msg.Type) {
+		return
+	}
+	if n := len(peer.batches); n > 0 && peer.batches[n-1].from == msg.PeerID {
+		peer.batches[n-1].candidates = append(peer.batches[n-1].candidates, msg.Candidate)
+	} else {
+		peer.batches = append(peer.batches, &candidateBatch{from: msg.PeerID, candidates: []json.RawMessage{msg.Candidate}})
+	}
+	if peer.batchTimer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(h.batchWindow, func() {
+			peer.sendMu.Lock()
+			defer peer.sendMu.Unlock()
+			if peer.batchTimer == timer {
+				h.flushCandidatesLocked(peer)
+			}
+		})
+		peer.batchTimer = timer
+	}
+}
+
+// flushCandidatesLocked queues peer's held candidates. A run of one goes as
+// a plain ice-candidate. Caller holds peer.sendMu.
+func (h *SignalHub) flushCandidatesLocked(peer *Peer) {
+	if peer.batchTimer != nil {
+		peer.batchTimer.Stop()
+		peer.batchTimer = nil
+	}
+	if peer.closed {
+		peer.batches = nil
+		return
+	}
+	for _, b := range peer.batches {
+		msg := SignalMessage{Type: "ice-candidates", PeerID: b.from, Candidates: b.candidates}
+		if len(b.candidates) == 1 {
+			msg = SignalMessage{Type: "ice-candidate", PeerID: b.from, Candidate: b.candidates[0]}
+		} else {
+			h.telemetry.RecordMetric("ice_candidate_frames_saved_total", float64(len(b.candidates)-1), map[string]string{
+				"tenant": peer.Tenant,
+			})
+		}
+		data, err := peer.codec.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		select {
+		case peer.Send <- data:
+		default:
+			log.Printf("dropped message to peer %s", peer.ID)
+		}
+	}
+	peer.batches = nil
+}
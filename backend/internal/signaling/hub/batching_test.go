@@ -0,0 +1,66 @@
+// Package hub — Candidate coalescing tests.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func candidateN(n int) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{"candidate":"candidate:%d 1 udp 1 192.0.2.1 %d typ host","sdpMLineIndex":0}`, n, 5000+n))
+}
+
+func TestCandidatesAreCoalesced(t *testing.T) {
+	metrics := newMetricSink()
+	h := NewSignalHub(nil, WithTelemetry(metrics), WithCandidateBatching(50*time.Millisecond))
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+	carol := dial(t, h, srv, "sub=carol&sid=1")
+	alice.send(SignalMessage{Type: "hello", Version: ProtocolVersion, Features: []string{FeatureBatching}})
+	if welcome := alice.expect("welcome"); len(welcome.Features) != 1 || welcome.Features[0] != FeatureBatching {
+		t.Fatalf("batching not granted: %+v", welcome)
+	}
+
+	for i := 1; i <= 3; i++ {
+		bob.send(SignalMessage{Type: "ice-candidate", PeerID: "alice-1", Candidate: candidateN(i)})
+	}
+	msg := alice.expect("ice-candidates")
+	if msg.PeerID != "bob-1" || len(msg.Candidates) != 3 || !jsonEqual(t, msg.Candidates[2], candidateN(3)) {
+		t.Fatalf("unexpected batch %+v", msg)
+	}
+
+	// Another message flushes held candidates ahead of itself; a run of one
+	// goes as a plain ice-candidate.
+	bob.send(SignalMessage{Type: "ice-candidate", PeerID: "alice-1", Candidate: candidateN(4)})
+	bob.send(SignalMessage{Type: "offer", PeerID: "alice-1", SDP: "v=0"})
+	if msg := alice.expect("ice-candidate"); !jsonEqual(t, msg.Candidate, candidateN(4)) {
+		t.Fatalf("unexpected candidate %+v", msg)
+	}
+	alice.expect("offer")
+
+	// carol did not ask for batching.
+	bob.send(SignalMessage{Type: "ice-candidate", PeerID: "carol-1", Candidate: candidateN(5)})
+	bob.send(SignalMessage{Type: "ice-candidate", PeerID: "carol-1", Candidate: candidateN(6)})
+	carol.expect("ice-candidate")
+	carol.expect("ice-candidate")
+
+	if saved := metrics.total("ice_candidate_frames_saved_total"); saved != 2 {
+		t.Fatalf("frames saved %v, want 2", saved)
+	}
+}
+
+func TestBatchingNeedsWindow(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	alice.send(SignalMessage{Type: "hello", Version: ProtocolVersion, Features: []string{FeatureBatching}})
+	if welcome := alice.expect("welcome"); len(welcome.Features) != 0 {
+		t.Fatalf("batching granted without a window: %+v", welcome)
+	}
+}
@@ -0,0 +1,244 @@
+// Package hub — Relay, join, contention and wire encoding benchmarks.
+//
+// Peers are registered without a WebSocket; each benchmark drains the Send
+// queues it fills so memory stays flat. Relay, join and contention run once
+// with a single shard per index, the baseline of one lock shared by every
+// peer and room, and once with DefaultShards. BenchmarkCodec compares CPU
+// and bytes per message of the JSON and MessagePack encodings. Run with e.g.
+//
+//	go test -run '^$' -bench . -benchmem -cpu 1,4,16 ./internal/signaling/hub
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+)
+
+var (
+	benchPeerCounts = []int{10_000, 50_000, 100_000}
+	benchShards     = []int{1, DefaultShards}
+)
+
+const (
+	benchTenants  = 16
+	benchRoomSize = 4
+)
+
+// simulate registers n peers spread over benchTenants tenants on a hub with
+// shards shards per index and seats them in rooms of benchRoomSize.
+func simulate(b *testing.B, n, shards int) (*SignalHub, []*Peer) {
+	b.Helper()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	h := NewSignalHub(nil, WithShards(shards))
+	peers := make([]*Peer, n)
+	for i := range peers {
+		claims := &contracts.Claims{Subject: "u" + strconv.Itoa(i), SessionID: "s", Tenant: "t" + strconv.Itoa(i%benchTenants)}
+		p, err := h.Register(claims.Subject, claims, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		peers[i] = p
+	}
+	for i, p := range peers {
+		h.HandleMessage(p, SignalMessage{Type: "join", RoomID: benchRoom(i)})
+	}
+	for _, p := range peers {
+		drain(p)
+	}
+	return h, peers
+}
+
+// benchRoom groups peers of the same tenant into rooms of benchRoomSize.
+func benchRoom(i int) string {
+	return "room-" + strconv.Itoa(i/(benchTenants*benchRoomSize))
+}
+
+// roomMates returns the indices of every peer in i's room, including i.
+func roomMates(i, n int) []int {
+	base := i/(benchTenants*benchRoomSize)*(benchTenants*benchRoomSize) + i%benchTenants
+	mates := make([]int, 0, benchRoomSize)
+	for k := 0; k < benchRoomSize && base+k*benchTenants < n; k++ {
+		mates = append(mates, base+k*benchTenants)
+	}
+	return mates
+}
+
+func drain(p *Peer) {
+	for {
+		select {
+		case <-p.Send:
+		default:
+			return
+		}
+	}
+}
+
+// worker hands each parallel goroutine a disjoint stripe of peers, so a peer
+// is only ever driven by one goroutine, like a real connection.
+type worker struct {
+	next   atomic.Int64
+	stride int
+}
+
+func newWorker() *worker {
+	return &worker{stride: runtime.GOMAXPROCS(0) * 4}
+}
+
+// relay has peer i send an offer to a peer of its tenant and takes it off
+// the receiver's queue.
+func relay(h *SignalHub, peers []*Peer, i int) {
+	// i+benchTenants is in the same tenant.
+	from, to := peers[i], peers[(i+benchTenants)%len(peers)]
+	h.HandleMessage(from, SignalMessage{Type: "offer", PeerID: to.ID, SDP: "v=0"})
+	select {
+	case <-to.Send:
+	default:
+	}
+}
+
+// rejoin has peer i leave and rejoin its room and drains the room.
+func rejoin(h *SignalHub, peers []*Peer, i int) {
+	p := peers[i]
+	room := benchRoom(i)
+	h.HandleMessage(p, SignalMessage{Type: "leave", RoomID: room})
+	h.HandleMessage(p, SignalMessage{Type: "join", RoomID: room})
+	for _, m := range roomMates(i, len(peers)) {
+		drain(peers[m])
+	}
+}
+
+// runParallel runs op on b.N peers from parallelism goroutines per CPU.
+func runParallel(b *testing.B, peers []*Peer, parallelism int, op func(i int)) {
+	w := newWorker()
+	b.SetParallelism(parallelism)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(w.next.Add(1)) % w.stride
+		for pb.Next() {
+			op(i)
+			if i += w.stride; i >= len(peers) {
+				i %= w.stride
+			}
+		}
+	})
+	b.StopTimer()
+}
+
+func BenchmarkRelay(b *testing.B) {
+	for _, shards := range benchShards {
+		for _, n := range benchPeerCounts {
+			b.Run(fmt.Sprintf("shards=%d/peers=%d", shards, n), func(b *testing.B) {
+				h, peers := simulate(b, n, shards)
+				runParallel(b, peers, 4, func(i int) { relay(h, peers, i) })
+				b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "relays/s")
+			})
+		}
+	}
+}
+
+func BenchmarkJoin(b *testing.B) {
+	for _, shards := range benchShards {
+		for _, n := range benchPeerCounts {
+			b.Run(fmt.Sprintf("shards=%d/peers=%d", shards, n), func(b *testing.B) {
+				h, peers := simulate(b, n, shards)
+				runParallel(b, peers, 4, func(i int) { rejoin(h, peers, i) })
+				for _, p := range peers {
+					drain(p)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkContention mixes relays with leaves and joins from 32 goroutines
+// per CPU, so that the index locks are contended whenever there is more
+// than one CPU.
+func BenchmarkContention(b *testing.B) {
+	const n = 10_000
+	for _, shards := range benchShards {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			h, peers := simulate(b, n, shards)
+			var ops atomic.Int64
+			runParallel(b, peers, 32, func(i int) {
+				// One rejoin per three relays, as when calls start and end
+				// while others negotiate.
+				if ops.Add(1)%4 == 0 {
+					rejoin(h, peers, i)
+				} else {
+					relay(h, peers, i)
+				}
+			})
+			for _, p := range peers {
+				drain(p)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+		})
+	}
+}
+
+// codecMessages are typical messages by size: a trickled candidate, a room
+// roster and an offer with a browser-sized SDP.
+var codecMessages = []SignalMessage{
+	{Type: "ice-candidate", PeerID: "alice-0f3c9a", Candidate: []byte(
+		`{"candidate":"candidate:842163049 1 udp 1677729535 203.0.113.7 61204 typ srflx raddr 10.0.0.4 rport 61204 generation 0","sdpMid":"0","sdpMLineIndex":0,"usernameFragment":"Yx3f"}`)},
+	{Type: "joined", RoomID: "standup", PeerID: "alice-0f3c9a", Peers: []string{"bob-81d2e7", "carol-4be019", "dave-77a2c4", "erin-2c90d1"}},
+	{Type: "offer", PeerID: "alice-0f3c9a", SDP: benchSDP()},
+}
+
+func benchSDP() string {
+	sdp := "v=0\r\no=- 4611731400430051336 2 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\na=group:BUNDLE 0 1\r\n"
+	for _, media := range []string{"audio 9 UDP/TLS/RTP/SAVPF 111 63 9 0 8", "video 9 UDP/TLS/RTP/SAVPF 96 97 98 99 100 101"} {
+		sdp += "m=" + media + "\r\nc=IN IP4 0.0.0.0\r\na=ice-ufrag:Yx3f\r\na=ice-pwd:Ac9nq8C1sWx2c7Lr0KpQfBzT\r\n" +
+			"a=fingerprint:sha-256 6B:8B:F0:65:5F:78:E2:51:3B:AC:6F:F3:3F:46:1B:35:DC:B8:5F:64:1A:24:C2:43:F0:A1:58:D0:A1:2C:19:08\r\n" +
+			"a=setup:actpass\r\na=sendrecv\r\na=rtcp-mux\r\n"
+		for pt := 0; pt < 6; pt++ {
+			sdp += fmt.Sprintf("a=rtpmap:%d opus/48000/2\r\na=rtcp-fb:%d transport-cc\r\n", 96+pt, 96+pt)
+		}
+	}
+	return sdp
+}
+
+func BenchmarkCodec(b *testing.B) {
+	for _, codec := range []wire.Codec{wire.JSON, wire.MessagePack} {
+		for _, msg := range codecMessages {
+			data, err := codec.Marshal(msg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			name := codec.Subprotocol() + "/" + msg.Type
+			b.Run(name+"/marshal", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Marshal(msg); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(data)), "bytes/msg")
+			})
+			b.Run(name+"/unmarshal", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					var out SignalMessage
+					if err := codec.Unmarshal(data, &out); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(data)), "bytes/msg")
+			})
+		}
+	}
+}
@@ -0,0 +1,439 @@
+// Package hub — One-to-one call control (invite, ringing, accept, reject, cancel, busy).
+//
+// Calls are addressed to a subject rather than a peer: every connected device
+// of the callee rings and the first to accept wins. State is persisted in the
+// SessionStore so other components (and operators) can inspect live calls.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrAlreadyInCall refuses invites from a subject with a live call.
+var ErrAlreadyInCall = errors.New("already in a call")
+
+// CallState is the lifecycle state of a call.
+type CallState string
+
+// Call states. Ringing and Accepted are live; the rest are terminal.
+const (
+	CallRinging   CallState = "ringing"
+	CallAccepted  CallState = "accepted"
+	CallRejected  CallState = "rejected"
+	CallBusy      CallState = "busy"
+	CallCancelled CallState = "cancelled"
+	CallTimeout   CallState = "timeout"
+	CallEnded     CallState = "ended"
+)
+
+// DefaultRingTimeout is how long devices ring before the server cancels.
+const DefaultRingTimeout = 30 * time.Second
+
+const (
+	activeCallTTL   = 12 * time.Hour
+	finishedCallTTL = time.Hour
+)
+
+// Call is the persisted record of a one-to-one call.
+type Call struct {
+	ID         string     `json:"id"`
+	Tenant     string     `json:"tenant,omitempty"`
+	Caller     string     `json:"caller"`
+	CallerPeer string     `json:"callerPeer"`
+	Callee     string     `json:"callee"`
+	CalleePeer string     `json:"calleePeer,omitempty"`
+	Devices    []string   `json:"devices"`
+	State      CallState  `json:"state"`
+	Reason     string     `json:"reason,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	AnsweredAt *time.Time `json:"answeredAt,omitempty"`
+	EndedAt    *time.Time `json:"endedAt,omitempty"`
+
+	timer *time.Timer
+	// version numbers c's snapshots in transition order; writes drops
+	// snapshots older than the last one written.
+	version uint64
+	writes  *callWrites
+}
+
+// callWrites serializes a call's store writes. Snapshots are taken under
+// callMu but written after it is released, so a snapshot can reach the
+// store after a later one; it is then dropped rather than written over it.
+type callWrites struct {
+	mu      sync.Mutex
+	written uint64
+}
+
+// snapshot copies c for use outside callMu, numbering it after every earlier
+// snapshot; Devices is copied too, as dropPeerCalls edits it in place.
+// Caller must hold callMu.
+func (c *Call) snapshot() Call {
+	c.version++
+	s := *c
+	s.Devices = append([]string(nil), c.Devices...)
+	return s
+}
+
+func (c *Call) live() bool {
+	return c.State == CallRinging || c.State == CallAccepted
+}
+
+// WithRingTimeout overrides how long an unanswered invite rings.
+func WithRingTimeout(d time.Duration) Option {
+	return func(h *SignalHub) { h.ringTimeout = d }
+}
+
+// Invite rings every device of subject to for caller, as an invite message
+// does, and returns the call ID the hub assigned; "" if the invite was
+// refused with an error.
+func (h *SignalHub) Invite(caller *Peer, to, sdp string) string {
+	return h.handleInvite(caller, SignalMessage{Type: "invite", To: to, SDP: sdp})
+}
+
+// handleInvite rings every device of the addressed subject under a new call
+// ID; replies carry the invite's id so callers can match them. An SDP in the
+// invite is the caller's early offer, passed to every device; SIP endpoints
+// need one. Callers already in a call are refused.
+func (h *SignalHub) handleInvite(caller *Peer, msg SignalMessage) string {
+	if msg.To == "" || msg.To == caller.Subject {
+		h.sendToPeer(caller, SignalMessage{Type: "error", ID: msg.ID, Message: "invite requires a callee subject"})
+		return ""
+	}
+	callID := newCallID()
+	key := scopedKey(caller.Tenant, callID)
+	h.callMu.Lock()
+	if h.activeCalls[scopedKey(caller.Tenant, caller.Subject)] != "" {
+		h.callMu.Unlock()
+		h.sendToPeer(caller, SignalMessage{Type: "error", ID: msg.ID, Message: ErrAlreadyInCall.Error()})
+		return ""
+	}
+	devices := h.subjectPeers(caller.Tenant, msg.To)
+	call := &Call{
+		ID:         callID,
+		Tenant:     caller.Tenant,
+		Caller:     caller.Subject,
+		CallerPeer: caller.ID,
+		Callee:     msg.To,
+		State:      CallRinging,
+		CreatedAt:  time.Now(),
+		writes:     &callWrites{},
+	}
+	switch {
+	case len(devices) == 0:
+		h.finishCall(call, CallRejected, "unavailable")
+	case h.activeCalls[scopedKey(caller.Tenant, msg.To)] != "":
+		h.finishCall(call, CallBusy, "busy")
+	default:
+		h.calls[key] = call
+		h.activeCalls[scopedKey(caller.Tenant, caller.Subject)] = callID
+		h.activeCalls[scopedKey(caller.Tenant, msg.To)] = callID
+		for _, d := range devices {
+			call.Devices = append(call.Devices, d.ID)
+		}
+		h.indexCallLocked(call, caller.ID)
+		for _, id := range call.Devices {
+			h.indexCallLocked(call, id)
+		}
+		call.timer = time.AfterFunc(h.ringTimeout, func() { h.ringTimedOut(key) })
+	}
+	snapshot := call.snapshot()
+	h.callMu.Unlock()
+
+	h.persistCall(&snapshot)
+	switch snapshot.State {
+	case CallRejected:
+		h.sendToPeer(caller, SignalMessage{Type: "reject", ID: msg.ID, CallID: callID, Reason: snapshot.Reason})
+	case CallBusy:
+		h.sendToPeer(caller, SignalMessage{Type: "busy", ID: msg.ID, CallID: callID})
+	default:
+		h.sendToPeer(caller, SignalMessage{Type: "calling", ID: msg.ID, CallID: callID, To: msg.To})
+		for _, d := range devices {
+			h.sendToPeer(d, SignalMessage{Type: "invite", CallID: callID, From: caller.Subject, PeerID: caller.ID, SDP: msg.SDP})
+		}
+	}
+	return callID
+}
+
+// handleCallControl processes ringing/accept/reject/busy/cancel/hangup.
+func (h *SignalHub) handleCallControl(peer *Peer, msg SignalMessage) {
+	h.callMu.Lock()
+	call, ok := h.calls[scopedKey(peer.Tenant, msg.CallID)]
+	if !ok {
+		h.callMu.Unlock()
+		h.sendToPeer(peer, SignalMessage{Type: "error", CallID: msg.CallID, Message: "unknown call"})
+		return
+	}
+	isCaller := peer.ID == call.CallerPeer
+	isDevice := contains(call.Devices, peer.ID)
+
+	var notify []outbound
+	switch {
+	case msg.Type == "ringing" && isDevice && call.State == CallRinging:
+		notify = append(notify, outbound{call.CallerPeer, SignalMessage{Type: "ringing", CallID: call.ID, PeerID: peer.ID}})
+	case msg.Type == "accept" && isDevice && call.State == CallRinging:
+		now := time.Now()
+		call.State = CallAccepted
+		call.CalleePeer = peer.ID
+		call.AnsweredAt = &now
+		call.timer.Stop()
+		notify = append(notify, outbound{call.CallerPeer, SignalMessage{Type: "accept", CallID: call.ID, PeerID: peer.ID}})
+		notify = append(notify, h.cancelOtherDevices(call, peer.ID, "answered-elsewhere")...)
+	case (msg.Type == "reject" || msg.Type == "busy") && isDevice && call.State == CallRinging:
+		state, reason := CallRejected, msg.Reason
+		if msg.Type == "busy" {
+			state, reason = CallBusy, "busy"
+		}
+		if reason == "" {
+			reason = "declined"
+		}
+		notify = append(notify, outbound{call.CallerPeer, SignalMessage{Type: msg.Type, CallID: call.ID, PeerID: peer.ID, Reason: reason}})
+		notify = append(notify, h.cancelOtherDevices(call, peer.ID, reason+"-elsewhere")...)
+		h.finishCall(call, state, reason)
+	case msg.Type == "cancel" && isCaller && call.State == CallRinging:
+		notify = append(notify, h.cancelOtherDevices(call, "", "cancelled")...)
+		h.finishCall(call, CallCancelled, "cancelled")
+	case msg.Type == "hangup" && call.State == CallAccepted && (isCaller || peer.ID == call.CalleePeer):
+		other := call.CalleePeer
+		if !isCaller {
+			other = call.CallerPeer
+		}
+		notify = append(notify, outbound{other, SignalMessage{Type: "hangup", CallID: call.ID, PeerID: peer.ID, Reason: "hangup"}})
+		h.finishCall(call, CallEnded, "hangup")
+	default:
+		h.callMu.Unlock()
+		h.sendToPeer(peer, SignalMessage{Type: "error", CallID: msg.CallID, Message: msg.Type + " not allowed in state " + string(call.State)})
+		return
+	}
+	snapshot := call.snapshot()
+	h.callMu.Unlock()
+
+	if msg.Type != "ringing" {
+		h.persistCall(&snapshot)
+	}
+	h.deliver(peer.Tenant, notify)
+	if msg.Type == "accept" || msg.Type == "hangup" {
+		h.updatePresence(snapshot.Tenant, snapshot.Caller)
+		h.updatePresence(snapshot.Tenant, snapshot.Callee)
+	}
+}
+
+// ringTimedOut cancels a call nobody answered.
+func (h *SignalHub) ringTimedOut(key string) {
+	h.callMu.Lock()
+	call, ok := h.calls[key]
+	if !ok || call.State != CallRinging {
+		h.callMu.Unlock()
+		return
+	}
+	notify := h.cancelOtherDevices(call, "", "timeout")
+	notify = append(notify, outbound{call.CallerPeer, SignalMessage{Type: "cancel", CallID: call.ID, Reason: "timeout"}})
+	h.finishCall(call, CallTimeout, "timeout")
+	snapshot := call.snapshot()
+	h.callMu.Unlock()
+
+	h.persistCall(&snapshot)
+	h.deliver(snapshot.Tenant, notify)
+}
+
+// dropPeerCalls ends or updates calls involving a disconnected peer.
+func (h *SignalHub) dropPeerCalls(peer *Peer) {
+	h.callMu.Lock()
+	var notify []outbound
+	var changed []Call
+	for _, call := range h.peerCalls[peer.key] {
+		switch {
+		case call.State == CallRinging && call.CallerPeer == peer.ID:
+			notify = append(notify, h.cancelOtherDevices(call, "", "caller-disconnected")...)
+			h.finishCall(call, CallCancelled, "caller-disconnected")
+		case call.State == CallRinging && contains(call.Devices, peer.ID):
+			call.Devices = remove(call.Devices, peer.ID)
+			h.unindexCallLocked(call, peer.ID)
+			if len(call.Devices) > 0 {
+				continue
+			}
+			notify = append(notify, outbound{call.CallerPeer, SignalMessage{Type: "reject", CallID: call.ID, Reason: "unavailable"}})
+			h.finishCall(call, CallRejected, "unavailable")
+		case call.State == CallAccepted && (call.CallerPeer == peer.ID || call.CalleePeer == peer.ID):
+			other := call.CalleePeer
+			if other == peer.ID {
+				other = call.CallerPeer
+			}
+			notify = append(notify, outbound{other, SignalMessage{Type: "hangup", CallID: call.ID, PeerID: peer.ID, Reason: "disconnected"}})
+			h.finishCall(call, CallEnded, "disconnected")
+		default:
+			continue
+		}
+		changed = append(changed, call.snapshot())
+	}
+	h.callMu.Unlock()
+
+	for i := range changed {
+		h.persistCall(&changed[i])
+	}
+	h.deliver(peer.Tenant, notify)
+	for _, call := range changed {
+		if call.AnsweredAt != nil {
+			h.updatePresence(call.Tenant, call.Caller)
+			h.updatePresence(call.Tenant, call.Callee)
+		}
+	}
+}
+
+// finishCall moves a call to a terminal state. Caller must hold callMu.
+func (h *SignalHub) finishCall(call *Call, state CallState, reason string) {
+	now := time.Now()
+	call.State = state
+	call.Reason = reason
+	call.EndedAt = &now
+	if call.timer != nil {
+		call.timer.Stop()
+	}
+	delete(h.calls, scopedKey(call.Tenant, call.ID))
+	h.unindexCallLocked(call, call.CallerPeer)
+	for _, id := range call.Devices {
+		h.unindexCallLocked(call, id)
+	}
+	h.emitCallRecord(call)
+	for _, subject := range []string{call.Caller, call.Callee} {
+		key := scopedKey(call.Tenant, subject)
+		if h.activeCalls[key] == call.ID {
+			delete(h.activeCalls, key)
+		}
+	}
+}
+
+// indexCallLocked records that peerID takes part in call, so a disconnect
+// only visits that peer's calls. Caller must hold callMu.
+func (h *SignalHub) indexCallLocked(call *Call, peerID string) {
+	key := scopedKey(call.Tenant, peerID)
+	if h.peerCalls[key] == nil {
+		h.peerCalls[key] = make(map[string]*Call)
+	}
+	h.peerCalls[key][call.ID] = call
+}
+
+// unindexCallLocked reverses indexCallLocked. Caller must hold callMu.
+func (h *SignalHub) unindexCallLocked(call *Call, peerID string) {
+	key := scopedKey(call.Tenant, peerID)
+	if calls, ok := h.peerCalls[key]; ok {
+		delete(calls, call.ID)
+		if len(calls) == 0 {
+			delete(h.peerCalls, key)
+		}
+	}
+}
+
+// cancelOtherDevices tells every ringing device except keep to stop ringing.
+func (h *SignalHub) cancelOtherDevices(call *Call, keep, reason string) []outbound {
+	var out []outbound
+	for _, id := range call.Devices {
+		if id != keep {
+			out = append(out, outbound{id, SignalMessage{Type: "cancel", CallID: call.ID, Reason: reason}})
+		}
+	}
+	return out
+}
+
+// persistCall writes the call record to the SessionStore, unless a later
+// snapshot of the call has been written already.
+func (h *SignalHub) persistCall(call *Call) {
+	call.writes.mu.Lock()
+	defer call.writes.mu.Unlock()
+	if call.version <= call.writes.written {
+		return
+	}
+	call.writes.written = call.version
+	data, err := json.Marshal(call)
+	if err != nil {
+		return
+	}
+	ttl := finishedCallTTL
+	if call.live() {
+		ttl = activeCallTTL
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.store.Set(ctx, callStoreKey(call.Tenant, call.ID), data, ttl); err != nil {
+		log.Printf("persist call %s: %v", call.ID, err)
+	}
+}
+
+// LoadCall reads a persisted call record from tenant's namespace.
+func (h *SignalHub) LoadCall(ctx context.Context, tenant, callID string) (*Call, error) {
+	data, err := h.store.Get(ctx, callStoreKey(tenant, callID))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var call Call
+	if err := json.Unmarshal(data, &call); err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+// callStoreKey is the SessionStore key for a call: tenant:<tenant>:call:<id>.
+func callStoreKey(tenant, callID string) string {
+	return "tenant:" + tenantOf(tenant) + ":call:" + callID
+}
+
+type outbound struct {
+	peerID string
+	msg    SignalMessage
+}
+
+func (h *SignalHub) deliver(tenant string, messages []outbound) {
+	for _, o := range messages {
+		if peer := h.lookupPeer(tenant, o.peerID); peer != nil {
+			h.sendToPeer(peer, o.msg)
+		}
+	}
+}
+
+// subjectPeers returns every connected device of a subject.
+func (h *SignalHub) subjectPeers(tenant, subject string) []*Peer {
+	key := scopedKey(tenant, subject)
+	ss := h.subjectShardFor(key)
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	devices := make([]*Peer, 0, len(ss.devices[key]))
+	for _, p := range ss.devices[key] {
+		devices = append(devices, p)
+	}
+	return devices
+}
+
+func newCallID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []string, v string) []string {
+	out := list[:0]
+	for _, item := range list {
+		if item != v {
+			out = append(out, item)
+		}
+	}
+	return out
+}
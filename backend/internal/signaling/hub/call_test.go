@@ -0,0 +1,228 @@
+// Package hub — Tests for the one-to-one call state machine.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInviteRingsEveryDeviceFirstAcceptWins(t *testing.T) {
+	store := newMemoryStore()
+	h := NewSignalHub(store)
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bobPhone := dial(t, h, srv, "sub=bob&sid=phone")
+	bobDesk := dial(t, h, srv, "sub=bob&sid=desk")
+
+	alice.send(SignalMessage{Type: "invite", To: "bob"})
+	calling := alice.expect("calling")
+	if calling.CallID == "" {
+		t.Fatal("expected server-assigned call id")
+	}
+	for _, device := range []*testClient{bobPhone, bobDesk} {
+		inv := device.expect("invite")
+		if inv.From != "alice" || inv.PeerID != alice.id || inv.CallID != calling.CallID {
+			t.Fatalf("unexpected invite %+v", inv)
+		}
+	}
+
+	bobPhone.send(SignalMessage{Type: "ringing", CallID: calling.CallID})
+	if msg := alice.expect("ringing"); msg.PeerID != bobPhone.id {
+		t.Errorf("ringing should identify the device, got %+v", msg)
+	}
+
+	bobDesk.send(SignalMessage{Type: "accept", CallID: calling.CallID})
+	if msg := alice.expect("accept"); msg.PeerID != bobDesk.id {
+		t.Errorf("accept should identify the answering device, got %+v", msg)
+	}
+	if msg := bobPhone.expect("cancel"); msg.Reason != "answered-elsewhere" {
+		t.Errorf("expected answered-elsewhere, got %+v", msg)
+	}
+
+	// A late accept from the other device loses.
+	bobPhone.send(SignalMessage{Type: "accept", CallID: calling.CallID})
+	bobPhone.expect("error")
+
+	call, err := h.LoadCall(context.Background(), "", calling.CallID)
+	if err != nil || call == nil {
+		t.Fatalf("load call: %v", err)
+	}
+	if call.State != CallAccepted || call.CalleePeer != bobDesk.id {
+		t.Errorf("unexpected persisted call %+v", call)
+	}
+
+	alice.send(SignalMessage{Type: "hangup", CallID: calling.CallID})
+	bobDesk.expect("hangup")
+	call, _ = h.LoadCall(context.Background(), "", calling.CallID)
+	if call.State != CallEnded || call.EndedAt == nil {
+		t.Errorf("expected ended call, got %+v", call)
+	}
+}
+
+func TestInviteBusyAndUnavailable(t *testing.T) {
+	h := NewSignalHub(newMemoryStore())
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+	carol := dial(t, h, srv, "sub=carol&sid=1")
+
+	alice.send(SignalMessage{Type: "invite", To: "nobody"})
+	if msg := alice.expect("reject"); msg.Reason != "unavailable" {
+		t.Errorf("expected unavailable, got %+v", msg)
+	}
+
+	alice.send(SignalMessage{Type: "invite", To: "bob"})
+	c1 := alice.expect("calling").CallID
+	bob.expect("invite")
+	bob.send(SignalMessage{Type: "accept", CallID: c1})
+	alice.expect("accept")
+
+	carol.send(SignalMessage{Type: "invite", To: "bob"})
+	carol.expect("busy")
+
+	bob.send(SignalMessage{Type: "busy", CallID: c1})
+	bob.expect("error")
+
+	// Callers in a call cannot start another.
+	alice.send(SignalMessage{Type: "invite", To: "carol", ID: "i1"})
+	if msg := alice.expect("error"); msg.ID != "i1" || msg.Message != ErrAlreadyInCall.Error() {
+		t.Errorf("expected already in a call, got %+v", msg)
+	}
+	carol.expectNone(100 * time.Millisecond)
+	if call, _ := h.LoadCall(context.Background(), "", c1); call.State != CallAccepted {
+		t.Errorf("first call disturbed: %+v", call)
+	}
+}
+
+func TestRejectCancelAndTimeout(t *testing.T) {
+	h := NewSignalHub(newMemoryStore(), WithRingTimeout(100*time.Millisecond))
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	alice.send(SignalMessage{Type: "invite", To: "bob"})
+	alice.expect("calling")
+	bob.send(SignalMessage{Type: "reject", CallID: bob.expect("invite").CallID})
+	if msg := alice.expect("reject"); msg.Reason != "declined" {
+		t.Errorf("expected declined, got %+v", msg)
+	}
+
+	alice.send(SignalMessage{Type: "invite", To: "bob"})
+	r2 := alice.expect("calling").CallID
+	bob.expect("invite")
+	alice.send(SignalMessage{Type: "cancel", CallID: r2})
+	if msg := bob.expect("cancel"); msg.Reason != "cancelled" {
+		t.Errorf("expected cancelled, got %+v", msg)
+	}
+
+	alice.send(SignalMessage{Type: "invite", To: "bob", CallID: "r3", ID: "i3"})
+	calling := alice.expect("calling")
+	if calling.ID != "i3" || calling.CallID == "r3" {
+		t.Errorf("expected a server-assigned call ID matched by id, got %+v", calling)
+	}
+	bob.expect("invite")
+	if msg := bob.expect("cancel"); msg.Reason != "timeout" {
+		t.Errorf("expected timeout on callee, got %+v", msg)
+	}
+	if msg := alice.expect("cancel"); msg.Reason != "timeout" {
+		t.Errorf("expected timeout on caller, got %+v", msg)
+	}
+	call, _ := h.LoadCall(context.Background(), "", calling.CallID)
+	if call == nil || call.State != CallTimeout {
+		t.Errorf("expected persisted timeout, got %+v", call)
+	}
+}
+
+func TestCallsDoNotCrossTenants(t *testing.T) {
+	h := NewSignalHub(newMemoryStore())
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1&tenant=acme")
+	dial(t, h, srv, "sub=bob&sid=1&tenant=globex")
+
+	alice.send(SignalMessage{Type: "invite", To: "bob"})
+	if msg := alice.expect("reject"); msg.Reason != "unavailable" {
+		t.Errorf("expected bob in another tenant to be unreachable, got %+v", msg)
+	}
+}
+
+// slowRingingStore holds back writes of ringing calls, so that they reach
+// the store after the transition that follows them.
+type slowRingingStore struct {
+	*memoryStore
+	delay    time.Duration
+	inFlight atomic.Int32
+}
+
+func (s *slowRingingStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	if strings.Contains(string(value), `"state":"ringing"`) {
+		time.Sleep(s.delay)
+	}
+	return s.memoryStore.Set(ctx, key, value, ttl)
+}
+
+// settle waits for writes in flight to finish.
+func (s *slowRingingStore) settle(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.inFlight.Load() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("store writes never finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCallRecordFollowsTransitionOrder(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	// Ring timeouts either side of the invite's write, so that accept wins
+	// some races and the timeout the rest.
+	for ring := 40 * time.Millisecond; ring <= 70*time.Millisecond; ring += 5 * time.Millisecond {
+		t.Run(fmt.Sprint(ring), func(t *testing.T) {
+			store := &slowRingingStore{memoryStore: newMemoryStore(), delay: delay}
+			h := NewSignalHub(store, WithRingTimeout(ring))
+			srv := newTestServer(t, h)
+			alice := dial(t, h, srv, "sub=alice&sid=1")
+			bob := dial(t, h, srv, "sub=bob&sid=1")
+
+			alice.send(SignalMessage{Type: "invite", To: "bob"})
+			// The timeout may beat the invite to either side.
+			bob.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if msg, err := bob.read(); err == nil && msg.Type == "invite" {
+				bob.send(SignalMessage{Type: "accept", CallID: msg.CallID})
+			}
+			var outcome SignalMessage
+			for outcome.Type == "" || outcome.Type == "calling" {
+				alice.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				var err error
+				if outcome, err = alice.read(); err != nil {
+					t.Fatalf("alice: waiting for the call's outcome: %v", err)
+				}
+			}
+			want := CallAccepted
+			switch {
+			case outcome.Type == "cancel" && outcome.Reason == "timeout":
+				want = CallTimeout
+			case outcome.Type != "accept":
+				t.Fatalf("expected accept or a timeout, got %+v", outcome)
+			}
+			callID := outcome.CallID
+			store.settle(t)
+			call, err := h.LoadCall(context.Background(), "", callID)
+			if err != nil || call == nil {
+				t.Fatalf("load call: %v", err)
+			}
+			if call.State != want {
+				t.Errorf("call %s, but its record says %s", want, call.State)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Package hub — Call Detail Record generation for calls and room sessions.
+//
+// A room session starts when the first peer joins and ends when the room
+// empties; a call record is emitted when the call reaches a terminal state.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/cdr"
+)
+
+// Participant leave causes recorded in room CDRs.
+const (
+	leaveCauseLeft         = "left"
+	leaveCauseMoved        = "moved"
+	leaveCauseDisconnected = "disconnected"
+	leaveCauseClosed       = "closed"
+	leaveCauseKicked       = "kicked"
+	leaveCauseBanned       = "banned"
+)
+
+// Room session end causes recorded in room CDRs.
+const (
+	sessionCauseEmpty  = "empty"
+	sessionCauseClosed = "closed"
+	sessionCauseEnded  = "ended"
+)
+
+type roomSession struct {
+	id           string
+	tenant       string
+	startedAt    time.Time
+	participants []cdr.Participant
+	// open maps a peer currently in the room to its participants index.
+	open map[string]int
+	// cause is why the session is ending; "" until it is closed, then
+	// sessionCauseClosed or sessionCauseEnded.
+	cause string
+}
+
+// WithCDR emits a Call Detail Record for every call and room session.
+func WithCDR(recorder cdr.Recorder) Option {
+	return func(h *SignalHub) { h.cdr = recorder }
+}
+
+// roomJoinedLocked records peer entering r. Caller must hold r's shard lock.
+func (h *SignalHub) roomJoinedLocked(r *room, peer *Peer) {
+	now := time.Now()
+	session := r.session
+	if session == nil {
+		session = &roomSession{id: newCallID(), tenant: peer.Tenant, startedAt: now, open: make(map[string]int)}
+		r.session = session
+	}
+	session.open[peer.ID] = len(session.participants)
+	session.participants = append(session.participants, cdr.Participant{
+		PeerID:   peer.ID,
+		Subject:  peer.Subject,
+		Role:     "member",
+		JoinedAt: now,
+	})
+}
+
+// roomLeftLocked closes peer's stay in r and emits the session record once
+// the room is empty. Caller must hold r's shard lock.
+func (h *SignalHub) roomLeftLocked(r *room, peer *Peer, roomID, cause string, emptied bool) {
+	session := r.session
+	if session == nil {
+		return
+	}
+	now := time.Now()
+	if i, open := session.open[peer.ID]; open {
+		p := &session.participants[i]
+		p.LeftAt = now
+		p.DurationMs = cdr.Millis(p.JoinedAt, now)
+		p.Cause = cause
+		delete(session.open, peer.ID)
+	}
+	if !emptied {
+		return
+	}
+	r.session = nil
+	sessionCause := session.cause
+	if sessionCause == "" {
+		sessionCause = sessionCauseEmpty
+	}
+	h.cdr.Emit(cdr.Record{
+		ID:           session.id,
+		Kind:         cdr.KindRoom,
+		Tenant:       session.tenant,
+		RoomID:       roomID,
+		StartedAt:    session.startedAt,
+		EndedAt:      now,
+		DurationMs:   cdr.Millis(session.startedAt, now),
+		Cause:        sessionCause,
+		Participants: session.participants,
+	})
+}
+
+// emitCallRecord writes the CDR for a call that just reached a terminal state.
+func (h *SignalHub) emitCallRecord(call *Call) {
+	ended := *call.EndedAt
+	caller := cdr.Participant{
+		PeerID:     call.CallerPeer,
+		Subject:    call.Caller,
+		Role:       "caller",
+		JoinedAt:   call.CreatedAt,
+		LeftAt:     ended,
+		DurationMs: cdr.Millis(call.CreatedAt, ended),
+	}
+	callee := cdr.Participant{Subject: call.Callee, Role: "callee", Cause: string(call.State)}
+	record := cdr.Record{
+		ID:        call.ID,
+		Kind:      cdr.KindCall,
+		Tenant:    call.Tenant,
+		CallID:    call.ID,
+		StartedAt: call.CreatedAt,
+		EndedAt:   ended,
+		Cause:     call.Reason,
+	}
+	if call.AnsweredAt != nil {
+		answered := *call.AnsweredAt
+		record.AnsweredAt = &answered
+		record.DurationMs = cdr.Millis(answered, ended)
+		callee.PeerID = call.CalleePeer
+		callee.JoinedAt = answered
+		callee.LeftAt = ended
+		callee.DurationMs = record.DurationMs
+		callee.Cause = ""
+	}
+	record.Participants = []cdr.Participant{caller, callee}
+	h.cdr.Emit(record)
+}
@@ -0,0 +1,144 @@
+// Package hub — Tests for CDR emission.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/cdr"
+)
+
+type captureCDR struct {
+	mu      sync.Mutex
+	records []cdr.Record
+}
+
+func (c *captureCDR) Emit(r cdr.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, r)
+}
+
+// wait returns the first n records, failing if they do not arrive.
+func (c *captureCDR) wait(t *testing.T, n int) []cdr.Record {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.mu.Lock()
+		if len(c.records) >= n {
+			out := append([]cdr.Record(nil), c.records[:n]...)
+			c.mu.Unlock()
+			return out
+		}
+		c.mu.Unlock()
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d CDRs", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRoomSessionCDR(t *testing.T) {
+	records := &captureCDR{}
+	h := NewSignalHub(nil, WithCDR(records))
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1&tenant=acme")
+	bob := dial(t, h, srv, "sub=bob&sid=1&tenant=acme")
+
+	alice.send(SignalMessage{Type: "join", RoomID: "standup"})
+	alice.expect("joined")
+	bob.send(SignalMessage{Type: "join", RoomID: "standup"})
+	bob.expect("joined")
+	alice.expect("peer_joined")
+
+	bob.send(SignalMessage{Type: "leave", RoomID: "standup"})
+	bob.send(SignalMessage{Type: "join", RoomID: "standup"})
+	bob.expect("joined")
+	alice.conn.Close()
+	bob.send(SignalMessage{Type: "join", RoomID: "retro"})
+	bob.expect("joined")
+
+	r := records.wait(t, 1)[0]
+	if r.Kind != cdr.KindRoom || r.RoomID != "standup" || r.Tenant != "acme" || r.Cause != "empty" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	causes := map[string][]string{}
+	for _, p := range r.Participants {
+		causes[p.Subject] = append(causes[p.Subject], p.Cause)
+		if p.LeftAt.Before(p.JoinedAt) {
+			t.Errorf("participant %s left before joining", p.PeerID)
+		}
+	}
+	if got := causes["bob"]; len(got) != 2 || got[0] != leaveCauseLeft || got[1] != leaveCauseMoved {
+		t.Errorf("unexpected bob legs %v", got)
+	}
+	if got := causes["alice"]; len(got) != 1 || got[0] != leaveCauseDisconnected {
+		t.Errorf("unexpected alice legs %v", got)
+	}
+}
+
+func TestCallCDR(t *testing.T) {
+	records := &captureCDR{}
+	h := NewSignalHub(nil, WithCDR(records))
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	alice.send(SignalMessage{Type: "invite", To: "carol"})
+	alice.expect("reject")
+
+	alice.send(SignalMessage{Type: "invite", To: "bob"})
+	callID := alice.expect("calling").CallID
+	bob.expect("invite")
+	bob.send(SignalMessage{Type: "accept", CallID: callID})
+	alice.expect("accept")
+	time.Sleep(20 * time.Millisecond)
+	bob.send(SignalMessage{Type: "hangup", CallID: callID})
+	alice.expect("hangup")
+
+	got := records.wait(t, 2)
+	missed, talk := got[0], got[1]
+	if missed.Cause != "unavailable" || missed.AnsweredAt != nil || missed.DurationMs != 0 {
+		t.Errorf("unexpected missed-call record %+v", missed)
+	}
+	if talk.Kind != cdr.KindCall || talk.Cause != "hangup" || talk.AnsweredAt == nil || talk.DurationMs < 20 {
+		t.Fatalf("unexpected call record %+v", talk)
+	}
+	if len(talk.Participants) != 2 || talk.Participants[1].PeerID != bob.id || talk.Participants[1].DurationMs != talk.DurationMs {
+		t.Errorf("unexpected participants %+v", talk.Participants)
+	}
+}
+
+func TestRoomSessionCDRRecordsCloseCause(t *testing.T) {
+	records := &captureCDR{}
+	h := NewSignalHub(nil, WithCDR(records))
+	srv := newTestServer(t, h)
+	mod := dial(t, h, srv, "sub=mod&sid=1&role=moderator")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	for _, room := range []string{"closed", "ended"} {
+		mod.expectJoin(t, room)
+		bob.expectJoin(t, room)
+		mod.expect("peer_joined")
+		if room == "closed" {
+			if _, err := h.CloseRoom("", room, "maintenance"); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			mod.send(SignalMessage{Type: "end-for-all"})
+		}
+		mod.expect("room-closed")
+		bob.expect("room-closed")
+	}
+
+	got := records.wait(t, 2)
+	for i, want := range []string{sessionCauseClosed, sessionCauseEnded} {
+		if got[i].RoomID != want || got[i].Cause != want {
+			t.Errorf("room %s: got cause %q, want %q", got[i].RoomID, got[i].Cause, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package hub — Outbound compression and bandwidth accounting.
+//
+// permessage-deflate is negotiated by the WebSocket handshake (the
+// upgrader's EnableCompression); on connections that negotiated it, and the
+// compression feature if they said hello, the hub deflates only frames of
+// at least the compression threshold, as small frames gain nothing. Sockets upgraded through CountBytes also report what
+// each frame took on the wire, so the hub exports the bytes compression
+// saved alongside the payload and wire totals.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCompressionThreshold is the smallest frame, in bytes, that is
+// compressed: above a typical candidate, below a typical SDP.
+const DefaultCompressionThreshold = 512
+
+// statsInterval is how often write pumps report their byte counts.
+const statsInterval = 10 * time.Second
+
+// WithCompressionThreshold compresses frames of at least n bytes on
+// connections that negotiated permessage-deflate; n <= 0 sends every frame
+// uncompressed.
+func WithCompressionThreshold(n int) Option {
+	return func(h *SignalHub) { h.compressMin = n }
+}
+
+// CountBytes wraps w so that a WebSocket upgraded from it counts the bytes
+// it writes to the network.
+func CountBytes(w http.ResponseWriter) http.ResponseWriter {
+	return &countingWriter{ResponseWriter: w}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+}
+
+func (w *countingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hub: response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &countingConn{Conn: conn}, rw, nil
+}
+
+type countingConn struct {
+	net.Conn
+	written atomic.Uint64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(uint64(n))
+	return n, err
+}
+
+// sendStats accumulates a write pump's byte counts between reports.
+type sendStats struct {
+	payload uint64
+	wire    uint64
+	saved   uint64
+}
+
+// add counts a frame of payload bytes that took wire bytes on the network,
+// or an unknown number when wire is zero. Only a deflated frame can be
+// smaller on the wire than its payload, as framing adds bytes.
+func (s *sendStats) add(payload, wire int) {
+	s.payload += uint64(payload)
+	s.wire += uint64(wire)
+	if wire > 0 && wire < payload {
+		s.saved += uint64(payload - wire)
+	}
+}
+
+// flush reports and resets the counts.
+func (s *sendStats) flush(h *SignalHub, tenant string) {
+	labels := map[string]string{"tenant": tenant}
+	for name, v := range map[string]uint64{
+		"ws_sent_payload_bytes_total":      s.payload,
+		"ws_sent_wire_bytes_total":         s.wire,
+		"ws_compression_saved_bytes_total": s.saved,
+	} {
+		if v > 0 {
+			h.telemetry.RecordMetric(name, float64(v), labels)
+		}
+	}
+	*s = sendStats{}
+}
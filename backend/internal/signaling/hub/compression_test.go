@@ -0,0 +1,110 @@
+// Package hub — Compression threshold and bandwidth accounting tests.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// metricSink sums recorded metrics by name.
+type metricSink struct {
+	mu     sync.Mutex
+	totals map[string]float64
+}
+
+func newMetricSink() *metricSink {
+	return &metricSink{totals: make(map[string]float64)}
+}
+
+func (m *metricSink) RecordMetric(name string, value float64, _ map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totals[name] += value
+}
+
+func (m *metricSink) total(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.totals[name]
+}
+
+// await waits for name to be recorded.
+func (m *metricSink) await(t *testing.T, name string) float64 {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for m.total(name) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never recorded", name)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return m.total(name)
+}
+
+func TestCompressionSavesLargeFrames(t *testing.T) {
+	metrics := newMetricSink()
+	h := NewSignalHub(nil, WithTelemetry(metrics), WithCompressionThreshold(256))
+	srv := newTestServer(t, h)
+	alice := dialWith(t, h, srv, "sub=alice&sid=1", websocket.Dialer{EnableCompression: true})
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	sdp := "v=0\r\n" + strings.Repeat("a=rtpmap:111 opus/48000/2\r\na=rtcp-fb:111 transport-cc\r\n", 40)
+	bob.send(SignalMessage{Type: "offer", PeerID: "alice-1", SDP: sdp})
+	if msg := alice.expect("offer"); msg.SDP != sdp {
+		t.Fatalf("offer did not survive compression")
+	}
+	alice.conn.Close()
+
+	// alice's write pump reports when the hub drops her.
+	saved := metrics.await(t, "ws_compression_saved_bytes_total")
+	payload, wire := metrics.total("ws_sent_payload_bytes_total"), metrics.total("ws_sent_wire_bytes_total")
+	if payload < float64(len(sdp)) || wire+saved != payload || saved < payload/2 {
+		t.Fatalf("payload %v, wire %v, saved %v", payload, wire, saved)
+	}
+}
+
+func TestSmallFramesAreNotCompressed(t *testing.T) {
+	metrics := newMetricSink()
+	h := NewSignalHub(nil, WithTelemetry(metrics))
+	srv := newTestServer(t, h)
+	alice := dialWith(t, h, srv, "sub=alice&sid=1", websocket.Dialer{EnableCompression: true})
+	alice.send(SignalMessage{Type: "join", RoomID: "r"})
+	alice.expect("joined")
+	alice.conn.Close()
+
+	wire := metrics.await(t, "ws_sent_wire_bytes_total")
+	if payload := metrics.total("ws_sent_payload_bytes_total"); wire <= payload || metrics.total("ws_compression_saved_bytes_total") != 0 {
+		t.Fatalf("payload %v, wire %v", payload, wire)
+	}
+}
+
+func TestHelloWithoutCompressionIsSentUncompressed(t *testing.T) {
+	metrics := newMetricSink()
+	h := NewSignalHub(nil, WithTelemetry(metrics), WithCompressionThreshold(256))
+	srv := newTestServer(t, h)
+	alice := dialWith(t, h, srv, "sub=alice&sid=1", websocket.Dialer{EnableCompression: true})
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	// permessage-deflate was negotiated, but hello does not ask for it.
+	alice.send(SignalMessage{Type: "hello", Version: ProtocolVersion, Features: []string{FeatureAcks}})
+	if welcome := alice.expect("welcome"); !reflect.DeepEqual(welcome.Features, []string{FeatureAcks}) {
+		t.Fatalf("unexpected welcome %+v", welcome)
+	}
+	sdp := "v=0\r\n" + strings.Repeat("a=rtpmap:111 opus/48000/2\r\na=rtcp-fb:111 transport-cc\r\n", 40)
+	bob.send(SignalMessage{Type: "offer", PeerID: "alice-1", SDP: sdp})
+	alice.expect("offer")
+	alice.conn.Close()
+
+	wire := metrics.await(t, "ws_sent_wire_bytes_total")
+	if payload := metrics.total("ws_sent_payload_bytes_total"); payload < float64(len(sdp)) || wire <= payload || metrics.total("ws_compression_saved_bytes_total") != 0 {
+		t.Fatalf("payload %v, wire %v", payload, wire)
+	}
+}
@@ -0,0 +1,211 @@
+// Package hub — Server-side room control for backend integrations.
+//
+// Applications that drive rooms for their users (contact centres, IVRs)
+// create rooms ahead of the first join, close them, remove peers, and
+// follow room lifecycle events in process. A created room counts against
+// the tenant's room quota and stays open empty until it is closed or its
+// members have all left. Closing a room removes its members with a
+// room-closed message; they stay connected. A kicked peer is disconnected
+// with CloseKicked.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/webhook"
+)
+
+// CloseKicked is the WebSocket close code sent to a kicked peer.
+const CloseKicked = 4002
+
+// Room control errors.
+var (
+	ErrRoomExists = errors.New("room already exists")
+	ErrNoSuchPeer = errors.New("peer does not exist")
+)
+
+// watchBuffer is how many events a slow watcher may fall behind before
+// events to it are dropped.
+const watchBuffer = 256
+
+// CreateRoom opens an empty room in tenant.
+func (h *SignalHub) CreateRoom(tenant, roomID string) error {
+	if roomID == "" {
+		return ErrNoSuchRoom
+	}
+	tenant = tenantOf(tenant)
+	key := scopedKey(tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if _, exists := rs.rooms[key]; exists {
+		return ErrRoomExists
+	}
+	st, err := h.acquireRoom(tenant)
+	if err != nil {
+		h.recordQuotaRejection(tenant, "rooms")
+		return err
+	}
+	rs.rooms[key] = &room{members: make(map[string]*Peer), tenant: st}
+	h.publishEvent(webhook.Event{Type: webhook.EventRoomCreated, Tenant: tenant, RoomID: roomID})
+	return nil
+}
+
+// acquireRoom counts a new room against tenant's quota.
+func (h *SignalHub) acquireRoom(tenant string) (*tenantState, error) {
+	h.tenantMu.Lock()
+	defer h.tenantMu.Unlock()
+	st := h.tenantLocked(tenant)
+	if q := h.quotas.Resolve(tenant); q != nil && q.MaxRooms > 0 && st.rooms >= q.MaxRooms {
+		h.releaseLocked(st)
+		return nil, ErrRoomQuota
+	}
+	st.rooms++
+	return st, nil
+}
+
+// CloseRoom removes every member of tenant's room roomID, telling each with
+// a room-closed message carrying reason, and returns how many there were.
+// Peers waiting in its lobby are denied with reason.
+func (h *SignalHub) CloseRoom(tenant, roomID, reason string) (int, error) {
+	return h.closeRoom(tenant, roomID, reason, "")
+}
+
+// closeRoom is CloseRoom; room-closed carries from, the subject ending the
+// room, when set.
+func (h *SignalHub) closeRoom(tenant, roomID, reason, from string) (int, error) {
+	tenant = tenantOf(tenant)
+	key := scopedKey(tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	r, exists := rs.rooms[key]
+	if !exists {
+		rs.mu.Unlock()
+		return 0, ErrNoSuchRoom
+	}
+	// Turn the lobby away first, so the last member leaving deletes the
+	// room.
+	waiting := make([]*Peer, 0, len(r.waiting))
+	for len(r.waiting) > 0 {
+		w, _ := h.dequeueLocked(r, 0, roomID, KnockDenied)
+		waiting = append(waiting, w.peer)
+	}
+	deny := func() {
+		for _, peer := range waiting {
+			h.resolve(peer, roomID, KnockDenied, reason)
+		}
+	}
+	if len(r.members) == 0 {
+		// Created and never joined, or only waited in: nothing else will
+		// delete it.
+		delete(rs.rooms, key)
+		rs.mu.Unlock()
+		h.releaseRoom(r.tenant)
+		h.publishEvent(webhook.Event{Type: webhook.EventRoomEmptied, Tenant: tenant, RoomID: roomID, Reason: leaveCauseClosed})
+		deny()
+		return 0, nil
+	}
+	if r.session != nil {
+		r.session.cause = sessionCauseClosed
+		if from != "" {
+			r.session.cause = sessionCauseEnded
+		}
+	}
+	members := make([]*Peer, 0, len(r.members))
+	for _, peer := range r.members {
+		members = append(members, peer)
+	}
+	rs.mu.Unlock()
+	deny()
+
+	closed := 0
+	for _, peer := range members {
+		peer.roomMu.Lock()
+		if peer.RoomID != roomID || peer.removed.Load() {
+			peer.roomMu.Unlock()
+			continue
+		}
+		h.removeFromRoomLocked(peer, leaveCauseClosed)
+		peer.roomMu.Unlock()
+		h.sendToPeer(peer, SignalMessage{Type: "room-closed", RoomID: roomID, From: from, Reason: reason})
+		closed++
+	}
+	return closed, nil
+}
+
+// Kick disconnects tenant's peer peerID, telling its client reason with
+// CloseKicked.
+func (h *SignalHub) Kick(tenant, peerID, reason string) error {
+	peer := h.lookupPeer(tenantOf(tenant), peerID)
+	if peer == nil {
+		return ErrNoSuchPeer
+	}
+	peer.roomMu.Lock()
+	h.removeFromRoomLocked(peer, leaveCauseKicked)
+	peer.roomMu.Unlock()
+	if peer.transport != nil {
+		peer.closeWith(CloseKicked, reason)
+	}
+	h.Unregister(peer)
+	return nil
+}
+
+// watcher receives one tenant's room events, or one room's when room is set.
+type watcher struct {
+	room   string
+	events chan webhook.Event
+}
+
+// WatchRooms streams tenant's room lifecycle events, only roomID's when it
+// is set, until stop is called. Events a slow reader has no room for are
+// dropped.
+func (h *SignalHub) WatchRooms(tenant, roomID string) (events <-chan webhook.Event, stop func()) {
+	tenant = tenantOf(tenant)
+	w := &watcher{room: roomID, events: make(chan webhook.Event, watchBuffer)}
+	h.watchMu.Lock()
+	if h.watchers[tenant] == nil {
+		h.watchers[tenant] = make(map[*watcher]struct{})
+	}
+	h.watchers[tenant][w] = struct{}{}
+	h.watchMu.Unlock()
+	return w.events, func() {
+		h.watchMu.Lock()
+		defer h.watchMu.Unlock()
+		if _, ok := h.watchers[tenant][w]; !ok {
+			return
+		}
+		delete(h.watchers[tenant], w)
+		if len(h.watchers[tenant]) == 0 {
+			delete(h.watchers, tenant)
+		}
+		close(w.events)
+	}
+}
+
+// notifyWatchers hands e to its tenant's watchers; it never blocks. It runs
+// under room shard locks, so it only takes watchMu's read lock: sends are
+// non-blocking and stop closes a channel only under the write lock.
+func (h *SignalHub) notifyWatchers(e webhook.Event) {
+	h.watchMu.RLock()
+	defer h.watchMu.RUnlock()
+	if len(h.watchers[e.Tenant]) == 0 {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	for w := range h.watchers[e.Tenant] {
+		if w.room != "" && w.room != e.RoomID {
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			log.Printf("dropped %s event for a room watcher in tenant %s", e.Type, e.Tenant)
+		}
+	}
+}
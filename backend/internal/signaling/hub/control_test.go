@@ -0,0 +1,104 @@
+// Package hub — Room control tests: created rooms, closing, kicks and
+// watchers.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/webhook"
+	"github.com/gorilla/websocket"
+)
+
+func TestCreatedRoomsCountAgainstQuota(t *testing.T) {
+	h := NewSignalHub(nil, WithTenantQuotas(&TenantQuotas{Default: &TenantQuota{MaxRooms: 1}}))
+	if err := h.CreateRoom("acme", "r1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.CreateRoom("acme", "r2"); !errors.Is(err, ErrRoomQuota) {
+		t.Fatalf("second room: %v", err)
+	}
+	// Closing the unjoined room releases it.
+	if n, err := h.CloseRoom("acme", "r1", ""); err != nil || n != 0 {
+		t.Fatalf("close: %d, %v", n, err)
+	}
+	if _, err := h.CloseRoom("acme", "r1", ""); !errors.Is(err, ErrNoSuchRoom) {
+		t.Fatalf("second close: %v", err)
+	}
+	if err := h.CreateRoom("acme", "r2"); err != nil {
+		t.Fatalf("room after close: %v", err)
+	}
+}
+
+func TestCreatedRoomIsJoinedAndEmptied(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	events, stop := h.WatchRooms("acme", "r1")
+	other, stopOther := h.WatchRooms("other", "")
+	defer stopOther()
+	if err := h.CreateRoom("acme", "r1"); err != nil {
+		t.Fatal(err)
+	}
+	alice := dial(t, h, srv, "sub=alice&sid=1&tenant=acme")
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if joined := alice.expect("joined"); len(joined.Peers) != 0 {
+		t.Fatalf("created room has members %v", joined.Peers)
+	}
+	alice.send(SignalMessage{Type: "leave", RoomID: "r1"})
+	alice.send(SignalMessage{Type: "join", RoomID: "r2"})
+	alice.expect("joined")
+
+	for _, want := range []string{webhook.EventRoomCreated, webhook.EventPeerJoined, webhook.EventPeerLeft, webhook.EventRoomEmptied} {
+		select {
+		case e := <-events:
+			if e.Type != want || e.RoomID != "r1" {
+				t.Fatalf("got %+v, want %s", e, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s event", want)
+		}
+	}
+	stop()
+	if _, open := <-events; open {
+		t.Fatal("events still open after stop")
+	}
+	select {
+	case e := <-other:
+		t.Fatalf("other tenant saw %+v", e)
+	default:
+	}
+}
+
+func TestKickClosesConnection(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("joined")
+	bob.send(SignalMessage{Type: "join", RoomID: "r1"})
+	bob.expect("joined")
+	alice.expect("peer_joined")
+
+	if err := h.Kick("", "bob-1", "bye"); err != nil {
+		t.Fatal(err)
+	}
+	bob.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := bob.conn.ReadMessage()
+	if !websocket.IsCloseError(err, CloseKicked) {
+		t.Fatalf("expected close %d, got %v", CloseKicked, err)
+	}
+	if err := h.Kick("", "bob-1", ""); !errors.Is(err, ErrNoSuchPeer) {
+		t.Fatalf("second kick: %v", err)
+	}
+	if n, err := h.CloseRoom("", "r1", "done"); err != nil || n != 1 {
+		t.Fatalf("close: %d, %v", n, err)
+	}
+	if msg := alice.expect("room-closed"); msg.RoomID != "r1" || msg.Reason != "done" {
+		t.Fatalf("alice got %+v", msg)
+	}
+}
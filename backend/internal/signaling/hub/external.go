@@ -0,0 +1,101 @@
+// Package hub — Synchronous room access for socketless participants.
+//
+// HTTP-signalled clients such as WHIP publishers and WHEP players need each
+// step's result in the response to the request that caused it, so these
+// entry points return errors and answers instead of sending them to the
+// peer. Their peers still receive room events on Peer.Send.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+)
+
+// ErrSFUDisabled is returned by the SFU entry points when no SFU is set.
+var ErrSFUDisabled = errors.New("sfu is not enabled")
+
+// RegisterLocal adds an in-process participant that is listed and announced
+// like any member, such as a WHIP publisher. It has no socket: its messages
+// are read from Peer.Send.
+func (h *SignalHub) RegisterLocal(peerID string, claims *contracts.Claims) (*Peer, error) {
+	return h.register(peerID, claims, nil, false)
+}
+
+// JoinSFU moves peer into roomID and switches the room to SFU mode, telling
+// existing members via room-mode. Hidden peers join an existing room only.
+func (h *SignalHub) JoinSFU(peer *Peer, roomID string) error {
+	if h.sfu == nil {
+		return ErrSFUDisabled
+	}
+	if roomID == "" {
+		return ErrNoSuchRoom
+	}
+	return h.join(peer, roomID, true)
+}
+
+// Publish answers peer's publish offer in its SFU room, announcing the
+// publication to the room on the first call.
+func (h *SignalHub) Publish(peer *Peer, offer string) (string, error) {
+	roomID, err := h.sfuRoomOf(peer)
+	if err != nil {
+		return "", err
+	}
+	return h.sfuPublish(peer, roomID, offer, false)
+}
+
+// PublishDuplex is Publish for a single sendrecv connection that also
+// carries back the publisher peer then subscribes to (see SFU.Duplex).
+func (h *SignalHub) PublishDuplex(peer *Peer, offer string) (string, error) {
+	roomID, err := h.sfuRoomOf(peer)
+	if err != nil {
+		return "", err
+	}
+	return h.sfuPublish(peer, roomID, offer, true)
+}
+
+// View answers peer's receive-only offer for publisherID's media in its SFU
+// room, at the simulcast layer ("" for the best available).
+func (h *SignalHub) View(peer *Peer, publisherID, layer, offer string) (string, error) {
+	roomID, err := h.sfuRoomOf(peer)
+	if err != nil {
+		return "", err
+	}
+	return h.sfu.View(peer.Tenant, roomID, peer.ID, publisherID, layer, offer)
+}
+
+// Publishers lists the peers publishing in peer's SFU room.
+func (h *SignalHub) Publishers(peer *Peer) ([]string, error) {
+	roomID, err := h.sfuRoomOf(peer)
+	if err != nil {
+		return nil, err
+	}
+	return h.sfu.Publishers(peer.Tenant, roomID), nil
+}
+
+// AddCandidate adds a trickled candidate to peer's publish or subscribe
+// (role) SFU connection.
+func (h *SignalHub) AddCandidate(peer *Peer, role string, candidate json.RawMessage) error {
+	roomID, err := h.sfuRoomOf(peer)
+	if err != nil {
+		return err
+	}
+	return h.sfu.AddCandidate(peer.Tenant, roomID, peer.ID, role, candidate)
+}
+
+func (h *SignalHub) sfuRoomOf(peer *Peer) (string, error) {
+	if h.sfu == nil {
+		return "", ErrSFUDisabled
+	}
+	roomID, ok := h.sfuRoom(peer)
+	if roomID == "" {
+		return "", ErrNotInRoom
+	}
+	if !ok {
+		return "", ErrNotSFURoom
+	}
+	return roomID, nil
+}
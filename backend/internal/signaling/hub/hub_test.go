@@ -0,0 +1,231 @@
+// Package hub — Room lifecycle tests and helpers running the hub behind a
+// real WebSocket server.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/webhook"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/gorilla/websocket"
+)
+
+type testClient struct {
+	t     *testing.T
+	id    string
+	conn  *websocket.Conn
+	codec wire.Codec
+}
+
+// newTestServer serves the hub on /ws, taking claims from the query string
+// (?sub=&sid=&tenant=&role=) instead of a JWT.
+func newTestServer(t *testing.T, h *SignalHub) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: wire.Subprotocols, EnableCompression: true}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		claims := &contracts.Claims{Subject: q.Get("sub"), SessionID: q.Get("sid"), Tenant: q.Get("tenant"), Role: q.Get("role")}
+		conn, err := upgrader.Upgrade(CountBytes(w), r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			_, raw, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg SignalMessage
+			if peer.Codec().Unmarshal(raw, &msg) == nil {
+				h.HandleMessage(peer, msg)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dial(t *testing.T, h *SignalHub, srv *httptest.Server, query string) *testClient {
+	t.Helper()
+	return dialWith(t, h, srv, query, *websocket.DefaultDialer)
+}
+
+// dialWith dials with dialer, e.g. to offer a subprotocol or compression.
+func dialWith(t *testing.T, h *SignalHub, srv *httptest.Server, query string, dialer websocket.Dialer) *testClient {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?" + query
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	values, _ := parseQuery(query)
+	id := values["sub"] + "-" + values["sid"]
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if h.lookupPeer(values["tenant"], id) != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("peer %s never registered", id)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return &testClient{t: t, id: id, conn: conn, codec: wire.ForSubprotocol(conn.Subprotocol())}
+}
+
+func parseQuery(q string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(q, "&") {
+		k, v, _ := strings.Cut(pair, "=")
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (c *testClient) send(msg SignalMessage) {
+	c.t.Helper()
+	data, err := c.codec.Marshal(msg)
+	if err == nil {
+		err = c.conn.WriteMessage(c.codec.FrameType(), data)
+	}
+	if err != nil {
+		c.t.Fatalf("%s send: %v", c.id, err)
+	}
+}
+
+// expect reads the next message and asserts its type.
+func (c *testClient) expect(msgType string) SignalMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	msg, err := c.read()
+	if err != nil {
+		c.t.Fatalf("%s: waiting for %s: %v", c.id, msgType, err)
+	}
+	if msg.Type != msgType {
+		c.t.Fatalf("%s: expected %s, got %+v", c.id, msgType, msg)
+	}
+	return msg
+}
+
+// expectNone asserts that nothing arrives within d. A read timeout breaks the
+// connection, so this must be the client's last read.
+func (c *testClient) expectNone(d time.Duration) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(d))
+	if msg, err := c.read(); err == nil {
+		c.t.Fatalf("%s: expected no message, got %+v", c.id, msg)
+	}
+}
+
+func (c *testClient) read() (SignalMessage, error) {
+	var msg SignalMessage
+	_, raw, err := c.conn.ReadMessage()
+	if err == nil {
+		err = c.codec.Unmarshal(raw, &msg)
+	}
+	return msg, err
+}
+
+// memoryStore is an in-memory SessionStore for assertions.
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{data: make(map[string][]byte)}
+}
+
+func (m *memoryStore) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.data[key], nil
+}
+
+func (m *memoryStore) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+type captureWebhooks struct {
+	mu     sync.Mutex
+	events []webhook.Event
+}
+
+func (c *captureWebhooks) Publish(e webhook.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+func (c *captureWebhooks) types() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]string, len(c.events))
+	for i, e := range c.events {
+		out[i] = e.Type + ":" + e.PeerID
+	}
+	return out
+}
+
+func TestRoomLifecycleWebhooks(t *testing.T) {
+	events := &captureWebhooks{}
+	h := NewSignalHub(nil, WithWebhooks(events))
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1&tenant=acme")
+	bob := dial(t, h, srv, "sub=bob&sid=1&tenant=acme")
+
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("joined")
+	bob.send(SignalMessage{Type: "join", RoomID: "r1"})
+	bob.expect("joined")
+	alice.expect("peer_joined")
+	bob.send(SignalMessage{Type: "leave", RoomID: "r1"})
+	// leave has no acknowledgement; wait for it before alice acts.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(events.types()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	alice.send(SignalMessage{Type: "leave", RoomID: "r1"})
+	alice.send(SignalMessage{Type: "join", RoomID: "r2"})
+	alice.expect("joined")
+
+	want := []string{
+		"room.created:alice-1", "peer.joined:alice-1", "peer.joined:bob-1",
+		"peer.left:bob-1", "peer.left:alice-1", "room.emptied:alice-1",
+		"room.created:alice-1", "peer.joined:alice-1",
+	}
+	got := events.types()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got events %v\nwant %v", got, want)
+	}
+	if e := events.events[3]; e.Tenant != "acme" || e.RoomID != "r1" || e.Reason != leaveCauseLeft || e.Subject != "bob" {
+		t.Errorf("unexpected peer.left event %+v", e)
+	}
+}
@@ -0,0 +1,348 @@
+// Package hub — Lobbies: screening joiners before they enter a room.
+//
+// A room in lobby mode queues joiners instead of admitting them. Each
+// waiting peer is told its queue position and how long it may wait; hosts
+// (peers whose token carries the host role) in the room get a knock per
+// waiting peer and admit or deny it, and are told when a knock is resolved
+// otherwise. Hosts enter directly, and can lock a room so that nobody else
+// may join or wait; moderators may lock it too (see moderation.go). Lobby
+// mode is switched by hosts, or on for every new room with
+// WithLobbyByDefault.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"errors"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/webhook"
+)
+
+// RoleHost is the role claim of peers that screen lobbies.
+const RoleHost = "host"
+
+// DefaultLobbyTimeout is how long a peer may wait in a lobby.
+const DefaultLobbyTimeout = 5 * time.Minute
+
+// Room states carried by room-state and joined.
+const (
+	RoomOpen   = "open"
+	RoomLobby  = "lobby"
+	RoomLocked = "locked"
+)
+
+// How a knock was resolved, carried by knock-resolved.
+const (
+	KnockAdmitted = "admitted"
+	KnockDenied   = "denied"
+	KnockLeft     = "left"
+	KnockTimeout  = "timeout"
+)
+
+// Lobby errors reported to clients.
+var (
+	ErrRoomLocked    = errors.New("room is locked")
+	ErrNotHost       = errors.New("only hosts may do this")
+	ErrNotWaiting    = errors.New("peer is not waiting in this room's lobby")
+	ErrLobbyRequired = errors.New("room admits through a lobby")
+)
+
+// WithLobbyByDefault puts every new room in lobby mode.
+func WithLobbyByDefault() Option {
+	return func(h *SignalHub) { h.lobbyByDefault = true }
+}
+
+// WithLobbyTimeout bounds how long a peer may wait in a lobby before it is
+// turned away.
+func WithLobbyTimeout(d time.Duration) Option {
+	return func(h *SignalHub) { h.lobbyTimeout = d }
+}
+
+// waiter is a peer in a lobby.
+type waiter struct {
+	peer     *Peer
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func (p *Peer) isHost() bool { return p.role == RoleHost }
+
+func (r *room) stateLocked() string {
+	switch {
+	case r.locked:
+		return RoomLocked
+	case r.lobby:
+		return RoomLobby
+	}
+	return RoomOpen
+}
+
+func (r *room) hostsLocked() []*Peer {
+	var hosts []*Peer
+	for _, p := range r.members {
+		if p.isHost() {
+			hosts = append(hosts, p)
+		}
+	}
+	return hosts
+}
+
+// knocksLocked returns a knock for each peer waiting in r.
+func knocksLocked(r *room, roomID string) []SignalMessage {
+	knocks := make([]SignalMessage, len(r.waiting))
+	for i, w := range r.waiting {
+		knocks[i] = SignalMessage{Type: "knock", RoomID: roomID, PeerID: w.peer.ID, From: w.peer.Subject, Metadata: w.peer.Metadata()}
+	}
+	return knocks
+}
+
+// waitingLocked tells w its position, i+1, and the seconds it has left.
+func waitingLocked(w *waiter, i int, roomID string) SignalMessage {
+	left := time.Until(w.deadline).Round(time.Second)
+	if left < time.Second {
+		left = time.Second
+	}
+	return SignalMessage{Type: "waiting", RoomID: roomID, Position: i + 1, Timeout: int(left / time.Second)}
+}
+
+// lobbyNotice is a message to send once the room's lock is released.
+type lobbyNotice struct {
+	to  *Peer
+	msg SignalMessage
+}
+
+func (h *SignalHub) notify(notices []lobbyNotice) {
+	for _, n := range notices {
+		h.sendToPeer(n.to, n.msg)
+	}
+}
+
+// waitLocked queues peer in r's lobby and releases the room and the peer's
+// locks, which the caller (enter) holds.
+func (h *SignalHub) waitLocked(rs *roomShard, r *room, peer *Peer, roomID string) error {
+	var err error
+	switch {
+	case r.locked:
+		err = ErrRoomLocked
+	case peer.transport == nil:
+		// In-process peers answer synchronously and cannot wait.
+		err = ErrLobbyRequired
+	}
+	if err != nil {
+		h.dropIfEmptyLocked(rs, r, roomID, KnockLeft)
+		rs.mu.Unlock()
+		peer.roomMu.Unlock()
+		return err
+	}
+	w := &waiter{peer: peer, deadline: time.Now().Add(h.lobbyTimeout)}
+	w.timer = time.AfterFunc(h.lobbyTimeout, func() { h.expireWaiter(w, roomID) })
+	r.waiting = append(r.waiting, w)
+	peer.waitingIn = roomID
+	notices := []lobbyNotice{{peer, waitingLocked(w, len(r.waiting)-1, roomID)}}
+	for _, host := range r.hostsLocked() {
+		notices = append(notices, lobbyNotice{host, SignalMessage{Type: "knock", RoomID: roomID, PeerID: peer.ID, From: peer.Subject, Metadata: peer.Metadata()}})
+	}
+	rs.mu.Unlock()
+	peer.roomMu.Unlock()
+	h.notify(notices)
+	return nil
+}
+
+// dequeueLocked removes r's i'th waiter, telling hosts the knock ended with
+// outcome and the waiters behind it their new positions.
+func (h *SignalHub) dequeueLocked(r *room, i int, roomID, outcome string) (*waiter, []lobbyNotice) {
+	w := r.waiting[i]
+	w.timer.Stop()
+	r.waiting = append(r.waiting[:i:i], r.waiting[i+1:]...)
+	var notices []lobbyNotice
+	for _, host := range r.hostsLocked() {
+		notices = append(notices, lobbyNotice{host, SignalMessage{Type: "knock-resolved", RoomID: roomID, PeerID: w.peer.ID, State: outcome}})
+	}
+	for j := i; j < len(r.waiting); j++ {
+		notices = append(notices, lobbyNotice{r.waiting[j].peer, waitingLocked(r.waiting[j], j, roomID)})
+	}
+	return w, notices
+}
+
+// dropIfEmptyLocked deletes r if it has neither members nor waiters, as
+// happens when the last peer leaves the lobby of a room nobody is in.
+// Caller holds rs.mu.
+func (h *SignalHub) dropIfEmptyLocked(rs *roomShard, r *room, roomID, reason string) {
+	key := scopedKey(r.tenant.name, roomID)
+	if len(r.members) > 0 || len(r.waiting) > 0 || rs.rooms[key] != r {
+		return
+	}
+	delete(rs.rooms, key)
+	h.publishEvent(webhook.Event{Type: webhook.EventRoomEmptied, Tenant: r.tenant.name, RoomID: roomID, Reason: reason})
+	// releaseRoom takes tenantMu, which ranks below the shard locks.
+	h.releaseRoom(r.tenant)
+}
+
+// leaveLobbyLocked takes peer out of the lobby it waits in (only as w, when
+// w is set), ending its knock with outcome. Caller holds peer.roomMu.
+func (h *SignalHub) leaveLobbyLocked(peer *Peer, w *waiter, outcome string) bool {
+	roomID := peer.waitingIn
+	key := scopedKey(peer.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	r := rs.rooms[key]
+	i := -1
+	if r != nil {
+		for j, queued := range r.waiting {
+			if queued.peer == peer && (w == nil || queued == w) {
+				i = j
+				break
+			}
+		}
+	}
+	if i < 0 {
+		rs.mu.Unlock()
+		if w == nil {
+			peer.waitingIn = ""
+		}
+		return false
+	}
+	_, notices := h.dequeueLocked(r, i, roomID, outcome)
+	h.dropIfEmptyLocked(rs, r, roomID, outcome)
+	rs.mu.Unlock()
+	peer.waitingIn = ""
+	h.notify(notices)
+	return true
+}
+
+// expireWaiter turns w away once its wait is over.
+func (h *SignalHub) expireWaiter(w *waiter, roomID string) {
+	peer := w.peer
+	peer.roomMu.Lock()
+	expired := peer.waitingIn == roomID && h.leaveLobbyLocked(peer, w, KnockTimeout)
+	peer.roomMu.Unlock()
+	if expired {
+		h.sendToPeer(peer, SignalMessage{Type: "denied", RoomID: roomID, Reason: KnockTimeout})
+	}
+}
+
+// hostRoomLocked returns host's room, which it must be a member and host
+// of. Caller holds rs.mu.
+func hostRoomLocked(rs *roomShard, key string, host *Peer) (*room, error) {
+	r := memberRoomLocked(rs, key, host)
+	switch {
+	case r == nil:
+		return nil, ErrNotInRoom
+	case !host.isHost():
+		return nil, ErrNotHost
+	}
+	return r, nil
+}
+
+// handleKnockAnswer admits or denies the waiting peer msg.PeerID.
+func (h *SignalHub) handleKnockAnswer(host *Peer, msg SignalMessage) {
+	roomID := host.currentRoom()
+	key := scopedKey(host.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	r, err := hostRoomLocked(rs, key, host)
+	i := -1
+	if err == nil {
+		for j, w := range r.waiting {
+			if w.peer.ID == msg.PeerID {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			err = ErrNotWaiting
+		}
+	}
+	if err != nil {
+		rs.mu.Unlock()
+		h.sendToPeer(host, SignalMessage{Type: "error", RoomID: roomID, PeerID: msg.PeerID, Message: err.Error()})
+		return
+	}
+	outcome := KnockDenied
+	if msg.Type == "admit" {
+		outcome = KnockAdmitted
+	}
+	w, notices := h.dequeueLocked(r, i, roomID, outcome)
+	rs.mu.Unlock()
+	h.notify(notices)
+	h.resolve(w.peer, roomID, outcome, msg.Reason)
+}
+
+// resolve lets an admitted waiter in, or tells a denied one why not.
+func (h *SignalHub) resolve(peer *Peer, roomID, outcome, reason string) {
+	if outcome == KnockAdmitted {
+		if err := h.enter(peer, roomID, false, true); err != nil {
+			h.sendToPeer(peer, SignalMessage{Type: "error", RoomID: roomID, Message: err.Error()})
+		}
+		return
+	}
+	peer.roomMu.Lock()
+	waiting := peer.waitingIn == roomID
+	if waiting {
+		peer.waitingIn = ""
+	}
+	peer.roomMu.Unlock()
+	if waiting {
+		h.sendToPeer(peer, SignalMessage{Type: "denied", RoomID: roomID, Reason: reason})
+	}
+}
+
+// handleRoomSettings applies a host's lobby-enable, lobby-disable,
+// room-lock or room-unlock; moderators may lock and unlock too. Disabling
+// the lobby admits everyone waiting; locking turns them away.
+func (h *SignalHub) handleRoomSettings(host *Peer, msgType string) {
+	roomID := host.currentRoom()
+	key := scopedKey(host.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	lock := msgType == "room-lock" || msgType == "room-unlock"
+	var r *room
+	var err error
+	if lock {
+		r, err = moderatedRoomLocked(rs, key, host)
+	} else {
+		r, err = hostRoomLocked(rs, key, host)
+	}
+	if err != nil {
+		rs.mu.Unlock()
+		h.sendToPeer(host, SignalMessage{Type: "error", RoomID: roomID, Message: err.Error()})
+		return
+	}
+	switch msgType {
+	case "lobby-enable":
+		r.lobby = true
+	case "lobby-disable":
+		r.lobby = false
+	case "room-lock":
+		r.locked = true
+	case "room-unlock":
+		r.locked = false
+	}
+	outcome := ""
+	switch {
+	case r.locked:
+		outcome = KnockDenied
+	case !r.lobby:
+		outcome = KnockAdmitted
+	}
+	var resolved []*Peer
+	var notices []lobbyNotice
+	for outcome != "" && len(r.waiting) > 0 {
+		w, n := h.dequeueLocked(r, 0, roomID, outcome)
+		resolved = append(resolved, w.peer)
+		notices = append(notices, n...)
+	}
+	state := SignalMessage{Type: "room-state", RoomID: roomID, State: r.stateLocked()}
+	for _, member := range r.members {
+		notices = append(notices, lobbyNotice{member, state})
+	}
+	rs.mu.Unlock()
+	h.notify(notices)
+	for _, peer := range resolved {
+		h.resolve(peer, roomID, outcome, RoomLocked)
+	}
+	if lock {
+		h.recordAudit(msgType, host, roomID, nil, "", "")
+	}
+}
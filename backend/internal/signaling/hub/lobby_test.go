@@ -0,0 +1,199 @@
+// Package hub — Lobby tests: knocking, admission, timeouts and locking.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+)
+
+// hostedRoom has a host in lobby room r1 of h.
+func hostedRoom(t *testing.T, h *SignalHub) (*testClient, func(query string) *testClient) {
+	t.Helper()
+	srv := newTestServer(t, h)
+	host := dial(t, h, srv, "sub=host&sid=1&role=host")
+	host.send(SignalMessage{Type: "join", RoomID: "r1"})
+	host.expect("joined")
+	host.send(SignalMessage{Type: "lobby-enable"})
+	if state := host.expect("room-state"); state.State != RoomLobby {
+		t.Fatalf("host got %+v", state)
+	}
+	return host, func(query string) *testClient { return dial(t, h, srv, query) }
+}
+
+func TestLobbyAdmitAndDeny(t *testing.T) {
+	h := NewSignalHub(nil)
+	host, dialPeer := hostedRoom(t, h)
+	alice := dialPeer("sub=alice&sid=1")
+	bob := dialPeer("sub=bob&sid=1")
+
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if w := alice.expect("waiting"); w.Position != 1 || w.Timeout < 1 {
+		t.Fatalf("alice got %+v", w)
+	}
+	if knock := host.expect("knock"); knock.PeerID != "alice-1" || knock.From != "alice" {
+		t.Fatalf("host got %+v", knock)
+	}
+	bob.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if w := bob.expect("waiting"); w.Position != 2 {
+		t.Fatalf("bob got %+v", w)
+	}
+	host.expect("knock")
+
+	// Only hosts in the room answer knocks.
+	bob.send(SignalMessage{Type: "admit", PeerID: "alice-1"})
+	if e := bob.expect("error"); e.Message != ErrNotInRoom.Error() {
+		t.Fatalf("bob got %+v", e)
+	}
+	host.send(SignalMessage{Type: "deny", PeerID: "alice-1", Reason: "not invited"})
+	if resolved := host.expect("knock-resolved"); resolved.PeerID != "alice-1" || resolved.State != KnockDenied {
+		t.Fatalf("host got %+v", resolved)
+	}
+	if denied := alice.expect("denied"); denied.RoomID != "r1" || denied.Reason != "not invited" {
+		t.Fatalf("alice got %+v", denied)
+	}
+	if w := bob.expect("waiting"); w.Position != 1 {
+		t.Fatalf("bob moved to %+v", w)
+	}
+
+	host.send(SignalMessage{Type: "admit", PeerID: "bob-1"})
+	host.expect("knock-resolved")
+	if joined := bob.expect("joined"); len(joined.Peers) != 1 || joined.State != RoomLobby {
+		t.Fatalf("bob got %+v", joined)
+	}
+	host.expect("peer_joined")
+	host.send(SignalMessage{Type: "admit", PeerID: "bob-1"})
+	if e := host.expect("error"); e.Message != ErrNotWaiting.Error() {
+		t.Fatalf("host got %+v", e)
+	}
+	bob.send(SignalMessage{Type: "lobby-disable"})
+	if e := bob.expect("error"); e.Message != ErrNotHost.Error() {
+		t.Fatalf("bob got %+v", e)
+	}
+}
+
+func TestLobbyTimeoutAndLeaving(t *testing.T) {
+	h := NewSignalHub(nil, WithLobbyTimeout(200*time.Millisecond))
+	host, dialPeer := hostedRoom(t, h)
+	alice := dialPeer("sub=alice&sid=1")
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("waiting")
+	host.expect("knock")
+	if denied := alice.expect("denied"); denied.Reason != KnockTimeout {
+		t.Fatalf("alice got %+v", denied)
+	}
+	if resolved := host.expect("knock-resolved"); resolved.State != KnockTimeout {
+		t.Fatalf("host got %+v", resolved)
+	}
+
+	// The room outlives its members while someone waits, and is deleted
+	// once its last waiter disconnects.
+	bob := dialPeer("sub=bob&sid=1")
+	bob.send(SignalMessage{Type: "join", RoomID: "r1"})
+	bob.expect("waiting")
+	host.expect("knock")
+	host.send(SignalMessage{Type: "leave"})
+	carol := dialPeer("sub=carol&sid=1")
+	carol.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if w := carol.expect("waiting"); w.Position != 2 {
+		t.Fatalf("carol got %+v", w)
+	}
+	carol.conn.Close()
+	bob.conn.Close()
+	key := scopedKey(DefaultTenant, "r1")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rs := h.roomShardFor(key)
+		rs.mu.Lock()
+		_, exists := rs.rooms[key]
+		rs.mu.Unlock()
+		if !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("room outlived its lobby")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLockedRoom(t *testing.T) {
+	h := NewSignalHub(nil)
+	host, dialPeer := hostedRoom(t, h)
+	alice := dialPeer("sub=alice&sid=1")
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("waiting")
+	host.expect("knock")
+
+	host.send(SignalMessage{Type: "room-lock"})
+	host.expect("knock-resolved")
+	if state := host.expect("room-state"); state.State != RoomLocked {
+		t.Fatalf("host got %+v", state)
+	}
+	if denied := alice.expect("denied"); denied.Reason != RoomLocked {
+		t.Fatalf("alice got %+v", denied)
+	}
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if e := alice.expect("error"); e.Message != ErrRoomLocked.Error() {
+		t.Fatalf("alice got %+v", e)
+	}
+	// Hosts still enter a locked room.
+	cohost := dialPeer("sub=cohost&sid=1&role=host")
+	cohost.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if joined := cohost.expect("joined"); joined.State != RoomLocked {
+		t.Fatalf("cohost got %+v", joined)
+	}
+	host.expect("peer_joined")
+
+	// Unlocking returns to the lobby; disabling it admits the queue.
+	host.send(SignalMessage{Type: "room-unlock"})
+	host.expect("room-state")
+	cohost.expect("room-state")
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("waiting")
+	host.expect("knock")
+	cohost.expect("knock")
+	cohost.send(SignalMessage{Type: "lobby-disable"})
+	if joined := alice.expect("joined"); len(joined.Peers) != 2 || joined.State != "" {
+		t.Fatalf("alice got %+v", joined)
+	}
+}
+
+func TestLobbyByDefault(t *testing.T) {
+	h := NewSignalHub(nil, WithLobbyByDefault())
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("waiting")
+	host := dial(t, h, srv, "sub=host&sid=1&role=host")
+	host.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if joined := host.expect("joined"); len(joined.Peers) != 0 || joined.State != RoomLobby {
+		t.Fatalf("host got %+v", joined)
+	}
+	if knock := host.expect("knock"); knock.PeerID != "alice-1" {
+		t.Fatalf("host got %+v", knock)
+	}
+
+	// Socketless peers cannot wait.
+	local, err := h.RegisterLocal("whip-1", &contracts.Claims{Subject: "whip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.HandleMessage(local, SignalMessage{Type: "join", RoomID: "r1"})
+	var e SignalMessage
+	if err := json.Unmarshal(<-local.Send, &e); err != nil || e.Message != ErrLobbyRequired.Error() {
+		t.Fatalf("local peer got %+v, %v", e, err)
+	}
+
+	if n, err := h.CloseRoom("", "r1", "over"); err != nil || n != 1 {
+		t.Fatalf("close: %d, %v", n, err)
+	}
+	if denied := alice.expect("denied"); denied.Reason != "over" {
+		t.Fatalf("alice got %+v", denied)
+	}
+}
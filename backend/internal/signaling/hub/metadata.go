@@ -0,0 +1,106 @@
+// Package hub — Peer metadata: display names and device details.
+//
+// Peer IDs are opaque, so peers may describe themselves with PeerMetadata,
+// on join or at any time with a metadata message. Metadata replaces the
+// peer's previous metadata as a whole; members see it in joined's members,
+// peer_joined and knock, and receive every later change as a metadata
+// message.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+)
+
+// Metadata limits.
+const (
+	maxDisplayName = 64
+	maxAvatarURL   = 512
+	maxDevice      = 32
+	maxAppFields   = 16
+	maxAppKey      = 32
+	maxAppValue    = 256
+)
+
+// ErrInvalidMetadata is returned for metadata over the limits.
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+// PeerMetadata is what a peer tells room members about itself.
+type PeerMetadata struct {
+	DisplayName string `json:"displayName,omitempty"`
+	// AvatarURL is an http or https URL.
+	AvatarURL string `json:"avatarUrl,omitempty"`
+	// Device is a free-form device type, such as "desktop" or "phone".
+	Device string `json:"device,omitempty"`
+	// App holds application-defined fields.
+	App map[string]string `json:"app,omitempty"`
+}
+
+// Member is a room member listed in joined.
+type Member struct {
+	PeerID   string        `json:"peerId"`
+	Metadata *PeerMetadata `json:"metadata,omitempty"`
+}
+
+// validate checks m against the metadata limits.
+func (m *PeerMetadata) validate() error {
+	switch {
+	case utf8.RuneCountInString(m.DisplayName) > maxDisplayName:
+		return fmt.Errorf("%w: displayName exceeds %d characters", ErrInvalidMetadata, maxDisplayName)
+	case len(m.AvatarURL) > maxAvatarURL:
+		return fmt.Errorf("%w: avatarUrl exceeds %d bytes", ErrInvalidMetadata, maxAvatarURL)
+	case utf8.RuneCountInString(m.Device) > maxDevice:
+		return fmt.Errorf("%w: device exceeds %d characters", ErrInvalidMetadata, maxDevice)
+	case len(m.App) > maxAppFields:
+		return fmt.Errorf("%w: more than %d app fields", ErrInvalidMetadata, maxAppFields)
+	}
+	if m.AvatarURL != "" {
+		u, err := url.Parse(m.AvatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: avatarUrl must be an http or https URL", ErrInvalidMetadata)
+		}
+	}
+	for k, v := range m.App {
+		if k == "" || len(k) > maxAppKey || len(v) > maxAppValue {
+			return fmt.Errorf("%w: app fields need keys of 1-%d bytes and values of at most %d", ErrInvalidMetadata, maxAppKey, maxAppValue)
+		}
+	}
+	return nil
+}
+
+// Metadata returns the peer's metadata, nil if it has set none.
+func (p *Peer) Metadata() *PeerMetadata {
+	return p.metadata.Load()
+}
+
+// setMetadata validates m and makes it peer's metadata.
+func (p *Peer) setMetadata(m *PeerMetadata) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	p.metadata.Store(m)
+	return nil
+}
+
+// handleMetadata replaces the sender's metadata and tells its room.
+func (h *SignalHub) handleMetadata(peer *Peer, msg SignalMessage) {
+	if msg.Metadata == nil {
+		msg.Metadata = &PeerMetadata{}
+	}
+	if err := peer.setMetadata(msg.Metadata); err != nil {
+		h.sendToPeer(peer, SignalMessage{Type: "error", ID: msg.ID, Message: err.Error()})
+		return
+	}
+	roomID := peer.currentRoom()
+	if roomID == "" || peer.hidden {
+		return
+	}
+	update := SignalMessage{Type: "metadata", RoomID: roomID, PeerID: peer.ID, Metadata: msg.Metadata}
+	for _, member := range h.roomMembers(peer.Tenant, roomID, peer.ID) {
+		h.sendToPeer(member, update)
+	}
+}
@@ -0,0 +1,39 @@
+// Package hub — Peer metadata tests.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadataReachesMembers(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	alice.send(SignalMessage{Type: "join", RoomID: "r1", Metadata: &PeerMetadata{DisplayName: "Alice", Device: "desktop"}})
+	alice.expect("joined")
+	bob.send(SignalMessage{Type: "join", RoomID: "r1", Metadata: &PeerMetadata{AvatarURL: "ftp://example.com/b.png"}})
+	if e := bob.expect("error"); !strings.HasPrefix(e.Message, ErrInvalidMetadata.Error()) {
+		t.Fatalf("bob got %+v", e)
+	}
+	bob.send(SignalMessage{Type: "join", RoomID: "r1", Metadata: &PeerMetadata{DisplayName: "Bob", App: map[string]string{"team": "blue"}}})
+	joined := bob.expect("joined")
+	if len(joined.Members) != 1 || joined.Members[0].PeerID != "alice-1" || joined.Members[0].Metadata.DisplayName != "Alice" {
+		t.Fatalf("bob joined with members %+v", joined.Members)
+	}
+	if pj := alice.expect("peer_joined"); pj.Metadata == nil || pj.Metadata.App["team"] != "blue" {
+		t.Fatalf("alice got %+v", pj)
+	}
+
+	bob.send(SignalMessage{Type: "metadata", Metadata: &PeerMetadata{DisplayName: "Robert"}})
+	if m := alice.expect("metadata"); m.PeerID != "bob-1" || m.RoomID != "r1" || m.Metadata.DisplayName != "Robert" || m.Metadata.App != nil {
+		t.Fatalf("alice got %+v", m)
+	}
+	bob.expectNone(100 * time.Millisecond)
+}
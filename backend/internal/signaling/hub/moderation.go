@@ -0,0 +1,195 @@
+// Package hub — Moderation: room members acting on other members.
+//
+// Hosts and moderators (peers whose token carries either role) may remove
+// members from their room, either until they rejoin (kick) or for as long as
+// the room exists (ban, which applies to every device of the member's
+// subject), ask a member to mute a track, lock the room (lock and unlock,
+// or room-lock and room-unlock; see lobby.go) and end it for everyone.
+// Hosts and moderators cannot be removed by each other. Every action is
+// recorded with WithAudit.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"errors"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/audit"
+)
+
+// RoleModerator is the role claim of peers that moderate rooms without
+// screening their lobbies.
+const RoleModerator = "moderator"
+
+// Track kinds a mute request names in its mode.
+const (
+	MediaAudio = "audio"
+	MediaVideo = "video"
+)
+
+// Moderation errors reported to clients.
+var (
+	ErrNotModerator  = errors.New("only hosts and moderators may do this")
+	ErrProtectedPeer = errors.New("hosts and moderators cannot be removed")
+	ErrBanned        = errors.New("banned from room")
+	ErrInvalidMedia  = errors.New("mode must be audio or video")
+)
+
+// WithAudit records every moderation action.
+func WithAudit(recorder audit.Recorder) Option {
+	return func(h *SignalHub) { h.audit = recorder }
+}
+
+func (p *Peer) canModerate() bool {
+	return p.role == RoleHost || p.role == RoleModerator
+}
+
+// moderatedRoomLocked returns mod's room, which it must be a member and
+// moderator of. Caller holds rs.mu.
+func moderatedRoomLocked(rs *roomShard, key string, mod *Peer) (*room, error) {
+	r := memberRoomLocked(rs, key, mod)
+	switch {
+	case r == nil:
+		return nil, ErrNotInRoom
+	case !mod.canModerate():
+		return nil, ErrNotModerator
+	}
+	return r, nil
+}
+
+// recordAudit records mod's action in roomID, on target if set.
+func (h *SignalHub) recordAudit(action string, mod *Peer, roomID string, target *Peer, media, reason string) {
+	e := audit.Entry{
+		Tenant:    mod.Tenant,
+		RoomID:    roomID,
+		Action:    action,
+		Actor:     mod.Subject,
+		ActorPeer: mod.ID,
+		Media:     media,
+		Reason:    reason,
+	}
+	if target != nil {
+		e.Target, e.TargetPeer = target.Subject, target.ID
+	}
+	h.audit.Record(e)
+}
+
+// handleRemoval applies a kick or ban of msg.PeerID. The removed peers and
+// the remaining members are told with peer-removed.
+func (h *SignalHub) handleRemoval(mod *Peer, msg SignalMessage) {
+	roomID := mod.currentRoom()
+	key := scopedKey(mod.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	r, err := moderatedRoomLocked(rs, key, mod)
+	var target *Peer
+	if err == nil {
+		target = r.members[msg.PeerID]
+		switch {
+		case target == nil:
+			err = ErrNoSuchPeer
+		case target.canModerate():
+			err = ErrProtectedPeer
+		}
+	}
+	if err != nil {
+		rs.mu.Unlock()
+		h.sendToPeer(mod, SignalMessage{Type: "error", RoomID: roomID, PeerID: msg.PeerID, Message: err.Error()})
+		return
+	}
+	cause := leaveCauseKicked
+	targets := []*Peer{target}
+	var denied []*Peer
+	var notices []lobbyNotice
+	if msg.Type == "ban" {
+		// A ban covers the subject's other devices, in the room or its
+		// lobby, and its later joins.
+		cause = leaveCauseBanned
+		if r.banned == nil {
+			r.banned = make(map[string]bool)
+		}
+		r.banned[target.Subject] = true
+		for _, p := range r.members {
+			if p != target && p.Subject == target.Subject {
+				targets = append(targets, p)
+			}
+		}
+		for i := 0; i < len(r.waiting); {
+			if r.waiting[i].peer.Subject != target.Subject {
+				i++
+				continue
+			}
+			w, n := h.dequeueLocked(r, i, roomID, KnockDenied)
+			denied = append(denied, w.peer)
+			notices = append(notices, n...)
+		}
+	}
+	rs.mu.Unlock()
+	h.notify(notices)
+	for _, p := range denied {
+		h.resolve(p, roomID, KnockDenied, cause)
+	}
+
+	for _, p := range targets {
+		p.roomMu.Lock()
+		present := p.RoomID == roomID && !p.removed.Load()
+		if present {
+			h.removeFromRoomLocked(p, cause)
+		}
+		p.roomMu.Unlock()
+		if !present {
+			continue
+		}
+		removed := SignalMessage{Type: "peer-removed", RoomID: roomID, PeerID: p.ID, From: mod.Subject, State: cause, Reason: msg.Reason}
+		h.sendToPeer(p, removed)
+		for _, member := range h.roomMembers(mod.Tenant, roomID, "") {
+			h.sendToPeer(member, removed)
+		}
+		h.recordAudit(msg.Type, mod, roomID, p, "", msg.Reason)
+	}
+}
+
+// handleMuteRequest asks msg.PeerID to mute its msg.Mode track. Muting is
+// up to the client; the hub only relays the request.
+func (h *SignalHub) handleMuteRequest(mod *Peer, msg SignalMessage) {
+	roomID := mod.currentRoom()
+	key := scopedKey(mod.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	r, err := moderatedRoomLocked(rs, key, mod)
+	var target *Peer
+	if err == nil {
+		target = r.members[msg.PeerID]
+		switch {
+		case target == nil:
+			err = ErrNoSuchPeer
+		case msg.Mode != MediaAudio && msg.Mode != MediaVideo:
+			err = ErrInvalidMedia
+		}
+	}
+	rs.mu.Unlock()
+	if err != nil {
+		h.sendToPeer(mod, SignalMessage{Type: "error", RoomID: roomID, PeerID: msg.PeerID, Message: err.Error()})
+		return
+	}
+	h.sendToPeer(target, SignalMessage{Type: "request-mute", RoomID: roomID, PeerID: mod.ID, From: mod.Subject, Mode: msg.Mode, Reason: msg.Reason})
+	h.recordAudit(msg.Type, mod, roomID, target, msg.Mode, msg.Reason)
+}
+
+// handleEndForAll closes mod's room, as CloseRoom does for operators.
+func (h *SignalHub) handleEndForAll(mod *Peer, msg SignalMessage) {
+	roomID := mod.currentRoom()
+	key := scopedKey(mod.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	_, err := moderatedRoomLocked(rs, key, mod)
+	rs.mu.Unlock()
+	if err == nil {
+		_, err = h.closeRoom(mod.Tenant, roomID, msg.Reason, mod.Subject)
+	}
+	if err != nil {
+		h.sendToPeer(mod, SignalMessage{Type: "error", RoomID: roomID, Message: err.Error()})
+		return
+	}
+	h.recordAudit(msg.Type, mod, roomID, nil, "", msg.Reason)
+}
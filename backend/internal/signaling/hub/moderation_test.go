@@ -0,0 +1,210 @@
+// Package hub — Moderation tests: kicks, bans, mute requests, locking and
+// ending rooms, and their audit trail.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/audit"
+)
+
+type auditLog struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (l *auditLog) Record(e audit.Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+}
+
+// actions returns the recorded actions as "action:actor>target".
+func (l *auditLog) actions() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []string
+	for _, e := range l.entries {
+		out = append(out, e.Action+":"+e.ActorPeer+">"+e.TargetPeer)
+	}
+	return out
+}
+
+// moderatedRoom has a moderator and members bob and carol (on two devices)
+// in room r1.
+func moderatedRoom(t *testing.T, h *SignalHub) (mod, bob, carol, carol2 *testClient, dialPeer func(string) *testClient) {
+	t.Helper()
+	srv := newTestServer(t, h)
+	dialPeer = func(query string) *testClient { return dial(t, h, srv, query) }
+	mod = dialPeer("sub=mod&sid=1&role=moderator")
+	bob = dialPeer("sub=bob&sid=1")
+	carol = dialPeer("sub=carol&sid=1")
+	carol2 = dialPeer("sub=carol&sid=2")
+	var joined []*testClient
+	for _, c := range []*testClient{mod, bob, carol, carol2} {
+		c.send(SignalMessage{Type: "join", RoomID: "r1"})
+		c.expect("joined")
+		for _, member := range joined {
+			member.expect("peer_joined")
+		}
+		joined = append(joined, c)
+	}
+	return mod, bob, carol, carol2, dialPeer
+}
+
+func TestKickAndBan(t *testing.T) {
+	log := &auditLog{}
+	h := NewSignalHub(nil, WithAudit(log))
+	mod, bob, carol, carol2, dialPeer := moderatedRoom(t, h)
+
+	// Members may not moderate, and moderators may not remove each other.
+	bob.send(SignalMessage{Type: "kick", PeerID: "carol-1"})
+	if e := bob.expect("error"); e.Message != ErrNotModerator.Error() {
+		t.Fatalf("bob got %+v", e)
+	}
+	mod.send(SignalMessage{Type: "kick", PeerID: "mod-1"})
+	if e := mod.expect("error"); e.Message != ErrProtectedPeer.Error() {
+		t.Fatalf("mod got %+v", e)
+	}
+
+	mod.send(SignalMessage{Type: "kick", PeerID: "bob-1", Reason: "spam"})
+	for _, c := range []*testClient{bob, mod, carol, carol2} {
+		if removed := c.expect("peer-removed"); removed.PeerID != "bob-1" || removed.State != "kicked" || removed.From != "mod" || removed.Reason != "spam" {
+			t.Fatalf("%s got %+v", c.id, removed)
+		}
+	}
+	// A kicked peer may come back.
+	bob.send(SignalMessage{Type: "join", RoomID: "r1"})
+	bob.expect("joined")
+	for _, c := range []*testClient{mod, carol, carol2} {
+		c.expect("peer_joined")
+	}
+
+	// A ban removes every device of the subject and keeps it out.
+	mod.send(SignalMessage{Type: "ban", PeerID: "carol-1"})
+	seen := map[string]int{}
+	for _, c := range []*testClient{mod, bob} {
+		for i := 0; i < 2; i++ {
+			removed := c.expect("peer-removed")
+			if removed.State != "banned" {
+				t.Fatalf("%s got %+v", c.id, removed)
+			}
+			seen[removed.PeerID]++
+		}
+	}
+	if seen["carol-1"] != 2 || seen["carol-2"] != 2 {
+		t.Fatalf("removals seen %v", seen)
+	}
+	carol.expect("peer-removed")
+	// carol-2 sees carol-1 go first, then its own removal.
+	carol2.expect("peer-removed")
+	if removed := carol2.expect("peer-removed"); removed.PeerID != "carol-2" {
+		t.Fatalf("carol-2 got %+v", removed)
+	}
+	carol2.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if e := carol2.expect("error"); e.Message != ErrBanned.Error() {
+		t.Fatalf("carol got %+v", e)
+	}
+	carol3 := dialPeer("sub=carol&sid=3")
+	carol3.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if e := carol3.expect("error"); e.Message != ErrBanned.Error() {
+		t.Fatalf("carol's new device got %+v", e)
+	}
+
+	got := log.actions()
+	if len(got) != 3 || got[0] != "kick:mod-1>bob-1" || got[1][:4] != "ban:" {
+		t.Fatalf("audit trail %v", got)
+	}
+}
+
+func TestLockAndUnlockAliases(t *testing.T) {
+	log := &auditLog{}
+	h := NewSignalHub(nil, WithAudit(log))
+	mod, bob, carol, carol2, dialPeer := moderatedRoom(t, h)
+
+	bob.send(SignalMessage{Type: "lock"})
+	if e := bob.expect("error"); e.Message != ErrNotModerator.Error() {
+		t.Fatalf("bob got %+v", e)
+	}
+	mod.send(SignalMessage{Type: "lock"})
+	for _, c := range []*testClient{mod, bob, carol, carol2} {
+		if state := c.expect("room-state"); state.State != RoomLocked {
+			t.Fatalf("%s got %+v", c.id, state)
+		}
+	}
+	dave := dialPeer("sub=dave&sid=1")
+	dave.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if e := dave.expect("error"); e.Message != ErrRoomLocked.Error() {
+		t.Fatalf("dave got %+v", e)
+	}
+	mod.send(SignalMessage{Type: "unlock"})
+	for _, c := range []*testClient{mod, bob, carol, carol2} {
+		if state := c.expect("room-state"); state.State != RoomOpen {
+			t.Fatalf("%s got %+v", c.id, state)
+		}
+	}
+	dave.send(SignalMessage{Type: "join", RoomID: "r1"})
+	dave.expect("joined")
+
+	want := []string{"room-lock:mod-1>", "room-unlock:mod-1>"}
+	if got := log.actions(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("audit trail %v, want %v", got, want)
+	}
+}
+
+func TestMuteRequestLockAndEnd(t *testing.T) {
+	log := &auditLog{}
+	h := NewSignalHub(nil, WithAudit(log))
+	mod, bob, carol, carol2, dialPeer := moderatedRoom(t, h)
+
+	mod.send(SignalMessage{Type: "request-mute", PeerID: "bob-1", Mode: "screen"})
+	if e := mod.expect("error"); e.Message != ErrInvalidMedia.Error() {
+		t.Fatalf("mod got %+v", e)
+	}
+	mod.send(SignalMessage{Type: "request-mute", PeerID: "bob-1", Mode: MediaAudio, Reason: "echo"})
+	if req := bob.expect("request-mute"); req.PeerID != "mod-1" || req.Mode != MediaAudio || req.Reason != "echo" {
+		t.Fatalf("bob got %+v", req)
+	}
+
+	// Moderators lock rooms too.
+	mod.send(SignalMessage{Type: "room-lock"})
+	for _, c := range []*testClient{mod, bob, carol, carol2} {
+		if state := c.expect("room-state"); state.State != RoomLocked {
+			t.Fatalf("%s got %+v", c.id, state)
+		}
+	}
+	dave := dialPeer("sub=dave&sid=1")
+	dave.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if e := dave.expect("error"); e.Message != ErrRoomLocked.Error() {
+		t.Fatalf("dave got %+v", e)
+	}
+
+	bob.send(SignalMessage{Type: "end-for-all"})
+	if e := bob.expect("error"); e.Message != ErrNotModerator.Error() {
+		t.Fatalf("bob got %+v", e)
+	}
+	mod.send(SignalMessage{Type: "end-for-all", Reason: "done"})
+	for _, c := range []*testClient{mod, bob, carol, carol2} {
+		if closed := c.expect("room-closed"); closed.From != "mod" || closed.Reason != "done" {
+			t.Fatalf("%s got %+v", c.id, closed)
+		}
+	}
+	// The room is gone, and with it the lock.
+	dave.send(SignalMessage{Type: "join", RoomID: "r1"})
+	dave.expect("joined")
+
+	want := []string{"request-mute:mod-1>bob-1", "room-lock:mod-1>", "end-for-all:mod-1>"}
+	got := log.actions()
+	if len(got) != len(want) {
+		t.Fatalf("audit trail %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("audit trail %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package hub — SDP and ICE candidate policies applied to relayed messages.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/candidate"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/sdp"
+)
+
+const (
+	hostCandidate  = "candidate:1 1 udp 2122260223 192.168.1.5 54321 typ host generation 0"
+	relayCandidate = "candidate:2 1 udp 41885439 198.51.100.9 3478 typ relay raddr 203.0.113.7 rport 61204 generation 0"
+)
+
+// policyOffer is an audio offer with three codecs and a host and a relay
+// candidate.
+const policyOffer = "v=0\r\no=- 1 2 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n" +
+	"m=audio 54321 UDP/TLS/RTP/SAVPF 111 9 0\r\nc=IN IP4 192.168.1.5\r\n" +
+	"a=rtcp:54321 IN IP4 192.168.1.5\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\na=rtpmap:9 G722/8000\r\na=rtpmap:0 PCMU/8000\r\n" +
+	"a=" + hostCandidate + "\r\na=" + relayCandidate + "\r\n"
+
+// policyPair dials alice and bob in tenant into room.
+func policyPair(t *testing.T, h *SignalHub, tenant, room string) (alice, bob *testClient) {
+	t.Helper()
+	srv := newTestServer(t, h)
+	alice = dial(t, h, srv, "sub=alice&sid=1&tenant="+tenant)
+	bob = dial(t, h, srv, "sub=bob&sid=1&tenant="+tenant)
+	alice.expectJoin(t, room)
+	bob.expectJoin(t, room)
+	alice.expect("peer_joined")
+	return alice, bob
+}
+
+func TestRelayedSDPFollowsPolicyPrecedence(t *testing.T) {
+	h := NewSignalHub(nil, WithSDPPolicies(&sdp.PolicySet{
+		Default: &sdp.Policy{Audio: sdp.MediaPolicy{Strip: []string{"PCMU"}}},
+		Tenants: map[string]*sdp.Policy{"acme": {Audio: sdp.MediaPolicy{Strip: []string{"G722"}}}},
+		Rooms: map[string]map[string]*sdp.Policy{
+			"acme": {"mobile": {Audio: sdp.MediaPolicy{MaxBitrateKbps: 64}}},
+		},
+	}))
+
+	for _, tc := range []struct {
+		tenant, room string
+		kept, gone   string
+		capped       bool
+	}{
+		{"acme", "lobby", "PCMU", "G722", false},    // tenant policy
+		{"acme", "mobile", "G722", "", true},        // room policy wins
+		{"globex", "mobile", "G722", "PCMU", false}, // acme's room policy stays in acme
+	} {
+		alice, bob := policyPair(t, h, tc.tenant, tc.room)
+		alice.send(SignalMessage{Type: "offer", PeerID: bob.id, SDP: policyOffer})
+		offer := bob.expect("offer")
+		if !strings.Contains(offer.SDP, tc.kept) || (tc.gone != "" && strings.Contains(offer.SDP, tc.gone)) {
+			t.Errorf("%s/%s: relayed SDP kept the wrong codecs:\n%s", tc.tenant, tc.room, offer.SDP)
+		}
+		if capped := strings.Contains(offer.SDP, "b=AS:64"); capped != tc.capped {
+			t.Errorf("%s/%s: bitrate cap applied = %v", tc.tenant, tc.room, capped)
+		}
+		report := alice.expect("sdp-policy")
+		if report.PeerID != bob.id || report.Policy == nil {
+			t.Errorf("%s/%s: unexpected report %+v", tc.tenant, tc.room, report)
+		}
+	}
+}
+
+// sendCandidate trickles candidate from c to peerID.
+func sendCandidate(t *testing.T, c *testClient, peerID, cand string) {
+	t.Helper()
+	init, _ := json.Marshal(candidate.Init{Candidate: cand})
+	c.send(SignalMessage{Type: "ice-candidate", PeerID: peerID, Candidate: init})
+}
+
+func TestRelayOnlyRoomHidesPeerAddresses(t *testing.T) {
+	h := NewSignalHub(nil, WithICEPolicies(&candidate.PolicySet{
+		Rooms: map[string]map[string]*candidate.Policy{
+			DefaultTenant: {"secure": {RelayOnly: true}},
+		},
+	}))
+
+	alice, bob := policyPair(t, h, "", "secure")
+	// Messages from one sender arrive in order, so the host candidate was
+	// dropped if the relay candidate comes first.
+	sendCandidate(t, alice, bob.id, hostCandidate)
+	sendCandidate(t, alice, bob.id, relayCandidate)
+	var init candidate.Init
+	if err := json.Unmarshal(bob.expect("ice-candidate").Candidate, &init); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(init.Candidate, "typ relay raddr 0.0.0.0 rport 0") {
+		t.Errorf("relay candidate not redacted: %q", init.Candidate)
+	}
+
+	alice.send(SignalMessage{Type: "offer", PeerID: bob.id, SDP: policyOffer})
+	offer := bob.expect("offer").SDP
+	for _, leak := range []string{"192.168.1.5", "203.0.113.7", "typ host"} {
+		if strings.Contains(offer, leak) {
+			t.Errorf("relayed SDP leaks %q:\n%s", leak, offer)
+		}
+	}
+	if !strings.Contains(offer, "c=IN IP4 0.0.0.0") || !strings.Contains(offer, "m=audio 9 ") {
+		t.Errorf("relayed SDP not blanked:\n%s", offer)
+	}
+
+	// Rooms without a policy relay candidates untouched, as do other
+	// tenants' rooms of the same name.
+	for _, tenant := range []string{"", "acme"} {
+		room := "open"
+		if tenant == "acme" {
+			room = "secure"
+		}
+		alice, bob := policyPair(t, h, tenant, room)
+		sendCandidate(t, alice, bob.id, hostCandidate)
+		if err := json.Unmarshal(bob.expect("ice-candidate").Candidate, &init); err != nil || init.Candidate != hostCandidate {
+			t.Errorf("%q/%s: got %q, %v", tenant, room, init.Candidate, err)
+		}
+	}
+}
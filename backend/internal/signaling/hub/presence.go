@@ -0,0 +1,252 @@
+// Package hub — User presence across the hub.
+//
+// Presence is per subject within a tenant, whatever room its devices are
+// in: offline without connected devices, in-call while it has an answered
+// call, and otherwise the most available status its devices chose (busy,
+// then online, then away; devices start online). Peers query it and
+// subscribe to it with presence-query and presence-subscribe; in-process
+// code uses Presence and WatchPresence. presenceMu is taken before callMu
+// and the shard locks, never while holding them.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Presence states.
+const (
+	PresenceOffline = "offline"
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceBusy    = "busy"
+	PresenceInCall  = "in-call"
+)
+
+// Presence request limits.
+const (
+	maxPresenceUsers         = 100
+	maxPresenceSubscriptions = 1000
+)
+
+// Presence errors reported to clients.
+var (
+	ErrInvalidPresence  = errors.New("state must be online, away or busy")
+	ErrPresenceRequest  = errors.New("presence requests name 1-100 users")
+	ErrPresenceSubLimit = errors.New("too many presence subscriptions")
+)
+
+// PresenceUpdate is a subject's new presence state.
+type PresenceUpdate struct {
+	Tenant    string
+	Subject   string
+	State     string
+	Timestamp time.Time
+}
+
+// presenceEntry is a subject's last published state and who follows it;
+// guarded by presenceMu. Entries exist while the subject is not offline or
+// is followed.
+type presenceEntry struct {
+	state       string
+	subscribers map[*Peer]struct{}
+	watchers    map[chan PresenceUpdate]struct{}
+}
+
+// presenceRank orders device statuses by availability.
+var presenceRank = map[string]int{PresenceAway: 1, PresenceOnline: 2, PresenceBusy: 3}
+
+// presenceStateLocked derives subject's state. Caller holds presenceMu.
+func (h *SignalHub) presenceStateLocked(tenant, subject string) string {
+	devices := h.subjectPeers(tenant, subject)
+	if len(devices) == 0 {
+		return PresenceOffline
+	}
+	h.callMu.Lock()
+	call := h.calls[scopedKey(tenant, h.activeCalls[scopedKey(tenant, subject)])]
+	inCall := call != nil && call.State == CallAccepted
+	h.callMu.Unlock()
+	if inCall {
+		return PresenceInCall
+	}
+	state := PresenceAway
+	for _, d := range devices {
+		status := d.status
+		if status == "" {
+			status = PresenceOnline
+		}
+		if presenceRank[status] > presenceRank[state] {
+			state = status
+		}
+	}
+	return state
+}
+
+// entryLocked returns subject's entry, creating it. Caller holds
+// presenceMu.
+func (h *SignalHub) entryLocked(key string) *presenceEntry {
+	e := h.presence[key]
+	if e == nil {
+		e = &presenceEntry{
+			state:       PresenceOffline,
+			subscribers: make(map[*Peer]struct{}),
+			watchers:    make(map[chan PresenceUpdate]struct{}),
+		}
+		h.presence[key] = e
+	}
+	return e
+}
+
+// pruneLocked drops e once nothing needs it. Caller holds presenceMu.
+func (h *SignalHub) pruneLocked(key string, e *presenceEntry) {
+	if e.state == PresenceOffline && len(e.subscribers) == 0 && len(e.watchers) == 0 {
+		delete(h.presence, key)
+	}
+}
+
+// updatePresence recomputes subject's state and tells its followers if it
+// changed. Messages are queued under presenceMu so followers see changes in
+// order.
+func (h *SignalHub) updatePresence(tenant, subject string) {
+	key := scopedKey(tenant, subject)
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	state := h.presenceStateLocked(tenant, subject)
+	e := h.presence[key]
+	if (e == nil && state == PresenceOffline) || (e != nil && e.state == state) {
+		return
+	}
+	e = h.entryLocked(key)
+	e.state = state
+	update := PresenceUpdate{Tenant: tenant, Subject: subject, State: state, Timestamp: time.Now().UTC()}
+	for ch := range e.watchers {
+		select {
+		case ch <- update:
+		default:
+			log.Printf("dropped presence update for a watcher in tenant %s", tenant)
+		}
+	}
+	msg := SignalMessage{Type: "presence", Presence: map[string]string{subject: state}}
+	for p := range e.subscribers {
+		h.sendToPeer(p, msg)
+	}
+	h.pruneLocked(key, e)
+}
+
+// Presence returns the presence state of each of tenant's subjects.
+func (h *SignalHub) Presence(tenant string, subjects ...string) map[string]string {
+	tenant = tenantOf(tenant)
+	states := make(map[string]string, len(subjects))
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	for _, subject := range subjects {
+		states[subject] = h.presenceStateLocked(tenant, subject)
+	}
+	return states
+}
+
+// WatchPresence streams changes to the presence of tenant's subjects until
+// stop is called. Updates a slow reader has no room for are dropped.
+func (h *SignalHub) WatchPresence(tenant string, subjects ...string) (updates <-chan PresenceUpdate, stop func()) {
+	tenant = tenantOf(tenant)
+	ch := make(chan PresenceUpdate, watchBuffer)
+	h.presenceMu.Lock()
+	for _, subject := range subjects {
+		h.entryLocked(scopedKey(tenant, subject)).watchers[ch] = struct{}{}
+	}
+	h.presenceMu.Unlock()
+	var stopped bool
+	return ch, func() {
+		h.presenceMu.Lock()
+		defer h.presenceMu.Unlock()
+		if stopped {
+			return
+		}
+		stopped = true
+		for _, subject := range subjects {
+			key := scopedKey(tenant, subject)
+			if e := h.presence[key]; e != nil {
+				delete(e.watchers, ch)
+				h.pruneLocked(key, e)
+			}
+		}
+		close(ch)
+	}
+}
+
+// handlePresence sets the sender's device status.
+func (h *SignalHub) handlePresence(peer *Peer, msg SignalMessage) {
+	if presenceRank[msg.State] == 0 {
+		h.sendToPeer(peer, SignalMessage{Type: "error", ID: msg.ID, Message: ErrInvalidPresence.Error()})
+		return
+	}
+	h.presenceMu.Lock()
+	peer.status = msg.State
+	h.presenceMu.Unlock()
+	h.updatePresence(peer.Tenant, peer.Subject)
+}
+
+// handlePresenceRequest answers presence-query, presence-subscribe and
+// presence-unsubscribe for msg.Users. Queries and subscriptions are
+// answered with one presence message of the users' states, carrying the
+// request's id.
+func (h *SignalHub) handlePresenceRequest(peer *Peer, msg SignalMessage) {
+	if len(msg.Users) == 0 || len(msg.Users) > maxPresenceUsers {
+		h.sendToPeer(peer, SignalMessage{Type: "error", ID: msg.ID, Message: ErrPresenceRequest.Error()})
+		return
+	}
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	switch msg.Type {
+	case "presence-subscribe":
+		if peer.presenceSubs == nil {
+			peer.presenceSubs = make(map[string]struct{})
+		}
+		if len(peer.presenceSubs)+len(msg.Users) > maxPresenceSubscriptions {
+			h.sendToPeer(peer, SignalMessage{Type: "error", ID: msg.ID, Message: ErrPresenceSubLimit.Error()})
+			return
+		}
+		if peer.removed.Load() {
+			return
+		}
+		for _, subject := range msg.Users {
+			key := scopedKey(peer.Tenant, subject)
+			h.entryLocked(key).subscribers[peer] = struct{}{}
+			peer.presenceSubs[key] = struct{}{}
+		}
+	case "presence-unsubscribe":
+		for _, subject := range msg.Users {
+			key := scopedKey(peer.Tenant, subject)
+			h.unsubscribeLocked(peer, key)
+		}
+		return
+	}
+	states := make(map[string]string, len(msg.Users))
+	for _, subject := range msg.Users {
+		states[subject] = h.presenceStateLocked(peer.Tenant, subject)
+	}
+	h.sendToPeer(peer, SignalMessage{Type: "presence", ID: msg.ID, Presence: states})
+}
+
+// unsubscribeLocked stops peer following key. Caller holds presenceMu.
+func (h *SignalHub) unsubscribeLocked(peer *Peer, key string) {
+	delete(peer.presenceSubs, key)
+	if e := h.presence[key]; e != nil {
+		delete(e.subscribers, peer)
+		h.pruneLocked(key, e)
+	}
+}
+
+// leavePresence drops an unregistered peer's subscriptions and updates its
+// subject.
+func (h *SignalHub) leavePresence(peer *Peer) {
+	h.presenceMu.Lock()
+	for key := range peer.presenceSubs {
+		h.unsubscribeLocked(peer, key)
+	}
+	h.presenceMu.Unlock()
+	h.updatePresence(peer.Tenant, peer.Subject)
+}
@@ -0,0 +1,86 @@
+// Package hub — Presence tests.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	updates, stop := h.WatchPresence("", "bob")
+	watch := func(want string) {
+		t.Helper()
+		select {
+		case u := <-updates:
+			if u.Subject != "bob" || u.State != want {
+				t.Fatalf("got %+v, want %s", u, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s update", want)
+		}
+	}
+
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	alice.send(SignalMessage{Type: "presence-subscribe", ID: "s1", Users: []string{"bob", "carol"}})
+	if p := alice.expect("presence"); p.ID != "s1" || p.Presence["bob"] != PresenceOffline || p.Presence["carol"] != PresenceOffline {
+		t.Fatalf("alice got %+v", p)
+	}
+
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+	watch(PresenceOnline)
+	if p := alice.expect("presence"); p.Presence["bob"] != PresenceOnline {
+		t.Fatalf("alice got %+v", p)
+	}
+	// The most available device wins: away on one device alone is away,
+	// but not while another is online.
+	bob.send(SignalMessage{Type: "presence", State: PresenceAway})
+	watch(PresenceAway)
+	alice.expect("presence")
+	bob2 := dial(t, h, srv, "sub=bob&sid=2")
+	watch(PresenceOnline)
+	alice.expect("presence")
+	bob2.send(SignalMessage{Type: "presence", State: "in-call"})
+	if e := bob2.expect("error"); e.Message != ErrInvalidPresence.Error() {
+		t.Fatalf("bob got %+v", e)
+	}
+
+	// Answered calls put both users in-call until they end.
+	alice.send(SignalMessage{Type: "invite", To: "bob"})
+	c1 := alice.expect("calling").CallID
+	bob.expect("invite")
+	bob2.expect("invite")
+	bob.send(SignalMessage{Type: "accept", CallID: c1})
+	alice.expect("accept")
+	watch(PresenceInCall)
+	if p := alice.expect("presence"); p.Presence["bob"] != PresenceInCall {
+		t.Fatalf("alice got %+v", p)
+	}
+	if got := h.Presence("", "alice", "bob", "carol"); got["alice"] != PresenceInCall || got["bob"] != PresenceInCall || got["carol"] != PresenceOffline {
+		t.Fatalf("presence %v", got)
+	}
+	bob.send(SignalMessage{Type: "hangup", CallID: c1})
+	alice.expect("hangup")
+	watch(PresenceOnline)
+	alice.expect("presence")
+
+	alice.send(SignalMessage{Type: "presence-unsubscribe", Users: []string{"bob"}})
+	alice.send(SignalMessage{Type: "presence-query", ID: "q1", Users: []string{"bob"}})
+	if p := alice.expect("presence"); p.ID != "q1" || p.Presence["bob"] != PresenceOnline {
+		t.Fatalf("alice got %+v", p)
+	}
+	// bob's remaining device is away.
+	bob2.conn.Close()
+	watch(PresenceAway)
+	bob.conn.Close()
+	watch(PresenceOffline)
+	alice.expectNone(100 * time.Millisecond)
+	stop()
+	if _, open := <-updates; open {
+		t.Fatal("updates open after stop")
+	}
+}
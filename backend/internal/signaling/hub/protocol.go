@@ -0,0 +1,161 @@
+// Package hub — Protocol version and capability negotiation.
+//
+// A client may open with hello, naming the protocol version it speaks, the
+// server message types it understands and the optional features it wants.
+// The hub answers welcome with the message types it accepts and the
+// features both sides support, then adapts to the connection: it withholds
+// message types the client did not list, acknowledges messages when acks
+// were agreed and compresses only when compression was. Clients that never
+// say hello get version 1 behaviour.
+//
+// Session resume is not a feature: a client that reconnects registers
+// afresh, replacing its old connection, and rejoins its room. A hello that
+// asks for resume is answered without it.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Protocol versions. Version 1 is the original protocol without a
+// handshake; version 2 adds hello, welcome and optional features.
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+// CloseUnsupportedVersion is the WebSocket close code sent after a hello
+// with a version the hub does not speak.
+const CloseUnsupportedVersion = 4001
+
+// Optional features a client can ask for in hello.
+const (
+	// FeatureAcks acknowledges each client message that carries an id,
+	// other than hello, with an ack of that id once handled; errors it
+	// causes come first.
+	FeatureAcks = "acks"
+	// FeatureBatching delivers trickled candidates coalesced into
+	// ice-candidates messages; offered when the hub has a batching window.
+	FeatureBatching = "batching"
+	// FeatureCompression deflates frames of at least the compression
+	// threshold; offered on WebSockets when the threshold is set, and only
+	// effective where the handshake negotiated permessage-deflate.
+	FeatureCompression = "compression"
+)
+
+// supports reports whether the hub offers peer the named feature.
+func (h *SignalHub) supports(peer *Peer, name string) bool {
+	switch name {
+	case FeatureAcks:
+		return true
+	case FeatureBatching:
+		return h.batchWindow > 0
+	case FeatureCompression:
+		_, ws := peer.transport.(*websocketTransport)
+		return ws && h.compressMin > 0
+	}
+	return false
+}
+
+// clientTypes are the message types the hub accepts from clients.
+var clientTypes = []string{
+	"hello", "join", "leave", "offer", "answer", "ice-candidate",
+	"invite", "ringing", "accept", "reject", "busy", "cancel", "hangup",
+	"publish", "subscribe", "unsubscribe", "subscribe-answer", "sfu-candidate",
+	"record-start", "record-stop",
+	"admit", "deny", "lobby-enable", "lobby-disable", "room-lock", "room-unlock",
+	"kick", "ban", "lock", "unlock", "request-mute", "end-for-all",
+	"metadata", "presence", "presence-query", "presence-subscribe", "presence-unsubscribe",
+}
+
+// alwaysSent are the message types sent whatever the client listed, as the
+// handshake and error reporting depend on them.
+var alwaysSent = map[string]bool{"welcome": true, "error": true, "ack": true}
+
+// protocol is what a connection negotiated.
+type protocol struct {
+	version  int
+	features map[string]bool
+	// types are the message types the client understands; nil for all.
+	types map[string]bool
+}
+
+// legacy is the protocol of clients that never say hello.
+var legacy = &protocol{version: MinProtocolVersion}
+
+// ProtocolVersion returns the version peer negotiated.
+func (p *Peer) ProtocolVersion() int {
+	return p.negotiated().version
+}
+
+// HasFeature reports whether peer negotiated the named feature.
+func (p *Peer) HasFeature(name string) bool {
+	return p.negotiated().features[name]
+}
+
+func (p *Peer) negotiated() *protocol {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	return p.proto
+}
+
+// wantsLocked reports whether the connection should be sent msgType.
+// Caller holds p.sendMu.
+func (p *Peer) wantsLocked(msgType string) bool {
+	return p.proto.types == nil || alwaysSent[msgType] || p.proto.types[msgType]
+}
+
+// handleHello negotiates the connection's protocol. Only a peer's first
+// message may be hello; an unsupported version closes the connection.
+func (h *SignalHub) handleHello(peer *Peer, msg SignalMessage, first bool) {
+	if !first {
+		h.sendToPeer(peer, SignalMessage{Type: "error", ID: msg.ID, Message: "hello must be the first message"})
+		return
+	}
+	if msg.Version < MinProtocolVersion || msg.Version > ProtocolVersion {
+		reason := fmt.Sprintf("unsupported protocol version %d (supported %d-%d)", msg.Version, MinProtocolVersion, ProtocolVersion)
+		if peer.transport == nil {
+			h.sendToPeer(peer, SignalMessage{Type: "error", ID: msg.ID, Message: reason})
+			return
+		}
+		// Clients tell this from a server that predates hello, which
+		// answers with an error. The frame goes through the write pump so
+		// it cannot overtake queued messages.
+		peer.closeWith(CloseUnsupportedVersion, reason)
+		return
+	}
+	proto := &protocol{version: msg.Version, features: make(map[string]bool)}
+	var granted []string
+	if msg.Version >= 2 {
+		for _, f := range msg.Features {
+			if h.supports(peer, f) && !proto.features[f] {
+				proto.features[f] = true
+				granted = append(granted, f)
+			}
+		}
+		if msg.Types != nil {
+			proto.types = make(map[string]bool, len(msg.Types))
+			for _, t := range msg.Types {
+				proto.types[t] = true
+			}
+		}
+	}
+	sort.Strings(granted)
+	peer.sendMu.Lock()
+	peer.proto = proto
+	peer.sendMu.Unlock()
+	if ws, ok := peer.transport.(*websocketTransport); ok {
+		ws.compress.Store(proto.features[FeatureCompression])
+	}
+	h.sendToPeer(peer, SignalMessage{
+		Type:     "welcome",
+		ID:       msg.ID,
+		PeerID:   peer.ID,
+		Version:  proto.version,
+		Types:    clientTypes,
+		Features: granted,
+	})
+}
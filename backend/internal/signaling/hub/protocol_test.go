@@ -0,0 +1,126 @@
+// Package hub — Protocol negotiation tests.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/gorilla/websocket"
+)
+
+func TestHelloNegotiatesFeaturesAndTypes(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	// resume is not offered.
+	alice.send(SignalMessage{Type: "hello", ID: "h", Version: ProtocolVersion, Features: []string{"resume", FeatureCompression, FeatureAcks},
+		Types: []string{"joined", "offer"}})
+	welcome := alice.expect("welcome")
+	if welcome.ID != "h" || welcome.Version != ProtocolVersion || welcome.PeerID != "alice-1" ||
+		!reflect.DeepEqual(welcome.Features, []string{FeatureAcks, FeatureCompression}) || len(welcome.Types) != len(clientTypes) {
+		t.Fatalf("unexpected welcome %+v", welcome)
+	}
+
+	alice.send(SignalMessage{Type: "join", RoomID: "r", ID: "1"})
+	alice.expect("joined")
+	if ack := alice.expect("ack"); ack.ID != "1" {
+		t.Fatalf("unexpected ack %+v", ack)
+	}
+	alice.send(SignalMessage{Type: "hello", ID: "2", Version: ProtocolVersion})
+	if msg := alice.expect("error"); msg.ID != "2" {
+		t.Fatalf("unexpected error %+v", msg)
+	}
+
+	// bob never said hello: he gets version 1, with every type and no acks.
+	bob.send(SignalMessage{Type: "join", RoomID: "r", ID: "3"})
+	bob.expect("joined")
+	bob.send(SignalMessage{Type: "offer", PeerID: "alice-1", SDP: "v=0"})
+	// alice did not list peer_joined, so the offer is the next message.
+	if msg := alice.expect("offer"); msg.PeerID != "bob-1" {
+		t.Fatalf("unexpected offer %+v", msg)
+	}
+	bob.send(SignalMessage{Type: "leave", RoomID: "r"})
+	bob.expectNone(200 * time.Millisecond)
+}
+
+func TestHelloRejectsUnsupportedVersion(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	c := dial(t, h, srv, "sub=alice&sid=1")
+	c.send(SignalMessage{Type: "hello", Version: ProtocolVersion + 1})
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := c.conn.ReadMessage()
+	if !websocket.IsCloseError(err, CloseUnsupportedVersion) {
+		t.Fatalf("expected close %d, got %v", CloseUnsupportedVersion, err)
+	}
+
+	// A socketless peer is told instead.
+	local, err := h.RegisterLocal("bot-1", &contracts.Claims{Subject: "bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.HandleMessage(local, SignalMessage{Type: "hello"})
+	var msg SignalMessage
+	if err := json.Unmarshal(<-local.Send, &msg); err != nil || msg.Type != "error" || msg.Message == "" {
+		t.Fatalf("unexpected reply %+v %v", msg, err)
+	}
+}
+
+func TestMixedEncodingsInterop(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	alice := dialWith(t, h, srv, "sub=alice&sid=1", websocket.Dialer{Subprotocols: []string{wire.SubprotocolMsgPack}})
+	bob := dialWith(t, h, srv, "sub=bob&sid=1", websocket.Dialer{Subprotocols: []string{wire.SubprotocolJSON}})
+	if alice.codec != wire.MessagePack || bob.codec != wire.JSON {
+		t.Fatalf("negotiated %q and %q", alice.conn.Subprotocol(), bob.conn.Subprotocol())
+	}
+
+	alice.send(SignalMessage{Type: "join", RoomID: "r"})
+	alice.expect("joined")
+	bob.send(SignalMessage{Type: "join", RoomID: "r"})
+	bob.expect("joined")
+	alice.expect("peer_joined")
+
+	candidate := json.RawMessage(`{"candidate":"candidate:1 1 udp 2130706431 192.0.2.1 5000 typ host","sdpMLineIndex":0}`)
+	alice.send(SignalMessage{Type: "ice-candidate", PeerID: "bob-1", Candidate: candidate})
+	msg := bob.expect("ice-candidate")
+	if msg.PeerID != "alice-1" || !jsonEqual(t, msg.Candidate, candidate) {
+		t.Fatalf("unexpected candidate %+v", msg)
+	}
+
+	bob.send(SignalMessage{Type: "ice-candidate", PeerID: "alice-1", Candidate: candidate})
+	alice.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frame, raw, err := alice.conn.ReadMessage()
+	if err != nil || frame != websocket.BinaryMessage {
+		t.Fatalf("expected a binary frame, got %d %v", frame, err)
+	}
+	// The candidate is a MessagePack map, not embedded JSON text.
+	var generic map[string]interface{}
+	if err := wire.MessagePack.Unmarshal(raw, &generic); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := generic["candidate"].(map[string]interface{}); !ok || c["sdpMLineIndex"] != int8(0) {
+		t.Fatalf("unexpected candidate encoding %#v", generic["candidate"])
+	}
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var x, y interface{}
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(x, y)
+}
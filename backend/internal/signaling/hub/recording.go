@@ -0,0 +1,185 @@
+// Package hub — Room recording control and consent notices.
+//
+// Any member may start or stop recording of its room. The recorder joins as
+// a hidden participant; every member, including later joiners, is sent a
+// recording notice while it runs so clients can show consent UI.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"errors"
+	"log"
+)
+
+// Recording states carried by recording notices.
+const (
+	RecordingStarted = "started"
+	RecordingStopped = "stopped"
+)
+
+// Recording errors reported to clients.
+var (
+	ErrRecordingDisabled = errors.New("recording is not enabled")
+	ErrAlreadyRecording  = errors.New("room is already being recorded")
+	ErrNotRecording      = errors.New("room is not being recorded")
+	ErrRecordingSFU      = errors.New("recording is not supported in sfu rooms")
+	ErrNotInRoom         = errors.New("not in a room")
+	ErrNoSuchRoom        = errors.New("room does not exist")
+)
+
+// Recorder records rooms, typically by joining them through RegisterHidden.
+type Recorder interface {
+	// Start begins recording and returns the recording's ID.
+	Start(tenant, roomID, startedBy string) (string, error)
+	Stop(tenant, roomID string) error
+}
+
+// WithRecorder enables record-start and record-stop. newRecorder is called
+// once with the constructed hub, which the recorder joins rooms through.
+func WithRecorder(newRecorder func(*SignalHub) Recorder) Option {
+	return func(h *SignalHub) { h.newRecorder = newRecorder }
+}
+
+// recording is a room's active recording; id is empty while starting.
+// Guarded by the room's shard lock.
+type recording struct {
+	id        string
+	startedBy string
+}
+
+func (rec *recording) notice(roomID, state string) *SignalMessage {
+	return &SignalMessage{Type: "recording", RoomID: roomID, RecordingID: rec.id, State: state, From: rec.startedBy}
+}
+
+// memberRoomLocked returns peer's room if peer is a member of it. Caller
+// holds the room's shard lock.
+func memberRoomLocked(rs *roomShard, key string, peer *Peer) *room {
+	r := rs.rooms[key]
+	if r == nil || r.members[peer.ID] != peer {
+		return nil
+	}
+	return r
+}
+
+func (h *SignalHub) handleRecordStart(peer *Peer) {
+	roomID := peer.currentRoom()
+	fail := func(err error) {
+		h.sendToPeer(peer, SignalMessage{Type: "error", RoomID: roomID, Message: err.Error()})
+	}
+	if h.recorder == nil {
+		fail(ErrRecordingDisabled)
+		return
+	}
+	key := scopedKey(peer.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	r := memberRoomLocked(rs, key, peer)
+	var err error
+	switch {
+	case r == nil:
+		err = ErrNotInRoom
+	case r.sfu:
+		err = ErrRecordingSFU
+	case r.recording != nil:
+		err = ErrAlreadyRecording
+	}
+	if err != nil {
+		rs.mu.Unlock()
+		fail(err)
+		return
+	}
+	rec := &recording{startedBy: peer.Subject}
+	r.recording = rec
+	rs.mu.Unlock()
+
+	// The recorder joins through the hub, so no lock may be held here.
+	id, err := h.recorder.Start(peer.Tenant, roomID, peer.Subject)
+	rs.mu.Lock()
+	if err != nil {
+		if r.recording == rec {
+			r.recording = nil
+		}
+		rs.mu.Unlock()
+		fail(err)
+		return
+	}
+	live := r.recording == rec
+	rec.id = id
+	members := make([]*Peer, 0, len(r.members))
+	for _, member := range r.members {
+		members = append(members, member)
+	}
+	notice := rec.notice(roomID, RecordingStarted)
+	rs.mu.Unlock()
+	if !live {
+		// The room emptied while the recorder was starting.
+		h.recorder.Stop(peer.Tenant, roomID)
+		return
+	}
+	for _, member := range members {
+		h.sendToPeer(member, *notice)
+	}
+}
+
+func (h *SignalHub) handleRecordStop(peer *Peer) {
+	roomID := peer.currentRoom()
+	key := scopedKey(peer.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	r := memberRoomLocked(rs, key, peer)
+	if r == nil || r.recording == nil || r.recording.id == "" {
+		rs.mu.Unlock()
+		h.sendToPeer(peer, SignalMessage{Type: "error", RoomID: roomID, Message: ErrNotRecording.Error()})
+		return
+	}
+	rec := r.recording
+	r.recording = nil
+	members := make([]*Peer, 0, len(r.members))
+	for _, member := range r.members {
+		members = append(members, member)
+	}
+	rs.mu.Unlock()
+
+	if err := h.recorder.Stop(peer.Tenant, roomID); err != nil {
+		log.Printf("Stopping recording %s: %v", rec.id, err)
+	}
+	notice := rec.notice(roomID, RecordingStopped)
+	notice.From = peer.Subject
+	for _, member := range members {
+		h.sendToPeer(member, *notice)
+	}
+}
+
+// joinHidden adds a hidden peer to an existing room. It receives peer_joined
+// for later members but is never listed or announced itself.
+func (h *SignalHub) joinHidden(peer *Peer, roomID string) error {
+	key := scopedKey(peer.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	peer.roomMu.Lock()
+	if peer.removed.Load() {
+		peer.roomMu.Unlock()
+		return nil
+	}
+	h.removeFromRoomLocked(peer, leaveCauseMoved)
+	rs.mu.Lock()
+	r, exists := rs.rooms[key]
+	if !exists {
+		rs.mu.Unlock()
+		peer.roomMu.Unlock()
+		return ErrNoSuchRoom
+	}
+	if r.hidden == nil {
+		r.hidden = make(map[string]*Peer)
+	}
+	r.hidden[peer.ID] = peer
+	members := make([]string, 0, len(r.members))
+	for id := range r.members {
+		members = append(members, id)
+	}
+	rs.mu.Unlock()
+	peer.RoomID = roomID
+	peer.roomMu.Unlock()
+	h.sendToPeer(peer, SignalMessage{Type: "joined", RoomID: roomID, PeerID: peer.ID, Peers: members})
+	return nil
+}
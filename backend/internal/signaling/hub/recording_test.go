@@ -0,0 +1,113 @@
+// Package hub — Recording control, consent notices and hidden participants.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+)
+
+// hiddenRecorder joins rooms as a hidden peer and records what it is sent.
+type hiddenRecorder struct {
+	h     *SignalHub
+	peers map[string]*Peer
+}
+
+func (r *hiddenRecorder) Start(tenant, roomID, _ string) (string, error) {
+	peer, err := r.h.RegisterHidden("rec-"+roomID, &contracts.Claims{Subject: "recorder", Tenant: tenant})
+	if err != nil {
+		return "", err
+	}
+	r.peers[roomID] = peer
+	r.h.HandleMessage(peer, SignalMessage{Type: "join", RoomID: roomID})
+	return "rec-1", nil
+}
+
+func (r *hiddenRecorder) Stop(_, roomID string) error {
+	r.h.Unregister(r.peers[roomID])
+	delete(r.peers, roomID)
+	return nil
+}
+
+// received drains a hidden peer's queued messages.
+func received(t *testing.T, peer *Peer) []SignalMessage {
+	t.Helper()
+	var out []SignalMessage
+	for {
+		select {
+		case data := <-peer.Send:
+			var msg SignalMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, msg)
+		default:
+			return out
+		}
+	}
+}
+
+func TestRecordingConsentAndHiddenPeer(t *testing.T) {
+	rec := &hiddenRecorder{peers: make(map[string]*Peer)}
+	h := NewSignalHub(nil, WithRecorder(func(h *SignalHub) Recorder {
+		rec.h = h
+		return rec
+	}))
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	alice.send(SignalMessage{Type: "record-stop"})
+	if msg := alice.expect("error"); msg.Message != ErrNotRecording.Error() {
+		t.Fatalf("stop before start: %+v", msg)
+	}
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("joined")
+	alice.send(SignalMessage{Type: "record-start"})
+	if msg := alice.expect("recording"); msg.State != RecordingStarted || msg.RecordingID != "rec-1" || msg.From != "alice" {
+		t.Fatalf("unexpected notice %+v", msg)
+	}
+	hidden := rec.peers["r1"]
+	if msgs := received(t, hidden); len(msgs) != 1 || msgs[0].Type != "joined" || len(msgs[0].Peers) != 1 || msgs[0].Peers[0] != "alice-1" {
+		t.Fatalf("hidden peer got %+v", msgs)
+	}
+
+	// bob is not told about the recorder, but the recorder is told about bob.
+	bob.send(SignalMessage{Type: "join", RoomID: "r1"})
+	if msg := bob.expect("joined"); len(msg.Peers) != 1 || msg.Peers[0] != "alice-1" {
+		t.Fatalf("bob joined with peers %v", msg.Peers)
+	}
+	if msg := bob.expect("recording"); msg.State != RecordingStarted {
+		t.Fatalf("late joiner notice %+v", msg)
+	}
+	alice.expect("peer_joined")
+	if msgs := received(t, hidden); len(msgs) != 1 || msgs[0].Type != "peer_joined" || msgs[0].PeerID != "bob-1" {
+		t.Fatalf("hidden peer got %+v", msgs)
+	}
+
+	bob.send(SignalMessage{Type: "record-stop"})
+	for _, c := range []*testClient{alice, bob} {
+		if msg := c.expect("recording"); msg.State != RecordingStopped || msg.From != "bob" {
+			t.Fatalf("%s: unexpected stop notice %+v", c.id, msg)
+		}
+	}
+	if len(rec.peers) != 0 {
+		t.Fatal("recorder not stopped")
+	}
+}
+
+func TestRecordingDisabled(t *testing.T) {
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	alice.send(SignalMessage{Type: "join", RoomID: "r1"})
+	alice.expect("joined")
+	alice.send(SignalMessage{Type: "record-start"})
+	if msg := alice.expect("error"); msg.Message != ErrRecordingDisabled.Error() {
+		t.Fatalf("unexpected reply %+v", msg)
+	}
+}
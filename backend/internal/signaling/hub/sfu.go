@@ -0,0 +1,174 @@
+// Package hub — SFU mode for large rooms.
+//
+// Once a room reaches the configured size it switches to SFU mode for the
+// rest of its life: members are told via room-mode, publish their media to
+// the SFU once and subscribe to each other's publications through it,
+// instead of offering to every member.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ModeSFU is the room-mode reported for rooms routed through the SFU.
+const ModeSFU = "sfu"
+
+// ErrNotSFURoom is reported for SFU messages in a mesh room.
+var ErrNotSFURoom = errors.New("room is not in sfu mode")
+
+// SFU is the media server the hub inserts into large rooms. Tenant and room
+// arguments match the hub's; SFU-initiated messages come back via Deliver.
+type SFU interface {
+	// Publish applies a publisher's offer and returns the answer.
+	Publish(tenant, roomID, peerID, offer string) (string, error)
+	// Subscribe forwards publisherID to peerID, or changes the simulcast
+	// layer of an existing subscription.
+	Subscribe(tenant, roomID, peerID, publisherID, layer string) error
+	Unsubscribe(tenant, roomID, peerID, publisherID string) error
+	// SubscriberAnswer answers the SFU's subscribe-offer.
+	SubscriberAnswer(tenant, roomID, peerID, answer string) error
+	// AddCandidate adds a trickled candidate for the publish or subscribe
+	// connection (role).
+	AddCandidate(tenant, roomID, peerID, role string, candidate json.RawMessage) error
+	Publishers(tenant, roomID string) []string
+	// View answers a receive-only client offer for publisherID's media, as
+	// WHEP players send; offering again renegotiates (ICE restart).
+	View(tenant, roomID, peerID, publisherID, layer, offer string) (string, error)
+	// Duplex answers a sendrecv offer that both publishes and receives the
+	// publisher peerID later subscribes to, as SIP endpoints need.
+	Duplex(tenant, roomID, peerID, offer string) (string, error)
+	// Leave drops peerID's connections and reports whether it was publishing.
+	Leave(tenant, roomID, peerID string) bool
+}
+
+// WithSFU switches rooms to SFU mode once they have threshold members.
+func WithSFU(sfu SFU, threshold int) Option {
+	return func(h *SignalHub) {
+		if threshold < 1 {
+			threshold = 1
+		}
+		h.sfu, h.sfuThreshold = sfu, threshold
+	}
+}
+
+// Deliver sends msg to peerID in tenant, if connected. It is how the SFU
+// signals subscribe-offers.
+func (h *SignalHub) Deliver(tenant, peerID string, msg SignalMessage) {
+	if peer := h.lookupPeer(tenant, peerID); peer != nil {
+		h.sendToPeer(peer, msg)
+	}
+}
+
+// sfuSwitchLocked reports whether adding a member has just taken r over the
+// SFU threshold, or force switched it. Caller holds the room's shard lock.
+func (h *SignalHub) sfuSwitchLocked(r *room, force bool) bool {
+	if h.sfu == nil || r.sfu || (!force && len(r.members) < h.sfuThreshold) {
+		return false
+	}
+	r.sfu = true
+	return true
+}
+
+// sfuRoom returns the peer's room ID if that room is in SFU mode.
+func (h *SignalHub) sfuRoom(peer *Peer) (string, bool) {
+	roomID := peer.currentRoom()
+	if h.sfu == nil || roomID == "" {
+		return roomID, false
+	}
+	key := scopedKey(peer.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r, exists := rs.rooms[key]
+	return roomID, exists && r.sfu
+}
+
+// roomMembers returns the room's members and hidden participants other than
+// except.
+func (h *SignalHub) roomMembers(tenant, roomID, except string) []*Peer {
+	key := scopedKey(tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r, exists := rs.rooms[key]
+	if !exists {
+		return nil
+	}
+	members := make([]*Peer, 0, len(r.members)+len(r.hidden))
+	for id, member := range r.members {
+		if id != except {
+			members = append(members, member)
+		}
+	}
+	for _, member := range r.hidden {
+		members = append(members, member)
+	}
+	return members
+}
+
+// handleSFU processes publish, subscribe, unsubscribe, subscribe-answer and
+// sfu-candidate messages.
+func (h *SignalHub) handleSFU(peer *Peer, msg SignalMessage) {
+	roomID, ok := h.sfuRoom(peer)
+	if !ok {
+		h.sendToPeer(peer, SignalMessage{Type: "error", RoomID: roomID, Message: ErrNotSFURoom.Error()})
+		return
+	}
+	var err error
+	switch msg.Type {
+	case "publish":
+		var answer string
+		if answer, err = h.sfuPublish(peer, roomID, msg.SDP, false); err == nil {
+			h.sendToPeer(peer, SignalMessage{Type: "publish-answer", RoomID: roomID, SDP: answer})
+		}
+	case "subscribe":
+		err = h.sfu.Subscribe(peer.Tenant, roomID, peer.ID, msg.PeerID, msg.Layer)
+	case "unsubscribe":
+		err = h.sfu.Unsubscribe(peer.Tenant, roomID, peer.ID, msg.PeerID)
+	case "subscribe-answer":
+		err = h.sfu.SubscriberAnswer(peer.Tenant, roomID, peer.ID, msg.SDP)
+	case "sfu-candidate":
+		err = h.sfu.AddCandidate(peer.Tenant, roomID, peer.ID, msg.Role, msg.Candidate)
+	}
+	if err != nil {
+		h.sendToPeer(peer, SignalMessage{Type: "error", RoomID: roomID, PeerID: msg.PeerID, Message: err.Error()})
+	}
+}
+
+// sfuPublish answers a publish (or duplex) offer and, on a peer's first
+// publish, tells the rest of the room it can subscribe.
+func (h *SignalHub) sfuPublish(peer *Peer, roomID, offer string, duplex bool) (string, error) {
+	already := false
+	for _, id := range h.sfu.Publishers(peer.Tenant, roomID) {
+		already = already || id == peer.ID
+	}
+	publish := h.sfu.Publish
+	if duplex {
+		publish = h.sfu.Duplex
+	}
+	answer, err := publish(peer.Tenant, roomID, peer.ID, offer)
+	if err != nil {
+		return "", err
+	}
+	if !already {
+		for _, other := range h.roomMembers(peer.Tenant, roomID, peer.ID) {
+			h.sendToPeer(other, SignalMessage{Type: "published", RoomID: roomID, PeerID: peer.ID})
+		}
+	}
+	return answer, nil
+}
+
+// sfuLeave releases peer's SFU connections after it left an SFU room.
+// hidden lists the room's hidden participants when peer's leaving emptied
+// it, as they can no longer be found through the room.
+func (h *SignalHub) sfuLeave(peer *Peer, roomID string, hidden []*Peer) {
+	if !h.sfu.Leave(peer.Tenant, roomID, peer.ID) {
+		return
+	}
+	for _, other := range append(h.roomMembers(peer.Tenant, roomID, peer.ID), hidden...) {
+		h.sendToPeer(other, SignalMessage{Type: "unpublished", RoomID: roomID, PeerID: peer.ID})
+	}
+}
@@ -0,0 +1,179 @@
+// Package hub — SFU room-mode switching and publish/subscribe signaling.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSFU records calls and answers every offer with "answer:<offer>".
+type fakeSFU struct {
+	mu         sync.Mutex
+	publishers []string
+	calls      []string
+}
+
+func (f *fakeSFU) record(call ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, strings.Join(call, " "))
+}
+
+func (f *fakeSFU) Publish(_, roomID, peerID, offer string) (string, error) {
+	f.record("publish", roomID, peerID)
+	f.mu.Lock()
+	f.publishers = append(f.publishers, peerID)
+	f.mu.Unlock()
+	return "answer:" + offer, nil
+}
+
+func (f *fakeSFU) Subscribe(_, roomID, peerID, publisherID, layer string) error {
+	f.record("subscribe", roomID, peerID, publisherID, layer)
+	return nil
+}
+
+func (f *fakeSFU) Unsubscribe(_, roomID, peerID, publisherID string) error {
+	f.record("unsubscribe", roomID, peerID, publisherID)
+	return nil
+}
+
+func (f *fakeSFU) SubscriberAnswer(_, roomID, peerID, _ string) error {
+	f.record("subscribe-answer", roomID, peerID)
+	return nil
+}
+
+func (f *fakeSFU) AddCandidate(_, roomID, peerID, role string, _ json.RawMessage) error {
+	f.record("candidate", roomID, peerID, role)
+	return nil
+}
+
+func (f *fakeSFU) Publishers(_, _ string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.publishers...)
+}
+
+func (f *fakeSFU) Duplex(_, roomID, peerID, offer string) (string, error) {
+	f.record("duplex", roomID, peerID)
+	f.mu.Lock()
+	f.publishers = append(f.publishers, peerID)
+	f.mu.Unlock()
+	return "answer:" + offer, nil
+}
+
+func (f *fakeSFU) View(_, roomID, peerID, publisherID, _, offer string) (string, error) {
+	f.record("view", roomID, peerID, publisherID)
+	return "answer:" + offer, nil
+}
+
+func (f *fakeSFU) Leave(_, roomID, peerID string) bool {
+	f.record("leave", roomID, peerID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, id := range f.publishers {
+		if id == peerID {
+			f.publishers = append(f.publishers[:i], f.publishers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeSFU) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func TestRoomSwitchesToSFUAtThreshold(t *testing.T) {
+	sfu := &fakeSFU{}
+	h := NewSignalHub(nil, WithSFU(sfu, 3))
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+	carol := dial(t, h, srv, "sub=carol&sid=1")
+	dave := dial(t, h, srv, "sub=dave&sid=1")
+
+	alice.send(SignalMessage{Type: "join", RoomID: "big"})
+	alice.expect("joined")
+	alice.send(SignalMessage{Type: "publish", SDP: "offer"})
+	if msg := alice.expect("error"); msg.Message != ErrNotSFURoom.Error() {
+		t.Fatalf("publish in mesh room: %+v", msg)
+	}
+	bob.send(SignalMessage{Type: "join", RoomID: "big"})
+	if msg := bob.expect("joined"); msg.Mode != "" {
+		t.Fatalf("mesh room reported mode %q", msg.Mode)
+	}
+	alice.expect("peer_joined")
+
+	carol.send(SignalMessage{Type: "join", RoomID: "big"})
+	if msg := carol.expect("joined"); msg.Mode != ModeSFU {
+		t.Fatalf("third member joined with mode %q", msg.Mode)
+	}
+	for _, c := range []*testClient{alice, bob} {
+		c.expect("peer_joined")
+		if msg := c.expect("room-mode"); msg.Mode != ModeSFU || msg.RoomID != "big" {
+			t.Fatalf("%s: unexpected room-mode %+v", c.id, msg)
+		}
+	}
+
+	alice.send(SignalMessage{Type: "publish", SDP: "offer"})
+	if msg := alice.expect("publish-answer"); msg.SDP != "answer:offer" {
+		t.Fatalf("publish-answer %+v", msg)
+	}
+	for _, c := range []*testClient{bob, carol} {
+		if msg := c.expect("published"); msg.PeerID != "alice-1" {
+			t.Fatalf("%s: unexpected published %+v", c.id, msg)
+		}
+	}
+
+	// Late joiners learn about existing publishers.
+	dave.send(SignalMessage{Type: "join", RoomID: "big"})
+	dave.expect("joined")
+	carol.expect("peer_joined")
+	if msg := dave.expect("published"); msg.PeerID != "alice-1" {
+		t.Fatalf("dave: unexpected published %+v", msg)
+	}
+
+	bob.send(SignalMessage{Type: "subscribe", PeerID: "alice-1", Layer: "h"})
+	bob.send(SignalMessage{Type: "sfu-candidate", Role: "subscribe", Candidate: json.RawMessage(`{"candidate":""}`)})
+	h.Deliver(DefaultTenant, "bob-1", SignalMessage{Type: "subscribe-offer", RoomID: "big", SDP: "sub-offer"})
+	bob.expect("peer_joined")
+	if msg := bob.expect("subscribe-offer"); msg.SDP != "sub-offer" {
+		t.Fatalf("subscribe-offer %+v", msg)
+	}
+	bob.send(SignalMessage{Type: "subscribe-answer", SDP: "sub-answer"})
+
+	alice.send(SignalMessage{Type: "leave", RoomID: "big"})
+	for _, c := range []*testClient{bob, carol} {
+		if msg := c.expect("unpublished"); msg.PeerID != "alice-1" {
+			t.Fatalf("%s: unexpected unpublished %+v", c.id, msg)
+		}
+	}
+
+	// bob's and alice's connections are handled concurrently, so compare
+	// the calls regardless of order.
+	want := []string{
+		"candidate big bob-1 subscribe",
+		"leave big alice-1",
+		"publish big alice-1",
+		"subscribe big bob-1 alice-1 h",
+		"subscribe-answer big bob-1",
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sfu.recorded()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := sfu.recorded()
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("sfu calls %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+// Package hub — Sharded peer, subject and room indexes.
+//
+// Each index is split into shards selected by an FNV-1a hash of the
+// tenant-scoped key, so joins, relays and unregisters on different peers or
+// rooms rarely contend on the same lock. No code path holds two shard locks
+// at once.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import "sync"
+
+// DefaultShards is the number of shards per index.
+const DefaultShards = 64
+
+type peerShard struct {
+	mu    sync.RWMutex
+	peers map[string]*Peer
+}
+
+type subjectShard struct {
+	mu      sync.RWMutex
+	devices map[string]map[string]*Peer
+}
+
+type roomShard struct {
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+// room is one tenant room; guarded by its shard's mu.
+type room struct {
+	members map[string]*Peer
+	tenant  *tenantState
+	session *roomSession
+	// sfu is set once the room reaches the SFU threshold; see sfu.go.
+	sfu bool
+	// hidden holds in-process participants such as recorders; they are
+	// not members and do not keep the room alive.
+	hidden    map[string]*Peer
+	recording *recording
+	// Lobby state; see lobby.go. waiting is in arrival order.
+	lobby   bool
+	locked  bool
+	waiting []*waiter
+	// banned holds subjects banned from the room; see moderation.go.
+	banned map[string]bool
+}
+
+// WithShards overrides the number of shards per index (minimum 1).
+func WithShards(n int) Option {
+	return func(h *SignalHub) {
+		if n < 1 {
+			n = 1
+		}
+		h.shardCount = n
+	}
+}
+
+func (h *SignalHub) initShards() {
+	h.peerShards = make([]*peerShard, h.shardCount)
+	h.subjectShards = make([]*subjectShard, h.shardCount)
+	h.roomShards = make([]*roomShard, h.shardCount)
+	for i := 0; i < h.shardCount; i++ {
+		h.peerShards[i] = &peerShard{peers: make(map[string]*Peer)}
+		h.subjectShards[i] = &subjectShard{devices: make(map[string]map[string]*Peer)}
+		h.roomShards[i] = &roomShard{rooms: make(map[string]*room)}
+	}
+}
+
+func (h *SignalHub) peerShardFor(key string) *peerShard {
+	return h.peerShards[shardIndex(key, len(h.peerShards))]
+}
+
+func (h *SignalHub) subjectShardFor(key string) *subjectShard {
+	return h.subjectShards[shardIndex(key, len(h.subjectShards))]
+}
+
+func (h *SignalHub) roomShardFor(key string) *roomShard {
+	return h.roomShards[shardIndex(key, len(h.roomShards))]
+}
+
+// lookupPeer returns the registered peer with this ID in tenant, or nil.
+func (h *SignalHub) lookupPeer(tenant, peerID string) *Peer {
+	key := scopedKey(tenant, peerID)
+	s := h.peerShardFor(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.peers[key]
+}
+
+// shardIndex is FNV-1a, inlined to avoid allocating a hash.Hash per lookup.
+func shardIndex(key string, n int) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return int(hash % uint32(n))
+}
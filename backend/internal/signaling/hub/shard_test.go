@@ -0,0 +1,93 @@
+// Package hub — Concurrency tests for the sharded indexes.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+)
+
+func TestConcurrentJoinLeaveLeavesNoState(t *testing.T) {
+	h := NewSignalHub(nil, WithShards(4))
+	const workers, perWorker = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id := strconv.Itoa(w*perWorker + i)
+				claims := &contracts.Claims{Subject: "u" + id, Tenant: "t" + strconv.Itoa(i%3)}
+				p, err := h.Register("p"+id, claims, nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				h.HandleMessage(p, SignalMessage{Type: "join", RoomID: "r" + strconv.Itoa(i%5)})
+				h.HandleMessage(p, SignalMessage{Type: "join", RoomID: "r" + strconv.Itoa(i%7)})
+				if i%2 == 0 {
+					h.HandleMessage(p, SignalMessage{Type: "leave"})
+				}
+				h.Unregister(p)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i, s := range h.roomShards {
+		if len(s.rooms) != 0 {
+			t.Errorf("room shard %d still holds %d rooms", i, len(s.rooms))
+		}
+	}
+	for i, s := range h.peerShards {
+		if len(s.peers) != 0 {
+			t.Errorf("peer shard %d still holds %d peers", i, len(s.peers))
+		}
+	}
+	if len(h.tenants) != 0 {
+		t.Errorf("tenant usage not released: %d tenants", len(h.tenants))
+	}
+}
+
+func TestReRegisterReplacesPeer(t *testing.T) {
+	h := NewSignalHub(nil, WithTenantQuotas(&TenantQuotas{Default: &TenantQuota{MaxPeers: 1}}))
+	claims := &contracts.Claims{Subject: "alice", Tenant: "acme"}
+	first, err := h.Register("alice-1", claims, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.HandleMessage(first, SignalMessage{Type: "join", RoomID: "r1"})
+
+	second, err := h.Register("alice-1", claims, nil)
+	if err != nil {
+		t.Fatalf("replacement must not count against the quota: %v", err)
+	}
+	if h.lookupPeer("acme", "alice-1") != second {
+		t.Fatal("lookup should return the replacement")
+	}
+	if !first.removed.Load() || first.currentRoom() != "" {
+		t.Error("replaced peer should be unregistered and out of its room")
+	}
+	// A late Unregister from the old connection must not remove the new one.
+	h.Unregister(first)
+	if h.lookupPeer("acme", "alice-1") != second {
+		t.Error("stale Unregister removed the replacement")
+	}
+}
+
+func TestShardIndexSpreadsKeys(t *testing.T) {
+	counts := make([]int, DefaultShards)
+	for i := 0; i < DefaultShards*100; i++ {
+		counts[shardIndex(scopedKey("acme", "peer-"+strconv.Itoa(i)), DefaultShards)]++
+	}
+	for i, c := range counts {
+		if c < 50 || c > 150 {
+			t.Errorf("shard %d got %d of %d keys", i, c, DefaultShards*100)
+		}
+	}
+}
@@ -10,170 +10,699 @@ import (
 	"encoding/json"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/audit"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/cdr"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/candidate"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/sdp"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/telemetry"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/webhook"
 	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/gorilla/websocket"
 )
 
 // SignalMessage represents a signaling message (join, offer, answer, ice-candidate, leave).
 type SignalMessage struct {
-	Type     string            `json:"type"`
-	RoomID   string            `json:"roomId,omitempty"`
-	PeerID   string            `json:"peerId,omitempty"`
-	Peers    []string          `json:"peers,omitempty"`
-	SDP      string            `json:"sdp,omitempty"`
-	Candidate json.RawMessage   `json:"candidate,omitempty"`
+	Type        string            `json:"type"`
+	RoomID      string            `json:"roomId,omitempty"`
+	PeerID      string            `json:"peerId,omitempty"`
+	Peers       []string          `json:"peers,omitempty"`
+	SDP         string            `json:"sdp,omitempty"`
+	Candidate   json.RawMessage   `json:"candidate,omitempty"`
+	Candidates  []json.RawMessage `json:"candidates,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Policy      *sdp.Report       `json:"policy,omitempty"`
+	CallID      string            `json:"callId,omitempty"`
+	To          string            `json:"to,omitempty"`
+	From        string            `json:"from,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	Mode        string            `json:"mode,omitempty"`
+	Layer       string            `json:"layer,omitempty"`
+	Role        string            `json:"role,omitempty"`
+	RecordingID string            `json:"recordingId,omitempty"`
+	State       string            `json:"state,omitempty"`
+	ID          string            `json:"id,omitempty"`
+	Version     int               `json:"version,omitempty"`
+	Types       []string          `json:"types,omitempty"`
+	Features    []string          `json:"features,omitempty"`
+	Position    int               `json:"position,omitempty"`
+	Timeout     int               `json:"timeout,omitempty"`
+	Metadata    *PeerMetadata     `json:"metadata,omitempty"`
+	Members     []Member          `json:"members,omitempty"`
+	Users       []string          `json:"users,omitempty"`
+	Presence    map[string]string `json:"presence,omitempty"`
 }
 
-// SignalHub manages connected peers and room membership.
+// SignalHub manages connected peers and room membership. Peers, subjects
+// and rooms live in sharded indexes keyed by scopedKey(tenant, id); see
+// shard.go.
 type SignalHub struct {
-	peers     map[string]*Peer
-	rooms     map[string]map[string]*Peer
-	store     contracts.SessionStore
-	mu        sync.RWMutex
+	shardCount    int
+	peerShards    []*peerShard
+	subjectShards []*subjectShard
+	roomShards    []*roomShard
+
+	tenants  map[string]*tenantState
+	tenantMu sync.Mutex
+	quotas   *TenantQuotas
+
+	store       contracts.SessionStore
+	sdpPolicies *sdp.PolicySet
+	icePolicies *candidate.PolicySet
+	telemetry   telemetry.Recorder
+	cdr         cdr.Recorder
+	webhooks    webhook.Publisher
+	audit       audit.Recorder
+	ringTimeout time.Duration
+	// lobbyTimeout bounds lobby waits; lobbyByDefault opens new rooms in
+	// lobby mode.
+	lobbyTimeout   time.Duration
+	lobbyByDefault bool
+
+	sfu          SFU
+	sfuThreshold int
+
+	recorder    Recorder
+	newRecorder func(*SignalHub) Recorder
+
+	compressMin int
+	batchWindow time.Duration
+
+	// Room watchers by tenant; see control.go.
+	watchers map[string]map[*watcher]struct{}
+	watchMu  sync.RWMutex
+
+	// Presence by tenant-scoped subject; see presence.go for lock order.
+	presence   map[string]*presenceEntry
+	presenceMu sync.Mutex
+
+	// Call state is guarded by callMu, which may be held while taking a
+	// shard lock but never the other way round.
+	calls       map[string]*Call
+	activeCalls map[string]string
+	peerCalls   map[string]map[string]*Call
+	callMu      sync.Mutex
 }
 
-// Peer represents a connected WebSocket client.
+// Option configures optional SignalHub behaviour.
+type Option func(*SignalHub)
+
+// WithSDPPolicies rewrites relayed offers and answers with operator policy.
+func WithSDPPolicies(policies *sdp.PolicySet) Option {
+	return func(h *SignalHub) { h.sdpPolicies = policies }
+}
+
+// WithICEPolicies filters trickled and SDP-embedded ICE candidates.
+func WithICEPolicies(policies *candidate.PolicySet) Option {
+	return func(h *SignalHub) { h.icePolicies = policies }
+}
+
+// WithTelemetry records hub decisions (e.g. candidate filtering) as metrics.
+func WithTelemetry(recorder telemetry.Recorder) Option {
+	return func(h *SignalHub) { h.telemetry = recorder }
+}
+
+// WithWebhooks publishes room and peer lifecycle events.
+func WithWebhooks(publisher webhook.Publisher) Option {
+	return func(h *SignalHub) { h.webhooks = publisher }
+}
+
+// Peer represents a connected WebSocket client. A peer's messages are
+// handled on its connection's goroutine; roomMu serialises room changes
+// against a concurrent Unregister.
 type Peer struct {
-	ID       string
-	RoomID   string
-	Conn     *websocket.Conn
-	Send     chan []byte
+	ID      string
+	RoomID  string
+	Tenant  string
+	Subject string
+	Send    chan []byte
+
+	key     string
+	tenant  *tenantState
+	role    string
+	hidden  bool
+	removed atomic.Bool
+	spoke   atomic.Bool
+	roomMu  sync.Mutex
+	// waitingIn is the room whose lobby the peer waits in; guarded by
+	// roomMu. See lobby.go.
+	waitingIn string
+	// transport carries the peer's messages; nil for in-process peers,
+	// which read Send themselves.
+	transport Transport
+	// codec encodes the peer's messages: its transport's, or JSON.
+	codec    wire.Codec
+	metadata atomic.Pointer[PeerMetadata]
+	// status is the device's chosen presence status and presenceSubs the
+	// subjects it follows; both guarded by the hub's presenceMu.
+	status       string
+	presenceSubs map[string]struct{}
+
+	// sendMu guards the send side: the negotiated protocol, held
+	// candidates, and closing.
+	sendMu      sync.Mutex
+	closed      bool
+	closing     bool
+	closeCode   int
+	closeReason string
+	proto       *protocol
+	batches     []*candidateBatch
+	batchTimer  *time.Timer
+}
+
+// Codec returns the encoding of the peer's connection, for decoding what
+// it sends.
+func (p *Peer) Codec() wire.Codec {
+	return p.codec
+}
+
+// currentRoom returns the peer's room ID.
+func (p *Peer) currentRoom() string {
+	p.roomMu.Lock()
+	defer p.roomMu.Unlock()
+	return p.RoomID
 }
 
 // NewSignalHub creates a new signaling hub.
-func NewSignalHub(store contracts.SessionStore) *SignalHub {
+func NewSignalHub(store contracts.SessionStore, opts ...Option) *SignalHub {
 	if store == nil {
 		store = &NoopStore{}
 	}
-	return &SignalHub{
-		peers: make(map[string]*Peer),
-		rooms: make(map[string]map[string]*Peer),
-		store: store,
+	h := &SignalHub{
+		shardCount:   DefaultShards,
+		tenants:      make(map[string]*tenantState),
+		store:        store,
+		telemetry:    telemetry.Nop{},
+		cdr:          cdr.Nop{},
+		webhooks:     webhook.Nop{},
+		audit:        audit.Nop{},
+		ringTimeout:  DefaultRingTimeout,
+		lobbyTimeout: DefaultLobbyTimeout,
+		compressMin:  DefaultCompressionThreshold,
+		calls:        make(map[string]*Call),
+		activeCalls:  make(map[string]string),
+		peerCalls:    make(map[string]map[string]*Call),
+		watchers:     make(map[string]map[*watcher]struct{}),
+		presence:     make(map[string]*presenceEntry),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.initShards()
+	if h.newRecorder != nil {
+		h.recorder = h.newRecorder(h)
 	}
+	return h
 }
 
-// Register adds a peer to the hub.
-func (h *SignalHub) Register(peerID string, conn *websocket.Conn) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// Register adds a peer to its tenant's namespace, enforcing the tenant's
+// peer quota. The returned Peer is the handle for HandleMessage and
+// Unregister. An existing connection with the same ID is replaced. Messages
+// are encoded by conn's negotiated subprotocol (see package wire).
+func (h *SignalHub) Register(peerID string, claims *contracts.Claims, conn *websocket.Conn) (*Peer, error) {
+	if conn == nil {
+		return h.register(peerID, claims, nil, false)
+	}
+	return h.register(peerID, claims, newWebsocketTransport(conn, h.compressMin), false)
+}
+
+// RegisterHidden adds an in-process participant, such as a recorder, that
+// joins existing rooms without being listed in joined or announced to
+// members. It has no socket: its messages are read from Peer.Send.
+func (h *SignalHub) RegisterHidden(peerID string, claims *contracts.Claims) (*Peer, error) {
+	return h.register(peerID, claims, nil, true)
+}
+
+func (h *SignalHub) register(peerID string, claims *contracts.Claims, t Transport, hidden bool) (*Peer, error) {
+	tenant := tenantOf(claims.Tenant)
+	if old := h.lookupPeer(tenant, peerID); old != nil {
+		h.evict(old)
+	}
+	st, err := h.acquirePeer(tenant)
+	if err != nil {
+		h.recordQuotaRejection(tenant, "peers")
+		return nil, err
+	}
 	peer := &Peer{
-		ID:   peerID,
-		Conn: conn,
-		Send: make(chan []byte, 256),
+		ID:      peerID,
+		Tenant:  tenant,
+		Subject: claims.Subject,
+		Send:    make(chan []byte, 256),
+		key:     scopedKey(tenant, peerID),
+		tenant:  st,
+		role:    claims.Role,
+		hidden:  hidden,
+		proto:   legacy,
+		codec:   wire.JSON,
 	}
-	h.peers[peerID] = peer
-	go peer.writePump()
+	if t != nil {
+		peer.transport, peer.codec = t, t.Codec()
+	}
+
+	ps := h.peerShardFor(peer.key)
+	ps.mu.Lock()
+	raced := ps.peers[peer.key]
+	ps.peers[peer.key] = peer
+	ps.mu.Unlock()
+	if raced != nil {
+		h.evict(raced)
+	}
+
+	subject := scopedKey(tenant, peer.Subject)
+	ss := h.subjectShardFor(subject)
+	ss.mu.Lock()
+	if ss.devices[subject] == nil {
+		ss.devices[subject] = make(map[string]*Peer)
+	}
+	ss.devices[subject][peerID] = peer
+	ss.mu.Unlock()
+	h.updatePresence(tenant, peer.Subject)
+
+	if t != nil {
+		go h.writePump(peer)
+	}
+	return peer, nil
 }
 
-// Unregister removes a peer and cleans up room membership.
-func (h *SignalHub) Unregister(peerID string) {
-	h.mu.Lock()
-	peer, ok := h.peers[peerID]
-	if !ok {
-		h.mu.Unlock()
+// evict unregisters a peer replaced by a newer connection and closes its
+// socket so its read loop exits.
+func (h *SignalHub) evict(old *Peer) {
+	h.Unregister(old)
+	if old.transport != nil {
+		old.transport.Close()
+	}
+}
+
+// Unregister removes a peer and cleans up room membership and calls. It is
+// safe to call more than once.
+func (h *SignalHub) Unregister(peer *Peer) {
+	if !peer.removed.CompareAndSwap(false, true) {
 		return
 	}
-	delete(h.peers, peerID)
-	if peer.RoomID != "" {
-		if room, exists := h.rooms[peer.RoomID]; exists {
-			delete(room, peerID)
-			if len(room) == 0 {
-				delete(h.rooms, peer.RoomID)
-			}
+	ps := h.peerShardFor(peer.key)
+	ps.mu.Lock()
+	if ps.peers[peer.key] == peer {
+		delete(ps.peers, peer.key)
+	}
+	ps.mu.Unlock()
+
+	subject := scopedKey(peer.Tenant, peer.Subject)
+	ss := h.subjectShardFor(subject)
+	ss.mu.Lock()
+	if devices, exists := ss.devices[subject]; exists && devices[peer.ID] == peer {
+		delete(devices, peer.ID)
+		if len(devices) == 0 {
+			delete(ss.devices, subject)
 		}
 	}
-	h.mu.Unlock()
+	ss.mu.Unlock()
+
+	peer.roomMu.Lock()
+	h.removeFromRoomLocked(peer, leaveCauseDisconnected)
+	peer.roomMu.Unlock()
+	h.releasePeer(peer.tenant)
+	h.dropPeerCalls(peer)
+	h.leavePresence(peer)
+	peer.sendMu.Lock()
+	peer.closed = true
+	h.flushCandidatesLocked(peer)
 	close(peer.Send)
+	peer.sendMu.Unlock()
 }
 
-// HandleMessage processes incoming signaling messages.
-func (h *SignalHub) HandleMessage(peerID string, msg SignalMessage) {
-	h.mu.Lock()
-	peer, ok := h.peers[peerID]
-	if !ok {
-		h.mu.Unlock()
+// HandleMessage processes incoming signaling messages from a registered peer.
+func (h *SignalHub) HandleMessage(peer *Peer, msg SignalMessage) {
+	if peer.removed.Load() {
+		return
+	}
+	first := !peer.spoke.Swap(true)
+	if !h.allowMessage(peer) {
+		h.recordQuotaRejection(peer.Tenant, "messages")
+		h.sendToPeer(peer, SignalMessage{Type: "error", ID: msg.ID, Message: ErrRateLimit.Error()})
 		return
 	}
-	h.mu.Unlock()
 
 	switch msg.Type {
+	case "hello":
+		h.handleHello(peer, msg, first)
+		return
 	case "join":
-		h.handleJoin(peer, msg.RoomID)
-	case "offer":
-		h.relayToPeer(peer, msg.PeerID, msg)
-	case "answer":
-		h.relayToPeer(peer, msg.PeerID, msg)
+		h.handleJoin(peer, msg)
+	case "offer", "answer":
+		h.relaySDP(peer, msg)
 	case "ice-candidate":
-		h.relayToPeer(peer, msg.PeerID, msg)
+		h.relayCandidate(peer, msg)
 	case "leave":
 		h.handleLeave(peer, msg.RoomID)
+	case "invite":
+		h.handleInvite(peer, msg)
+	case "ringing", "accept", "reject", "busy", "cancel", "hangup":
+		h.handleCallControl(peer, msg)
+	case "publish", "subscribe", "unsubscribe", "subscribe-answer", "sfu-candidate":
+		h.handleSFU(peer, msg)
+	case "record-start":
+		h.handleRecordStart(peer)
+	case "record-stop":
+		h.handleRecordStop(peer)
+	case "kick", "ban":
+		h.handleRemoval(peer, msg)
+	case "request-mute":
+		h.handleMuteRequest(peer, msg)
+	case "end-for-all":
+		h.handleEndForAll(peer, msg)
+	case "admit", "deny":
+		h.handleKnockAnswer(peer, msg)
+	case "lobby-enable", "lobby-disable", "room-lock", "room-unlock":
+		h.handleRoomSettings(peer, msg.Type)
+	case "lock", "unlock":
+		// Moderation names for room-lock and room-unlock.
+		h.handleRoomSettings(peer, "room-"+msg.Type)
+	case "metadata":
+		h.handleMetadata(peer, msg)
+	case "presence":
+		h.handlePresence(peer, msg)
+	case "presence-query", "presence-subscribe", "presence-unsubscribe":
+		h.handlePresenceRequest(peer, msg)
 	default:
 		h.sendToPeer(peer, SignalMessage{Type: "error", PeerID: msg.PeerID})
 	}
+	if msg.ID != "" && peer.HasFeature(FeatureAcks) {
+		h.sendToPeer(peer, SignalMessage{Type: "ack", ID: msg.ID})
+	}
 }
 
-func (h *SignalHub) handleJoin(peer *Peer, roomID string) {
+// handleJoin joins msg.RoomID, first setting the peer's metadata if msg
+// carries any.
+func (h *SignalHub) handleJoin(peer *Peer, msg SignalMessage) {
+	roomID := msg.RoomID
 	if roomID == "" {
 		h.sendToPeer(peer, SignalMessage{Type: "error"})
 		return
 	}
-	h.mu.Lock()
-	if peer.RoomID != "" {
-		if room, exists := h.rooms[peer.RoomID]; exists {
-			delete(room, peer.ID)
-			if len(room) == 0 {
-				delete(h.rooms, peer.RoomID)
-			}
+	if msg.Metadata != nil {
+		if err := peer.setMetadata(msg.Metadata); err != nil {
+			h.sendToPeer(peer, SignalMessage{Type: "error", RoomID: roomID, Message: err.Error()})
+			return
 		}
 	}
-	peer.RoomID = roomID
-	if h.rooms[roomID] == nil {
-		h.rooms[roomID] = make(map[string]*Peer)
+	if err := h.join(peer, roomID, false); err != nil {
+		h.sendToPeer(peer, SignalMessage{Type: "error", RoomID: roomID, Message: err.Error()})
+	}
+}
+
+// join moves peer into roomID, creating the room if needed, or into its
+// lobby. forceSFU switches the room to SFU mode regardless of its size.
+func (h *SignalHub) join(peer *Peer, roomID string, forceSFU bool) error {
+	return h.enter(peer, roomID, forceSFU, false)
+}
+
+// enter is join; admitted peers skip the lobby, and enter only if they are
+// still waiting in roomID's.
+func (h *SignalHub) enter(peer *Peer, roomID string, forceSFU, admitted bool) error {
+	if peer.hidden {
+		return h.joinHidden(peer, roomID)
+	}
+	key := scopedKey(peer.Tenant, roomID)
+	rs := h.roomShardFor(key)
+
+	peer.roomMu.Lock()
+	if peer.removed.Load() || (admitted && peer.waitingIn != roomID) {
+		peer.roomMu.Unlock()
+		return nil
+	}
+	screened := !admitted && !peer.isHost()
+	// Check the room quota and lock before leaving the current room, so a
+	// rejected join leaves the peer where it was.
+	rs.mu.Lock()
+	existing, exists := rs.rooms[key]
+	locked := exists && existing.locked
+	banned := exists && existing.banned[peer.Subject]
+	rs.mu.Unlock()
+	if banned {
+		peer.roomMu.Unlock()
+		return ErrBanned
+	}
+	if screened && locked {
+		peer.roomMu.Unlock()
+		return ErrRoomLocked
+	}
+	if !exists && !h.roomAvailable(peer.tenant, false) {
+		peer.roomMu.Unlock()
+		h.recordQuotaRejection(peer.Tenant, "rooms")
+		return ErrRoomQuota
+	}
+	h.removeFromRoomLocked(peer, leaveCauseMoved)
+
+	rs.mu.Lock()
+	r, exists := rs.rooms[key]
+	if !exists {
+		if !h.roomAvailable(peer.tenant, true) {
+			rs.mu.Unlock()
+			peer.roomMu.Unlock()
+			h.recordQuotaRejection(peer.Tenant, "rooms")
+			return ErrRoomQuota
+		}
+		r = &room{members: make(map[string]*Peer), tenant: peer.tenant, lobby: h.lobbyByDefault}
+		rs.rooms[key] = r
+		h.publishRoomEvent(webhook.EventRoomCreated, peer, roomID, "")
+	}
+	if screened && (r.locked || r.lobby) {
+		return h.waitLocked(rs, r, peer, roomID)
 	}
-	existingPeers := make([]string, 0, len(h.rooms[roomID]))
-	for id := range h.rooms[roomID] {
+	existingPeers := make([]string, 0, len(r.members))
+	members := make([]Member, 0, len(r.members))
+	others := make([]*Peer, 0, len(r.members))
+	for id, other := range r.members {
 		existingPeers = append(existingPeers, id)
+		members = append(members, Member{PeerID: id, Metadata: other.Metadata()})
+		others = append(others, other)
 	}
-	h.rooms[roomID][peer.ID] = peer
-	h.mu.Unlock()
+	for _, other := range r.hidden {
+		others = append(others, other)
+	}
+	var consent *SignalMessage
+	if r.recording != nil && r.recording.id != "" {
+		consent = r.recording.notice(roomID, RecordingStarted)
+	}
+	r.members[peer.ID] = peer
+	switched := h.sfuSwitchLocked(r, forceSFU)
+	mode := ""
+	if r.sfu {
+		mode = ModeSFU
+	}
+	h.roomJoinedLocked(r, peer)
+	h.publishRoomEvent(webhook.EventPeerJoined, peer, roomID, "")
+	state := r.stateLocked()
+	var knocks []SignalMessage
+	if peer.isHost() {
+		knocks = knocksLocked(r, roomID)
+	}
+	rs.mu.Unlock()
+	peer.RoomID = roomID
+	peer.roomMu.Unlock()
 
-	h.sendToPeer(peer, SignalMessage{Type: "joined", RoomID: roomID, PeerID: peer.ID, Peers: existingPeers})
+	if state == RoomOpen {
+		state = ""
+	}
+	h.sendToPeer(peer, SignalMessage{Type: "joined", RoomID: roomID, PeerID: peer.ID, Peers: existingPeers, Members: members, Mode: mode, State: state})
+	if consent != nil {
+		h.sendToPeer(peer, *consent)
+	}
+	for _, knock := range knocks {
+		h.sendToPeer(peer, knock)
+	}
 
 	// Notify existing peers that a new peer joined
-	for _, otherID := range existingPeers {
-		h.mu.RLock()
-		otherPeer := h.peers[otherID]
-		h.mu.RUnlock()
-		if otherPeer != nil {
-			h.sendToPeer(otherPeer, SignalMessage{Type: "peer_joined", PeerID: peer.ID})
+	for _, other := range others {
+		h.sendToPeer(other, SignalMessage{Type: "peer_joined", PeerID: peer.ID, Metadata: peer.Metadata()})
+		if switched {
+			h.sendToPeer(other, SignalMessage{Type: "room-mode", RoomID: roomID, Mode: ModeSFU})
+		}
+	}
+	if mode == ModeSFU && !switched {
+		for _, id := range h.sfu.Publishers(peer.Tenant, roomID) {
+			h.sendToPeer(peer, SignalMessage{Type: "published", RoomID: roomID, PeerID: id})
 		}
 	}
+	return nil
 }
 
 func (h *SignalHub) handleLeave(peer *Peer, roomID string) {
-	h.mu.Lock()
-	if peer.RoomID != "" {
-		if room, exists := h.rooms[peer.RoomID]; exists {
-			delete(room, peer.ID)
-			if len(room) == 0 {
-				delete(h.rooms, peer.RoomID)
-			}
+	peer.roomMu.Lock()
+	h.removeFromRoomLocked(peer, leaveCauseLeft)
+	peer.roomMu.Unlock()
+}
+
+// removeFromRoomLocked takes peer out of its current room, if any. Caller
+// must hold peer.roomMu.
+func (h *SignalHub) removeFromRoomLocked(peer *Peer, cause string) {
+	if peer.waitingIn != "" {
+		h.leaveLobbyLocked(peer, nil, KnockLeft)
+	}
+	if peer.RoomID == "" {
+		return
+	}
+	roomID := peer.RoomID
+	key := scopedKey(peer.Tenant, roomID)
+	rs := h.roomShardFor(key)
+	rs.mu.Lock()
+	r, exists := rs.rooms[key]
+	if peer.hidden {
+		if exists {
+			delete(r.hidden, peer.ID)
 		}
+		rs.mu.Unlock()
 		peer.RoomID = ""
+		// Hidden viewers may hold SFU connections even after the room
+		// emptied; Leave is a no-op for peers without one.
+		if h.sfu != nil {
+			h.sfu.Leave(peer.Tenant, roomID, peer.ID)
+		}
+		return
 	}
-	h.mu.Unlock()
+	if !exists || r.members[peer.ID] != peer {
+		rs.mu.Unlock()
+		peer.RoomID = ""
+		return
+	}
+	delete(r.members, peer.ID)
+	wasSFU := r.sfu
+	// A vacated room ends its session; it is kept while peers wait in its
+	// lobby, and deleted once empty.
+	vacated := len(r.members) == 0
+	emptied := vacated && len(r.waiting) == 0
+	var rec *recording
+	var hidden []*Peer
+	if vacated {
+		rec, r.recording = r.recording, nil
+		for _, p := range r.hidden {
+			hidden = append(hidden, p)
+		}
+	}
+	if emptied {
+		delete(rs.rooms, key)
+	} else if vacated {
+		r.sfu, r.hidden = false, nil
+	}
+	h.roomLeftLocked(r, peer, roomID, cause, vacated)
+	h.publishRoomEvent(webhook.EventPeerLeft, peer, roomID, cause)
+	if emptied {
+		h.publishRoomEvent(webhook.EventRoomEmptied, peer, roomID, cause)
+	}
+	rs.mu.Unlock()
+	if emptied {
+		h.releaseRoom(r.tenant)
+	}
+	if wasSFU {
+		h.sfuLeave(peer, roomID, hidden)
+	}
+	if rec != nil {
+		go h.recorder.Stop(peer.Tenant, roomID)
+	}
+	peer.RoomID = ""
+}
+
+// publishRoomEvent queues a lifecycle webhook; it never blocks.
+func (h *SignalHub) publishRoomEvent(eventType string, peer *Peer, roomID, reason string) {
+	h.publishEvent(webhook.Event{
+		Type:    eventType,
+		Tenant:  peer.Tenant,
+		RoomID:  roomID,
+		PeerID:  peer.ID,
+		Subject: peer.Subject,
+		Reason:  reason,
+	})
+}
+
+// publishEvent sends a lifecycle event to webhooks and room watchers.
+func (h *SignalHub) publishEvent(e webhook.Event) {
+	h.webhooks.Publish(e)
+	h.notifyWatchers(e)
+}
+
+// relaySDP applies the resolved codec/bandwidth policy before relaying an
+// offer or answer, and reports any rewrite back to the sender.
+func (h *SignalHub) relaySDP(from *Peer, msg SignalMessage) {
+	target := msg.PeerID
+	roomID := from.currentRoom()
+	var report *sdp.Report
+	if policy := h.sdpPolicies.Resolve(from.Tenant, roomID); policy != nil && msg.SDP != "" {
+		rewritten, r, err := policy.Apply(msg.SDP)
+		if err != nil {
+			h.sendToPeer(from, SignalMessage{Type: "error", PeerID: target, Message: "invalid sdp: " + err.Error()})
+			return
+		}
+		msg.SDP, report = rewritten, r
+	}
+	if policy := h.icePolicies.Resolve(from.Tenant, roomID); policy != nil && msg.SDP != "" {
+		filtered, decisions, err := policy.FilterSDP(msg.SDP)
+		if err != nil {
+			h.sendToPeer(from, SignalMessage{Type: "error", PeerID: target, Message: "invalid sdp: " + err.Error()})
+			return
+		}
+		msg.SDP = filtered
+		for _, d := range decisions {
+			h.recordCandidateDecision(from, "sdp", d)
+		}
+	}
+	h.relayToPeer(from, target, msg)
+	if report != nil && report.Changed() {
+		h.sendToPeer(from, SignalMessage{Type: "sdp-policy", PeerID: target, Policy: report})
+	}
+}
+
+// relayCandidate forwards a trickled candidate if the room's policy allows it.
+func (h *SignalHub) relayCandidate(from *Peer, msg SignalMessage) {
+	roomID := from.currentRoom()
+	policy := h.icePolicies.Resolve(from.Tenant, roomID)
+	if policy == nil {
+		h.relayToPeer(from, msg.PeerID, msg)
+		return
+	}
+	init, err := candidate.ParseInit(msg.Candidate)
+	if err != nil {
+		h.recordCandidateDecision(from, "trickle", candidate.Decision{Reason: candidate.ReasonMalformed})
+		return
+	}
+	d := policy.Evaluate(init.Candidate)
+	h.recordCandidateDecision(from, "trickle", d)
+	if !d.Allow {
+		return
+	}
+	if d.Candidate != "" {
+		init.Candidate = d.Candidate
+	}
+	if msg.Candidate, err = json.Marshal(init); err != nil {
+		return
+	}
+	h.relayToPeer(from, msg.PeerID, msg)
+}
+
+func (h *SignalHub) recordCandidateDecision(from *Peer, source string, d candidate.Decision) {
+	decision := "drop"
+	if d.Allow {
+		decision = "allow"
+	}
+	h.telemetry.RecordMetric("ice_candidate_policy_decisions_total", 1, map[string]string{
+		"decision": decision,
+		"reason":   d.Reason,
+		"type":     d.Type,
+		"source":   source,
+		"tenant":   from.Tenant,
+	})
 }
 
 func (h *SignalHub) relayToPeer(from *Peer, toPeerID string, msg SignalMessage) {
 	if toPeerID == "" {
 		return
 	}
-	h.mu.RLock()
-	toPeer, ok := h.peers[toPeerID]
-	h.mu.RUnlock()
-	if !ok {
+	// Lookups are tenant-scoped: a peer in another tenant is indistinguishable
+	// from one that does not exist.
+	toPeer := h.lookupPeer(from.Tenant, toPeerID)
+	if toPeer == nil {
 		return
 	}
 	msg.PeerID = from.ID
@@ -181,10 +710,22 @@ func (h *SignalHub) relayToPeer(from *Peer, toPeerID string, msg SignalMessage)
 }
 
 func (h *SignalHub) sendToPeer(peer *Peer, msg SignalMessage) {
-	data, err := json.Marshal(msg)
+	if msg.Type == "ice-candidate" && h.batchWindow > 0 && peer.HasFeature(FeatureBatching) {
+		h.batchCandidate(peer, msg)
+		return
+	}
+	data, err := peer.codec.Marshal(msg)
 	if err != nil {
 		return
 	}
+	peer.sendMu.Lock()
+	defer peer.sendMu.Unlock()
+	if peer.closed || !peer.wantsLocked(msg.Type) {
+		return
+	}
+	if len(peer.batches) > 0 {
+		h.flushCandidatesLocked(peer)
+	}
 	select {
 	case peer.Send <- data:
 	default:
@@ -192,26 +733,58 @@ func (h *SignalHub) sendToPeer(peer *Peer, msg SignalMessage) {
 	}
 }
 
-func (p *Peer) writePump() {
+func (h *SignalHub) writePump(p *Peer) {
 	ticker := time.NewTicker(54 * time.Second)
 	defer ticker.Stop()
+	report := time.NewTicker(statsInterval)
+	defer report.Stop()
+	var stats sendStats
+	defer stats.flush(h, p.Tenant)
 	for {
 		select {
 		case msg, ok := <-p.Send:
 			if !ok {
+				p.transport.Close()
 				return
 			}
-			if err := p.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			if msg == nil {
+				p.sendMu.Lock()
+				code, reason := p.closeCode, p.closeReason
+				p.sendMu.Unlock()
+				p.transport.CloseWith(code, reason)
 				return
 			}
+			wire, err := p.transport.Write(msg)
+			if err != nil {
+				return
+			}
+			stats.add(len(msg), wire)
+		case <-report.C:
+			stats.flush(h, p.Tenant)
 		case <-ticker.C:
-			if err := p.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := p.transport.Ping(); err != nil {
 				return
 			}
 		}
 	}
 }
 
+// closeWith queues a close behind the peer's pending messages; the write
+// pump tells the client code and reason and closes the transport.
+func (p *Peer) closeWith(code int, reason string) {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	if p.closed || p.closing {
+		return
+	}
+	p.closing, p.closeCode, p.closeReason = true, code, reason
+	select {
+	case p.Send <- nil:
+	default:
+		p.transport.Close()
+	}
+}
+
 // NoopStore is a no-op SessionStore for when Redis is unavailable.
 type NoopStore struct{}
 
@@ -0,0 +1,209 @@
+// Package hub — Tenant namespacing and quotas.
+//
+// Every peer, room, call and stored record is keyed by the tenant claim, so
+// identical room or peer IDs in two tenants never meet. Quotas bound each
+// tenant's concurrent peers, rooms and inbound message rate.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultTenant is the namespace for tokens without a tenant claim.
+const DefaultTenant = "default"
+
+// Quota errors returned by Register and reported to clients.
+var (
+	ErrPeerQuota = errors.New("tenant peer quota exceeded")
+	ErrRoomQuota = errors.New("tenant room quota exceeded")
+	ErrRateLimit = errors.New("tenant message rate exceeded")
+)
+
+// TenantQuota limits one tenant. Zero values mean unlimited.
+type TenantQuota struct {
+	MaxPeers          int     `json:"maxPeers,omitempty"`
+	MaxRooms          int     `json:"maxRooms,omitempty"`
+	MessagesPerSecond float64 `json:"messagesPerSecond,omitempty"`
+	// Burst is the message bucket size (default: one second's worth).
+	Burst int `json:"burst,omitempty"`
+}
+
+// TenantQuotas holds the default quota and per-tenant overrides.
+type TenantQuotas struct {
+	Default *TenantQuota            `json:"default,omitempty"`
+	Tenants map[string]*TenantQuota `json:"tenants,omitempty"`
+}
+
+// LoadTenantQuotas reads a JSON quota file.
+func LoadTenantQuotas(path string) (*TenantQuotas, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var q TenantQuotas
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, fmt.Errorf("tenant quotas %s: %w", path, err)
+	}
+	return &q, nil
+}
+
+// Resolve returns the quota for tenant, or nil when unlimited.
+func (q *TenantQuotas) Resolve(tenant string) *TenantQuota {
+	if q == nil {
+		return nil
+	}
+	if t, ok := q.Tenants[tenant]; ok {
+		return t
+	}
+	return q.Default
+}
+
+// WithTenantQuotas enforces per-tenant peer, room and message-rate limits.
+func WithTenantQuotas(quotas *TenantQuotas) Option {
+	return func(h *SignalHub) { h.quotas = quotas }
+}
+
+// tenantState is the live usage of one tenant. Counts are guarded by the
+// hub's tenantMu; the limiter has its own lock.
+type tenantState struct {
+	name    string
+	peers   int
+	rooms   int
+	limiter *tokenBucket
+}
+
+// tenantOf normalises an empty tenant claim to DefaultTenant.
+func tenantOf(tenant string) string {
+	if tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}
+
+// scopedKey namespaces an identifier by tenant. The tenant is length-prefixed
+// so that no tenant and ID pair can produce another pair's key, whatever
+// either contains.
+func scopedKey(tenant, id string) string {
+	tenant = tenantOf(tenant)
+	return strconv.Itoa(len(tenant)) + ":" + tenant + "/" + id
+}
+
+// tenantLocked returns (creating) the usage record for tenant. Caller must
+// hold tenantMu.
+func (h *SignalHub) tenantLocked(tenant string) *tenantState {
+	st, ok := h.tenants[tenant]
+	if !ok {
+		st = &tenantState{name: tenant}
+		if q := h.quotas.Resolve(tenant); q != nil && q.MessagesPerSecond > 0 {
+			st.limiter = newTokenBucket(q.MessagesPerSecond, q.Burst)
+		}
+		h.tenants[tenant] = st
+	}
+	return st
+}
+
+// releaseLocked drops an idle tenant's usage record. Caller must hold tenantMu.
+func (h *SignalHub) releaseLocked(st *tenantState) {
+	if st.peers == 0 && st.rooms == 0 && h.tenants[st.name] == st {
+		delete(h.tenants, st.name)
+	}
+}
+
+// acquirePeer counts a new peer against its tenant's quota.
+func (h *SignalHub) acquirePeer(tenant string) (*tenantState, error) {
+	h.tenantMu.Lock()
+	defer h.tenantMu.Unlock()
+	st := h.tenantLocked(tenant)
+	if q := h.quotas.Resolve(tenant); q != nil && q.MaxPeers > 0 && st.peers >= q.MaxPeers {
+		h.releaseLocked(st)
+		return nil, ErrPeerQuota
+	}
+	st.peers++
+	return st, nil
+}
+
+func (h *SignalHub) releasePeer(st *tenantState) {
+	h.tenantMu.Lock()
+	defer h.tenantMu.Unlock()
+	st.peers--
+	h.releaseLocked(st)
+}
+
+// roomAvailable reports whether the tenant may create another room; when
+// reserve is set the room is counted.
+func (h *SignalHub) roomAvailable(st *tenantState, reserve bool) bool {
+	h.tenantMu.Lock()
+	defer h.tenantMu.Unlock()
+	if q := h.quotas.Resolve(st.name); q != nil && q.MaxRooms > 0 && st.rooms >= q.MaxRooms {
+		return false
+	}
+	if reserve {
+		st.rooms++
+	}
+	return true
+}
+
+func (h *SignalHub) releaseRoom(st *tenantState) {
+	h.tenantMu.Lock()
+	defer h.tenantMu.Unlock()
+	st.rooms--
+	h.releaseLocked(st)
+}
+
+// allowMessage applies the tenant's message rate limit.
+func (h *SignalHub) allowMessage(peer *Peer) bool {
+	if peer.tenant == nil || peer.tenant.limiter == nil {
+		return true
+	}
+	return peer.tenant.limiter.allow(time.Now())
+}
+
+func (h *SignalHub) recordQuotaRejection(tenant, quota string) {
+	h.telemetry.RecordMetric("tenant_quota_rejections_total", 1, map[string]string{
+		"tenant": tenantOf(tenant),
+		"quota":  quota,
+	})
+}
+
+// tokenBucket is a minimal thread-safe token bucket.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := float64(burst)
+	if b <= 0 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,140 @@
+// Package hub — Tests for tenant isolation and quotas.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRoomsAndPeersAreIsolatedByTenant(t *testing.T) {
+	h := NewSignalHub(newMemoryStore())
+	srv := newTestServer(t, h)
+	acmeAlice := dial(t, h, srv, "sub=alice&sid=1&tenant=acme")
+	acmeBob := dial(t, h, srv, "sub=bob&sid=1&tenant=acme")
+	globexAlice := dial(t, h, srv, "sub=alice&sid=1&tenant=globex")
+
+	acmeAlice.send(SignalMessage{Type: "join", RoomID: "lobby"})
+	acmeAlice.expect("joined")
+	if msg := globexAlice.expectJoin(t, "lobby"); len(msg.Peers) != 0 {
+		t.Fatalf("globex saw acme peers in lobby: %v", msg.Peers)
+	}
+
+	// Same peer ID in both tenants: the offer must reach only acme's bob.
+	globexAlice.send(SignalMessage{Type: "offer", PeerID: "bob-1", SDP: "v=0"})
+	acmeAlice.send(SignalMessage{Type: "offer", PeerID: "bob-1", SDP: "v=0"})
+	if msg := acmeBob.expect("offer"); msg.PeerID != "alice-1" {
+		t.Fatalf("unexpected offer %+v", msg)
+	}
+	acmeBob.expectNone(100 * time.Millisecond)
+
+	globexAlice.send(SignalMessage{Type: "invite", To: "bob"})
+	rejected := globexAlice.expect("reject")
+	if rejected.Reason != "unavailable" {
+		t.Errorf("globex reached acme's bob: %+v", rejected)
+	}
+	acmeAlice.send(SignalMessage{Type: "invite", To: "bob"})
+	calling := acmeAlice.expect("calling")
+
+	ctx := context.Background()
+	if call, _ := h.LoadCall(ctx, "acme", calling.CallID); call == nil || call.State != CallRinging {
+		t.Errorf("expected acme call record, got %+v", call)
+	}
+	if call, _ := h.LoadCall(ctx, "globex", rejected.CallID); call == nil || call.State != CallRejected {
+		t.Errorf("expected separate globex call record, got %+v", call)
+	}
+	if call, _ := h.LoadCall(ctx, "globex", calling.CallID); call != nil {
+		t.Errorf("acme call visible in globex: %+v", call)
+	}
+}
+
+func TestScopedKeysDoNotCollide(t *testing.T) {
+	if scopedKey("a", "b/c") == scopedKey("a/b", "c") {
+		t.Fatal("tenant a room b/c shares a key with tenant a/b room c")
+	}
+	h := NewSignalHub(nil)
+	srv := newTestServer(t, h)
+	a := dial(t, h, srv, "sub=alice&sid=1&tenant=a")
+	ab := dial(t, h, srv, "sub=mallory&sid=1&tenant=a/b")
+	a.expectJoin(t, "b/c")
+	if msg := ab.expectJoin(t, "c"); len(msg.Peers) != 0 {
+		t.Fatalf("tenant a/b joined tenant a's room: %v", msg.Peers)
+	}
+	a.expectNone(100 * time.Millisecond)
+}
+
+func (c *testClient) expectJoin(t *testing.T, room string) SignalMessage {
+	t.Helper()
+	c.send(SignalMessage{Type: "join", RoomID: room})
+	return c.expect("joined")
+}
+
+func TestTenantPeerQuota(t *testing.T) {
+	h := NewSignalHub(nil, WithTenantQuotas(&TenantQuotas{
+		Tenants: map[string]*TenantQuota{"acme": {MaxPeers: 1}},
+	}))
+	srv := newTestServer(t, h)
+	dial(t, h, srv, "sub=alice&sid=1&tenant=acme")
+	dial(t, h, srv, "sub=alice&sid=1&tenant=globex")
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?sub=bob&sid=1&tenant=acme"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("expected policy-violation close, got %v", err)
+	}
+}
+
+func TestTenantRoomQuotaAndMessageRate(t *testing.T) {
+	h := NewSignalHub(nil, WithTenantQuotas(&TenantQuotas{
+		Default: &TenantQuota{MaxRooms: 1, MessagesPerSecond: 0.001, Burst: 3},
+	}))
+	srv := newTestServer(t, h)
+	alice := dial(t, h, srv, "sub=alice&sid=1")
+	bob := dial(t, h, srv, "sub=bob&sid=1")
+
+	alice.expectJoin(t, "r1")
+	bob.send(SignalMessage{Type: "join", RoomID: "r2"})
+	if msg := bob.expect("error"); msg.Message != ErrRoomQuota.Error() {
+		t.Errorf("expected room quota error, got %+v", msg)
+	}
+	bob.expectJoin(t, "r1")
+	alice.expect("peer_joined")
+
+	// Burst of 3 shared by the tenant: alice's join, bob's two joins.
+	alice.send(SignalMessage{Type: "leave", RoomID: "r1"})
+	if msg := alice.expect("error"); msg.Message != ErrRateLimit.Error() {
+		t.Errorf("expected rate limit error, got %+v", msg)
+	}
+}
+
+func TestLoadTenantQuotas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	os.WriteFile(path, []byte(`{"default":{"maxPeers":100},"tenants":{"acme":{"maxRooms":5,"messagesPerSecond":50}}}`), 0o600)
+	q, err := LoadTenantQuotas(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Resolve("acme").MaxRooms != 5 || q.Resolve("other").MaxPeers != 100 {
+		t.Errorf("unexpected quotas %+v", q)
+	}
+	var none *TenantQuotas
+	if none.Resolve("acme") != nil {
+		t.Error("nil quotas must resolve to unlimited")
+	}
+}
@@ -0,0 +1,97 @@
+// Package hub — Transports carrying peers' messages to their clients.
+//
+// A peer's write pump hands each encoded message to its Transport. The
+// WebSocket transport is the usual one; HTTP fallbacks (SSE, long-poll)
+// implement the same interface, so the hub treats every connected peer
+// alike. Peers without a transport are read from Peer.Send in process.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package hub
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries one peer's messages to its client. Write, Ping and
+// CloseWith are called from the peer's write pump only; Close may be called
+// from any goroutine.
+type Transport interface {
+	// Codec is the encoding messages are written in.
+	Codec() wire.Codec
+	// Write sends one encoded message and returns the bytes it took on the
+	// network, or 0 when the transport cannot tell.
+	Write(data []byte) (int, error)
+	// Ping keeps an idle connection alive.
+	Ping() error
+	// CloseWith ends the connection, telling the client code and reason.
+	CloseWith(code int, reason string) error
+	// Close ends the connection without notice.
+	Close() error
+}
+
+// RegisterTransport is Register for a peer connected over any transport.
+func (h *SignalHub) RegisterTransport(peerID string, claims *contracts.Claims, t Transport) (*Peer, error) {
+	return h.register(peerID, claims, t, false)
+}
+
+// writeWait bounds WebSocket control frames.
+const writeWait = 10 * time.Second
+
+// websocketTransport writes to a WebSocket, deflating frames of at least
+// compressMin bytes when the connection negotiated compression.
+type websocketTransport struct {
+	conn        *websocket.Conn
+	codec       wire.Codec
+	compressMin int
+	// compress is cleared by a hello that does not ask for compression.
+	compress atomic.Bool
+	// counter counts the socket's bytes when it was upgraded via CountBytes.
+	counter *countingConn
+}
+
+func newWebsocketTransport(conn *websocket.Conn, compressMin int) *websocketTransport {
+	counter, _ := conn.NetConn().(*countingConn)
+	t := &websocketTransport{
+		conn:        conn,
+		codec:       wire.ForSubprotocol(conn.Subprotocol()),
+		compressMin: compressMin,
+		counter:     counter,
+	}
+	t.compress.Store(true)
+	return t
+}
+
+func (t *websocketTransport) Codec() wire.Codec { return t.codec }
+
+func (t *websocketTransport) Write(data []byte) (int, error) {
+	t.conn.EnableWriteCompression(t.compress.Load() && t.compressMin > 0 && len(data) >= t.compressMin)
+	var before uint64
+	if t.counter != nil {
+		before = t.counter.written.Load()
+	}
+	if err := t.conn.WriteMessage(t.codec.FrameType(), data); err != nil {
+		return 0, err
+	}
+	if t.counter == nil {
+		return 0, nil
+	}
+	return int(t.counter.written.Load() - before), nil
+}
+
+func (t *websocketTransport) Ping() error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+}
+
+func (t *websocketTransport) CloseWith(code int, reason string) error {
+	t.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+	return t.conn.Close()
+}
+
+func (t *websocketTransport) Close() error {
+	return t.conn.Close()
+}
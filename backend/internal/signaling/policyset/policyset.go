@@ -0,0 +1,49 @@
+// Package policyset — Default, per-tenant and per-room policy resolution.
+//
+// The SDP and ICE candidate policy files share one layout: a default
+// policy, per-tenant overrides, and per-room overrides keyed by tenant and
+// then room ID, as rooms are namespaced by tenant.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package policyset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Set resolves policies per room, falling back to tenant then default.
+type Set[P any] struct {
+	Default *P            `json:"default,omitempty"`
+	Tenants map[string]*P `json:"tenants,omitempty"`
+	// Rooms holds room policies by tenant, then room ID.
+	Rooms map[string]map[string]*P `json:"rooms,omitempty"`
+}
+
+// Load reads a JSON policy set from disk; kind names it in errors.
+func Load[P any](path, kind string) (*Set[P], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set Set[P]
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", kind, path, err)
+	}
+	return &set, nil
+}
+
+// Resolve returns the most specific policy for the tenant and room, or nil.
+func (s *Set[P]) Resolve(tenant, roomID string) *P {
+	if s == nil {
+		return nil
+	}
+	if p, ok := s.Rooms[tenant][roomID]; ok && roomID != "" {
+		return p
+	}
+	if p, ok := s.Tenants[tenant]; ok && tenant != "" {
+		return p
+	}
+	return s.Default
+}
@@ -0,0 +1,42 @@
+// Package policyset — Tests for policy resolution.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package policyset
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type policy struct {
+	Name string `json:"name"`
+}
+
+func TestRoomPoliciesAreScopedToTheirTenant(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(path, []byte(`{
+		"default": {"name": "default"},
+		"tenants": {"globex": {"name": "globex"}},
+		"rooms": {"acme": {"lobby": {"name": "acme-lobby"}}}
+	}`), 0o600)
+	set, err := Load[policy](path, "test policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ tenant, room, want string }{
+		{"acme", "lobby", "acme-lobby"},
+		{"acme", "other", "default"},
+		{"globex", "lobby", "globex"},
+		{"default", "lobby", "default"},
+	} {
+		if got := set.Resolve(tc.tenant, tc.room); got == nil || got.Name != tc.want {
+			t.Errorf("Resolve(%q, %q) = %+v, want %s", tc.tenant, tc.room, got, tc.want)
+		}
+	}
+	var nilSet *Set[policy]
+	if nilSet.Resolve("acme", "lobby") != nil {
+		t.Error("nil set must resolve to nil")
+	}
+}
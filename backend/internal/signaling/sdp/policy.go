@@ -0,0 +1,222 @@
+// Package sdp — Operator codec and bandwidth policy for relayed SDP.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sdp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/policyset"
+)
+
+// MediaPolicy controls codec selection and bandwidth for one media kind.
+type MediaPolicy struct {
+	// Prefer lists codec names (e.g. "opus", "H264") moved to the front in order.
+	Prefer []string `json:"prefer,omitempty"`
+	// Strip lists codec names removed from the description.
+	Strip []string `json:"strip,omitempty"`
+	// Exclusive removes every codec not listed in Prefer.
+	Exclusive bool `json:"exclusive,omitempty"`
+	// MaxBitrateKbps injects b=AS and b=TIAS limits when greater than zero.
+	MaxBitrateKbps int `json:"maxBitrateKbps,omitempty"`
+}
+
+// Policy is the operator-defined rewrite applied to offers and answers.
+type Policy struct {
+	Audio      MediaPolicy `json:"audio"`
+	Video      MediaPolicy `json:"video"`
+	DisableRTX bool        `json:"disableRtx,omitempty"`
+	DisableFEC bool        `json:"disableFec,omitempty"`
+	DisableRED bool        `json:"disableRed,omitempty"`
+}
+
+// Report describes what a policy changed, for feedback to the sender.
+type Report struct {
+	Removed   []string            `json:"removed,omitempty"`
+	Order     map[string][]string `json:"order,omitempty"`
+	Bandwidth map[string]int      `json:"bandwidthKbps,omitempty"`
+	Warnings  []string            `json:"warnings,omitempty"`
+}
+
+// Changed reports whether the policy altered the description.
+func (r *Report) Changed() bool {
+	return len(r.Removed) > 0 || len(r.Order) > 0 || len(r.Bandwidth) > 0 || len(r.Warnings) > 0
+}
+
+// PolicySet resolves policies per room, falling back to tenant then default.
+type PolicySet = policyset.Set[Policy]
+
+// LoadPolicySet reads a JSON policy set from disk.
+func LoadPolicySet(path string) (*PolicySet, error) {
+	return policyset.Load[Policy](path, "sdp policy")
+}
+
+// Apply rewrites an SDP body according to the policy.
+func (p *Policy) Apply(body string) (string, *Report, error) {
+	desc, err := Parse(body)
+	if err != nil {
+		return "", nil, err
+	}
+	report := &Report{}
+	for i, m := range desc.Media {
+		var mp *MediaPolicy
+		switch m.Kind() {
+		case "audio":
+			mp = &p.Audio
+		case "video":
+			mp = &p.Video
+		default:
+			continue
+		}
+		label := sectionLabel(m, i)
+		p.applyCodecs(m, mp, label, report)
+		if mp.MaxBitrateKbps > 0 {
+			m.SetBandwidth("AS", mp.MaxBitrateKbps)
+			m.SetBandwidth("TIAS", mp.MaxBitrateKbps*1000)
+			if report.Bandwidth == nil {
+				report.Bandwidth = make(map[string]int)
+			}
+			report.Bandwidth[label] = mp.MaxBitrateKbps
+		}
+	}
+	return desc.String(), report, nil
+}
+
+func (p *Policy) applyCodecs(m *MediaSection, mp *MediaPolicy, label string, report *Report) {
+	codecs := m.Codecs()
+	payloads := m.Payloads()
+	drop := make(map[int]bool)
+	for _, pt := range payloads {
+		c := codecs[pt]
+		if c == nil || c.AssociatedPT >= 0 {
+			continue
+		}
+		name := strings.ToLower(c.Name)
+		switch {
+		case isRED(name) && p.DisableRED,
+			isFEC(name) && p.DisableFEC,
+			containsFold(mp.Strip, name),
+			mp.Exclusive && !isAuxiliary(name) && !containsFold(mp.Prefer, name):
+			drop[pt] = true
+		}
+	}
+	for _, pt := range payloads {
+		if c := codecs[pt]; c != nil && c.AssociatedPT >= 0 {
+			if p.DisableRTX || drop[c.AssociatedPT] {
+				drop[pt] = true
+			}
+		}
+	}
+	if len(drop) > 0 && !keepsMedia(payloads, codecs, drop) {
+		report.Warnings = append(report.Warnings, label+": policy would remove every codec; section left unchanged")
+		return
+	}
+	if len(drop) > 0 {
+		for _, pt := range payloads {
+			if drop[pt] {
+				report.Removed = append(report.Removed, fmt.Sprintf("%s:%s/%d", label, codecName(codecs[pt]), pt))
+			}
+		}
+		m.RemovePayloads(drop)
+	}
+	if len(mp.Prefer) > 0 {
+		reordered := preferOrder(m.Payloads(), codecs, mp.Prefer)
+		if !equalInts(reordered, m.Payloads()) {
+			m.SetPayloads(reordered)
+			if report.Order == nil {
+				report.Order = make(map[string][]string)
+			}
+			names := make([]string, 0, len(reordered))
+			for _, pt := range reordered {
+				names = append(names, codecName(codecs[pt]))
+			}
+			report.Order[label] = names
+		}
+	}
+}
+
+// keepsMedia reports whether a payload carrying media survives drop;
+// RTX, RED, FEC, DTMF and comfort noise alone leave nothing to decode.
+func keepsMedia(pts []int, codecs map[int]*Codec, drop map[int]bool) bool {
+	for _, pt := range pts {
+		if drop[pt] {
+			continue
+		}
+		c := codecs[pt]
+		if c == nil || (c.AssociatedPT < 0 && !isAuxiliary(strings.ToLower(c.Name))) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferOrder stably moves preferred codecs (and their RTX) to the front.
+func preferOrder(pts []int, codecs map[int]*Codec, prefer []string) []int {
+	rank := func(pt int) int {
+		c := codecs[pt]
+		if c == nil {
+			return len(prefer)
+		}
+		if c.AssociatedPT >= 0 && codecs[c.AssociatedPT] != nil {
+			c = codecs[c.AssociatedPT]
+		}
+		for i, name := range prefer {
+			if strings.EqualFold(name, c.Name) {
+				return i
+			}
+		}
+		return len(prefer)
+	}
+	out := append([]int{}, pts...)
+	sort.SliceStable(out, func(i, j int) bool { return rank(out[i]) < rank(out[j]) })
+	return out
+}
+
+func sectionLabel(m *MediaSection, index int) string {
+	if mids := m.Attributes("mid"); len(mids) > 0 {
+		return m.Kind() + "/" + mids[0]
+	}
+	return fmt.Sprintf("%s/%d", m.Kind(), index)
+}
+
+func codecName(c *Codec) string {
+	if c == nil {
+		return "unknown"
+	}
+	return c.Name
+}
+
+func isRED(name string) bool { return name == "red" }
+
+func isFEC(name string) bool {
+	return name == "ulpfec" || strings.HasPrefix(name, "flexfec")
+}
+
+// isAuxiliary marks payloads that carry no media of their own.
+func isAuxiliary(name string) bool {
+	return isRED(name) || isFEC(name) || name == "telephone-event" || name == "cn"
+}
+
+func containsFold(list []string, name string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+// Package sdp — Tests for SDP parsing and policy rewriting.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sdp
+
+import (
+	"strings"
+	"testing"
+)
+
+const offer = "v=0\r\n" +
+	"o=- 4611731400430051336 2 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=group:BUNDLE 0 1\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 111 63 0\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=mid:0\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\n" +
+	"a=fmtp:111 minptime=10;useinbandfec=1\r\n" +
+	"a=rtpmap:63 red/48000/2\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n" +
+	"m=video 9 UDP/TLS/RTP/SAVPF 96 97 102 103 45\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=mid:1\r\n" +
+	"a=rtpmap:96 VP8/90000\r\n" +
+	"a=rtcp-fb:96 nack\r\n" +
+	"a=rtpmap:97 rtx/90000\r\n" +
+	"a=fmtp:97 apt=96\r\n" +
+	"a=rtpmap:102 H264/90000\r\n" +
+	"a=fmtp:102 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f\r\n" +
+	"a=rtpmap:103 rtx/90000\r\n" +
+	"a=fmtp:103 apt=102\r\n" +
+	"a=rtpmap:45 ulpfec/90000\r\n"
+
+func TestParseRoundTrip(t *testing.T) {
+	desc, err := Parse(offer)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(desc.Media) != 2 {
+		t.Fatalf("expected 2 media sections, got %d", len(desc.Media))
+	}
+	if got := desc.String(); got != offer {
+		t.Errorf("round trip mismatch:\n%s", got)
+	}
+	codecs := desc.Media[1].Codecs()
+	if codecs[103].AssociatedPT != 102 {
+		t.Errorf("expected rtx 103 to reference 102, got %d", codecs[103].AssociatedPT)
+	}
+}
+
+func TestParseRejectsGarbage(t *testing.T) {
+	if _, err := Parse("hello"); err == nil {
+		t.Error("expected error for non-SDP input")
+	}
+}
+
+func TestPolicyStripsAndReorders(t *testing.T) {
+	policy := &Policy{
+		Audio: MediaPolicy{Prefer: []string{"opus"}, Exclusive: true},
+		Video: MediaPolicy{Prefer: []string{"H264"}, Strip: []string{"VP8"}, MaxBitrateKbps: 500},
+	}
+	out, report, err := policy.Apply(offer)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if strings.Contains(out, "PCMU") {
+		t.Error("expected PCMU to be removed by exclusive audio policy")
+	}
+	if strings.Contains(out, "VP8") || strings.Contains(out, "apt=96") {
+		t.Error("expected VP8 and its RTX to be removed")
+	}
+	if !strings.Contains(out, "m=video 9 UDP/TLS/RTP/SAVPF 102 103 45\r\n") {
+		t.Errorf("unexpected video m-line in:\n%s", out)
+	}
+	if !strings.Contains(out, "c=IN IP4 0.0.0.0\r\nb=AS:500\r\nb=TIAS:500000\r\n") {
+		t.Errorf("expected bandwidth lines after c= line in:\n%s", out)
+	}
+	if len(report.Removed) != 3 {
+		t.Errorf("expected 3 removed payloads, got %v", report.Removed)
+	}
+	if report.Bandwidth["video/1"] != 500 {
+		t.Errorf("expected video bandwidth in report, got %v", report.Bandwidth)
+	}
+}
+
+func TestPolicyTogglesRTXFECRED(t *testing.T) {
+	policy := &Policy{DisableRTX: true, DisableFEC: true, DisableRED: true}
+	out, report, err := policy.Apply(offer)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	for _, name := range []string{"rtx/", "ulpfec", "red/"} {
+		if strings.Contains(out, name) {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	if !report.Changed() {
+		t.Error("expected report to record changes")
+	}
+}
+
+func TestPolicyKeepsSectionWhenEverythingStripped(t *testing.T) {
+	policy := &Policy{Audio: MediaPolicy{Strip: []string{"opus", "red", "PCMU"}}}
+	out, report, err := policy.Apply(offer)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if !strings.Contains(out, "m=audio 9 UDP/TLS/RTP/SAVPF 111 63 0") {
+		t.Error("expected audio section to be left unchanged")
+	}
+	if len(report.Warnings) != 1 {
+		t.Errorf("expected one warning, got %v", report.Warnings)
+	}
+}
+
+func TestPolicyKeepsSectionLeftWithOnlyAuxiliaryPayloads(t *testing.T) {
+	video := "v=0\r\n" +
+		"o=- 1 2 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96 97 45\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=mid:0\r\n" +
+		"a=rtpmap:96 VP8/90000\r\n" +
+		"a=rtpmap:97 rtx/90000\r\n" +
+		"a=fmtp:97 apt=96\r\n" +
+		"a=rtpmap:45 ulpfec/90000\r\n"
+	policy := &Policy{Video: MediaPolicy{Prefer: []string{"H264"}, Exclusive: true}}
+	out, report, err := policy.Apply(video)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if !strings.Contains(out, "m=video 9 UDP/TLS/RTP/SAVPF 96 97 45") {
+		t.Errorf("expected video section to be left unchanged:\n%s", out)
+	}
+	if len(report.Warnings) != 1 || len(report.Removed) != 0 {
+		t.Errorf("expected one warning and no removals, got %+v", report)
+	}
+}
+
+func TestPolicySetResolve(t *testing.T) {
+	def, tenant, room := &Policy{}, &Policy{}, &Policy{}
+	set := &PolicySet{
+		Default: def,
+		Tenants: map[string]*Policy{"acme": tenant},
+		Rooms:   map[string]map[string]*Policy{"acme": {"mobile": room}},
+	}
+	if set.Resolve("acme", "mobile") != room {
+		t.Error("room policy should win")
+	}
+	if set.Resolve("globex", "mobile") != def {
+		t.Error("room policy must not apply to another tenant's room")
+	}
+	if set.Resolve("acme", "lobby") != tenant {
+		t.Error("tenant policy should apply when room has none")
+	}
+	if set.Resolve("", "lobby") != def {
+		t.Error("default policy should apply otherwise")
+	}
+	var nilSet *PolicySet
+	if nilSet.Resolve("acme", "mobile") != nil {
+		t.Error("nil set should resolve to nil")
+	}
+}
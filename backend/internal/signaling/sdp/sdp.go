@@ -0,0 +1,210 @@
+// Package sdp — Minimal SDP parser used by the signaling relay path.
+//
+// Keeps every line of the original description so that rewriting only touches
+// what a policy explicitly changes.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sdp
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// SessionDescription is a line-preserving view of an SDP body.
+type SessionDescription struct {
+	Session []string
+	Media   []*MediaSection
+}
+
+// MediaSection holds the lines of one m= section, starting with the m= line.
+type MediaSection struct {
+	Lines []string
+}
+
+// Codec describes one payload type declared in a media section.
+type Codec struct {
+	PayloadType int
+	Name        string
+	ClockRate   int
+	// AssociatedPT is the apt= target for RTX payloads, or -1.
+	AssociatedPT int
+}
+
+// Parse splits an SDP body into session and media sections.
+func Parse(body string) (*SessionDescription, error) {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	lines := strings.Split(strings.TrimRight(body, "\n"), "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "v=") {
+		return nil, errors.New("sdp: missing version line")
+	}
+	desc := &SessionDescription{}
+	var current *MediaSection
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return nil, errors.New("sdp: malformed line " + strconv.Quote(line))
+		}
+		if strings.HasPrefix(line, "m=") {
+			if len(strings.Fields(line[2:])) < 4 {
+				return nil, errors.New("sdp: malformed media line " + strconv.Quote(line))
+			}
+			current = &MediaSection{Lines: []string{line}}
+			desc.Media = append(desc.Media, current)
+			continue
+		}
+		if current == nil {
+			desc.Session = append(desc.Session, line)
+		} else {
+			current.Lines = append(current.Lines, line)
+		}
+	}
+	return desc, nil
+}
+
+// String serialises the description with CRLF line endings.
+func (s *SessionDescription) String() string {
+	var b strings.Builder
+	for _, line := range s.Session {
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	for _, m := range s.Media {
+		for _, line := range m.Lines {
+			b.WriteString(line)
+			b.WriteString("\r\n")
+		}
+	}
+	return b.String()
+}
+
+// Kind returns the media type (audio, video, application).
+func (m *MediaSection) Kind() string {
+	return strings.Fields(m.Lines[0][2:])[0]
+}
+
+// Payloads returns the format list of the m= line in order.
+func (m *MediaSection) Payloads() []int {
+	fields := strings.Fields(m.Lines[0][2:])
+	pts := make([]int, 0, len(fields)-3)
+	for _, f := range fields[3:] {
+		if pt, err := strconv.Atoi(f); err == nil {
+			pts = append(pts, pt)
+		}
+	}
+	return pts
+}
+
+// SetPayloads rewrites the format list of the m= line.
+func (m *MediaSection) SetPayloads(pts []int) {
+	fields := strings.Fields(m.Lines[0][2:])
+	out := append([]string{}, fields[:3]...)
+	for _, pt := range pts {
+		out = append(out, strconv.Itoa(pt))
+	}
+	m.Lines[0] = "m=" + strings.Join(out, " ")
+}
+
+// Attributes returns the values of every a=<name>: line in the section.
+func (m *MediaSection) Attributes(name string) []string {
+	prefix := "a=" + name + ":"
+	var values []string
+	for _, line := range m.Lines {
+		if strings.HasPrefix(line, prefix) {
+			values = append(values, line[len(prefix):])
+		}
+	}
+	return values
+}
+
+// Codecs returns the codecs declared via rtpmap/fmtp, keyed by payload type.
+func (m *MediaSection) Codecs() map[int]*Codec {
+	codecs := make(map[int]*Codec)
+	for _, v := range m.Attributes("rtpmap") {
+		pt, rest, ok := splitPayload(v)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(rest, "/")
+		c := &Codec{PayloadType: pt, Name: parts[0], AssociatedPT: -1}
+		if len(parts) > 1 {
+			c.ClockRate, _ = strconv.Atoi(parts[1])
+		}
+		codecs[pt] = c
+	}
+	for _, v := range m.Attributes("fmtp") {
+		pt, rest, ok := splitPayload(v)
+		if !ok || codecs[pt] == nil {
+			continue
+		}
+		for _, param := range strings.Split(rest, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if found && key == "apt" {
+				if apt, err := strconv.Atoi(value); err == nil {
+					codecs[pt].AssociatedPT = apt
+				}
+			}
+		}
+	}
+	return codecs
+}
+
+// RemovePayloads drops the payload types from the m= line together with
+// their rtpmap, fmtp and rtcp-fb attributes.
+func (m *MediaSection) RemovePayloads(drop map[int]bool) {
+	kept := make([]int, 0)
+	for _, pt := range m.Payloads() {
+		if !drop[pt] {
+			kept = append(kept, pt)
+		}
+	}
+	m.SetPayloads(kept)
+	lines := m.Lines[:1]
+	for _, line := range m.Lines[1:] {
+		if pt, ok := attributePayload(line); ok && drop[pt] {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	m.Lines = lines
+}
+
+// SetBandwidth replaces any b=<kind> line with the given value, placing it
+// after the c= line as RFC 4566 requires.
+func (m *MediaSection) SetBandwidth(kind string, value int) {
+	prefix := "b=" + kind + ":"
+	line := prefix + strconv.Itoa(value)
+	insertAt := 1
+	for i, l := range m.Lines {
+		if strings.HasPrefix(l, prefix) {
+			m.Lines[i] = line
+			return
+		}
+		if strings.HasPrefix(l, "i=") || strings.HasPrefix(l, "c=") || strings.HasPrefix(l, "b=") {
+			insertAt = i + 1
+		}
+	}
+	m.Lines = append(m.Lines[:insertAt], append([]string{line}, m.Lines[insertAt:]...)...)
+}
+
+func attributePayload(line string) (int, bool) {
+	for _, name := range []string{"a=rtpmap:", "a=fmtp:", "a=rtcp-fb:"} {
+		if strings.HasPrefix(line, name) {
+			pt, _, ok := splitPayload(line[len(name):])
+			return pt, ok
+		}
+	}
+	return 0, false
+}
+
+func splitPayload(v string) (int, string, bool) {
+	head, rest, _ := strings.Cut(v, " ")
+	pt, err := strconv.Atoi(head)
+	if err != nil {
+		return 0, "", false
+	}
+	return pt, rest, true
+}
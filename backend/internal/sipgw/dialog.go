@@ -0,0 +1,470 @@
+// Package sipgw — SIP dialogs mapped to hub calls and rooms.
+//
+// The agent's INVITEs to users are answered once the browser callee's
+// answer and trickled candidates are in; hub calls to the agent are sent
+// on as INVITEs, with the agent's answer relayed back. Either side ends a
+// call with BYE or hangup, and an unanswered one with CANCEL or cancel.
+// Room dialogs last until the agent's BYE.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sipgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+)
+
+// dialogKind says what a dialog is bridged to.
+type dialogKind int
+
+const (
+	// kindCallOut is the agent calling a user through the hub.
+	kindCallOut dialogKind = iota
+	// kindCallIn is a hub call to the agent's subject.
+	kindCallIn
+	// kindRoom is the agent in a room.
+	kindRoom
+)
+
+// dialogState is where a dialog is in its INVITE transaction.
+type dialogState int
+
+const (
+	stateEarly dialogState = iota
+	stateConfirmed
+)
+
+// dialog is one INVITE dialog with the agent.
+type dialog struct {
+	kind   dialogKind
+	state  dialogState
+	callID string
+	// tag is the gateway's tag; local and remote are the From and To of
+	// requests the gateway sends in the dialog, and target their URI.
+	tag                   string
+	local, remote, target string
+	cseq                  int
+	// invite is the agent's INVITE, or the gateway's for kindCallIn.
+	invite *message
+
+	// hubCall is the hub call ID and peerID the browser peer on its other
+	// end, once known.
+	hubCall, peerID string
+	// answer and candidates collect a browser callee's answer until the
+	// gather window closes.
+	answer     string
+	candidates []json.RawMessage
+	timer      *time.Timer
+	// cancelled marks a kindCallIn INVITE the gateway has cancelled.
+	cancelled bool
+
+	// roomID is the room of a kindRoom dialog and watching the publisher
+	// it carries back.
+	roomID, watching string
+}
+
+// request builds an in-dialog request from the gateway.
+func (c *conn) request(d *dialog, method string, cseq int) *message {
+	m := &message{method: method, uri: d.target}
+	m.add("Via", c.via())
+	m.add("Max-Forwards", "70")
+	m.add("From", d.local)
+	m.add("To", d.remote)
+	m.add("Call-ID", d.callID)
+	m.add("CSeq", fmt.Sprintf("%d %s", cseq, method))
+	return m
+}
+
+// respond answers the agent's INVITE of d.
+func (c *conn) respond(d *dialog, status int, reason string) *message {
+	resp := response(d.invite, status, reason, d.tag)
+	if status >= 200 && status < 300 {
+		resp.add("Contact", c.contactHeader())
+	}
+	return resp
+}
+
+// invite starts a dialog for the agent's INVITE: a call when the request
+// URI names a user and a room when it carries the room prefix.
+func (c *conn) invite(req *message) {
+	callID := req.get("Call-ID")
+	c.mu.Lock()
+	peer, existing := c.peer, c.dialogs[callID]
+	c.mu.Unlock()
+	switch {
+	case existing != nil:
+		// Re-INVITEs would renegotiate media, which the hub cannot relay.
+		c.send(response(req, 488, "Not Acceptable Here", ""))
+		return
+	case peer == nil:
+		c.send(response(req, 403, "Forbidden", newToken()))
+		return
+	}
+	tag := newToken()
+	offer, err := fromSIP(req.body)
+	if err != nil {
+		c.send(response(req, 488, "Not Acceptable Here", tag))
+		return
+	}
+	c.send(response(req, 100, "Trying", ""))
+
+	d := &dialog{callID: callID, tag: tag, invite: req, local: req.get("To") + ";tag=" + tag, remote: req.get("From")}
+	if d.target = uriOf(req.get("Contact")); d.target == "" {
+		d.target = uriOf(req.get("From"))
+	}
+	user := userOf(req.uri)
+	if roomID, ok := strings.CutPrefix(user, c.g.cfg.RoomPrefix); ok && roomID != "" {
+		d.kind, d.roomID = kindRoom, roomID
+		c.joinRoom(peer, d, offer)
+		return
+	}
+	d.kind = kindCallOut
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.peer != peer {
+		c.send(c.respond(d, 480, "Temporarily Unavailable"))
+		return
+	}
+	// The hub's replies reach handleEvent through the pump, after c.mu is
+	// released and the dialog knows its call ID.
+	if d.hubCall = c.g.hub.Invite(peer, user, offer); d.hubCall == "" {
+		c.send(c.respond(d, 486, "Busy Here"))
+		return
+	}
+	c.dialogs[callID] = d
+}
+
+// joinRoom joins d's room, publishes the agent's offer on a duplex SFU
+// connection and answers, then carries back the first other publisher.
+// An agent is in one room at a time.
+func (c *conn) joinRoom(peer *hub.Peer, d *dialog, offer string) {
+	c.mu.Lock()
+	for _, other := range c.dialogs {
+		if other.kind == kindRoom {
+			c.mu.Unlock()
+			c.send(c.respond(d, 486, "Busy Here"))
+			return
+		}
+	}
+	c.dialogs[d.callID] = d
+	c.mu.Unlock()
+
+	// The SFU waits for candidate gathering, so this runs unlocked.
+	err := c.g.hub.JoinSFU(peer, d.roomID)
+	var answer string
+	if err == nil {
+		if answer, err = c.g.hub.PublishDuplex(peer, offer); err != nil {
+			c.g.hub.HandleMessage(peer, hub.SignalMessage{Type: "leave", RoomID: d.roomID})
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dialogs[d.callID] != d {
+		return
+	}
+	if err != nil {
+		delete(c.dialogs, d.callID)
+		status, reason := sipStatus(err)
+		c.send(c.respond(d, status, reason))
+		return
+	}
+	d.state = stateConfirmed
+	c.send(c.respond(d, 200, "OK").withSDP(toSIP(answer, nil)))
+	log.Printf("SIP agent %s joined room %s", peer.ID, d.roomID)
+	c.watchLocked(d)
+}
+
+// watchLocked subscribes a room dialog carrying nobody to the first other
+// publisher. Caller holds c.mu.
+func (c *conn) watchLocked(d *dialog) {
+	if d.watching != "" {
+		return
+	}
+	publishers, err := c.g.hub.Publishers(c.peer)
+	if err != nil {
+		return
+	}
+	sort.Strings(publishers)
+	for _, id := range publishers {
+		if id != c.peer.ID {
+			d.watching = id
+			c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "subscribe", PeerID: id})
+			return
+		}
+	}
+}
+
+// bye ends a confirmed dialog at the agent's request.
+func (c *conn) bye(req *message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.dialogs[req.get("Call-ID")]
+	if d == nil || d.state != stateConfirmed {
+		c.send(response(req, 481, "Call/Transaction Does Not Exist", ""))
+		return
+	}
+	c.send(response(req, 200, "OK", ""))
+	c.hangupLocked(d)
+}
+
+// cancel stops the agent's unanswered INVITE.
+func (c *conn) cancel(req *message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.dialogs[req.get("Call-ID")]
+	if d == nil || d.kind == kindCallIn || d.state != stateEarly {
+		c.send(response(req, 481, "Call/Transaction Does Not Exist", ""))
+		return
+	}
+	c.send(response(req, 200, "OK", d.tag))
+	c.send(c.respond(d, 487, "Request Terminated"))
+	c.hangupLocked(d)
+}
+
+// hangupLocked forgets d and tells the hub it has ended. Caller holds c.mu.
+func (c *conn) hangupLocked(d *dialog) {
+	c.forgetLocked(d)
+	switch {
+	case d.kind == kindRoom:
+		c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "leave", RoomID: d.roomID})
+	case d.state == stateEarly && d.peerID == "":
+		c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "cancel", CallID: d.hubCall})
+	default:
+		c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "hangup", CallID: d.hubCall})
+	}
+}
+
+// terminateLocked ends d towards the agent: BYE once confirmed, CANCEL for
+// the gateway's own INVITE, else the final response status. A cancelled
+// INVITE stays until the agent's final response to it. Caller holds c.mu.
+func (c *conn) terminateLocked(d *dialog, status int, reason string) {
+	switch {
+	case d.state == stateConfirmed:
+		c.forgetLocked(d)
+		c.send(c.request(d, "BYE", d.nextCSeq()))
+	case d.kind == kindCallIn:
+		if !d.cancelled {
+			d.cancelled = true
+			n, _ := d.invite.cseq()
+			cancel := c.request(d, "CANCEL", n)
+			cancel.set("Via", d.invite.get("Via"))
+			cancel.uri = d.invite.uri
+			c.send(cancel)
+		}
+	default:
+		c.forgetLocked(d)
+		c.send(c.respond(d, status, reason))
+	}
+}
+
+func (c *conn) forgetLocked(d *dialog) {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	if c.dialogs[d.callID] == d {
+		delete(c.dialogs, d.callID)
+	}
+}
+
+func (d *dialog) nextCSeq() int {
+	d.cseq++
+	return d.cseq
+}
+
+// handleEvent applies a hub event to the agent's dialogs. Caller holds c.mu.
+func (c *conn) handleEvent(msg hub.SignalMessage) {
+	switch msg.Type {
+	case "invite":
+		c.incomingLocked(msg)
+	case "ringing", "accept", "reject", "busy", "cancel", "hangup", "error":
+		for _, d := range c.dialogs {
+			if d.hubCall != "" && d.hubCall == msg.CallID {
+				c.callEventLocked(d, msg)
+				return
+			}
+		}
+	case "answer", "ice-candidate":
+		for _, d := range c.dialogs {
+			if d.kind == kindCallOut && d.state == stateEarly && d.peerID != "" && d.peerID == msg.PeerID {
+				c.collectLocked(d, msg)
+				return
+			}
+		}
+	case "published", "unpublished":
+		for _, d := range c.dialogs {
+			if d.kind == kindRoom && d.state == stateConfirmed {
+				if msg.Type == "unpublished" && msg.PeerID == d.watching {
+					d.watching = ""
+				}
+				c.watchLocked(d)
+				return
+			}
+		}
+	}
+}
+
+// incomingLocked sends a hub call to the agent as an INVITE carrying the
+// caller's early offer. Caller holds c.mu.
+func (c *conn) incomingLocked(msg hub.SignalMessage) {
+	if msg.SDP == "" || c.contact == "" {
+		c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "reject", CallID: msg.CallID, Reason: "unsupported"})
+		return
+	}
+	domain := c.g.cfg.Domain
+	d := &dialog{
+		kind:    kindCallIn,
+		callID:  newToken() + "@" + domain,
+		tag:     newToken(),
+		target:  c.contact,
+		remote:  "<sip:" + c.claims.Subject + "@" + domain + ">",
+		hubCall: msg.CallID,
+		peerID:  msg.PeerID,
+	}
+	d.local = "<sip:" + msg.From + "@" + domain + ">;tag=" + d.tag
+	d.invite = c.request(d, "INVITE", d.nextCSeq())
+	d.invite.add("Contact", c.contactHeader())
+	d.invite.withSDP(toSIP(msg.SDP, nil))
+	c.dialogs[d.callID] = d
+	c.send(d.invite)
+}
+
+// callEventLocked applies a hub call event to a call dialog. Caller holds
+// c.mu.
+func (c *conn) callEventLocked(d *dialog, msg hub.SignalMessage) {
+	if d.kind == kindCallIn {
+		switch {
+		case msg.Type == "cancel" && d.state == stateEarly,
+			msg.Type == "hangup" && d.state == stateConfirmed:
+			c.terminateLocked(d, 0, "")
+		}
+		return
+	}
+	switch msg.Type {
+	case "ringing":
+		if d.state == stateEarly {
+			c.send(c.respond(d, 180, "Ringing"))
+		}
+	case "accept":
+		d.peerID = msg.PeerID
+	case "reject":
+		if msg.Reason == "unavailable" {
+			c.terminateLocked(d, 480, "Temporarily Unavailable")
+		} else {
+			c.terminateLocked(d, 603, "Decline")
+		}
+	case "busy":
+		c.terminateLocked(d, 486, "Busy Here")
+	case "cancel":
+		c.terminateLocked(d, 408, "Request Timeout")
+	case "hangup":
+		c.terminateLocked(d, 480, "Temporarily Unavailable")
+	case "error":
+		if d.state == stateEarly && d.peerID == "" {
+			c.terminateLocked(d, 400, "Bad Request")
+		}
+	}
+}
+
+// collectLocked gathers the browser callee's answer and candidates,
+// answering the agent on an end-of-candidates or when the gather window
+// closes. Caller holds c.mu.
+func (c *conn) collectLocked(d *dialog, msg hub.SignalMessage) {
+	if msg.Type == "answer" {
+		if d.answer != "" {
+			return
+		}
+		d.answer = msg.SDP
+		d.timer = time.AfterFunc(c.g.cfg.GatherWindow, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.dialogs[d.callID] == d && d.state == stateEarly {
+				c.answerLocked(d)
+			}
+		})
+		return
+	}
+	var init candidateInit
+	if len(msg.Candidate) > 0 && string(msg.Candidate) != "null" && json.Unmarshal(msg.Candidate, &init) == nil && init.Candidate != "" {
+		d.candidates = append(d.candidates, msg.Candidate)
+		return
+	}
+	if d.answer != "" {
+		c.answerLocked(d)
+	}
+}
+
+// answerLocked answers the agent with the collected answer. Caller holds
+// c.mu.
+func (c *conn) answerLocked(d *dialog) {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.state = stateConfirmed
+	c.send(c.respond(d, 200, "OK").withSDP(toSIP(d.answer, d.candidates)))
+	d.candidates = nil
+}
+
+// handleResponse applies the agent's responses to the gateway's INVITEs;
+// responses to BYE and CANCEL need nothing.
+func (c *conn) handleResponse(resp *message) {
+	cseq, method := resp.cseq()
+	if method != "INVITE" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.dialogs[resp.get("Call-ID")]
+	if d == nil || d.kind != kindCallIn {
+		return
+	}
+	switch {
+	case resp.status < 200:
+		if (resp.status == 180 || resp.status == 183) && d.state == stateEarly && !d.cancelled {
+			c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "ringing", CallID: d.hubCall})
+		}
+	case resp.status < 300:
+		if d.state == stateConfirmed {
+			return
+		}
+		d.state, d.remote = stateConfirmed, resp.get("To")
+		if target := uriOf(resp.get("Contact")); target != "" {
+			d.target = target
+		}
+		c.send(c.request(d, "ACK", cseq))
+		answer, err := fromSIP(resp.body)
+		switch {
+		case d.cancelled:
+			c.terminateLocked(d, 0, "")
+		case err != nil:
+			c.terminateLocked(d, 0, "")
+			c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "reject", CallID: d.hubCall, Reason: "unsupported"})
+		default:
+			c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "accept", CallID: d.hubCall})
+			c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "answer", PeerID: d.peerID, SDP: answer})
+		}
+	default:
+		// The ACK of a failure response belongs to the INVITE transaction.
+		ack := c.request(d, "ACK", cseq)
+		ack.set("Via", d.invite.get("Via"))
+		ack.set("To", resp.get("To"))
+		ack.uri = d.invite.uri
+		c.send(ack)
+		c.forgetLocked(d)
+		switch {
+		case d.cancelled:
+		case resp.status == 486 || resp.status == 600:
+			c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "busy", CallID: d.hubCall})
+		case resp.status == 603:
+			c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "reject", CallID: d.hubCall, Reason: "declined"})
+		default:
+			c.g.hub.HandleMessage(c.peer, hub.SignalMessage{Type: "reject", CallID: d.hubCall, Reason: "unavailable"})
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Package sipgw — SIP over WebSocket (RFC 7118) gateway to calls and rooms.
+//
+// SIP user agents connect with the "sip" subprotocol and a token query
+// parameter, like /ws/signal, and REGISTER as the token's subject. A
+// registered agent is a hub peer: its INVITEs to a user become hub calls
+// ringing that user's devices, hub calls to its subject become INVITEs to
+// it, and INVITEs to <RoomPrefix><room> join the room through the SFU on a
+// single sendrecv connection that carries back one other publisher at a
+// time. Agents must offer and answer WebRTC media (ICE and DTLS-SRTP) with
+// their candidates included, as they cannot trickle.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sipgw
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocol is the WebSocket subprotocol agents must request.
+const Subprotocol = "sip"
+
+// Defaults for Config.
+const (
+	DefaultDomain       = "localhost"
+	DefaultRoomPrefix   = "room-"
+	DefaultGatherWindow = time.Second
+)
+
+// defaultExpires is the registration lifetime when the agent asks none.
+const defaultExpires = 3600
+
+// allow lists the methods the gateway accepts.
+const allow = "REGISTER, INVITE, ACK, BYE, CANCEL, OPTIONS"
+
+// Config configures a Gateway.
+type Config struct {
+	// Domain is the host part of the gateway's own SIP URIs.
+	Domain string
+	// RoomPrefix marks request URIs that address rooms: with the default,
+	// sip:room-lobby@domain is room "lobby".
+	RoomPrefix string
+	// GatherWindow bounds how long a browser callee's trickled candidates
+	// are collected into its answer before the 200 OK is sent.
+	GatherWindow time.Duration
+}
+
+// Gateway serves SIP over WebSocket. Mount it at /sip.
+type Gateway struct {
+	hub       *hub.SignalHub
+	validator contracts.TokenValidator
+	cfg       Config
+	upgrader  websocket.Upgrader
+}
+
+// New creates a gateway that signals through h and authenticates agents
+// with validator.
+func New(h *hub.SignalHub, validator contracts.TokenValidator, cfg Config) *Gateway {
+	if cfg.Domain == "" {
+		cfg.Domain = DefaultDomain
+	}
+	if cfg.RoomPrefix == "" {
+		cfg.RoomPrefix = DefaultRoomPrefix
+	}
+	if cfg.GatherWindow <= 0 {
+		cfg.GatherWindow = DefaultGatherWindow
+	}
+	return &Gateway{
+		hub:       h,
+		validator: validator,
+		cfg:       cfg,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{Subprotocol},
+			CheckOrigin:  func(*http.Request) bool { return true },
+		},
+	}
+}
+
+// conn is one agent's WebSocket connection.
+type conn struct {
+	g         *Gateway
+	ws        *websocket.Conn
+	claims    *contracts.Claims
+	transport string
+	writeMu   sync.Mutex
+
+	// mu guards the registration and dialogs against the hub event pump.
+	mu      sync.Mutex
+	peer    *hub.Peer
+	contact string
+	expiry  *time.Timer
+	dialogs map[string]*dialog // by SIP Call-ID
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, err := g.validator.Validate(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	ws, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("SIP WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer ws.Close()
+	if ws.Subprotocol() != Subprotocol {
+		ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseProtocolError, "sip subprotocol required"))
+		return
+	}
+	c := &conn{g: g, ws: ws, claims: claims, transport: "WS", dialogs: make(map[string]*dialog)}
+	if r.TLS != nil {
+		c.transport = "WSS"
+	}
+	defer func() {
+		c.mu.Lock()
+		c.unregisterLocked()
+		c.mu.Unlock()
+	}()
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		m, err := parseMessage(string(data))
+		if err != nil {
+			continue
+		}
+		if m.isRequest() {
+			c.handleRequest(m)
+		} else {
+			c.handleResponse(m)
+		}
+	}
+}
+
+func (c *conn) handleRequest(req *message) {
+	switch req.method {
+	case "REGISTER":
+		c.register(req)
+	case "INVITE":
+		c.invite(req)
+	case "ACK":
+		// 2xx responses are not retransmitted on this reliable transport,
+		// so there is nothing for an ACK to stop.
+	case "BYE":
+		c.bye(req)
+	case "CANCEL":
+		c.cancel(req)
+	case "OPTIONS":
+		resp := response(req, 200, "OK", newToken())
+		resp.add("Allow", allow)
+		c.send(resp)
+	default:
+		resp := response(req, 405, "Method Not Allowed", newToken())
+		resp.add("Allow", allow)
+		c.send(resp)
+	}
+}
+
+// register binds the agent's Contact to its token's subject, creating its
+// hub peer on first use. Expires 0 removes the binding and the peer.
+func (c *conn) register(req *message) {
+	tag := newToken()
+	if userOf(uriOf(req.get("To"))) != c.claims.Subject {
+		c.send(response(req, 403, "Forbidden", tag))
+		return
+	}
+	contact := req.get("Contact")
+	expires := defaultExpires
+	if v := param(contact, "expires"); v != "" {
+		expires, _ = strconv.Atoi(v)
+	} else if v := req.get("Expires"); v != "" {
+		expires, _ = strconv.Atoi(v)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case contact == "":
+		// A query: report the current binding.
+	case contact == "*" || expires <= 0:
+		c.unregisterLocked()
+	default:
+		if c.peer == nil {
+			peer, err := c.g.hub.RegisterLocal(c.claims.Subject+"-sip-"+newToken()[:8], c.claims)
+			if err != nil {
+				c.send(response(req, 503, "Service Unavailable", tag))
+				return
+			}
+			c.peer = peer
+			go c.pump(peer)
+			log.Printf("SIP agent %s registered as %s", c.claims.Subject, peer.ID)
+		}
+		c.contact = uriOf(contact)
+		if c.expiry != nil {
+			c.expiry.Stop()
+		}
+		var timer *time.Timer
+		timer = time.AfterFunc(time.Duration(expires)*time.Second, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.expiry == timer {
+				c.unregisterLocked()
+			}
+		})
+		c.expiry = timer
+	}
+	resp := response(req, 200, "OK", tag)
+	if c.contact != "" {
+		resp.add("Contact", "<"+c.contact+">;expires="+strconv.Itoa(expires))
+	}
+	c.send(resp)
+}
+
+// unregisterLocked ends the agent's dialogs and drops its hub peer, which
+// ends its calls and takes it out of its room. Caller holds c.mu.
+func (c *conn) unregisterLocked() {
+	if c.peer == nil {
+		return
+	}
+	for _, d := range c.dialogs {
+		c.terminateLocked(d, 480, "Temporarily Unavailable")
+	}
+	c.dialogs = make(map[string]*dialog)
+	if c.expiry != nil {
+		c.expiry.Stop()
+		c.expiry = nil
+	}
+	c.g.hub.Unregister(c.peer)
+	log.Printf("SIP agent %s unregistered", c.peer.ID)
+	c.peer, c.contact = nil, ""
+}
+
+// pump handles peer's hub events until the hub drops it.
+func (c *conn) pump(peer *hub.Peer) {
+	for data := range peer.Send {
+		var msg hub.SignalMessage
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		c.mu.Lock()
+		if c.peer == peer {
+			c.handleEvent(msg)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// send writes m to the agent. Errors surface on the read loop.
+func (c *conn) send(m *message) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.ws.WriteMessage(websocket.TextMessage, []byte(m.String()))
+}
+
+// contactHeader is the gateway's Contact for the agent's dialogs.
+func (c *conn) contactHeader() string {
+	return "<sip:" + c.peer.ID + "@" + c.g.cfg.Domain + ";transport=ws>"
+}
+
+// via returns a Via for a request the gateway sends.
+func (c *conn) via() string {
+	return "SIP/2.0/" + c.transport + " " + c.g.cfg.Domain + ";branch=" + newBranch()
+}
+
+// sipStatus maps hub and SFU errors to SIP final responses; anything else
+// is taken to be an unusable offer.
+func sipStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, hub.ErrPeerQuota), errors.Is(err, hub.ErrRoomQuota), errors.Is(err, hub.ErrRateLimit),
+		errors.Is(err, hub.ErrSFUDisabled):
+		return 503, "Service Unavailable"
+	case errors.Is(err, hub.ErrNoSuchRoom):
+		return 404, "Not Found"
+	}
+	return 488, "Not Acceptable Here"
+}
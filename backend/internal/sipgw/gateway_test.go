@@ -0,0 +1,519 @@
+// Package sipgw — End-to-end SIP over WebSocket against a local user agent
+// stand-in.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sipgw
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/sfu"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/client"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/pion/ice/v4"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const testSecret = "sipgw-test-secret"
+
+func token(user string) string {
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user, "session_id": "1", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testSecret))
+	return signed
+}
+
+// newServer serves /ws/signal like cmd/signaling plus the gateway at /sip,
+// with an SFU for room dialogs.
+func newServer(t *testing.T) string {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	var h *hub.SignalHub
+	media, err := sfu.New(sfu.Config{Loopback: true}, func(tenant, peerID string, msg sfu.Message) {
+		h.Deliver(tenant, peerID, hub.SignalMessage{Type: msg.Type, RoomID: msg.RoomID, SDP: msg.SDP})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(media.Close)
+	h = hub.NewSignalHub(nil, hub.WithSFU(media, 100))
+	validator := auth.NewJWTValidator(testSecret)
+
+	mux := http.NewServeMux()
+	mux.Handle("/sip", New(h, validator, Config{Domain: "test.invalid", GatherWindow: 5 * time.Second}))
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws/signal", func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.Validate(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			var msg hub.SignalMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			h.HandleMessage(peer, msg)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// agent is the SIP user agent stand-in.
+type agent struct {
+	t    *testing.T
+	user string
+	ws   *websocket.Conn
+	in   chan *message
+}
+
+func dialAgent(t *testing.T, base, user string) *agent {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{Subprotocol}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(base, "http")+"/sip?token="+token(user), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	a := &agent{t: t, user: user, ws: ws, in: make(chan *message, 64)}
+	go func() {
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if m, err := parseMessage(string(data)); err == nil {
+				a.in <- m
+			}
+		}
+	}()
+	return a
+}
+
+func (a *agent) send(m *message) {
+	a.t.Helper()
+	if err := a.ws.WriteMessage(websocket.TextMessage, []byte(m.String())); err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+// request builds a request from the agent.
+func (a *agent) request(method, uri, callID string, cseq int, to string) *message {
+	m := &message{method: method, uri: uri}
+	m.add("Via", "SIP/2.0/WS agent.invalid;branch="+newBranch())
+	m.add("Max-Forwards", "70")
+	m.add("From", "<sip:"+a.user+"@test.invalid>;tag=ua-"+a.user)
+	m.add("To", to)
+	m.add("Call-ID", callID)
+	m.add("CSeq", fmt.Sprintf("%d %s", cseq, method))
+	m.add("Contact", "<sip:"+a.user+"@agent.invalid;transport=ws>")
+	return m
+}
+
+// expect returns the next message, failing unless it is a response with
+// status or a request with method.
+func (a *agent) expect(want any) *message {
+	a.t.Helper()
+	select {
+	case m := <-a.in:
+		if m.status != want && m.method != want {
+			a.t.Fatalf("expected %v, got %q", want, m.String())
+		}
+		return m
+	case <-time.After(10 * time.Second):
+		a.t.Fatalf("no %v", want)
+	}
+	return nil
+}
+
+func (a *agent) register() {
+	a.t.Helper()
+	req := a.request("REGISTER", "sip:test.invalid", "reg-"+a.user, 1, "<sip:"+a.user+"@test.invalid>")
+	a.send(req)
+	a.expect(200)
+}
+
+func newPeerConnection(t *testing.T) *webrtc.PeerConnection {
+	t.Helper()
+	se := webrtc.SettingEngine{}
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+// audioPeer returns a connection sending an Opus track and a channel that
+// receives once connected.
+func audioPeer(t *testing.T) (*webrtc.PeerConnection, *webrtc.TrackLocalStaticRTP, chan struct{}) {
+	t.Helper()
+	pc := newPeerConnection(t)
+	track, _ := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "sip")
+	if _, err := pc.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	connected := make(chan struct{}, 1)
+	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		if s == webrtc.PeerConnectionStateConnected {
+			connected <- struct{}{}
+		}
+	})
+	return pc, track, connected
+}
+
+// gathered applies desc locally and returns it with every candidate.
+func gathered(t *testing.T, pc *webrtc.PeerConnection, desc webrtc.SessionDescription, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(desc); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	return pc.LocalDescription().SDP
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s timed out", what)
+	}
+}
+
+func browser(t *testing.T, ctx context.Context, base, user string) (*client.Client, chan client.Message) {
+	t.Helper()
+	events := make(chan client.Message, 64)
+	c := client.New(base, func(context.Context) (string, error) { return token(user), nil },
+		client.WithoutReconnect(), client.WithHandlers(client.Handlers{OnMessage: func(msg client.Message) { events <- msg }}))
+	t.Cleanup(func() { c.Close() })
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return c, events
+}
+
+func expect(t *testing.T, ch <-chan client.Message, typ string) client.Message {
+	t.Helper()
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Type == typ {
+				return msg
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no %s message", typ)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	base := newServer(t)
+	if resp, err := http.Get(base + "/sip"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated connect: %v %v", resp, err)
+	}
+	alice := dialAgent(t, base, "alice")
+
+	alice.send(alice.request("INVITE", "sip:bob@test.invalid", "c1", 1, "<sip:bob@test.invalid>").withSDP("v=0\r\n"))
+	alice.expect(403)
+	alice.send(alice.request("REGISTER", "sip:test.invalid", "r1", 1, "<sip:bob@test.invalid>"))
+	alice.expect(403)
+
+	req := alice.request("REGISTER", "sip:test.invalid", "r1", 2, "<sip:alice@test.invalid>")
+	req.set("Contact", "<sip:alice@agent.invalid;transport=ws>;expires=60")
+	alice.send(req)
+	if resp := alice.expect(200); resp.get("Contact") != "<sip:alice@agent.invalid;transport=ws>;expires=60" || tagOf(resp.get("To")) == "" {
+		t.Fatalf("unexpected REGISTER response %q", resp.String())
+	}
+	alice.send(alice.request("OPTIONS", "sip:test.invalid", "o1", 1, "<sip:test.invalid>"))
+	if resp := alice.expect(200); resp.get("Allow") != allow {
+		t.Fatalf("unexpected OPTIONS response %q", resp.String())
+	}
+	alice.send(alice.request("MESSAGE", "sip:bob@test.invalid", "m1", 1, "<sip:bob@test.invalid>"))
+	alice.expect(405)
+	plain := "v=0\r\no=- 1 1 IN IP4 192.0.2.1\r\ns=-\r\nc=IN IP4 192.0.2.1\r\nt=0 0\r\nm=audio 4000 RTP/AVP 0\r\n"
+	alice.send(alice.request("INVITE", "sip:bob@test.invalid", "c2", 1, "<sip:bob@test.invalid>").withSDP(plain))
+	alice.expect(488)
+
+	// A browser reaches alice's agent while registered and not after.
+	bob, events := browser(t, ctx, base, "bob")
+	bob.Send(client.Message{Type: "invite", To: "alice", SDP: "v=0\r\n"})
+	expect(t, events, "calling")
+	invite := alice.expect("INVITE")
+	if invite.uri != "sip:alice@agent.invalid;transport=ws" {
+		t.Fatalf("INVITE sent to %q", invite.uri)
+	}
+	resp := response(invite, 480, "Temporarily Unavailable", "ua")
+	alice.send(resp)
+	alice.expect("ACK")
+	if msg := expect(t, events, "reject"); msg.Reason != "unavailable" {
+		t.Fatalf("unexpected reject %+v", msg)
+	}
+
+	req = alice.request("REGISTER", "sip:test.invalid", "r1", 3, "<sip:alice@test.invalid>")
+	req.set("Contact", "*")
+	req.add("Expires", "0")
+	alice.send(req)
+	alice.expect(200)
+	bob.Send(client.Message{Type: "invite", To: "alice", SDP: "v=0\r\n"})
+	if msg := expect(t, events, "reject"); msg.Reason != "unavailable" {
+		t.Fatalf("invite after unregister: %+v", msg)
+	}
+}
+
+func TestCallToBrowser(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	base := newServer(t)
+	bob, events := browser(t, ctx, base, "bob")
+	alice := dialAgent(t, base, "alice")
+	alice.register()
+
+	ua, _, uaConnected := audioPeer(t)
+	sdpOffer, err := ua.CreateOffer(nil)
+	offerSDP := gathered(t, ua, sdpOffer, err)
+	invite := alice.request("INVITE", "sip:bob@test.invalid", "call-1", 1, "<sip:bob@test.invalid>").withSDP(offerSDP)
+	alice.send(invite)
+	alice.expect(100)
+
+	ringing := expect(t, events, "invite")
+	if ringing.From != "alice" || ringing.SDP == "" || ringing.PeerID == "" {
+		t.Fatalf("unexpected invite %+v", ringing)
+	}
+	bob.Send(client.Message{Type: "ringing", CallID: ringing.CallID})
+	alice.expect(180)
+
+	// bob answers like a browser, trickling candidates after the answer.
+	pc, _, bobConnected := audioPeer(t)
+	candidates := make(chan *webrtc.ICECandidate, 16)
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) { candidates <- c })
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: ringing.SDP}); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	bob.Send(client.Message{Type: "accept", CallID: ringing.CallID})
+	bob.Answer(ringing.PeerID, answer.SDP)
+	for c := range candidates {
+		if c == nil {
+			bob.Candidate(ringing.PeerID, client.ICECandidate{})
+			break
+		}
+		init := c.ToJSON()
+		bob.Candidate(ringing.PeerID, client.ICECandidate{Candidate: init.Candidate, SDPMid: init.SDPMid, SDPMLineIndex: init.SDPMLineIndex})
+	}
+
+	ok := alice.expect(200)
+	if !strings.Contains(ok.body, "a=candidate:") || strings.Contains(ok.body, "trickle") || !strings.Contains(ok.body, "a=end-of-candidates") {
+		t.Fatalf("answer lacks merged candidates:\n%s", ok.body)
+	}
+	if err := ua.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: ok.body}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, uaConnected, "agent connection")
+	waitFor(t, bobConnected, "browser connection")
+	to := ok.get("To")
+	alice.send(alice.request("ACK", uriOf(ok.get("Contact")), "call-1", 1, to))
+	alice.send(alice.request("BYE", uriOf(ok.get("Contact")), "call-1", 2, to))
+	alice.expect(200)
+	expect(t, events, "hangup")
+
+	// A declined call, then one the agent cancels.
+	alice.send(alice.request("INVITE", "sip:bob@test.invalid", "call-2", 1, "<sip:bob@test.invalid>").withSDP(offerSDP))
+	alice.expect(100)
+	bob.Send(client.Message{Type: "reject", CallID: expect(t, events, "invite").CallID})
+	alice.expect(603)
+
+	invite = alice.request("INVITE", "sip:bob@test.invalid", "call-3", 1, "<sip:bob@test.invalid>").withSDP(offerSDP)
+	alice.send(invite)
+	alice.expect(100)
+	expect(t, events, "invite")
+	cancelReq := alice.request("CANCEL", invite.uri, "call-3", 1, invite.get("To"))
+	cancelReq.set("Via", invite.get("Via"))
+	alice.send(cancelReq)
+	alice.expect(200)
+	alice.expect(487)
+	if msg := expect(t, events, "cancel"); msg.Reason != "cancelled" {
+		t.Fatalf("unexpected cancel %+v", msg)
+	}
+}
+
+func TestCallFromBrowser(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	base := newServer(t)
+	bob, events := browser(t, ctx, base, "bob")
+	alice := dialAgent(t, base, "alice")
+	alice.register()
+
+	pc, _, bobConnected := audioPeer(t)
+	offer, err := pc.CreateOffer(nil)
+	bob.Send(client.Message{Type: "invite", To: "alice", SDP: gathered(t, pc, offer, err)})
+	calling := expect(t, events, "calling")
+
+	invite := alice.expect("INVITE")
+	if !strings.Contains(invite.body, "a=candidate:") || tagOf(invite.get("From")) == "" || invite.get("Contact") == "" {
+		t.Fatalf("unexpected INVITE %q", invite.String())
+	}
+	alice.send(response(invite, 180, "Ringing", "ua"))
+	expect(t, events, "ringing")
+
+	ua, _, uaConnected := audioPeer(t)
+	if err := ua.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: invite.body}); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := ua.CreateAnswer(nil)
+	ok := response(invite, 200, "OK", "ua").withSDP(gathered(t, ua, answer, err))
+	ok.add("Contact", "<sip:alice@agent.invalid;transport=ws>")
+	alice.send(ok)
+	if ack := alice.expect("ACK"); ack.uri != "sip:alice@agent.invalid;transport=ws" || tagOf(ack.get("To")) != "ua" {
+		t.Fatalf("unexpected ACK %q", ack.String())
+	}
+	if msg := expect(t, events, "accept"); msg.CallID != calling.CallID {
+		t.Fatalf("unexpected accept %+v", msg)
+	}
+	reply := expect(t, events, "answer")
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: reply.SDP}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, uaConnected, "agent connection")
+	waitFor(t, bobConnected, "browser connection")
+
+	bob.Send(client.Message{Type: "hangup", CallID: calling.CallID})
+	bye := alice.expect("BYE")
+	if bye.get("Call-ID") != invite.get("Call-ID") {
+		t.Fatalf("BYE for another dialog %q", bye.String())
+	}
+	alice.send(response(bye, 200, "OK", ""))
+
+	// The caller gives up: the INVITE is cancelled.
+	bob.Send(client.Message{Type: "invite", To: "alice", SDP: invite.body})
+	calling = expect(t, events, "calling")
+	invite = alice.expect("INVITE")
+	bob.Send(client.Message{Type: "cancel", CallID: calling.CallID})
+	cancelReq := alice.expect("CANCEL")
+	if cancelReq.get("Via") != invite.get("Via") {
+		t.Fatalf("CANCEL does not match INVITE %q", cancelReq.String())
+	}
+	alice.send(response(cancelReq, 200, "OK", ""))
+	alice.send(response(invite, 487, "Request Terminated", "ua"))
+	alice.expect("ACK")
+
+	// The agent is busy.
+	bob.Send(client.Message{Type: "invite", To: "alice", SDP: invite.body})
+	invite = alice.expect("INVITE")
+	alice.send(response(invite, 486, "Busy Here", "ua"))
+	alice.expect("ACK")
+	expect(t, events, "busy")
+}
+
+func TestRoom(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	base := newServer(t)
+
+	// Each agent sends audio and receives the other's through the SFU.
+	received := make(chan string, 2)
+	join := func(user string) (*agent, *message) {
+		a := dialAgent(t, base, user)
+		a.register()
+		pc, track, _ := audioPeer(t)
+		pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			if _, _, err := remote.ReadRTP(); err == nil {
+				received <- user
+			}
+		})
+		go func() {
+			ticker := time.NewTicker(20 * time.Millisecond)
+			defer ticker.Stop()
+			for seq := uint16(1); ctx.Err() == nil; seq++ {
+				<-ticker.C
+				track.WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960}, Payload: []byte{0xf8, 0xff, 0xfe}})
+			}
+		}()
+		offer, err := pc.CreateOffer(nil)
+		a.send(a.request("INVITE", "sip:room-lobby@test.invalid", "room-"+user, 1, "<sip:room-lobby@test.invalid>").withSDP(gathered(t, pc, offer, err)))
+		a.expect(100)
+		ok := a.expect(200)
+		if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: ok.body}); err != nil {
+			t.Fatal(err)
+		}
+		a.send(a.request("ACK", uriOf(ok.get("Contact")), "room-"+user, 1, ok.get("To")))
+		return a, ok
+	}
+	alice, _ := join("alice")
+	carol, carolOK := join("carol")
+
+	// A browser in the room sees both agents publishing.
+	watcher, events := browser(t, ctx, base, "dave")
+	joined, err := watcher.Join(ctx, "lobby")
+	if err != nil || joined.Mode != hub.ModeSFU || len(joined.Peers) != 2 {
+		t.Fatalf("join: %+v %v", joined, err)
+	}
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case user := <-received:
+			got[user] = true
+		case <-ctx.Done():
+			t.Fatalf("only %v received media", got)
+		}
+	}
+
+	// A second room dialog on one registration is refused.
+	pc := newPeerConnection(t)
+	pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio)
+	offer, err := pc.CreateOffer(nil)
+	alice.send(alice.request("INVITE", "sip:room-other@test.invalid", "room-2", 1, "<sip:room-other@test.invalid>").withSDP(gathered(t, pc, offer, err)))
+	alice.expect(100)
+	alice.expect(486)
+
+	carol.send(carol.request("BYE", uriOf(carolOK.get("Contact")), "room-carol", 2, carolOK.get("To")))
+	carol.expect(200)
+	if msg := expect(t, events, "unpublished"); !strings.HasPrefix(msg.PeerID, "carol-sip-") {
+		t.Fatalf("unexpected unpublished %+v", msg)
+	}
+}
@@ -0,0 +1,234 @@
+// Package sipgw — SIP message parsing and construction.
+//
+// Only what a WebSocket-attached user agent needs: one message per frame
+// (RFC 7118), so there is no stream framing, and no retransmission as the
+// transport is reliable.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sipgw
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errMalformed is returned for frames that are not SIP messages.
+var errMalformed = errors.New("malformed sip message")
+
+// compactHeaders maps RFC 3261 compact header names to their full forms.
+var compactHeaders = map[string]string{
+	"v": "Via", "f": "From", "t": "To", "i": "Call-ID", "m": "Contact",
+	"l": "Content-Length", "c": "Content-Type", "k": "Supported", "s": "Subject",
+}
+
+type header struct{ name, value string }
+
+// message is a SIP request (method set) or response (status set).
+type message struct {
+	method, uri string
+	status      int
+	reason      string
+	headers     []header
+	body        string
+}
+
+func parseMessage(data string) (*message, error) {
+	head, body, ok := strings.Cut(data, "\r\n\r\n")
+	if !ok {
+		return nil, errMalformed
+	}
+	lines := strings.Split(head, "\r\n")
+	m := &message{body: body}
+	start := strings.SplitN(lines[0], " ", 3)
+	if len(start) != 3 {
+		return nil, errMalformed
+	}
+	if start[0] == "SIP/2.0" {
+		status, err := strconv.Atoi(start[1])
+		if err != nil {
+			return nil, errMalformed
+		}
+		m.status, m.reason = status, start[2]
+	} else if start[2] == "SIP/2.0" {
+		m.method, m.uri = start[0], start[1]
+	} else {
+		return nil, errMalformed
+	}
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		// Folded continuation lines belong to the previous header.
+		if (line[0] == ' ' || line[0] == '\t') && len(m.headers) > 0 {
+			m.headers[len(m.headers)-1].value += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, errMalformed
+		}
+		m.add(canonicalName(strings.TrimSpace(name)), strings.TrimSpace(value))
+	}
+	if n, err := strconv.Atoi(m.get("Content-Length")); err == nil && n <= len(m.body) {
+		m.body = m.body[:n]
+	}
+	return m, nil
+}
+
+func canonicalName(name string) string {
+	if full, ok := compactHeaders[strings.ToLower(name)]; ok {
+		return full
+	}
+	for _, known := range []string{"Via", "From", "To", "Call-ID", "CSeq", "Contact", "Content-Length", "Content-Type", "Expires", "Max-Forwards"} {
+		if strings.EqualFold(name, known) {
+			return known
+		}
+	}
+	return name
+}
+
+func (m *message) isRequest() bool { return m.method != "" }
+
+// get returns the first value of name.
+func (m *message) get(name string) string {
+	for _, h := range m.headers {
+		if h.name == name {
+			return h.value
+		}
+	}
+	return ""
+}
+
+func (m *message) getAll(name string) []string {
+	var values []string
+	for _, h := range m.headers {
+		if h.name == name {
+			values = append(values, h.value)
+		}
+	}
+	return values
+}
+
+func (m *message) add(name, value string) {
+	m.headers = append(m.headers, header{name, value})
+}
+
+// set replaces every value of name with value, in place of the first.
+func (m *message) set(name, value string) {
+	kept, found := m.headers[:0], false
+	for _, h := range m.headers {
+		switch {
+		case h.name != name:
+			kept = append(kept, h)
+		case !found:
+			kept = append(kept, header{name, value})
+			found = true
+		}
+	}
+	if !found {
+		kept = append(kept, header{name, value})
+	}
+	m.headers = kept
+}
+
+// cseq returns the CSeq number and method.
+func (m *message) cseq() (int, string) {
+	num, method, _ := strings.Cut(m.get("CSeq"), " ")
+	n, _ := strconv.Atoi(num)
+	return n, strings.TrimSpace(method)
+}
+
+func (m *message) String() string {
+	var b strings.Builder
+	if m.isRequest() {
+		fmt.Fprintf(&b, "%s %s SIP/2.0\r\n", m.method, m.uri)
+	} else {
+		fmt.Fprintf(&b, "SIP/2.0 %d %s\r\n", m.status, m.reason)
+	}
+	for _, h := range m.headers {
+		if h.name != "Content-Length" {
+			fmt.Fprintf(&b, "%s: %s\r\n", h.name, h.value)
+		}
+	}
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(m.body), m.body)
+	return b.String()
+}
+
+// response builds a response to req, adding toTag to To if it has none.
+func response(req *message, status int, reason, toTag string) *message {
+	resp := &message{status: status, reason: reason}
+	for _, via := range req.getAll("Via") {
+		resp.add("Via", via)
+	}
+	to := req.get("To")
+	if toTag != "" && tagOf(to) == "" {
+		to += ";tag=" + toTag
+	}
+	resp.add("From", req.get("From"))
+	resp.add("To", to)
+	resp.add("Call-ID", req.get("Call-ID"))
+	resp.add("CSeq", req.get("CSeq"))
+	return resp
+}
+
+// withSDP sets an application/sdp body.
+func (m *message) withSDP(sdp string) *message {
+	m.set("Content-Type", "application/sdp")
+	m.body = sdp
+	return m
+}
+
+// param returns the value of a ;name=value parameter of a header value,
+// looking only after the URI when it is enclosed in angle brackets.
+func param(value, name string) string {
+	if i := strings.LastIndex(value, ">"); i >= 0 {
+		value = value[i+1:]
+	}
+	for _, p := range strings.Split(value, ";")[1:] {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func tagOf(value string) string { return param(value, "tag") }
+
+// uriOf extracts the URI from a name-addr or addr-spec header value.
+func uriOf(value string) string {
+	if i := strings.Index(value, "<"); i >= 0 {
+		if j := strings.Index(value[i:], ">"); j >= 0 {
+			return value[i+1 : i+j]
+		}
+	}
+	uri, _, _ := strings.Cut(value, ";")
+	return strings.TrimSpace(uri)
+}
+
+// userOf returns the user part of a sip: or sips: URI.
+func userOf(uri string) string {
+	rest, ok := strings.CutPrefix(uri, "sip:")
+	if !ok {
+		rest, _ = strings.CutPrefix(uri, "sips:")
+	}
+	user, _, ok := strings.Cut(rest, "@")
+	if !ok {
+		return ""
+	}
+	user, _, _ = strings.Cut(user, ";")
+	return user
+}
+
+func newToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newBranch returns a Via branch with the RFC 3261 magic cookie.
+func newBranch() string { return "z9hG4bK" + newToken() }
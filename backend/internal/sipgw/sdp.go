@@ -0,0 +1,166 @@
+// Package sipgw — SDP translation between SIP endpoints and browsers.
+//
+// Media flows directly between the endpoints, so both must speak WebRTC
+// media (ICE and DTLS-SRTP), as RFC 7118 user agents in browsers do. The
+// differences left are in signalling: SIP bodies use CRLF and carry every
+// candidate, while browsers trickle theirs after the SDP.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package sipgw
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errNotWebRTC is returned for SDP whose media cannot reach a browser.
+var errNotWebRTC = errors.New("sdp lacks ice credentials or dtls fingerprint")
+
+// candidateInit mirrors the browser's RTCIceCandidateInit.
+type candidateInit struct {
+	Candidate     string  `json:"candidate"`
+	SDPMid        *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex *uint16 `json:"sdpMLineIndex,omitempty"`
+}
+
+// section is one SDP section: the session header (index -1) or a media
+// section.
+type section struct {
+	mid   string
+	lines []string
+}
+
+func splitSections(sdp string) []*section {
+	sections := []*section{{}}
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "m=") {
+			sections = append(sections, &section{})
+		}
+		cur := sections[len(sections)-1]
+		if mid, ok := strings.CutPrefix(line, "a=mid:"); ok {
+			cur.mid = mid
+		}
+		cur.lines = append(cur.lines, line)
+	}
+	return sections
+}
+
+func joinSections(sections []*section) string {
+	var b strings.Builder
+	for _, s := range sections {
+		for _, line := range s.lines {
+			b.WriteString(line)
+			b.WriteString("\r\n")
+		}
+	}
+	return b.String()
+}
+
+func (s *section) has(prefix string) bool {
+	for _, line := range s.lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromSIP checks that a SIP endpoint's SDP is usable by a browser: every
+// active media section must be ICE and DTLS-SRTP, with credentials and a
+// fingerprint at session or media level.
+func fromSIP(sdp string) (string, error) {
+	sections := splitSections(sdp)
+	if len(sections) < 2 {
+		return "", errNotWebRTC
+	}
+	session := sections[0]
+	for _, media := range sections[1:] {
+		fields := strings.Fields(media.lines[0])
+		if len(fields) < 3 || fields[1] == "0" {
+			continue // rejected or malformed m= line
+		}
+		if !strings.Contains(fields[2], "DTLS") && !strings.Contains(fields[2], "SAVPF") {
+			return "", errNotWebRTC
+		}
+		for _, attr := range []string{"a=ice-ufrag:", "a=ice-pwd:", "a=fingerprint:"} {
+			if !media.has(attr) && !session.has(attr) {
+				return "", errNotWebRTC
+			}
+		}
+	}
+	return joinSections(sections), nil
+}
+
+// toSIP merges a browser's trickled candidates into its SDP so the SIP
+// endpoint gets them all in one body, and drops the trickle option.
+func toSIP(sdp string, candidates []json.RawMessage) string {
+	sections := splitSections(sdp)
+	for _, raw := range candidates {
+		var c candidateInit
+		if json.Unmarshal(raw, &c) != nil || c.Candidate == "" {
+			continue
+		}
+		if target := candidateSection(sections, c); target != nil {
+			line := "a=" + strings.TrimPrefix(c.Candidate, "a=")
+			if !target.has(line) {
+				target.lines = append(target.lines, line)
+			}
+		}
+	}
+	for i, s := range sections {
+		kept := s.lines[:0]
+		for _, line := range s.lines {
+			switch {
+			case line == "a=ice-options:trickle", line == "a=end-of-candidates":
+			case strings.HasPrefix(line, "a=ice-options:"):
+				opts := strings.Fields(strings.TrimPrefix(line, "a=ice-options:"))
+				var rest []string
+				for _, o := range opts {
+					if o != "trickle" {
+						rest = append(rest, o)
+					}
+				}
+				if len(rest) > 0 {
+					kept = append(kept, "a=ice-options:"+strings.Join(rest, " "))
+				}
+			default:
+				kept = append(kept, line)
+			}
+		}
+		if i > 0 && s.has("a=candidate:") {
+			kept = append(kept, "a=end-of-candidates")
+		}
+		s.lines = kept
+	}
+	return joinSections(sections)
+}
+
+// candidateSection finds the media section a candidate belongs to, by mid
+// and then by m-line index.
+func candidateSection(sections []*section, c candidateInit) *section {
+	if c.SDPMid != nil {
+		for _, s := range sections[1:] {
+			if s.mid == *c.SDPMid {
+				return s
+			}
+		}
+	}
+	index := 0
+	if c.SDPMLineIndex != nil {
+		index = int(*c.SDPMLineIndex)
+	} else if c.SDPMid != nil {
+		if n, err := strconv.Atoi(*c.SDPMid); err == nil {
+			index = n
+		}
+	}
+	if index+1 < len(sections) {
+		return sections[index+1]
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package stun — RFC 5389 message encoding for the embedded Binding responder.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package stun
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net"
+)
+
+// Message types and attributes used by the Binding responder.
+const (
+	MagicCookie = 0x2112A442
+
+	TypeBindingRequest    uint16 = 0x0001
+	TypeBindingIndication uint16 = 0x0011
+	TypeBindingSuccess    uint16 = 0x0101
+	TypeBindingError      uint16 = 0x0111
+
+	AttrMappedAddress     uint16 = 0x0001
+	AttrErrorCode         uint16 = 0x0009
+	AttrUnknownAttributes uint16 = 0x000A
+	AttrXORMappedAddress  uint16 = 0x0020
+	AttrSoftware          uint16 = 0x8022
+	AttrFingerprint       uint16 = 0x8028
+
+	headerSize          = 20
+	fingerprintXOR      = 0x5354554e
+	familyIPv4     byte = 0x01
+	familyIPv6     byte = 0x02
+)
+
+// Attribute is a raw type-length-value attribute.
+type Attribute struct {
+	Type  uint16
+	Value []byte
+}
+
+// Message is a decoded STUN message.
+type Message struct {
+	Type          uint16
+	TransactionID [12]byte
+	Attributes    []Attribute
+}
+
+var errNotSTUN = errors.New("stun: not a STUN message")
+
+// Decode parses a STUN message, verifying the FINGERPRINT when present.
+func Decode(b []byte) (*Message, error) {
+	if len(b) < headerSize || b[0]&0xC0 != 0 {
+		return nil, errNotSTUN
+	}
+	if binary.BigEndian.Uint32(b[4:8]) != MagicCookie {
+		return nil, errNotSTUN
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if length%4 != 0 || headerSize+length != len(b) {
+		return nil, errors.New("stun: bad message length")
+	}
+	m := &Message{Type: binary.BigEndian.Uint16(b[0:2])}
+	copy(m.TransactionID[:], b[8:20])
+	for off := headerSize; off < len(b); {
+		if off+4 > len(b) {
+			return nil, errors.New("stun: truncated attribute")
+		}
+		typ := binary.BigEndian.Uint16(b[off : off+2])
+		alen := int(binary.BigEndian.Uint16(b[off+2 : off+4]))
+		if off+4+alen > len(b) {
+			return nil, errors.New("stun: truncated attribute")
+		}
+		if typ == AttrFingerprint {
+			want := crc32.ChecksumIEEE(b[:off]) ^ fingerprintXOR
+			if alen != 4 || binary.BigEndian.Uint32(b[off+4:off+8]) != want {
+				return nil, errors.New("stun: fingerprint mismatch")
+			}
+		}
+		m.Attributes = append(m.Attributes, Attribute{Type: typ, Value: b[off+4 : off+4+alen]})
+		off += 4 + pad4(alen)
+	}
+	return m, nil
+}
+
+// Get returns the first attribute of the given type.
+func (m *Message) Get(typ uint16) ([]byte, bool) {
+	for _, a := range m.Attributes {
+		if a.Type == typ {
+			return a.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Encode serialises the message and appends a FINGERPRINT attribute.
+func (m *Message) Encode() []byte {
+	size := headerSize
+	for _, a := range m.Attributes {
+		size += 4 + pad4(len(a.Value))
+	}
+	b := make([]byte, size, size+8)
+	binary.BigEndian.PutUint16(b[0:2], m.Type)
+	binary.BigEndian.PutUint32(b[4:8], MagicCookie)
+	copy(b[8:20], m.TransactionID[:])
+	off := headerSize
+	for _, a := range m.Attributes {
+		binary.BigEndian.PutUint16(b[off:off+2], a.Type)
+		binary.BigEndian.PutUint16(b[off+2:off+4], uint16(len(a.Value)))
+		copy(b[off+4:], a.Value)
+		off += 4 + pad4(len(a.Value))
+	}
+	// Length must include the fingerprint before the CRC is computed.
+	binary.BigEndian.PutUint16(b[2:4], uint16(size-headerSize+8))
+	crc := crc32.ChecksumIEEE(b) ^ fingerprintXOR
+	b = append(b, 0x80, 0x28, 0x00, 0x04, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(b[size+4:], crc)
+	return b
+}
+
+// XORAddress encodes an (XOR-)MAPPED-ADDRESS value for addr.
+func XORAddress(addr *net.UDPAddr, txID [12]byte, xor bool) []byte {
+	ip := addr.IP.To4()
+	family := familyIPv4
+	if ip == nil {
+		ip = addr.IP.To16()
+		family = familyIPv6
+	}
+	v := make([]byte, 4+len(ip))
+	v[1] = family
+	port := uint16(addr.Port)
+	out := append(net.IP{}, ip...)
+	if xor {
+		port ^= MagicCookie >> 16
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[0:4], MagicCookie)
+		copy(key[4:], txID[:])
+		for i := range out {
+			out[i] ^= key[i]
+		}
+	}
+	binary.BigEndian.PutUint16(v[2:4], port)
+	copy(v[4:], out)
+	return v
+}
+
+// ParseXORAddress decodes an XOR-MAPPED-ADDRESS value.
+func ParseXORAddress(v []byte, txID [12]byte) (*net.UDPAddr, error) {
+	if len(v) != 8 && len(v) != 20 {
+		return nil, errors.New("stun: bad address length")
+	}
+	var key [16]byte
+	binary.BigEndian.PutUint32(key[0:4], MagicCookie)
+	copy(key[4:], txID[:])
+	ip := make(net.IP, len(v)-4)
+	for i := range ip {
+		ip[i] = v[4+i] ^ key[i]
+	}
+	port := binary.BigEndian.Uint16(v[2:4]) ^ MagicCookie>>16
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func errorCode(code int, reason string) []byte {
+	v := make([]byte, 4, 4+len(reason))
+	v[2] = byte(code / 100)
+	v[3] = byte(code % 100)
+	return append(v, reason...)
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,219 @@
+// Package stun — Embedded STUN Binding responder.
+//
+// Answers RFC 5389 Binding requests on a UDP socket so small or on-prem
+// deployments do not depend on public STUN servers.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package stun
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/telemetry"
+)
+
+// Config holds responder limits.
+type Config struct {
+	// RatePerSecond is the sustained Binding rate allowed per source IP.
+	RatePerSecond float64
+	// Burst is the token bucket depth per source IP.
+	Burst int
+	// Software is advertised in the SOFTWARE attribute when non-empty.
+	Software string
+}
+
+// DefaultConfig returns conservative per-IP limits.
+func DefaultConfig() Config {
+	return Config{RatePerSecond: 20, Burst: 40, Software: "carrier-grade-webrtc"}
+}
+
+// Server is a STUN Binding responder bound to one PacketConn.
+type Server struct {
+	conn    net.PacketConn
+	cfg     Config
+	limiter *limiter
+
+	requests    *telemetry.Counter
+	responses   *telemetry.Counter
+	errors      *telemetry.Counter
+	rateLimited *telemetry.Counter
+	malformed   *telemetry.Counter
+}
+
+// NewServer creates a responder on conn, registering its metrics.
+func NewServer(conn net.PacketConn, cfg Config, metrics *telemetry.Registry) *Server {
+	if metrics == nil {
+		metrics = telemetry.NewRegistry()
+	}
+	return &Server{
+		conn:        conn,
+		cfg:         cfg,
+		limiter:     newLimiter(cfg.RatePerSecond, cfg.Burst),
+		requests:    metrics.Counter("stun_binding_requests_total", "STUN Binding requests received", nil),
+		responses:   metrics.Counter("stun_binding_responses_total", "STUN Binding success responses sent", nil),
+		errors:      metrics.Counter("stun_binding_errors_total", "STUN Binding error responses sent", nil),
+		rateLimited: metrics.Counter("stun_rate_limited_total", "STUN requests dropped by per-IP rate limit", nil),
+		malformed:   metrics.Counter("stun_malformed_total", "Datagrams that were not valid STUN messages", nil),
+	}
+}
+
+// ListenAndServe binds addr and serves until ctx is cancelled.
+func ListenAndServe(ctx context.Context, addr string, cfg Config, metrics *telemetry.Registry) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return NewServer(conn, cfg, metrics).Serve(ctx)
+}
+
+// Serve reads datagrams until ctx is cancelled or the socket fails.
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		s.conn.Close()
+	}()
+	go s.limiter.sweep(ctx, time.Minute)
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if resp := s.handle(buf[:n], addr); resp != nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *Server) handle(packet []byte, addr net.Addr) []byte {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	msg, err := Decode(packet)
+	if err != nil {
+		s.malformed.Inc()
+		return nil
+	}
+	if msg.Type == TypeBindingIndication {
+		return nil
+	}
+	if msg.Type != TypeBindingRequest {
+		s.malformed.Inc()
+		return nil
+	}
+	s.requests.Inc()
+	if !s.limiter.allow(udpAddr.IP.String()) {
+		s.rateLimited.Inc()
+		return nil
+	}
+
+	resp := &Message{TransactionID: msg.TransactionID}
+	if unknown := unknownRequired(msg); len(unknown) > 0 {
+		s.errors.Inc()
+		list := make([]byte, 2*len(unknown))
+		for i, t := range unknown {
+			binary.BigEndian.PutUint16(list[2*i:], t)
+		}
+		resp.Type = TypeBindingError
+		resp.Attributes = append(resp.Attributes,
+			Attribute{Type: AttrErrorCode, Value: errorCode(420, "Unknown Attribute")},
+			Attribute{Type: AttrUnknownAttributes, Value: list})
+		return resp.Encode()
+	}
+
+	s.responses.Inc()
+	resp.Type = TypeBindingSuccess
+	resp.Attributes = append(resp.Attributes,
+		Attribute{Type: AttrXORMappedAddress, Value: XORAddress(udpAddr, msg.TransactionID, true)},
+		Attribute{Type: AttrMappedAddress, Value: XORAddress(udpAddr, msg.TransactionID, false)})
+	if s.cfg.Software != "" {
+		resp.Attributes = append(resp.Attributes, Attribute{Type: AttrSoftware, Value: []byte(s.cfg.Software)})
+	}
+	return resp.Encode()
+}
+
+// unknownRequired lists comprehension-required attributes we do not handle.
+func unknownRequired(m *Message) []uint16 {
+	var unknown []uint16
+	for _, a := range m.Attributes {
+		if a.Type >= 0x8000 {
+			continue
+		}
+		switch a.Type {
+		case AttrMappedAddress, AttrXORMappedAddress:
+		default:
+			unknown = append(unknown, a.Type)
+		}
+	}
+	return unknown
+}
+
+// limiter is a per-key token bucket.
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+func (l *limiter) allow(key string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops idle buckets so the map does not grow with every source seen.
+func (l *limiter) sweep(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, b := range l.buckets {
+				if now.Sub(b.last) > every {
+					delete(l.buckets, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package stun — Loopback tests for the Binding responder.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package stun
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/telemetry"
+)
+
+func startServer(t *testing.T, cfg Config) (*net.UDPAddr, *telemetry.Registry) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	metrics := telemetry.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go NewServer(conn, cfg, metrics).Serve(ctx)
+	return conn.LocalAddr().(*net.UDPAddr), metrics
+}
+
+func bindingRequest(t *testing.T, attrs ...Attribute) *Message {
+	t.Helper()
+	m := &Message{Type: TypeBindingRequest, Attributes: attrs}
+	if _, err := rand.Read(m.TransactionID[:]); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func roundTrip(t *testing.T, client *net.UDPConn, server *net.UDPAddr, req *Message) *Message {
+	t.Helper()
+	if _, err := client.WriteToUDP(req.Encode(), server); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := client.ReadFromUDP(buf)
+	if err != nil {
+		return nil
+	}
+	resp, err := Decode(buf[:n])
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.TransactionID != req.TransactionID {
+		t.Fatal("transaction ID mismatch")
+	}
+	return resp
+}
+
+func TestBindingReturnsReflexiveAddress(t *testing.T) {
+	server, metrics := startServer(t, DefaultConfig())
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	defer client.Close()
+
+	req := bindingRequest(t)
+	resp := roundTrip(t, client, server, req)
+	if resp == nil || resp.Type != TypeBindingSuccess {
+		t.Fatalf("expected binding success, got %+v", resp)
+	}
+	value, ok := resp.Get(AttrXORMappedAddress)
+	if !ok {
+		t.Fatal("missing XOR-MAPPED-ADDRESS")
+	}
+	mapped, err := ParseXORAddress(value, req.TransactionID)
+	if err != nil {
+		t.Fatalf("parse address: %v", err)
+	}
+	local := client.LocalAddr().(*net.UDPAddr)
+	if !mapped.IP.Equal(local.IP) || mapped.Port != local.Port {
+		t.Errorf("expected %v, got %v", local, mapped)
+	}
+
+	var out strings.Builder
+	metrics.WriteTo(&out)
+	if !strings.Contains(out.String(), "stun_binding_responses_total 1") {
+		t.Errorf("expected response counter in metrics:\n%s", out.String())
+	}
+}
+
+func TestUnknownRequiredAttributeRejected(t *testing.T) {
+	server, _ := startServer(t, DefaultConfig())
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	defer client.Close()
+
+	resp := roundTrip(t, client, server, bindingRequest(t, Attribute{Type: 0x0006, Value: []byte("user")}))
+	if resp == nil || resp.Type != TypeBindingError {
+		t.Fatalf("expected binding error, got %+v", resp)
+	}
+	if code, ok := resp.Get(AttrErrorCode); !ok || code[2] != 4 || code[3] != 20 {
+		t.Errorf("expected 420 error code, got %v", code)
+	}
+}
+
+func TestRateLimitPerSource(t *testing.T) {
+	server, metrics := startServer(t, Config{RatePerSecond: 0.001, Burst: 2})
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		if roundTrip(t, client, server, bindingRequest(t)) == nil {
+			t.Fatalf("request %d should be answered within burst", i)
+		}
+	}
+	if roundTrip(t, client, server, bindingRequest(t)) != nil {
+		t.Fatal("expected third request to be rate limited")
+	}
+	if got := metrics.Counter("stun_rate_limited_total", "", nil).Value(); got != 1 {
+		t.Errorf("expected 1 rate-limited request, got %d", got)
+	}
+}
+
+func TestDecodeRejectsNonSTUN(t *testing.T) {
+	if _, err := Decode([]byte("GET / HTTP/1.1\r\n\r\nxxxx")); err == nil {
+		t.Error("expected non-STUN datagram to be rejected")
+	}
+	req := bindingRequest(t).Encode()
+	req[len(req)-1] ^= 0xFF
+	if _, err := Decode(req); err == nil {
+		t.Error("expected corrupted fingerprint to be rejected")
+	}
+}
@@ -0,0 +1,219 @@
+// Package telemetry — In-process metric registry with Prometheus text exposition.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing metric.
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() { c.value.Add(1) }
+
+// Add adds n to the counter.
+func (c *Counter) Add(n uint64) { c.value.Add(n) }
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 { return c.value.Load() }
+
+// Gauge is a metric that can go up and down.
+type Gauge struct {
+	value atomic.Int64
+}
+
+// Set replaces the gauge value.
+func (g *Gauge) Set(v int64) { g.value.Store(v) }
+
+// Add adjusts the gauge by delta.
+func (g *Gauge) Add(delta int64) { g.value.Add(delta) }
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() int64 { return g.value.Load() }
+
+// floatCounter is a counter of fractional amounts, fed by Flush.
+type floatCounter struct {
+	bits atomic.Uint64
+}
+
+func (c *floatCounter) add(v float64) {
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (c *floatCounter) value() float64 { return math.Float64frombits(c.bits.Load()) }
+
+// Series kinds.
+const (
+	kindCounter = iota
+	kindGauge
+	kindFloat
+)
+
+type series struct {
+	name    string
+	labels  string
+	counter *Counter
+	gauge   *Gauge
+	float   *floatCounter
+}
+
+// Registry holds named counters and gauges for scraping.
+type Registry struct {
+	mu     sync.RWMutex
+	series map[string]*series
+	help   map[string]string
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		series: make(map[string]*series),
+		help:   make(map[string]string),
+	}
+}
+
+// Counter returns the counter for name and labels, creating it on first use.
+func (r *Registry) Counter(name, help string, labels map[string]string) *Counter {
+	return r.get(name, help, labels, kindCounter).counter
+}
+
+// Gauge returns the gauge for name and labels, creating it on first use.
+func (r *Registry) Gauge(name, help string, labels map[string]string) *Gauge {
+	return r.get(name, help, labels, kindGauge).gauge
+}
+
+func (r *Registry) get(name, help string, labels map[string]string, kind int) *series {
+	key := name + formatLabels(labels)
+	r.mu.RLock()
+	s, ok := r.series[key]
+	r.mu.RUnlock()
+	if ok {
+		return s
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.series[key]; ok {
+		return s
+	}
+	s = &series{name: name, labels: formatLabels(labels)}
+	switch kind {
+	case kindGauge:
+		s.gauge = &Gauge{}
+	case kindFloat:
+		s.float = &floatCounter{}
+	default:
+		s.counter = &Counter{}
+	}
+	r.series[key] = s
+	if _, ok := r.help[name]; !ok || help != "" {
+		r.help[name] = help
+	}
+	return s
+}
+
+// Flush adds metric events to counters, keeping fractional values; pass it
+// as a NonBlockingTelemetry flush function so hot-path events surface on the
+// scrape endpoint.
+func (r *Registry) Flush(events []Event) {
+	for _, e := range events {
+		if e.Type != "metric" || e.Value < 0 {
+			continue
+		}
+		s := r.get(e.Name, "", e.Labels, kindFloat)
+		switch {
+		case s.float != nil:
+			s.float.add(e.Value)
+		case s.counter != nil:
+			s.counter.Add(uint64(math.Round(e.Value)))
+		}
+	}
+}
+
+// WriteTo writes every series in Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	all := make([]*series, 0, len(r.series))
+	for _, s := range r.series {
+		all = append(all, s)
+	}
+	help := make(map[string]string, len(r.help))
+	for k, v := range r.help {
+		help[k] = v
+	}
+	r.mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		return all[i].labels < all[j].labels
+	})
+
+	var b strings.Builder
+	last := ""
+	for _, s := range all {
+		if s.name != last {
+			last = s.name
+			kind := "counter"
+			if s.gauge != nil {
+				kind = "gauge"
+			}
+			if h := help[s.name]; h != "" {
+				fmt.Fprintf(&b, "# HELP %s %s\n", s.name, h)
+			}
+			fmt.Fprintf(&b, "# TYPE %s %s\n", s.name, kind)
+		}
+		switch {
+		case s.gauge != nil:
+			fmt.Fprintf(&b, "%s%s %d\n", s.name, s.labels, s.gauge.Value())
+		case s.float != nil:
+			fmt.Fprintf(&b, "%s%s %s\n", s.name, s.labels, strconv.FormatFloat(s.float.value(), 'g', -1, 64))
+		default:
+			fmt.Fprintf(&b, "%s%s %d\n", s.name, s.labels, s.counter.Value())
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Handler serves the registry on a /metrics endpoint.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.WriteTo(w)
+	})
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		parts = append(parts, k+`="`+v+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,150 @@
+// Package telemetry — Non-blocking telemetry collector for service hot paths.
+//
+// Buffers metric and span events and flushes them asynchronously so that
+// signaling never waits on observability backends.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package telemetry
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event represents a single telemetry event (metric, span).
+type Event struct {
+	Type      string
+	Name      string
+	Value     float64
+	Labels    map[string]string
+	Timestamp time.Time
+}
+
+// Recorder is the write side used by instrumented components.
+type Recorder interface {
+	RecordMetric(name string, value float64, labels map[string]string)
+}
+
+// NonBlockingTelemetry buffers events and flushes asynchronously.
+type NonBlockingTelemetry struct {
+	buffer    chan Event
+	flushFn   func(events []Event)
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	batchSize int
+	interval  time.Duration
+	dropped   atomic.Uint64
+}
+
+// New creates a telemetry collector that never blocks callers.
+func New(bufferSize, batchSize int, flushInterval time.Duration, flushFn func([]Event)) *NonBlockingTelemetry {
+	t := &NonBlockingTelemetry{
+		buffer:    make(chan Event, bufferSize),
+		flushFn:   flushFn,
+		stopCh:    make(chan struct{}),
+		batchSize: batchSize,
+		interval:  flushInterval,
+	}
+	t.wg.Add(1)
+	go t.flushLoop()
+	return t
+}
+
+// LogFlusher writes each event to the standard logger.
+func LogFlusher(events []Event) {
+	for _, e := range events {
+		log.Printf("telemetry: %s %s %.2f %v", e.Type, e.Name, e.Value, e.Labels)
+	}
+}
+
+// Record enqueues an event without blocking. Drops if buffer is full.
+func (t *NonBlockingTelemetry) Record(event Event) {
+	event.Timestamp = time.Now()
+	select {
+	case t.buffer <- event:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// RecordMetric is a convenience for counter/gauge metrics.
+func (t *NonBlockingTelemetry) RecordMetric(name string, value float64, labels map[string]string) {
+	t.Record(Event{Type: "metric", Name: name, Value: value, Labels: labels})
+}
+
+// RecordSpan records a span duration for tracing.
+func (t *NonBlockingTelemetry) RecordSpan(name string, duration time.Duration, labels map[string]string) {
+	t.Record(Event{Type: "span", Name: name, Value: duration.Seconds(), Labels: labels})
+}
+
+// Dropped returns the number of events discarded because the buffer was full.
+func (t *NonBlockingTelemetry) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+// Shutdown stops the collector and flushes remaining events.
+func (t *NonBlockingTelemetry) Shutdown(ctx context.Context) error {
+	close(t.stopCh)
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *NonBlockingTelemetry) flushLoop() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	batch := make([]Event, 0, t.batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		events := make([]Event, len(batch))
+		copy(events, batch)
+		batch = batch[:0]
+		go t.flushFn(events) // Flush in goroutine to avoid blocking loop
+	}
+
+	for {
+		select {
+		case <-t.stopCh:
+			for {
+				select {
+				case e := <-t.buffer:
+					batch = append(batch, e)
+					if len(batch) >= t.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case e := <-t.buffer:
+			batch = append(batch, e)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Nop discards every event; used when telemetry is not configured.
+type Nop struct{}
+
+// RecordMetric implements Recorder.
+func (Nop) RecordMetric(string, float64, map[string]string) {}
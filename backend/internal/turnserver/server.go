@@ -0,0 +1,277 @@
+// Package turnserver — Embedded TURN relay built on pion/turn.
+//
+// Authenticates clients with the auth service's TURN REST credentials,
+// enforces per-user allocation quotas, confines relays to a port range, and
+// accounts relayed bytes per user and tenant.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package turnserver
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/telemetry"
+	"github.com/pion/turn/v4"
+)
+
+// Config holds relay settings.
+type Config struct {
+	Realm string
+	// Secret is the TURN REST shared secret (coturn static-auth-secret).
+	Secret string
+	// RelayIP is the address advertised in XOR-RELAYED-ADDRESS.
+	RelayIP net.IP
+	// RelayBind is the local address relay sockets listen on (default 0.0.0.0).
+	RelayBind    string
+	RelayMinPort uint16
+	RelayMaxPort uint16
+	// MaxAllocationsPerUser rejects further allocations with 486; 0 disables.
+	MaxAllocationsPerUser int
+}
+
+// Usage is the relay accounting for one user.
+type Usage struct {
+	Allocations int
+	BytesIn     uint64
+	BytesOut    uint64
+}
+
+type userState struct {
+	tenant      string
+	allocations int
+	bytesIn     atomic.Uint64
+	bytesOut    atomic.Uint64
+}
+
+// Server wraps a pion TURN server with quotas and accounting.
+type Server struct {
+	cfg    Config
+	issuer *auth.TURNCredentialIssuer
+	turn   *turn.Server
+
+	mu    sync.Mutex
+	users map[string]*userState
+	conns map[string]*meteredConn
+
+	metrics         *telemetry.Registry
+	activeAlloc     *telemetry.Gauge
+	allocTotal      *telemetry.Counter
+	authFailures    *telemetry.Counter
+	quotaRejections *telemetry.Counter
+}
+
+// New starts a TURN server answering on conn.
+func New(conn net.PacketConn, cfg Config, metrics *telemetry.Registry) (*Server, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("turnserver: shared secret required")
+	}
+	if cfg.RelayIP == nil {
+		return nil, errors.New("turnserver: relay IP required")
+	}
+	if cfg.RelayBind == "" {
+		cfg.RelayBind = "0.0.0.0"
+	}
+	if metrics == nil {
+		metrics = telemetry.NewRegistry()
+	}
+	s := &Server{
+		cfg:             cfg,
+		issuer:          auth.NewTURNCredentialIssuer(cfg.Secret, 0),
+		users:           make(map[string]*userState),
+		conns:           make(map[string]*meteredConn),
+		metrics:         metrics,
+		activeAlloc:     metrics.Gauge("turn_allocations_active", "Active TURN allocations", nil),
+		allocTotal:      metrics.Counter("turn_allocations_total", "TURN allocations created", nil),
+		authFailures:    metrics.Counter("turn_auth_failures_total", "TURN requests rejected by authentication", nil),
+		quotaRejections: metrics.Counter("turn_quota_rejections_total", "TURN allocations rejected by per-user quota", nil),
+	}
+	generator := &meteredGenerator{
+		server: s,
+		inner: &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: cfg.RelayIP,
+			Address:      cfg.RelayBind,
+			MinPort:      cfg.RelayMinPort,
+			MaxPort:      cfg.RelayMaxPort,
+		},
+	}
+	srv, err := turn.NewServer(turn.ServerConfig{
+		Realm:        cfg.Realm,
+		AuthHandler:  s.authenticate,
+		QuotaHandler: s.withinQuota,
+		EventHandler: turn.EventHandler{
+			OnAllocationCreated: s.allocationCreated,
+			OnAllocationDeleted: s.allocationDeleted,
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            conn,
+			RelayAddressGenerator: generator,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.turn = srv
+	return s, nil
+}
+
+// Close stops the server and releases every allocation.
+func (s *Server) Close() error {
+	return s.turn.Close()
+}
+
+// Usage returns the accounting for a user ("tenant/subject" or "subject").
+func (s *Server) Usage(user string) Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.users[user]
+	if !ok {
+		return Usage{}
+	}
+	return Usage{Allocations: st.allocations, BytesIn: st.bytesIn.Load(), BytesOut: st.bytesOut.Load()}
+}
+
+// authenticate derives the long-term key for a TURN REST username.
+func (s *Server) authenticate(username, realm string, _ net.Addr) ([]byte, bool) {
+	if _, err := s.issuer.Verify(username); err != nil {
+		s.authFailures.Inc()
+		return nil, false
+	}
+	return turn.GenerateAuthKey(username, realm, s.issuer.Password(username)), true
+}
+
+func (s *Server) withinQuota(username, _ string, _ net.Addr) bool {
+	if s.cfg.MaxAllocationsPerUser <= 0 {
+		return true
+	}
+	user := restUser(username)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.users[user]; ok && st.allocations >= s.cfg.MaxAllocationsPerUser {
+		s.quotaRejections.Inc()
+		return false
+	}
+	return true
+}
+
+func (s *Server) allocationCreated(_, _ net.Addr, _, username, _ string, relayAddr net.Addr, _ int) {
+	user := restUser(username)
+	s.mu.Lock()
+	st, ok := s.users[user]
+	if !ok {
+		st = &userState{tenant: tenantOf(user)}
+		s.users[user] = st
+	}
+	st.allocations++
+	if conn, ok := s.conns[relayAddr.String()]; ok {
+		conn.attach(st)
+	}
+	s.mu.Unlock()
+	s.allocTotal.Inc()
+	s.activeAlloc.Add(1)
+}
+
+func (s *Server) allocationDeleted(_, _ net.Addr, _, username, _ string) {
+	user := restUser(username)
+	s.mu.Lock()
+	if st, ok := s.users[user]; ok {
+		st.allocations--
+		if st.allocations <= 0 {
+			delete(s.users, user)
+		}
+	}
+	s.mu.Unlock()
+	s.activeAlloc.Add(-1)
+}
+
+// restUser strips the "<expiry>:" prefix from a TURN REST username.
+func restUser(username string) string {
+	if _, user, found := strings.Cut(username, ":"); found {
+		return user
+	}
+	return username
+}
+
+func tenantOf(user string) string {
+	if tenant, _, found := strings.Cut(user, "/"); found {
+		return tenant
+	}
+	return "default"
+}
+
+// meteredGenerator wraps a relay address generator so every relay socket
+// reports the bytes it carries.
+type meteredGenerator struct {
+	server *Server
+	inner  turn.RelayAddressGenerator
+}
+
+func (g *meteredGenerator) Validate() error { return g.inner.Validate() }
+
+func (g *meteredGenerator) AllocatePacketConn(network string, requestedPort int) (net.PacketConn, net.Addr, error) {
+	conn, addr, err := g.inner.AllocatePacketConn(network, requestedPort)
+	if err != nil {
+		return nil, nil, err
+	}
+	mc := &meteredConn{PacketConn: conn, server: g.server, key: addr.String()}
+	g.server.mu.Lock()
+	g.server.conns[mc.key] = mc
+	g.server.mu.Unlock()
+	return mc, addr, nil
+}
+
+func (g *meteredGenerator) AllocateConn(network string, requestedPort int) (net.Conn, net.Addr, error) {
+	return g.inner.AllocateConn(network, requestedPort)
+}
+
+type connOwner struct {
+	user     *userState
+	bytesIn  *telemetry.Counter
+	bytesOut *telemetry.Counter
+}
+
+// meteredConn counts relayed bytes; "in" is traffic received from peers.
+type meteredConn struct {
+	net.PacketConn
+	server *Server
+	key    string
+	owner  atomic.Pointer[connOwner]
+}
+
+func (c *meteredConn) attach(st *userState) {
+	labels := map[string]string{"tenant": st.tenant}
+	c.owner.Store(&connOwner{
+		user:     st,
+		bytesIn:  c.server.metrics.Counter("turn_relay_bytes_in_total", "Bytes received on relay sockets from peers", labels),
+		bytesOut: c.server.metrics.Counter("turn_relay_bytes_out_total", "Bytes sent from relay sockets to peers", labels),
+	})
+}
+
+func (c *meteredConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if o := c.owner.Load(); o != nil && n > 0 {
+		o.user.bytesIn.Add(uint64(n))
+		o.bytesIn.Add(uint64(n))
+	}
+	return n, addr, err
+}
+
+func (c *meteredConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if o := c.owner.Load(); o != nil && n > 0 {
+		o.user.bytesOut.Add(uint64(n))
+		o.bytesOut.Add(uint64(n))
+	}
+	return n, err
+}
+
+func (c *meteredConn) Close() error {
+	c.server.mu.Lock()
+	delete(c.server.conns, c.key)
+	c.server.mu.Unlock()
+	return c.PacketConn.Close()
+}
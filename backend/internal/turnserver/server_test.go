@@ -0,0 +1,161 @@
+// Package turnserver — Loopback tests for the TURN relay.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package turnserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/pion/turn/v4"
+)
+
+const testSecret = "turn-test-secret"
+
+func startRelay(t *testing.T, maxAllocations int) (*Server, string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv, err := New(conn, Config{
+		Realm:                 "test.local",
+		Secret:                testSecret,
+		RelayIP:               net.IPv4(127, 0, 0, 1),
+		RelayBind:             "127.0.0.1",
+		RelayMinPort:          40000,
+		RelayMaxPort:          40100,
+		MaxAllocationsPerUser: maxAllocations,
+	}, nil)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv, conn.LocalAddr().String()
+}
+
+func newClient(t *testing.T, server, username, password string) *turn.Client {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("client listen: %v", err)
+	}
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: server,
+		TURNServerAddr: server,
+		Username:       username,
+		Password:       password,
+		Realm:          "test.local",
+		Conn:           conn,
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if err := client.Listen(); err != nil {
+		t.Fatalf("client listen: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+	return client
+}
+
+func TestRelayAccountsBytesPerUser(t *testing.T) {
+	srv, addr := startRelay(t, 0)
+	creds := auth.NewTURNCredentialIssuer(testSecret, time.Hour).Issue("acme/alice", time.Time{})
+	client := newClient(t, addr, creds.Username, creds.Password)
+
+	relayConn, err := client.Allocate()
+	if err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	defer relayConn.Close()
+	relayAddr := relayConn.LocalAddr().(*net.UDPAddr)
+	if relayAddr.Port < 40000 || relayAddr.Port > 40100 {
+		t.Errorf("relay port %d outside configured range", relayAddr.Port)
+	}
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("peer listen: %v", err)
+	}
+	defer peer.Close()
+
+	// Client -> peer through the relay (also installs the permission).
+	if _, err := relayConn.WriteTo([]byte("hello-peer"), peer.LocalAddr()); err != nil {
+		t.Fatalf("relay write: %v", err)
+	}
+	buf := make([]byte, 1500)
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, from, err := peer.ReadFrom(buf)
+	if err != nil || string(buf[:n]) != "hello-peer" {
+		t.Fatalf("peer read: %q %v", buf[:n], err)
+	}
+
+	// Peer -> client through the relay.
+	if _, err := peer.WriteTo([]byte("hello-client"), from); err != nil {
+		t.Fatalf("peer write: %v", err)
+	}
+	relayConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, _, err = relayConn.ReadFrom(buf); err != nil || string(buf[:n]) != "hello-client" {
+		t.Fatalf("relay read: %q %v", buf[:n], err)
+	}
+
+	usage := srv.Usage("acme/alice")
+	if usage.Allocations != 1 || usage.BytesOut != 10 || usage.BytesIn != 12 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if got := srv.metrics.Counter("turn_relay_bytes_in_total", "", map[string]string{"tenant": "acme"}).Value(); got != 12 {
+		t.Errorf("expected tenant byte counter 12, got %d", got)
+	}
+}
+
+func TestRejectsBadCredentials(t *testing.T) {
+	srv, addr := startRelay(t, 0)
+	creds := auth.NewTURNCredentialIssuer("other-secret", time.Hour).Issue("mallory", time.Time{})
+	client := newClient(t, addr, creds.Username, creds.Password)
+	if _, err := client.Allocate(); err == nil {
+		t.Fatal("expected allocation with wrong secret to fail")
+	}
+	expired := "1000:mallory"
+	client = newClient(t, addr, expired, auth.NewTURNCredentialIssuer(testSecret, 0).Password(expired))
+	if _, err := client.Allocate(); err == nil {
+		t.Fatal("expected allocation with expired credentials to fail")
+	}
+	if srv.authFailures.Value() == 0 {
+		t.Error("expected auth failures to be counted")
+	}
+}
+
+func TestPerUserAllocationQuota(t *testing.T) {
+	srv, addr := startRelay(t, 1)
+	issuer := auth.NewTURNCredentialIssuer(testSecret, time.Hour)
+	creds := issuer.Issue("bob", time.Time{})
+
+	first := newClient(t, addr, creds.Username, creds.Password)
+	relayConn, err := first.Allocate()
+	if err != nil {
+		t.Fatalf("first allocate: %v", err)
+	}
+	defer relayConn.Close()
+
+	second := newClient(t, addr, creds.Username, creds.Password)
+	if _, err := second.Allocate(); err == nil {
+		t.Fatal("expected second allocation to exceed quota")
+	}
+	if srv.quotaRejections.Value() != 1 {
+		t.Errorf("expected 1 quota rejection, got %d", srv.quotaRejections.Value())
+	}
+
+	other := issuer.Issue("carol", time.Time{})
+	third := newClient(t, addr, other.Username, other.Password)
+	conn, err := third.Allocate()
+	if err != nil {
+		t.Fatalf("other user should not be affected by bob's quota: %v", err)
+	}
+	conn.Close()
+}
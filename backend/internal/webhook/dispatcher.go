@@ -0,0 +1,306 @@
+// Package webhook — Asynchronous dispatcher with retries and dead-lettering.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Publisher is the write side used by the hub.
+type Publisher interface {
+	Publish(event Event)
+}
+
+// Nop discards events; used when no webhooks are configured.
+type Nop struct{}
+
+// Publish implements Publisher.
+func (Nop) Publish(Event) {}
+
+// DeadLetter is a delivery that exhausted its retries.
+type DeadLetter struct {
+	Event     Event     `json:"event"`
+	URL       string    `json:"url"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError"`
+	FailedAt  time.Time `json:"failedAt"`
+}
+
+// DeadLetterQueue stores failed deliveries for inspection or replay.
+type DeadLetterQueue interface {
+	Put(dl DeadLetter)
+}
+
+// MemoryDLQ keeps the most recent dead letters up to a fixed capacity.
+type MemoryDLQ struct {
+	mu       sync.Mutex
+	items    []DeadLetter
+	capacity int
+}
+
+// NewMemoryDLQ creates an in-memory queue holding at most capacity entries.
+func NewMemoryDLQ(capacity int) *MemoryDLQ {
+	return &MemoryDLQ{capacity: capacity}
+}
+
+// Put implements DeadLetterQueue, evicting the oldest entry when full.
+func (q *MemoryDLQ) Put(dl DeadLetter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) >= q.capacity && q.capacity > 0 {
+		q.items = q.items[1:]
+	}
+	q.items = append(q.items, dl)
+}
+
+// Items returns a copy of the queued dead letters, oldest first.
+func (q *MemoryDLQ) Items() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadLetter(nil), q.items...)
+}
+
+// FileDLQ appends dead letters to a JSON-lines file.
+type FileDLQ struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileDLQ opens (or appends to) path.
+func NewFileDLQ(path string) (*FileDLQ, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDLQ{file: f}, nil
+}
+
+// Put implements DeadLetterQueue.
+func (q *FileDLQ) Put(dl DeadLetter) {
+	line, err := json.Marshal(dl)
+	if err != nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		log.Printf("webhook: dead-letter write: %v", err)
+	}
+}
+
+// Close releases the file.
+func (q *FileDLQ) Close() error {
+	return q.file.Close()
+}
+
+// Dispatcher queues events and delivers them on background workers. Each
+// subscription has its own queue and workers, so a receiver that is down
+// and being retried only delays its own deliveries.
+type Dispatcher struct {
+	cfg    Config
+	client *http.Client
+	dlq    DeadLetterQueue
+	queues []*queue
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	dropped      atomic.Uint64
+	delivered    atomic.Uint64
+	deadLettered atomic.Uint64
+}
+
+// queue holds one subscription's pending events.
+type queue struct {
+	sub    Subscription
+	events chan Event
+}
+
+// NewDispatcher starts cfg.Workers delivery workers per subscription. A nil
+// dlq keeps the last 1000 dead letters in memory.
+func NewDispatcher(cfg Config, dlq DeadLetterQueue) *Dispatcher {
+	cfg = cfg.withDefaults()
+	if dlq == nil {
+		dlq = NewMemoryDLQ(1000)
+	}
+	d := &Dispatcher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond},
+		dlq:    dlq,
+		stopCh: make(chan struct{}),
+	}
+	for _, sub := range cfg.Subscriptions {
+		q := &queue{sub: sub, events: make(chan Event, cfg.BufferSize)}
+		d.queues = append(d.queues, q)
+		for i := 0; i < cfg.Workers; i++ {
+			d.wg.Add(1)
+			go d.worker(q)
+		}
+	}
+	return d
+}
+
+// Publish enqueues an event for every matching subscription without
+// blocking. Events nobody subscribes to are discarded; a delivery whose
+// subscription queue is full is dropped.
+func (d *Dispatcher) Publish(event Event) {
+	stamped := false
+	for _, q := range d.queues {
+		if !q.sub.Matches(event) {
+			continue
+		}
+		if !stamped {
+			if event.ID == "" {
+				event.ID = newEventID()
+			}
+			if event.Timestamp.IsZero() {
+				event.Timestamp = time.Now().UTC()
+			}
+			stamped = true
+		}
+		select {
+		case q.events <- event:
+		default:
+			d.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns the number of deliveries discarded because their
+// subscription's queue was full.
+func (d *Dispatcher) Dropped() uint64 { return d.dropped.Load() }
+
+// Delivered returns the number of successful deliveries.
+func (d *Dispatcher) Delivered() uint64 { return d.delivered.Load() }
+
+// DeadLettered returns the number of deliveries sent to the dead-letter queue.
+func (d *Dispatcher) DeadLettered() uint64 { return d.deadLettered.Load() }
+
+// Shutdown stops retry backoff, delivers what is queued with a single
+// attempt each, and waits for workers to finish.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	close(d.stopCh)
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) worker(q *queue) {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.stopCh:
+			for {
+				select {
+				case e := <-q.events:
+					d.dispatch(q.sub, e)
+				default:
+					return
+				}
+			}
+		case e := <-q.events:
+			d.dispatch(q.sub, e)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(sub Subscription, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	d.deliver(sub, event, body)
+}
+
+// deliver retries with exponential backoff until success, a permanent
+// failure, MaxAttempts, or shutdown.
+func (d *Dispatcher) deliver(sub Subscription, event Event, body []byte) {
+	backoff := time.Duration(d.cfg.InitialBackoffMs) * time.Millisecond
+	maxBackoff := time.Duration(d.cfg.MaxBackoffMs) * time.Millisecond
+	var lastErr error
+	attempt := 0
+	for attempt < d.cfg.MaxAttempts {
+		attempt++
+		retry, err := d.post(sub, event, body)
+		if err == nil {
+			d.delivered.Add(1)
+			return
+		}
+		lastErr = err
+		if !retry || attempt == d.cfg.MaxAttempts {
+			break
+		}
+		// Half fixed, half random so failed receivers aren't hit in lockstep.
+		wait := backoff/2 + time.Duration(mathrand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-time.After(wait):
+		case <-d.stopCh:
+			lastErr = fmt.Errorf("%w (shutting down)", err)
+			attempt = d.cfg.MaxAttempts
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	d.deadLettered.Add(1)
+	d.dlq.Put(DeadLetter{Event: event, URL: sub.URL, Attempts: attempt, LastError: lastErr.Error(), FailedAt: time.Now().UTC()})
+}
+
+// post performs one delivery and reports whether a failure is retryable.
+func (d *Dispatcher) post(sub Subscription, event Event, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, event.ID)
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	if sub.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook: %s returned %s", sub.URL, resp.Status)
+	default:
+		return false, fmt.Errorf("webhook: %s returned %s", sub.URL, resp.Status)
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,162 @@
+// Package webhook — Outbound webhooks for room and peer lifecycle events.
+//
+// Events are queued without blocking the hub, delivered to every matching
+// subscription with an HMAC-SHA256 signature, retried with exponential
+// backoff, and dead-lettered once retries are exhausted.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types.
+const (
+	EventRoomCreated = "room.created"
+	EventPeerJoined  = "peer.joined"
+	EventPeerLeft    = "peer.left"
+	EventRoomEmptied = "room.emptied"
+)
+
+// Request headers set on every delivery.
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event is the JSON body of a webhook delivery.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Tenant    string    `json:"tenant,omitempty"`
+	RoomID    string    `json:"roomId,omitempty"`
+	PeerID    string    `json:"peerId,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// Subscription delivers the listed event types (all when empty) of Tenant
+// (every tenant when empty) to URL.
+type Subscription struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events,omitempty"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// Matches reports whether the subscription receives event.
+func (s Subscription) Matches(event Event) bool {
+	return (s.Tenant == "" || s.Tenant == event.Tenant) && s.Wants(event.Type)
+}
+
+// Wants reports whether the subscription receives eventType.
+func (s Subscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is the webhook configuration file.
+type Config struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	// MaxAttempts includes the first delivery (default 5).
+	MaxAttempts      int `json:"maxAttempts,omitempty"`
+	InitialBackoffMs int `json:"initialBackoffMs,omitempty"`
+	MaxBackoffMs     int `json:"maxBackoffMs,omitempty"`
+	TimeoutMs        int `json:"timeoutMs,omitempty"`
+	// BufferSize bounds each subscription's queued events; further events
+	// are dropped (default 4096).
+	BufferSize int `json:"bufferSize,omitempty"`
+	// Workers is the number of concurrent deliveries per subscription
+	// (default 4).
+	Workers int `json:"workers,omitempty"`
+	// DeadLetterFile appends exhausted deliveries as JSON lines; when unset
+	// they are kept in a bounded in-memory queue.
+	DeadLetterFile string `json:"deadLetterFile,omitempty"`
+}
+
+// LoadConfig reads a JSON webhook configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("webhook config %s: %w", path, err)
+	}
+	for i, s := range cfg.Subscriptions {
+		if s.URL == "" {
+			return nil, fmt.Errorf("webhook config %s: subscription %d has no url", path, i)
+		}
+	}
+	return &cfg, nil
+}
+
+func (c *Config) withDefaults() Config {
+	out := *c
+	if out.MaxAttempts <= 0 {
+		out.MaxAttempts = 5
+	}
+	if out.InitialBackoffMs <= 0 {
+		out.InitialBackoffMs = 500
+	}
+	if out.MaxBackoffMs <= 0 {
+		out.MaxBackoffMs = 30000
+	}
+	if out.TimeoutMs <= 0 {
+		out.TimeoutMs = 5000
+	}
+	if out.BufferSize <= 0 {
+		out.BufferSize = 4096
+	}
+	if out.Workers <= 0 {
+		out.Workers = 4
+	}
+	return out
+}
+
+// Sign returns the X-Webhook-Signature value for a body sent at timestamp
+// (unix seconds): "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a received signature and rejects timestamps older than
+// tolerance (0 skips the age check). Receivers should use this to
+// authenticate deliveries.
+func Verify(secret, timestamp string, body []byte, signature string, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if tolerance > 0 && time.Since(time.Unix(ts, 0)) > tolerance {
+		return false
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
@@ -0,0 +1,234 @@
+// Package webhook — Tests for signing, retries and dead-lettering.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"type":"peer.joined"}`)
+	now := time.Now().Unix()
+	stamp := strconv.FormatInt(now, 10)
+	sig := Sign("s3cret", now, body)
+	if !Verify("s3cret", stamp, body, sig, time.Minute) {
+		t.Fatal("expected signature to verify")
+	}
+	if Verify("other", stamp, body, sig, time.Minute) {
+		t.Error("wrong secret must not verify")
+	}
+	if Verify("s3cret", stamp, []byte(`{}`), sig, time.Minute) {
+		t.Error("tampered body must not verify")
+	}
+	old := now - 3600
+	if Verify("s3cret", strconv.FormatInt(old, 10), body, Sign("s3cret", old, body), time.Minute) {
+		t.Error("stale timestamp must not verify")
+	}
+}
+
+// receiver records deliveries and answers with the next queued status.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	got      []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.got = append(r.got, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	r.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.got)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func fastConfig(subs ...Subscription) Config {
+	return Config{Subscriptions: subs, MaxAttempts: 3, InitialBackoffMs: 1, MaxBackoffMs: 5, Workers: 1}
+}
+
+func TestDeliveryIsSignedAndRetried(t *testing.T) {
+	rcv := &receiver{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	d := NewDispatcher(fastConfig(Subscription{URL: srv.URL, Secret: "k"}), nil)
+	d.Publish(Event{Type: EventPeerJoined, RoomID: "r1", PeerID: "p1"})
+	waitFor(t, func() bool { return d.Delivered()+d.DeadLettered() == 1 })
+	d.Shutdown(context.Background())
+
+	if rcv.count() != 3 || d.Delivered() != 1 || d.DeadLettered() != 0 {
+		t.Fatalf("attempts=%d delivered=%d dead=%d", rcv.count(), d.Delivered(), d.DeadLettered())
+	}
+	last := rcv.got[2]
+	if last.Header.Get(HeaderEvent) != EventPeerJoined || last.Header.Get(HeaderID) == "" {
+		t.Errorf("missing event headers: %v", last.Header)
+	}
+	if !Verify("k", last.Header.Get(HeaderTimestamp), rcv.bodies[2], last.Header.Get(HeaderSignature), time.Minute) {
+		t.Error("delivery signature does not verify")
+	}
+}
+
+func TestExhaustedAndPermanentFailuresAreDeadLettered(t *testing.T) {
+	down := &receiver{statuses: []int{500, 500, 500}}
+	downSrv := httptest.NewServer(down)
+	defer downSrv.Close()
+	gone := &receiver{statuses: []int{http.StatusGone}}
+	goneSrv := httptest.NewServer(gone)
+	defer goneSrv.Close()
+
+	dlq := NewMemoryDLQ(10)
+	d := NewDispatcher(fastConfig(Subscription{URL: downSrv.URL}, Subscription{URL: goneSrv.URL}), dlq)
+	d.Publish(Event{Type: EventRoomEmptied, RoomID: "r1"})
+	waitFor(t, func() bool { return d.DeadLettered() == 2 })
+	d.Shutdown(context.Background())
+
+	if down.count() != 3 {
+		t.Errorf("expected 3 attempts against failing receiver, got %d", down.count())
+	}
+	if gone.count() != 1 {
+		t.Errorf("410 must not be retried, got %d attempts", gone.count())
+	}
+	items := dlq.Items()
+	if len(items) != 2 {
+		t.Fatalf("expected 2 dead letters, got %+v", items)
+	}
+	// Subscriptions are delivered independently, so either may finish first.
+	if items[0].URL != downSrv.URL {
+		items[0], items[1] = items[1], items[0]
+	}
+	if items[0].URL != downSrv.URL || items[0].Attempts != 3 || items[0].Event.RoomID != "r1" {
+		t.Errorf("unexpected dead letter %+v", items[0])
+	}
+}
+
+func TestSubscriptionsFilterByEventType(t *testing.T) {
+	rooms := &receiver{}
+	roomSrv := httptest.NewServer(rooms)
+	defer roomSrv.Close()
+	all := &receiver{}
+	allSrv := httptest.NewServer(all)
+	defer allSrv.Close()
+
+	d := NewDispatcher(fastConfig(
+		Subscription{URL: roomSrv.URL, Events: []string{EventRoomCreated, EventRoomEmptied}},
+		Subscription{URL: allSrv.URL},
+	), nil)
+	for _, typ := range []string{EventRoomCreated, EventPeerJoined, EventPeerLeft, EventRoomEmptied} {
+		d.Publish(Event{Type: typ})
+	}
+	waitFor(t, func() bool { return d.Delivered() == 6 })
+	d.Shutdown(context.Background())
+
+	if rooms.count() != 2 || all.count() != 4 {
+		t.Errorf("rooms=%d all=%d", rooms.count(), all.count())
+	}
+}
+
+func TestSubscriptionsFilterByTenant(t *testing.T) {
+	acme := &receiver{}
+	acmeSrv := httptest.NewServer(acme)
+	defer acmeSrv.Close()
+	all := &receiver{}
+	allSrv := httptest.NewServer(all)
+	defer allSrv.Close()
+
+	d := NewDispatcher(fastConfig(
+		Subscription{URL: acmeSrv.URL, Tenant: "acme"},
+		Subscription{URL: allSrv.URL},
+	), nil)
+	for _, tenant := range []string{"acme", "globex", "default"} {
+		d.Publish(Event{Type: EventPeerJoined, Tenant: tenant})
+	}
+	waitFor(t, func() bool { return d.Delivered() == 4 })
+	d.Shutdown(context.Background())
+
+	if acme.count() != 1 || all.count() != 3 {
+		t.Fatalf("acme=%d all=%d", acme.count(), all.count())
+	}
+	if !strings.Contains(string(acme.bodies[0]), `"tenant":"acme"`) {
+		t.Errorf("acme received %s", acme.bodies[0])
+	}
+}
+
+func TestFailingReceiverDoesNotDelayOthers(t *testing.T) {
+	down := &receiver{statuses: []int{500, 500, 500, 500, 500, 500}}
+	downSrv := httptest.NewServer(down)
+	defer downSrv.Close()
+	up := &receiver{}
+	upSrv := httptest.NewServer(up)
+	defer upSrv.Close()
+
+	cfg := fastConfig(Subscription{URL: downSrv.URL}, Subscription{URL: upSrv.URL})
+	cfg.InitialBackoffMs, cfg.MaxBackoffMs = 10000, 10000
+	d := NewDispatcher(cfg, nil)
+	for i := 0; i < 3; i++ {
+		d.Publish(Event{Type: EventPeerJoined})
+	}
+	// The failing receiver's single worker is backing off for 10s.
+	waitFor(t, func() bool { return up.count() == 3 })
+	if down.count() != 1 {
+		t.Errorf("expected one attempt against the failing receiver, got %d", down.count())
+	}
+	d.Shutdown(context.Background())
+}
+
+func TestPublishNeverBlocks(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	cfg := fastConfig(Subscription{URL: srv.URL})
+	cfg.BufferSize = 4
+	d := NewDispatcher(cfg, nil)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			d.Publish(Event{Type: EventPeerJoined})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a stalled receiver")
+	}
+	if d.Dropped() == 0 {
+		t.Error("expected events to be dropped while the receiver is stalled")
+	}
+	close(release)
+	d.Shutdown(context.Background())
+}
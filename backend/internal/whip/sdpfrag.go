@@ -0,0 +1,137 @@
+// Package whip — Trickle ICE SDP fragments (RFC 8840).
+//
+// PATCH bodies carry the client's ICE credentials and candidates per media
+// section; a changed ufrag asks for an ICE restart, answered with the
+// server's new credentials and candidates in the same format.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package whip
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ContentTypeSDPFrag is the media type of trickle and restart bodies.
+const ContentTypeSDPFrag = "application/trickle-ice-sdpfrag"
+
+// fragment is a parsed SDP fragment.
+type fragment struct {
+	ufrag, pwd string
+	candidates []fragmentCandidate
+}
+
+type fragmentCandidate struct {
+	mid        string
+	mLineIndex uint16
+	value      string // "candidate:..." without the a= prefix
+}
+
+// json encodes the candidate as a webrtc.ICECandidateInit.
+func (c fragmentCandidate) json() json.RawMessage {
+	init := struct {
+		Candidate     string  `json:"candidate"`
+		SDPMid        *string `json:"sdpMid,omitempty"`
+		SDPMLineIndex uint16  `json:"sdpMLineIndex"`
+	}{Candidate: c.value, SDPMLineIndex: c.mLineIndex}
+	if c.mid != "" {
+		init.SDPMid = &c.mid
+	}
+	data, _ := json.Marshal(init)
+	return data
+}
+
+// parseFragment reads credentials and candidates from body. Credentials may
+// appear at session level or in any media section; the first wins.
+func parseFragment(body string) fragment {
+	var f fragment
+	mLine, mid := -1, ""
+	for _, line := range sdpLines(body) {
+		switch {
+		case strings.HasPrefix(line, "m="):
+			mLine++
+			mid = ""
+		case strings.HasPrefix(line, "a=mid:"):
+			mid = strings.TrimPrefix(line, "a=mid:")
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			if f.ufrag == "" {
+				f.ufrag = strings.TrimPrefix(line, "a=ice-ufrag:")
+			}
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			if f.pwd == "" {
+				f.pwd = strings.TrimPrefix(line, "a=ice-pwd:")
+			}
+		case strings.HasPrefix(line, "a=candidate:"):
+			c := fragmentCandidate{mid: mid, value: strings.TrimPrefix(line, "a=")}
+			if mLine >= 0 {
+				c.mLineIndex = uint16(mLine)
+			}
+			f.candidates = append(f.candidates, c)
+		}
+	}
+	return f
+}
+
+// iceUfrag returns the first ice-ufrag in a session description.
+func iceUfrag(sdp string) string {
+	return parseFragment(sdp).ufrag
+}
+
+// restartOffer rewrites offer with the new ICE credentials and without its
+// old candidates, so reapplying it restarts ICE.
+func restartOffer(offer, ufrag, pwd string) string {
+	var b strings.Builder
+	for _, line := range sdpLines(offer) {
+		switch {
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			line = "a=ice-ufrag:" + ufrag
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			line = "a=ice-pwd:" + pwd
+		case strings.HasPrefix(line, "a=candidate:"), line == "a=end-of-candidates":
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// answerFragment extracts the ICE credentials and candidates of each media
+// section of answer, for an ICE restart response.
+func answerFragment(answer string) string {
+	var b strings.Builder
+	inMedia := false
+	endMedia := func() {
+		if inMedia {
+			b.WriteString("a=end-of-candidates\r\n")
+		}
+	}
+	for _, line := range sdpLines(answer) {
+		switch {
+		case strings.HasPrefix(line, "a=group:"), strings.HasPrefix(line, "a=ice-options:"), line == "a=ice-lite":
+			if !inMedia {
+				b.WriteString(line + "\r\n")
+			}
+		case strings.HasPrefix(line, "m="):
+			endMedia()
+			inMedia = true
+			b.WriteString(line + "\r\n")
+		case !inMedia:
+		case strings.HasPrefix(line, "a=mid:"), strings.HasPrefix(line, "a=ice-ufrag:"),
+			strings.HasPrefix(line, "a=ice-pwd:"), strings.HasPrefix(line, "a=candidate:"):
+			b.WriteString(line + "\r\n")
+		}
+	}
+	endMedia()
+	return b.String()
+}
+
+func sdpLines(body string) []string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
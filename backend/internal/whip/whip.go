@@ -0,0 +1,367 @@
+// Package whip — WHIP ingest and WHEP playback over HTTP.
+//
+// POST /whip/{room} publishes the offered media into the room through the
+// SFU and POST /whep/{room} plays a room publisher back; each returns the
+// answer and a session resource that takes PATCH for trickle ICE and ICE
+// restart and DELETE for teardown. Requests carry the signaling service's
+// JWTs as bearer tokens. WHIP publishers are ordinary room members, so
+// WebSocket clients see them join and publish; the room is switched to SFU
+// mode when one joins. WHEP players join rooms hidden, like recorders.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package whip
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/sfu"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/contracts"
+)
+
+// Session kinds, which are also the path prefixes they are served under.
+const (
+	KindWHIP = "whip"
+	KindWHEP = "whep"
+)
+
+// ContentTypeSDP is the media type of offers and answers.
+const ContentTypeSDP = "application/sdp"
+
+// maxBodyBytes bounds offers and fragments.
+const maxBodyBytes = 64 << 10
+
+// Errors reported in response bodies.
+var (
+	ErrNoPublisher = errors.New("no publisher in room")
+	ErrForbidden   = errors.New("session belongs to another client")
+)
+
+// Handler serves WHIP and WHEP. Mount it at /whip/ and /whep/.
+type Handler struct {
+	hub       *hub.SignalHub
+	validator contracts.TokenValidator
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// New creates a handler that joins rooms through h and authorizes requests
+// with validator.
+func New(h *hub.SignalHub, validator contracts.TokenValidator) *Handler {
+	return &Handler{hub: h, validator: validator, sessions: make(map[string]*session)}
+}
+
+// session is one WHIP publisher or WHEP player.
+type session struct {
+	id, kind, roomID string
+	tenant, subject  string
+	peer             *hub.Peer
+	// publisherID is the peer a WHEP player watches.
+	publisherID, layer string
+
+	// mu serialises renegotiation; offer is the last applied remote offer
+	// and etag identifies the current ICE session.
+	mu    sync.Mutex
+	offer string
+	etag  string
+}
+
+// role is the SFU connection the session's candidates belong to.
+func (s *session) role() string {
+	if s.kind == KindWHIP {
+		return sfu.RolePublish
+	}
+	return sfu.RoleSubscribe
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "Location, ETag, Accept-Patch")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || (parts[0] != KindWHIP && parts[0] != KindWHEP) || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	kind, roomID := parts[0], parts[1]
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
+		if len(parts) == 2 {
+			w.Header().Set("Accept-Post", ContentTypeSDP)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	claims, err := h.authorize(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST, OPTIONS")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.create(w, r, kind, roomID, claims)
+		return
+	}
+	s, err := h.lookup(kind, roomID, parts[2], claims)
+	if err != nil {
+		status := http.StatusNotFound
+		if err == ErrForbidden {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	switch r.Method {
+	case http.MethodPatch:
+		h.patch(w, r, s)
+	case http.MethodDelete:
+		h.remove(s)
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("Allow", "PATCH, DELETE, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authorize validates the request's bearer token.
+func (h *Handler) authorize(r *http.Request) (*contracts.Claims, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, errors.New("bearer token required")
+	}
+	claims, err := h.validator.Validate(r.Context(), token)
+	if err != nil {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// create handles POST: it registers the session's peer, joins the room and
+// answers the offer.
+func (h *Handler) create(w http.ResponseWriter, r *http.Request, kind, roomID string, claims *contracts.Claims) {
+	offer, ok := readBody(w, r, ContentTypeSDP)
+	if !ok {
+		return
+	}
+	s := &session{id: newID(), kind: kind, roomID: roomID, tenant: claims.Tenant, subject: claims.Subject}
+	peerID := claims.Subject + "-" + kind + "-" + s.id[:8]
+	var err error
+	if kind == KindWHIP {
+		s.peer, err = h.hub.RegisterLocal(peerID, claims)
+	} else {
+		s.peer, err = h.hub.RegisterHidden(peerID, claims)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+	answer, err := h.start(s, r.URL.Query(), offer)
+	if err != nil {
+		h.hub.Unregister(s.peer)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+	s.offer, s.etag = offer, etag(answer)
+
+	h.mu.Lock()
+	h.sessions[s.id] = s
+	h.mu.Unlock()
+	go h.watch(s)
+	log.Printf("%s session %s started for %s in room %s", strings.ToUpper(kind), s.id, claims.Subject, roomID)
+
+	w.Header().Set("Content-Type", ContentTypeSDP)
+	w.Header().Set("Location", "/"+kind+"/"+url.PathEscape(roomID)+"/"+s.id)
+	w.Header().Set("ETag", s.etag)
+	w.Header().Set("Accept-Patch", ContentTypeSDPFrag)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, answer)
+}
+
+// start joins the room and publishes, or picks the publisher to play (the
+// peer query parameter, else the first) and views it at the layer
+// parameter.
+func (h *Handler) start(s *session, query url.Values, offer string) (string, error) {
+	if err := h.hub.JoinSFU(s.peer, s.roomID); err != nil {
+		return "", err
+	}
+	if s.kind == KindWHIP {
+		return h.hub.Publish(s.peer, offer)
+	}
+	publishers, err := h.hub.Publishers(s.peer)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(publishers)
+	s.publisherID, s.layer = query.Get("peer"), query.Get("layer")
+	if s.publisherID == "" {
+		if len(publishers) == 0 {
+			return "", ErrNoPublisher
+		}
+		s.publisherID = publishers[0]
+	}
+	return h.hub.View(s.peer, s.publisherID, s.layer, offer)
+}
+
+// patch handles PATCH: candidates are trickled to the session's connection,
+// and new ICE credentials restart ICE, answered with the server's own.
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request, s *session) {
+	body, ok := readBody(w, r, ContentTypeSDPFrag)
+	if !ok {
+		return
+	}
+	frag := parseFragment(body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if match := r.Header.Get("If-Match"); match != "" && match != "*" && match != s.etag {
+		http.Error(w, "etag mismatch", http.StatusPreconditionFailed)
+		return
+	}
+	restart := frag.ufrag != "" && frag.ufrag != iceUfrag(s.offer)
+	var answer string
+	if restart {
+		if frag.pwd == "" {
+			http.Error(w, "ice restart requires ice-pwd", http.StatusBadRequest)
+			return
+		}
+		offer := restartOffer(s.offer, frag.ufrag, frag.pwd)
+		var err error
+		if s.kind == KindWHIP {
+			answer, err = h.hub.Publish(s.peer, offer)
+		} else {
+			answer, err = h.hub.View(s.peer, s.publisherID, s.layer, offer)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+		s.offer, s.etag = offer, etag(answer)
+	}
+	for _, c := range frag.candidates {
+		if err := h.hub.AddCandidate(s.peer, s.role(), c.json()); err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			return
+		}
+	}
+	if !restart {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeSDPFrag)
+	w.Header().Set("ETag", s.etag)
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, answerFragment(answer))
+}
+
+// lookup returns the session if claims belong to the client that created it.
+func (h *Handler) lookup(kind, roomID, id string, claims *contracts.Claims) (*session, error) {
+	h.mu.Lock()
+	s := h.sessions[id]
+	h.mu.Unlock()
+	if s == nil || s.kind != kind || s.roomID != roomID {
+		return nil, errors.New("no such session")
+	}
+	if s.tenant != claims.Tenant || s.subject != claims.Subject {
+		return nil, ErrForbidden
+	}
+	return s, nil
+}
+
+// remove ends a session; its peer leaves the room, releasing its SFU
+// connections.
+func (h *Handler) remove(s *session) {
+	h.mu.Lock()
+	if h.sessions[s.id] != s {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.sessions, s.id)
+	h.mu.Unlock()
+	h.hub.Unregister(s.peer)
+	log.Printf("%s session %s ended", strings.ToUpper(s.kind), s.id)
+}
+
+// watch drains the session peer's room events. A WHEP session ends when its
+// publisher stops, and any session ends if the hub drops its peer.
+func (h *Handler) watch(s *session) {
+	for data := range s.peer.Send {
+		if s.kind != KindWHEP {
+			continue
+		}
+		var msg hub.SignalMessage
+		if json.Unmarshal(data, &msg) == nil && msg.Type == "unpublished" && msg.PeerID == s.publisherID {
+			go h.remove(s)
+		}
+	}
+	h.remove(s)
+}
+
+// Close ends every session.
+func (h *Handler) Close() {
+	h.mu.Lock()
+	sessions := make([]*session, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	h.mu.Unlock()
+	for _, s := range sessions {
+		h.remove(s)
+	}
+}
+
+// readBody reads a request body of content type want, replying with an
+// error if it has another type or is empty.
+func readBody(w http.ResponseWriter, r *http.Request, want string) (string, bool) {
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != want {
+		http.Error(w, "content type must be "+want, http.StatusUnsupportedMediaType)
+		return "", false
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil || len(data) == 0 {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return "", false
+	}
+	return string(data), true
+}
+
+// statusFor maps hub and SFU errors to HTTP statuses; anything else is
+// taken to be a bad offer.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, hub.ErrPeerQuota), errors.Is(err, hub.ErrRoomQuota), errors.Is(err, hub.ErrRateLimit):
+		return http.StatusTooManyRequests
+	case errors.Is(err, hub.ErrNoSuchRoom), errors.Is(err, ErrNoPublisher), errors.Is(err, sfu.ErrNotPublishing):
+		return http.StatusNotFound
+	case errors.Is(err, hub.ErrNotSFURoom), errors.Is(err, hub.ErrNotInRoom):
+		return http.StatusConflict
+	case errors.Is(err, hub.ErrSFUDisabled):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+func etag(answer string) string {
+	return `"` + iceUfrag(answer) + `"`
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
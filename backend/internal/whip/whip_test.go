@@ -0,0 +1,293 @@
+// Package whip — End-to-end WHIP ingest and WHEP playback over loopback.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package whip
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/sfu"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/client"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/pion/ice/v4"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const testSecret = "whip-test-secret"
+
+func token(user string) string {
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user, "session_id": "1", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testSecret))
+	return signed
+}
+
+// newServer serves /ws/signal like cmd/signaling plus WHIP and WHEP, with
+// every room in SFU mode only once a WHIP publisher joins.
+func newServer(t *testing.T) string {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	var h *hub.SignalHub
+	media, err := sfu.New(sfu.Config{Loopback: true}, func(tenant, peerID string, msg sfu.Message) {
+		h.Deliver(tenant, peerID, hub.SignalMessage{Type: msg.Type, RoomID: msg.RoomID, SDP: msg.SDP})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(media.Close)
+	h = hub.NewSignalHub(nil, hub.WithSFU(media, 100))
+	validator := auth.NewJWTValidator(testSecret)
+	handler := New(h, validator)
+	t.Cleanup(handler.Close)
+
+	mux := http.NewServeMux()
+	mux.Handle("/whip/", handler)
+	mux.Handle("/whep/", handler)
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws/signal", func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.Validate(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			var msg hub.SignalMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			h.HandleMessage(peer, msg)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func newPeerConnection(t *testing.T) *webrtc.PeerConnection {
+	t.Helper()
+	se := webrtc.SettingEngine{}
+	se.SetIncludeLoopbackCandidate(true)
+	se.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+	se.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+// do sends an HTTP request as user and returns the response and its body.
+func do(t *testing.T, method, url, user, contentType, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if user != "" {
+		req.Header.Set("Authorization", "Bearer "+token(user))
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+// negotiate posts pc's gathered offer to url and applies the answer,
+// returning the session resource URL.
+func negotiate(t *testing.T, pc *webrtc.PeerConnection, url, user string) (string, string) {
+	t.Helper()
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	resp, answer := do(t, http.MethodPost, url, user, ContentTypeSDP, pc.LocalDescription().SDP)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST %s: %d %s", url, resp.StatusCode, answer)
+	}
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Header.Get("Location"), resp.Header.Get("ETag")
+}
+
+func expect(t *testing.T, ch <-chan client.Message, typ string) client.Message {
+	t.Helper()
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Type == typ {
+				return msg
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s message", typ)
+		}
+	}
+}
+
+func TestPublishAndPlay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	base := newServer(t)
+
+	// A WebSocket member sees the WHIP publisher as an ordinary peer.
+	events := make(chan client.Message, 64)
+	alice := client.New(base, func(context.Context) (string, error) { return token("alice"), nil },
+		client.WithoutReconnect(), client.WithHandlers(client.Handlers{OnMessage: func(msg client.Message) { events <- msg }}))
+	defer alice.Close()
+	if err := alice.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Join(ctx, "stage"); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, _ := do(t, http.MethodPost, base+"/whip/stage", "", ContentTypeSDP, "v=0"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated POST: %d", resp.StatusCode)
+	}
+	// alice's room is still a mesh room, so there is nothing to play.
+	if resp, _ := do(t, http.MethodPost, base+"/whep/stage", "viewer", ContentTypeSDP, "v=0"); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("WHEP in a mesh room: %d", resp.StatusCode)
+	}
+
+	publisher := newPeerConnection(t)
+	audio, _ := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "obs")
+	video, _ := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "obs")
+	publisher.AddTrack(audio)
+	publisher.AddTrack(video)
+	whipURL, whipETag := negotiate(t, publisher, base+"/whip/stage", "obs")
+	if !strings.HasPrefix(whipURL, "/whip/stage/") || whipETag == "" {
+		t.Fatalf("unexpected session headers %q %q", whipURL, whipETag)
+	}
+	joined := expect(t, events, "peer_joined")
+	if mode := expect(t, events, "room-mode"); mode.Mode != hub.ModeSFU {
+		t.Fatalf("unexpected room-mode %+v", mode)
+	}
+	if published := expect(t, events, "published"); published.PeerID != joined.PeerID {
+		t.Fatalf("published %q, joined %q", published.PeerID, joined.PeerID)
+	}
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for seq := uint16(1); ctx.Err() == nil; seq++ {
+			<-ticker.C
+			audio.WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960}, Payload: []byte{0xf8, 0xff, 0xfe}})
+			video.WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 1800, Marker: true}, Payload: []byte{0x10, 0x00, 0x9d, 0x01, 0x2a}})
+		}
+	}()
+
+	viewer := newPeerConnection(t)
+	viewer.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	viewer.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	received := make(chan webrtc.RTPCodecType, 2)
+	viewer.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if _, _, err := track.ReadRTP(); err == nil {
+			received <- track.Kind()
+		}
+	})
+	whepURL, _ := negotiate(t, viewer, base+"/whep/stage", "viewer")
+	kinds := map[webrtc.RTPCodecType]bool{}
+	for len(kinds) < 2 {
+		select {
+		case kind := <-received:
+			kinds[kind] = true
+		case <-ctx.Done():
+			t.Fatalf("viewer received only %v", kinds)
+		}
+	}
+
+	// Trickle and ICE restart on the publisher's session.
+	candidate := "a=candidate:1 1 udp 2130706431 127.0.0.1 9 typ host\r\n"
+	resp, body := do(t, http.MethodPatch, base+whipURL, "obs", ContentTypeSDPFrag, "a=mid:0\r\n"+candidate, "If-Match", whipETag)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("trickle: %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, http.MethodPatch, base+whipURL, "obs", ContentTypeSDPFrag, candidate, "If-Match", `"stale"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match: %d", resp.StatusCode)
+	}
+	if resp, _ := do(t, http.MethodPatch, base+whipURL, "mallory", ContentTypeSDPFrag, candidate); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("foreign PATCH: %d", resp.StatusCode)
+	}
+	restart := "a=ice-ufrag:restart1\r\na=ice-pwd:restartpasswordrestartpassword\r\n"
+	resp, body = do(t, http.MethodPatch, base+whipURL, "obs", ContentTypeSDPFrag, restart, "If-Match", "*")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != ContentTypeSDPFrag {
+		t.Fatalf("ICE restart: %d %s", resp.StatusCode, body)
+	}
+	frag := parseFragment(body)
+	if frag.ufrag == "" || `"`+frag.ufrag+`"` == whipETag || resp.Header.Get("ETag") != `"`+frag.ufrag+`"` || len(frag.candidates) == 0 {
+		t.Fatalf("unexpected restart answer %q (etag %s)", body, resp.Header.Get("ETag"))
+	}
+
+	// Ending the broadcast tells the room and ends its players.
+	if resp, _ := do(t, http.MethodDelete, base+whipURL, "obs", "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("DELETE: %d", resp.StatusCode)
+	}
+	if msg := expect(t, events, "unpublished"); msg.PeerID != joined.PeerID {
+		t.Fatalf("unexpected unpublished %+v", msg)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, _ := do(t, http.MethodDelete, base+whepURL, "viewer", "", "")
+		if resp.StatusCode == http.StatusNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("WHEP session outlived its publisher: %d", resp.StatusCode)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestParseFragment(t *testing.T) {
+	frag := parseFragment("a=ice-options:trickle\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:0\r\na=ice-ufrag:EsAw\r\na=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n" +
+		"a=candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\na=mid:1\r\na=candidate:2 1 udp 1 192.0.2.1 61765 typ host\r\na=end-of-candidates\r\n")
+	if frag.ufrag != "EsAw" || frag.pwd != "P2uYro0UCOQ4zxjKXaWCBui1" || len(frag.candidates) != 2 {
+		t.Fatalf("unexpected fragment %+v", frag)
+	}
+	if c := frag.candidates[1]; c.mid != "1" || c.mLineIndex != 1 || !strings.HasPrefix(c.value, "candidate:2 ") {
+		t.Fatalf("unexpected candidate %+v", c)
+	}
+	offer := restartOffer("v=0\r\na=ice-ufrag:old\r\na=ice-pwd:oldpwd\r\na=candidate:1 1 udp 1 192.0.2.1 1 typ host\r\n", "new", "newpwd")
+	if offer != "v=0\r\na=ice-ufrag:new\r\na=ice-pwd:newpwd\r\n" {
+		t.Fatalf("unexpected restart offer %q", offer)
+	}
+}
@@ -0,0 +1,527 @@
+// Package client — Go signaling client for the /ws/signal endpoint.
+//
+// A Client acquires a token, connects, and reconnects with jittered
+// exponential backoff when the connection drops, rejoining its room. Each
+// connection opens with a hello handshake negotiating the protocol version
+// and features, in JSON or, with WithMessagePack, MessagePack. Incoming messages are delivered to Handlers and to any
+// pending Request waiters.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/gorilla/websocket"
+)
+
+// Errors returned by Client.
+var (
+	ErrNotConnected       = errors.New("signaling: not connected")
+	ErrClosed             = errors.New("signaling: client closed")
+	ErrUnsupportedVersion = errors.New("signaling: protocol version not supported by server")
+	ErrNoAcks             = errors.New("signaling: server did not agree to acks")
+)
+
+// ProtocolVersion is the protocol version the client speaks. Servers that
+// predate the handshake are spoken to at version 1.
+const ProtocolVersion = 2
+
+// closeUnsupportedVersion is the close code of a server rejecting the
+// client's version.
+const closeUnsupportedVersion = 4001
+
+// Optional protocol features for WithFeatures.
+const (
+	// FeatureAcks has the server acknowledge messages sent with SendAcked.
+	FeatureAcks = "acks"
+	// FeatureBatching lets the server coalesce trickled candidates into
+	// ice-candidates messages, which are passed to OnCandidate one by one.
+	FeatureBatching = "batching"
+	// FeatureCompression lets the server deflate large messages; it is
+	// asked for by WithCompression.
+	FeatureCompression = "compression"
+)
+
+// Reconnect defaults.
+const (
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Handlers are invoked on the client's read goroutine and must not block.
+// Nil handlers are skipped; OnMessage sees every message, including those
+// also passed to a typed handler.
+type Handlers struct {
+	OnConnect    func()
+	OnDisconnect func(err error)
+	OnMessage    func(msg Message)
+	OnPeerJoined func(peerID string)
+	OnOffer      func(from, sdp string)
+	OnAnswer     func(from, sdp string)
+	OnCandidate  func(from string, candidate ICECandidate)
+	OnError      func(msg Message)
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHandlers sets the event callbacks.
+func WithHandlers(h Handlers) Option {
+	return func(c *Client) { c.handlers = h }
+}
+
+// WithBackoff sets the reconnect backoff bounds.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		if min > 0 {
+			c.minBackoff = min
+		}
+		if max >= c.minBackoff {
+			c.maxBackoff = max
+		}
+	}
+}
+
+// WithoutReconnect disables automatic reconnection.
+func WithoutReconnect() Option {
+	return func(c *Client) { c.reconnect = false }
+}
+
+// WithFeatures asks the server for optional protocol features; HasFeature
+// reports which it agreed to.
+func WithFeatures(names ...string) Option {
+	return func(c *Client) { c.features = names }
+}
+
+// WithMessagePack asks for the binary MessagePack encoding. Servers that do
+// not offer it are spoken to in JSON.
+func WithMessagePack() Option {
+	return func(c *Client) { c.subprotocol = wire.SubprotocolMsgPack }
+}
+
+// WithCompression offers permessage-deflate and asks for FeatureCompression,
+// with which the server deflates large messages such as SDP.
+func WithCompression() Option {
+	return func(c *Client) { c.compress = true }
+}
+
+// WithMetadata sets the metadata sent with every join; see SetMetadata.
+func WithMetadata(m Metadata) Option {
+	return func(c *Client) { c.metadata = &m }
+}
+
+// WithDialer overrides the WebSocket dialer (TLS config, proxy, timeouts).
+func WithDialer(d *websocket.Dialer) Option {
+	return func(c *Client) { c.dialer = d }
+}
+
+// Client is a signaling connection. It is safe for concurrent use.
+type Client struct {
+	url         string
+	tokens      TokenSource
+	dialer      *websocket.Dialer
+	handlers    Handlers
+	reconnect   bool
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	features    []string
+	subprotocol string
+	compress    bool
+	ids         atomic.Uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	room    string
+	peerID  string
+	version int
+	granted map[string]bool
+	waiters map[*waiter]struct{}
+
+	metadata     *Metadata
+	presenceSubs map[string]struct{}
+
+	writeMu sync.Mutex
+}
+
+type waiter struct {
+	match func(Message) bool
+	reply chan Message
+}
+
+// New creates a client for the signaling service at baseURL (http(s) or
+// ws(s)); it connects on Connect.
+func New(baseURL string, tokens TokenSource, opts ...Option) *Client {
+	c := &Client{
+		url:        signalURL(baseURL),
+		tokens:     tokens,
+		dialer:     websocket.DefaultDialer,
+		reconnect:  true,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		waiters:    make(map[*waiter]struct{}),
+
+		presenceSubs: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+func signalURL(base string) string {
+	base = strings.TrimSuffix(base, "/")
+	if strings.HasPrefix(base, "http") {
+		base = "ws" + strings.TrimPrefix(base, "http")
+	}
+	if !strings.HasSuffix(base, "/ws/signal") {
+		base += "/ws/signal"
+	}
+	return base
+}
+
+// Connect dials the service. It fails if the first attempt fails; after that
+// the client reconnects on its own until Close.
+func (c *Client) Connect(ctx context.Context) error {
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	if !c.attach(conn) {
+		return ErrClosed
+	}
+	go c.run(conn)
+	return nil
+}
+
+// Close disconnects and stops reconnecting. Pending requests fail with ErrClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.cancel()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	c.writeMu.Lock()
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return conn.Close()
+}
+
+// Connected reports whether a connection is currently open.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// PeerID is this client's ID from the most recent joined message.
+func (c *Client) PeerID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peerID
+}
+
+// Version is the protocol version of the current connection.
+func (c *Client) Version() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// HasFeature reports whether the server agreed to the named feature on the
+// current connection.
+func (c *Client) HasFeature(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.granted[name]
+}
+
+// Send writes msg on the current connection.
+func (c *Client) Send(msg Message) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		if c.ctx.Err() != nil {
+			return ErrClosed
+		}
+		return ErrNotConnected
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return write(conn, msg)
+}
+
+// write encodes msg in conn's negotiated encoding.
+func write(conn *websocket.Conn, msg Message) error {
+	codec := wire.ForSubprotocol(conn.Subprotocol())
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(codec.FrameType(), data)
+}
+
+// Request sends msg and waits for the first incoming message accepted by
+// match, until ctx is done or the client is closed. The waiter survives a
+// reconnect, so a join that the reconnect replays still completes.
+func (c *Client) Request(ctx context.Context, msg Message, match func(Message) bool) (Message, error) {
+	w := &waiter{match: match, reply: make(chan Message, 1)}
+	c.mu.Lock()
+	c.waiters[w] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiters, w)
+		c.mu.Unlock()
+	}()
+
+	if err := c.Send(msg); err != nil {
+		return Message{}, err
+	}
+	select {
+	case reply := <-w.reply:
+		return reply, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-c.ctx.Done():
+		return Message{}, ErrClosed
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	token, err := c.tokens(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	var header http.Header
+	if c.subprotocol != "" {
+		header = http.Header{"Sec-WebSocket-Protocol": {c.subprotocol}}
+	}
+	dialer := c.dialer
+	if c.compress {
+		d := *dialer
+		d.EnableCompression = true
+		dialer = &d
+	}
+	conn, _, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.handshake(ctx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// handshake says hello and reads the server's welcome. A server that
+// predates the handshake answers with an error and is spoken to at
+// version 1.
+func (c *Client) handshake(ctx context.Context, conn *websocket.Conn) error {
+	features := c.features
+	if c.compress {
+		features = append(features[:len(features):len(features)], FeatureCompression)
+	}
+	if err := write(conn, Message{Type: "hello", Version: ProtocolVersion, Features: features}); err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	conn.SetReadDeadline(deadline)
+	defer conn.SetReadDeadline(time.Time{})
+	_, raw, err := conn.ReadMessage()
+	if err != nil {
+		if websocket.IsCloseError(err, closeUnsupportedVersion) {
+			return ErrUnsupportedVersion
+		}
+		return err
+	}
+	var reply Message
+	if err := wire.ForSubprotocol(conn.Subprotocol()).Unmarshal(raw, &reply); err != nil {
+		return err
+	}
+	version, granted := 1, map[string]bool{}
+	if reply.Type == "welcome" {
+		version = reply.Version
+		for _, f := range reply.Features {
+			granted[f] = true
+		}
+	}
+	c.mu.Lock()
+	c.version, c.granted = version, granted
+	c.mu.Unlock()
+	return nil
+}
+
+// attach makes conn current, unless Close won the race.
+func (c *Client) attach(conn *websocket.Conn) bool {
+	c.mu.Lock()
+	if c.ctx.Err() != nil {
+		c.mu.Unlock()
+		conn.Close()
+		return false
+	}
+	c.conn = conn
+	c.mu.Unlock()
+	if c.handlers.OnConnect != nil {
+		c.handlers.OnConnect()
+	}
+	return true
+}
+
+// run reads from conn and, when it drops, reconnects, rejoins the room and
+// renews presence subscriptions.
+func (c *Client) run(conn *websocket.Conn) {
+	for {
+		err := c.readLoop(conn)
+		c.mu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.mu.Unlock()
+		conn.Close()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if c.handlers.OnDisconnect != nil {
+			c.handlers.OnDisconnect(err)
+		}
+		if !c.reconnect {
+			return
+		}
+		if conn = c.redial(); conn == nil || !c.attach(conn) {
+			return
+		}
+		c.mu.Lock()
+		room, metadata := c.room, c.metadata
+		users := make([]string, 0, len(c.presenceSubs))
+		for user := range c.presenceSubs {
+			users = append(users, user)
+		}
+		c.mu.Unlock()
+		if room != "" {
+			c.Send(Message{Type: "join", RoomID: room, Metadata: metadata})
+		}
+		if len(users) > 0 {
+			c.Send(Message{Type: "presence-subscribe", Users: users})
+		}
+	}
+}
+
+// redial retries with jittered exponential backoff until it connects or the
+// client is closed.
+func (c *Client) redial() *websocket.Conn {
+	backoff := c.minBackoff
+	for {
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		select {
+		case <-time.After(wait):
+		case <-c.ctx.Done():
+			return nil
+		}
+		conn, err := c.dial(c.ctx)
+		if err == nil {
+			return conn
+		}
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	codec := wire.ForSubprotocol(conn.Subprotocol())
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var msg Message
+		if codec.Unmarshal(raw, &msg) != nil {
+			continue
+		}
+		c.dispatch(msg)
+	}
+}
+
+func (c *Client) dispatch(msg Message) {
+	c.mu.Lock()
+	if msg.Type == "joined" {
+		c.room, c.peerID = msg.RoomID, msg.PeerID
+	}
+	for w := range c.waiters {
+		if w.match(msg) {
+			select {
+			case w.reply <- msg:
+			default:
+			}
+			delete(c.waiters, w)
+		}
+	}
+	c.mu.Unlock()
+
+	h := c.handlers
+	if h.OnMessage != nil {
+		h.OnMessage(msg)
+	}
+	switch msg.Type {
+	case "peer_joined":
+		if h.OnPeerJoined != nil {
+			h.OnPeerJoined(msg.PeerID)
+		}
+	case "offer":
+		if h.OnOffer != nil {
+			h.OnOffer(msg.PeerID, msg.SDP)
+		}
+	case "answer":
+		if h.OnAnswer != nil {
+			h.OnAnswer(msg.PeerID, msg.SDP)
+		}
+	case "ice-candidate":
+		var candidate ICECandidate
+		if h.OnCandidate != nil && json.Unmarshal(msg.Candidate, &candidate) == nil {
+			h.OnCandidate(msg.PeerID, candidate)
+		}
+	case "ice-candidates":
+		for _, raw := range msg.Candidates {
+			var candidate ICECandidate
+			if h.OnCandidate != nil && json.Unmarshal(raw, &candidate) == nil {
+				h.OnCandidate(msg.PeerID, candidate)
+			}
+		}
+	case "error":
+		if h.OnError != nil {
+			h.OnError(msg)
+		}
+	}
+}
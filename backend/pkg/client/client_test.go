@@ -0,0 +1,457 @@
+// Package client — Tests against an in-process signaling hub.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/wire"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+const testSecret = "client-test-secret"
+
+// testServer mirrors cmd/signaling's /ws/signal handler and can drop every
+// open connection to exercise reconnects.
+type testServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	conns []*websocket.Conn
+}
+
+func newTestServer(t *testing.T, opts ...hub.Option) *testServer {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	h := hub.NewSignalHub(nil, opts...)
+	validator := auth.NewJWTValidator(testSecret)
+	upgrader := websocket.Upgrader{Subprotocols: wire.Subprotocols, EnableCompression: true}
+	ts := &testServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.Validate(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ts.mu.Lock()
+		ts.conns = append(ts.conns, conn)
+		ts.mu.Unlock()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			_, raw, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg hub.SignalMessage
+			if peer.Codec().Unmarshal(raw, &msg) == nil {
+				h.HandleMessage(peer, msg)
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *testServer) dropAll() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, c := range ts.conns {
+		c.Close()
+	}
+	ts.conns = nil
+}
+
+var sessions atomic.Int64
+
+// mintToken signs a token the way the auth service does, with a fresh
+// session ID per call.
+func mintToken(user string) TokenSource {
+	return func(context.Context) (string, error) {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":        user,
+			"session_id": "s" + strconv.FormatInt(sessions.Add(1), 10),
+			"exp":        time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(testSecret))
+	}
+}
+
+func connect(t *testing.T, ts *testServer, user string, opts ...Option) *Client {
+	t.Helper()
+	c := New(ts.URL, mintToken(user), opts...)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	var zero T
+	return zero
+}
+
+func TestJoinAndRelay(t *testing.T) {
+	ts := newTestServer(t)
+	peerJoined := make(chan string, 1)
+	offers := make(chan [2]string, 1)
+	// alice speaks MessagePack and bob JSON.
+	alice := connect(t, ts, "alice", WithMessagePack(), WithHandlers(Handlers{
+		OnPeerJoined: func(id string) { peerJoined <- id },
+		OnOffer:      func(from, sdp string) { offers <- [2]string{from, sdp} },
+	}))
+	candidates := make(chan ICECandidate, 1)
+	bob := connect(t, ts, "bob", WithHandlers(Handlers{
+		OnCandidate: func(_ string, c ICECandidate) { candidates <- c },
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	a, err := alice.Join(ctx, "lobby")
+	if err != nil || a.RoomID != "lobby" || len(a.Peers) != 0 {
+		t.Fatalf("alice join: %+v, %v", a, err)
+	}
+	b, err := bob.Join(ctx, "lobby")
+	if err != nil || len(b.Peers) != 1 || b.Peers[0] != a.PeerID {
+		t.Fatalf("bob join: %+v, %v", b, err)
+	}
+	if id := receive(t, peerJoined); id != b.PeerID || bob.PeerID() != b.PeerID {
+		t.Errorf("peer_joined %q, want %q", id, b.PeerID)
+	}
+
+	bob.Offer(a.PeerID, "v=0")
+	if got := receive(t, offers); got != [2]string{b.PeerID, "v=0"} {
+		t.Errorf("offer %v", got)
+	}
+	mid := "0"
+	alice.Candidate(b.PeerID, ICECandidate{Candidate: "candidate:1 1 udp 1 192.0.2.1 9 typ host", SDPMid: &mid})
+	if got := receive(t, candidates); got.SDPMid == nil || *got.SDPMid != "0" {
+		t.Errorf("candidate %+v", got)
+	}
+}
+
+func TestJoinReturnsServerError(t *testing.T) {
+	ts := newTestServer(t, hub.WithTenantQuotas(&hub.TenantQuotas{Default: &hub.TenantQuota{MaxRooms: 1}}))
+	alice := connect(t, ts, "alice")
+	bob := connect(t, ts, "bob")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := alice.Join(ctx, "r1"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := bob.Join(ctx, "r2")
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Message != hub.ErrRoomQuota.Error() {
+		t.Fatalf("expected room quota error, got %v", err)
+	}
+}
+
+func TestReconnectRejoinsRoom(t *testing.T) {
+	ts := newTestServer(t)
+	joined := make(chan Message, 4)
+	disconnects := make(chan error, 4)
+	c := connect(t, ts, "alice", WithBackoff(10*time.Millisecond, 50*time.Millisecond), WithHandlers(Handlers{
+		OnDisconnect: func(err error) { disconnects <- err },
+		OnMessage: func(m Message) {
+			if m.Type == "joined" {
+				joined <- m
+			}
+		},
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	first, err := c.Join(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, joined)
+
+	ts.dropAll()
+	receive(t, disconnects)
+	again := receive(t, joined)
+	if again.RoomID != "lobby" || again.PeerID == first.PeerID {
+		t.Errorf("expected a rejoin under a new session, got %+v", again)
+	}
+	if !c.Connected() || c.PeerID() != again.PeerID {
+		t.Error("client state not updated after reconnect")
+	}
+}
+
+func TestCloseFailsPendingRequests(t *testing.T) {
+	ts := newTestServer(t)
+	c := connect(t, ts, "alice", WithoutReconnect())
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Request(context.Background(), Message{Type: "join", RoomID: "r1"}, func(Message) bool { return false })
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+	if err := receive(t, done); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if err := c.Send(Message{Type: "leave"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("send after close: %v", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	ts := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	acked := connect(t, ts, "alice", WithFeatures(FeatureAcks))
+	if acked.Version() != ProtocolVersion || !acked.HasFeature(FeatureAcks) {
+		t.Fatalf("negotiated version %d, acks %v", acked.Version(), acked.HasFeature(FeatureAcks))
+	}
+	if err := acked.SendAcked(ctx, Message{Type: "join", RoomID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	plain := connect(t, ts, "bob")
+	if err := plain.SendAcked(ctx, Message{Type: "join", RoomID: "r1"}); !errors.Is(err, ErrNoAcks) {
+		t.Fatalf("SendAcked without acks: %v", err)
+	}
+
+	// A server that predates hello answers it with an error; one that does
+	// not speak the client's version closes.
+	for reply, want := range map[string]error{"error": nil, "close": ErrUnsupportedVersion} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.ReadMessage()
+			if reply == "error" {
+				conn.WriteJSON(Message{Type: "error"})
+			} else {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeUnsupportedVersion, "unsupported"))
+			}
+			conn.ReadMessage()
+		}))
+		c := New(srv.URL, StaticToken("t"), WithoutReconnect())
+		err := c.Connect(ctx)
+		if !errors.Is(err, want) {
+			t.Errorf("%s: Connect returned %v", reply, err)
+		}
+		if err == nil && c.Version() != 1 {
+			t.Errorf("%s: version %d", reply, c.Version())
+		}
+		c.Close()
+		srv.Close()
+	}
+}
+
+func TestBatchedCandidates(t *testing.T) {
+	ts := newTestServer(t, hub.WithCandidateBatching(20*time.Millisecond))
+	candidates := make(chan ICECandidate, 2)
+	alice := connect(t, ts, "alice", WithCompression(), WithFeatures(FeatureBatching), WithHandlers(Handlers{
+		OnCandidate: func(_ string, c ICECandidate) { candidates <- c },
+	}))
+	if !alice.HasFeature(FeatureBatching) || !alice.HasFeature(FeatureCompression) {
+		t.Fatal("batching and compression not negotiated")
+	}
+	bob := connect(t, ts, "bob")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	a, err := alice.Join(ctx, "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Join(ctx, "lobby"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"candidate:1 1 udp 1 192.0.2.1 9 typ host", "candidate:2 1 udp 1 192.0.2.2 9 typ host"} {
+		bob.Candidate(a.PeerID, ICECandidate{Candidate: c})
+	}
+	if first, second := receive(t, candidates), receive(t, candidates); first.Candidate[10] != '1' || second.Candidate[10] != '2' {
+		t.Errorf("candidates %+v %+v", first, second)
+	}
+}
+
+func TestAuthServiceToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ UserID string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/auth/token" || req.UserID != "bot" || r.Header.Get("X-API-Key") != "acme-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "signed"})
+	}))
+	defer srv.Close()
+	if token, err := AuthServiceToken(srv.URL, "bot", "acme-key", nil)(context.Background()); err != nil || token != "signed" {
+		t.Fatalf("token %q, err %v", token, err)
+	}
+	if _, err := AuthServiceToken(srv.URL, "bot", "", nil)(context.Background()); err == nil {
+		t.Error("expected an error for a rejected request")
+	}
+}
+
+func TestSignalURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"http://localhost:8080":           "ws://localhost:8080/ws/signal",
+		"https://sig.example.com/":        "wss://sig.example.com/ws/signal",
+		"wss://sig.example.com/ws/signal": "wss://sig.example.com/ws/signal",
+	} {
+		if got := signalURL(in); got != want {
+			t.Errorf("signalURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// roleToken signs a token for user carrying role.
+func roleToken(user, role string) TokenSource {
+	return func(context.Context) (string, error) {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": user, "session_id": "r1", "role": role, "exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(testSecret))
+	}
+}
+
+func TestJoinThroughLobby(t *testing.T) {
+	ts := newTestServer(t, hub.WithLobbyByDefault())
+	knocks := make(chan string, 2)
+	host := New(ts.URL, roleToken("host", "host"), WithHandlers(Handlers{OnMessage: func(m Message) {
+		if m.Type == "knock" {
+			knocks <- m.PeerID
+		}
+	}}))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := host.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	if joined, err := host.Join(ctx, "r1"); err != nil || joined.State != "lobby" {
+		t.Fatalf("host joined %+v, %v", joined, err)
+	}
+
+	alice := connect(t, ts, "alice")
+	joined := make(chan error, 1)
+	go func() {
+		_, err := alice.Join(ctx, "r1")
+		joined <- err
+	}()
+	host.Admit(receive(t, knocks))
+	if err := receive(t, joined); err != nil {
+		t.Fatalf("admitted join: %v", err)
+	}
+
+	bob := connect(t, ts, "bob")
+	go func() {
+		_, err := bob.Join(ctx, "r1")
+		joined <- err
+	}()
+	host.Deny(receive(t, knocks), "full")
+	var denied *DeniedError
+	if err := receive(t, joined); !errors.As(err, &denied) || denied.Reason != "full" {
+		t.Fatalf("denied join: %v", err)
+	}
+}
+
+func TestModeratorKick(t *testing.T) {
+	ts := newTestServer(t)
+	removed := make(chan Message, 1)
+	mod := New(ts.URL, roleToken("mod", "moderator"))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := mod.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer mod.Close()
+	bob := connect(t, ts, "bob", WithHandlers(Handlers{OnMessage: func(m Message) {
+		if m.Type == "peer-removed" {
+			removed <- m
+		}
+	}}))
+	if _, err := mod.Join(ctx, "r1"); err != nil {
+		t.Fatal(err)
+	}
+	joined, err := bob.Join(ctx, "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod.Kick(joined.PeerID, "spam")
+	if m := receive(t, removed); m.PeerID != joined.PeerID || m.State != "kicked" || m.Reason != "spam" {
+		t.Fatalf("bob got %+v", m)
+	}
+}
+
+func TestMetadataAndPresence(t *testing.T) {
+	ts := newTestServer(t)
+	updates := make(chan Message, 4)
+	alice := connect(t, ts, "alice", WithMetadata(Metadata{DisplayName: "Alice"}), WithHandlers(Handlers{OnMessage: func(m Message) {
+		if m.Type == "metadata" || (m.Type == "presence" && m.ID == "") {
+			updates <- m
+		}
+	}}))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if states, err := alice.SubscribePresence(ctx, "bob"); err != nil || states["bob"] != PresenceOffline {
+		t.Fatalf("subscribe: %v, %v", states, err)
+	}
+	if _, err := alice.Join(ctx, "r1"); err != nil {
+		t.Fatal(err)
+	}
+
+	bob := connect(t, ts, "bob")
+	if m := receive(t, updates); m.Presence["bob"] != PresenceOnline {
+		t.Fatalf("alice got %+v", m)
+	}
+	joined, err := bob.Join(ctx, "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(joined.Members) != 1 || joined.Members[0].Metadata == nil || joined.Members[0].Metadata.DisplayName != "Alice" {
+		t.Fatalf("bob joined with members %+v", joined.Members)
+	}
+	bob.SetMetadata(Metadata{DisplayName: "Bob", Device: "phone"})
+	if m := receive(t, updates); m.Type != "metadata" || m.PeerID != joined.PeerID || m.Metadata.Device != "phone" {
+		t.Fatalf("alice got %+v", m)
+	}
+	bob.SetPresence(PresenceBusy)
+	if m := receive(t, updates); m.Presence["bob"] != PresenceBusy {
+		t.Fatalf("alice got %+v", m)
+	}
+	if states, err := bob.QueryPresence(ctx, "alice", "bob"); err != nil || states["alice"] != PresenceOnline || states["bob"] != PresenceBusy {
+		t.Fatalf("query: %v, %v", states, err)
+	}
+	var rejected *ServerError
+	if _, err := bob.QueryPresence(ctx); !errors.As(err, &rejected) {
+		t.Fatalf("empty query: %v", err)
+	}
+}
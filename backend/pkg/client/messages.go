@@ -0,0 +1,379 @@
+// Package client — Wire messages and typed send helpers.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+// Message is the signaling envelope exchanged over /ws/signal.
+type Message struct {
+	Type        string            `json:"type"`
+	RoomID      string            `json:"roomId,omitempty"`
+	PeerID      string            `json:"peerId,omitempty"`
+	Peers       []string          `json:"peers,omitempty"`
+	SDP         string            `json:"sdp,omitempty"`
+	Candidate   json.RawMessage   `json:"candidate,omitempty"`
+	Candidates  []json.RawMessage `json:"candidates,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Policy      json.RawMessage   `json:"policy,omitempty"`
+	CallID      string            `json:"callId,omitempty"`
+	To          string            `json:"to,omitempty"`
+	From        string            `json:"from,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	Mode        string            `json:"mode,omitempty"`
+	Layer       string            `json:"layer,omitempty"`
+	Role        string            `json:"role,omitempty"`
+	RecordingID string            `json:"recordingId,omitempty"`
+	State       string            `json:"state,omitempty"`
+	ID          string            `json:"id,omitempty"`
+	Version     int               `json:"version,omitempty"`
+	Types       []string          `json:"types,omitempty"`
+	Features    []string          `json:"features,omitempty"`
+	Position    int               `json:"position,omitempty"`
+	Timeout     int               `json:"timeout,omitempty"`
+	Metadata    *Metadata         `json:"metadata,omitempty"`
+	Members     []Member          `json:"members,omitempty"`
+	Users       []string          `json:"users,omitempty"`
+	Presence    map[string]string `json:"presence,omitempty"`
+}
+
+// Metadata is what a peer tells room members about itself.
+type Metadata struct {
+	DisplayName string `json:"displayName,omitempty"`
+	// AvatarURL is an http or https URL.
+	AvatarURL string `json:"avatarUrl,omitempty"`
+	// Device is a free-form device type, such as "desktop" or "phone".
+	Device string `json:"device,omitempty"`
+	// App holds application-defined fields.
+	App map[string]string `json:"app,omitempty"`
+}
+
+// Member is a room member and its metadata, if it set any.
+type Member struct {
+	PeerID   string    `json:"peerId"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// Presence states.
+const (
+	PresenceOffline = "offline"
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceBusy    = "busy"
+	PresenceInCall  = "in-call"
+)
+
+// ICECandidate mirrors the browser's RTCIceCandidateInit.
+type ICECandidate struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *uint16 `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// Joined is the server's acknowledgement of a join.
+type Joined struct {
+	RoomID string
+	// PeerID is this client's ID as seen by other peers.
+	PeerID string
+	// Peers are the other members already in the room.
+	Peers []string
+	// Mode is "sfu" when the room routes media through the SFU.
+	Mode string
+	// State is "lobby" or "locked" when the room screens joiners.
+	State string
+	// Members are Peers with their metadata.
+	Members []Member
+}
+
+// DeniedError is returned by Join when the room's lobby turned the client
+// away: a host denied it, its wait timed out, or the room was locked or
+// closed.
+type DeniedError struct {
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	if e.Reason == "" {
+		return "signaling: denied entry"
+	}
+	return "signaling: denied entry: " + e.Reason
+}
+
+// ServerError is an "error" message returned in response to a request.
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	if e.Message == "" {
+		return "signaling: request rejected"
+	}
+	return "signaling: " + e.Message
+}
+
+// Join enters roomID, leaving any current room, and waits for the server's
+// joined acknowledgement. The room is rejoined automatically after a reconnect.
+// In a room with a lobby Join waits until a host admits the client, which
+// sees its place in the queue as "waiting" messages; ctx bounds the wait.
+func (c *Client) Join(ctx context.Context, roomID string) (*Joined, error) {
+	c.mu.Lock()
+	c.room = roomID
+	metadata := c.metadata
+	c.mu.Unlock()
+	reply, err := c.Request(ctx, Message{Type: "join", RoomID: roomID, Metadata: metadata}, func(m Message) bool {
+		return (m.Type == "joined" || m.Type == "error" || m.Type == "denied") && m.RoomID == roomID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Type != "joined" {
+		c.mu.Lock()
+		if c.room == roomID {
+			c.room = ""
+		}
+		c.mu.Unlock()
+		if reply.Type == "denied" {
+			return nil, &DeniedError{Reason: reply.Reason}
+		}
+		return nil, &ServerError{Message: reply.Message}
+	}
+	return &Joined{RoomID: reply.RoomID, PeerID: reply.PeerID, Peers: reply.Peers, Mode: reply.Mode, State: reply.State, Members: reply.Members}, nil
+}
+
+// SetMetadata replaces the metadata room members see, now and on every
+// later join.
+func (c *Client) SetMetadata(m Metadata) error {
+	c.mu.Lock()
+	c.metadata = &m
+	c.mu.Unlock()
+	return c.Send(Message{Type: "metadata", Metadata: &m})
+}
+
+// SetPresence sets this device's presence status: "online", "away" or
+// "busy". The user's presence is its most available device's, or "in-call"
+// during an answered call.
+func (c *Client) SetPresence(state string) error {
+	return c.Send(Message{Type: "presence", State: state})
+}
+
+// QueryPresence returns the presence state of each of users.
+func (c *Client) QueryPresence(ctx context.Context, users ...string) (map[string]string, error) {
+	return c.presenceRequest(ctx, "presence-query", users)
+}
+
+// SubscribePresence returns the presence state of each of users and has the
+// server send a "presence" message whenever one changes. Subscriptions are
+// renewed after a reconnect.
+func (c *Client) SubscribePresence(ctx context.Context, users ...string) (map[string]string, error) {
+	states, err := c.presenceRequest(ctx, "presence-subscribe", users)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	for _, user := range users {
+		c.presenceSubs[user] = struct{}{}
+	}
+	c.mu.Unlock()
+	return states, nil
+}
+
+// UnsubscribePresence stops presence updates for users.
+func (c *Client) UnsubscribePresence(users ...string) error {
+	c.mu.Lock()
+	for _, user := range users {
+		delete(c.presenceSubs, user)
+	}
+	c.mu.Unlock()
+	return c.Send(Message{Type: "presence-unsubscribe", Users: users})
+}
+
+func (c *Client) presenceRequest(ctx context.Context, msgType string, users []string) (map[string]string, error) {
+	id := strconv.FormatUint(c.ids.Add(1), 10)
+	reply, err := c.Request(ctx, Message{Type: msgType, ID: id, Users: users}, func(m Message) bool {
+		return (m.Type == "presence" || m.Type == "error") && m.ID == id
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Type == "error" {
+		return nil, &ServerError{Message: reply.Message}
+	}
+	return reply.Presence, nil
+}
+
+// SendAcked sends msg with a fresh id and waits for the server to
+// acknowledge handling it. It needs FeatureAcks.
+func (c *Client) SendAcked(ctx context.Context, msg Message) error {
+	if !c.HasFeature(FeatureAcks) {
+		return ErrNoAcks
+	}
+	msg.ID = strconv.FormatUint(c.ids.Add(1), 10)
+	reply, err := c.Request(ctx, msg, func(m Message) bool {
+		return (m.Type == "ack" || m.Type == "error") && m.ID == msg.ID
+	})
+	if err != nil {
+		return err
+	}
+	if reply.Type == "error" {
+		return &ServerError{Message: reply.Message}
+	}
+	return nil
+}
+
+// Leave exits roomID.
+func (c *Client) Leave(roomID string) error {
+	c.mu.Lock()
+	if c.room == roomID {
+		c.room = ""
+	}
+	c.mu.Unlock()
+	return c.Send(Message{Type: "leave", RoomID: roomID})
+}
+
+// Offer relays an SDP offer to peerID.
+func (c *Client) Offer(peerID, sdp string) error {
+	return c.Send(Message{Type: "offer", PeerID: peerID, SDP: sdp})
+}
+
+// Answer relays an SDP answer to peerID.
+func (c *Client) Answer(peerID, sdp string) error {
+	return c.Send(Message{Type: "answer", PeerID: peerID, SDP: sdp})
+}
+
+// Candidate trickles an ICE candidate to peerID.
+func (c *Client) Candidate(peerID string, candidate ICECandidate) error {
+	raw, err := json.Marshal(candidate)
+	if err != nil {
+		return err
+	}
+	return c.Send(Message{Type: "ice-candidate", PeerID: peerID, Candidate: raw})
+}
+
+// SFU candidate roles for SFUCandidate.
+const (
+	RolePublish   = "publish"
+	RoleSubscribe = "subscribe"
+)
+
+// Publish sends an offer for this client's media to the SFU of the current
+// room and returns its answer. The room must be in SFU mode.
+func (c *Client) Publish(ctx context.Context, offer string) (string, error) {
+	reply, err := c.Request(ctx, Message{Type: "publish", SDP: offer}, func(m Message) bool {
+		return m.Type == "publish-answer" || (m.Type == "error" && m.RoomID != "" && m.PeerID == "")
+	})
+	if err != nil {
+		return "", err
+	}
+	if reply.Type == "error" {
+		return "", &ServerError{Message: reply.Message}
+	}
+	return reply.SDP, nil
+}
+
+// Subscribe asks the SFU to forward publisherID's media at the given
+// simulcast layer ("" for the best available); subscribing again switches
+// layer. The media arrives via a subscribe-offer to answer with
+// SubscribeAnswer.
+func (c *Client) Subscribe(publisherID, layer string) error {
+	return c.Send(Message{Type: "subscribe", PeerID: publisherID, Layer: layer})
+}
+
+// Unsubscribe stops forwarding publisherID's media.
+func (c *Client) Unsubscribe(publisherID string) error {
+	return c.Send(Message{Type: "unsubscribe", PeerID: publisherID})
+}
+
+// SubscribeAnswer answers the SFU's latest subscribe-offer.
+func (c *Client) SubscribeAnswer(sdp string) error {
+	return c.Send(Message{Type: "subscribe-answer", SDP: sdp})
+}
+
+// SFUCandidate trickles a candidate for the publish or subscribe connection.
+func (c *Client) SFUCandidate(role string, candidate ICECandidate) error {
+	raw, err := json.Marshal(candidate)
+	if err != nil {
+		return err
+	}
+	return c.Send(Message{Type: "sfu-candidate", Role: role, Candidate: raw})
+}
+
+// Admit lets peerID in from the current room's lobby. Only hosts may.
+func (c *Client) Admit(peerID string) error {
+	return c.Send(Message{Type: "admit", PeerID: peerID})
+}
+
+// Deny turns peerID away from the current room's lobby with reason.
+func (c *Client) Deny(peerID, reason string) error {
+	return c.Send(Message{Type: "deny", PeerID: peerID, Reason: reason})
+}
+
+// SetLobby switches the current room's lobby on or off; switching it off
+// admits everyone waiting.
+func (c *Client) SetLobby(on bool) error {
+	if on {
+		return c.Send(Message{Type: "lobby-enable"})
+	}
+	return c.Send(Message{Type: "lobby-disable"})
+}
+
+// SetLocked locks or unlocks the current room. A locked room turns away
+// everyone but hosts, including those waiting.
+func (c *Client) SetLocked(locked bool) error {
+	if locked {
+		return c.Send(Message{Type: "room-lock"})
+	}
+	return c.Send(Message{Type: "room-unlock"})
+}
+
+// Kick removes peerID from the current room; it may rejoin. Only hosts and
+// moderators may, and not on each other.
+func (c *Client) Kick(peerID, reason string) error {
+	return c.Send(Message{Type: "kick", PeerID: peerID, Reason: reason})
+}
+
+// Ban removes every device of peerID's user from the current room and keeps
+// them out for as long as the room exists.
+func (c *Client) Ban(peerID, reason string) error {
+	return c.Send(Message{Type: "ban", PeerID: peerID, Reason: reason})
+}
+
+// RequestMute asks peerID to mute its "audio" or "video" track.
+func (c *Client) RequestMute(peerID, media, reason string) error {
+	return c.Send(Message{Type: "request-mute", PeerID: peerID, Mode: media, Reason: reason})
+}
+
+// EndForAll closes the current room, removing every member.
+func (c *Client) EndForAll(reason string) error {
+	return c.Send(Message{Type: "end-for-all", Reason: reason})
+}
+
+// StartRecording asks the server to record the current room and returns the
+// recording ID. Every member, this client included, is also sent a
+// "recording" notice with state "started".
+func (c *Client) StartRecording(ctx context.Context) (string, error) {
+	return c.recordingRequest(ctx, "record-start", "started")
+}
+
+// StopRecording stops recording the current room.
+func (c *Client) StopRecording(ctx context.Context) (string, error) {
+	return c.recordingRequest(ctx, "record-stop", "stopped")
+}
+
+func (c *Client) recordingRequest(ctx context.Context, msgType, state string) (string, error) {
+	reply, err := c.Request(ctx, Message{Type: msgType}, func(m Message) bool {
+		return (m.Type == "recording" && m.State == state) || (m.Type == "error" && m.PeerID == "")
+	})
+	if err != nil {
+		return "", err
+	}
+	if reply.Type == "error" {
+		return "", &ServerError{Message: reply.Message}
+	}
+	return reply.RecordingID, nil
+}
@@ -0,0 +1,60 @@
+// Package client — Token acquisition.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// TokenSource returns a signaling JWT. It is called on every connect and
+// reconnect, so sources that mint tokens keep long-lived clients valid.
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken always returns token.
+func StaticToken(token string) TokenSource {
+	return func(context.Context) (string, error) { return token, nil }
+}
+
+// AuthServiceToken requests a token for userID from the auth service's
+// POST /auth/token endpoint at authURL, e.g. http://localhost:8081,
+// authenticating with apiKey, which decides the token's tenant.
+func AuthServiceToken(authURL, userID, apiKey string, httpClient *http.Client) TokenSource {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return func(ctx context.Context) (string, error) {
+		body, _ := json.Marshal(map[string]string{"userId": userID})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, authURL+"/auth/token", bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("auth token: status %d", resp.StatusCode)
+		}
+		var out struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return "", err
+		}
+		if out.Token == "" {
+			return "", fmt.Errorf("auth token: empty token")
+		}
+		return out.Token, nil
+	}
+}
@@ -11,6 +11,10 @@ type Claims struct {
 	Subject   string
 	SessionID string
 	ExpiresAt int64
+	// Tenant is the optional customer namespace the token was issued for.
+	Tenant string
+	// Role is the optional participant role, such as "host".
+	Role string
 }
 
 // TokenValidator validates JWTs and returns claims or an error.
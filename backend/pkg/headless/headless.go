@@ -0,0 +1,399 @@
+// Package headless — Browserless WebRTC peer for bots and end-to-end tests.
+//
+// A Peer joins rooms through the signaling service (pkg/client), negotiates
+// real SDP and trickled ICE with pion, and sends a PCMU test tone, synthetic
+// VP8 frames and data-channel payloads — or echoes back whatever it receives.
+// Per-remote counters let tests assert that media actually flowed.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package headless
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/client"
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+// ErrNoSession is returned for a remote peer with no peer connection.
+var ErrNoSession = errors.New("headless: no session with peer")
+
+// Config selects what a Peer sends.
+type Config struct {
+	ICEServers []webrtc.ICEServer
+	// Audio sends a 440 Hz PCMU tone.
+	Audio bool
+	// Video sends synthetic (non-decodable) VP8 frames at 30 fps.
+	Video bool
+	// DataChannel opens a data channel when offering and sends a payload
+	// every 100ms once it is open.
+	DataChannel bool
+	// Echo reflects received RTP and data-channel messages back to the
+	// sender instead of generating media.
+	Echo bool
+	// OfferOnJoin offers to every peer that joins the room after this one.
+	OfferOnJoin bool
+	// Loopback restricts ICE to loopback host candidates, for tests on one host.
+	Loopback bool
+	// ClientOptions are passed to the signaling client; its handlers are
+	// replaced by the Peer's own.
+	ClientOptions []client.Option
+}
+
+// Stats counts what one session received.
+type Stats struct {
+	State        string
+	AudioPackets int64
+	AudioBytes   int64
+	VideoPackets int64
+	VideoBytes   int64
+	DataMessages int64
+	DataBytes    int64
+}
+
+// Peer is a headless WebRTC endpoint. It is safe for concurrent use.
+type Peer struct {
+	cfg    Config
+	api    *webrtc.API
+	client *client.Client
+
+	events chan func()
+	done   chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// New creates a Peer for the signaling service at baseURL.
+func New(baseURL string, tokens client.TokenSource, cfg Config) (*Peer, error) {
+	api, err := newAPI(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &Peer{
+		cfg:      cfg,
+		api:      api,
+		events:   make(chan func(), 1024),
+		done:     make(chan struct{}),
+		sessions: make(map[string]*session),
+	}
+	opts := append(append([]client.Option{}, cfg.ClientOptions...), client.WithHandlers(client.Handlers{
+		OnPeerJoined: func(id string) {
+			if cfg.OfferOnJoin {
+				p.enqueue(func() { p.offer(id) })
+			}
+		},
+		OnOffer:     func(from, sdp string) { p.enqueue(func() { p.handleOffer(from, sdp) }) },
+		OnAnswer:    func(from, sdp string) { p.enqueue(func() { p.handleAnswer(from, sdp) }) },
+		OnCandidate: func(from string, c client.ICECandidate) { p.enqueue(func() { p.handleCandidate(from, c) }) },
+	}))
+	p.client = client.New(baseURL, tokens, opts...)
+	go p.run()
+	return p, nil
+}
+
+func newAPI(cfg Config) (*webrtc.API, error) {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: pcmu, PayloadType: 0,
+	}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: vp8, PayloadType: 96,
+	}, webrtc.RTPCodecTypeVideo); err != nil {
+		return nil, err
+	}
+	s := webrtc.SettingEngine{}
+	if cfg.Loopback {
+		s.SetIncludeLoopbackCandidate(true)
+		s.SetIPFilter(func(ip net.IP) bool { return ip.IsLoopback() })
+		s.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+		s.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	}
+	return webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithSettingEngine(s)), nil
+}
+
+// Client is the underlying signaling client.
+func (p *Peer) Client() *client.Client { return p.client }
+
+// Connect connects to the signaling service.
+func (p *Peer) Connect(ctx context.Context) error { return p.client.Connect(ctx) }
+
+// Join enters roomID and waits for the server's acknowledgement.
+func (p *Peer) Join(ctx context.Context, roomID string) (*client.Joined, error) {
+	return p.client.Join(ctx, roomID)
+}
+
+// Call offers to peerID. Negotiation continues in the background; use
+// WaitFor to block until media flows.
+func (p *Peer) Call(ctx context.Context, peerID string) error {
+	result := make(chan error, 1)
+	p.enqueue(func() { result <- p.offer(peerID) })
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.done:
+		return client.ErrClosed
+	}
+}
+
+// Stats returns the counters for the session with peerID.
+func (p *Peer) Stats(peerID string) (Stats, error) {
+	p.mu.Lock()
+	s, ok := p.sessions[peerID]
+	p.mu.Unlock()
+	if !ok {
+		return Stats{}, ErrNoSession
+	}
+	return s.stats(), nil
+}
+
+// Sessions lists the remote peer IDs with an open session.
+func (p *Peer) Sessions() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := make([]string, 0, len(p.sessions))
+	for id := range p.sessions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// WaitFor polls the session with peerID until cond holds or ctx is done.
+func (p *Peer) WaitFor(ctx context.Context, peerID string, cond func(Stats) bool) (Stats, error) {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		st, err := p.Stats(peerID)
+		if err == nil && cond(st) {
+			return st, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return st, err
+		}
+	}
+}
+
+// Hangup closes the session with peerID.
+func (p *Peer) Hangup(peerID string) {
+	p.mu.Lock()
+	s := p.sessions[peerID]
+	delete(p.sessions, peerID)
+	p.mu.Unlock()
+	if s != nil {
+		s.close()
+	}
+}
+
+// Close ends every session and disconnects from signaling.
+func (p *Peer) Close() error {
+	p.once.Do(func() { close(p.done) })
+	p.mu.Lock()
+	sessions := p.sessions
+	p.sessions = make(map[string]*session)
+	p.mu.Unlock()
+	for _, s := range sessions {
+		s.close()
+	}
+	return p.client.Close()
+}
+
+// enqueue hands a signaling event to the worker, preserving arrival order.
+// It blocks when the queue is full rather than drop negotiation messages.
+func (p *Peer) enqueue(fn func()) {
+	select {
+	case p.events <- fn:
+	case <-p.done:
+	}
+}
+
+func (p *Peer) run() {
+	for {
+		select {
+		case fn := <-p.events:
+			fn()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// newSession replaces any existing session with peerID.
+func (p *Peer) newSession(peerID string) (*session, error) {
+	pc, err := p.api.NewPeerConnection(webrtc.Configuration{ICEServers: p.cfg.ICEServers})
+	if err != nil {
+		return nil, err
+	}
+	s := &session{peer: p, remote: peerID, pc: pc, done: make(chan struct{})}
+	if err := s.setup(); err != nil {
+		pc.Close()
+		return nil, err
+	}
+	p.mu.Lock()
+	old := p.sessions[peerID]
+	p.sessions[peerID] = s
+	p.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+	return s, nil
+}
+
+func (p *Peer) session(peerID string) *session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[peerID]
+}
+
+func (p *Peer) offer(peerID string) error {
+	s, err := p.newSession(peerID)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureReceivers(); err != nil {
+		return err
+	}
+	if p.cfg.DataChannel {
+		dc, err := s.pc.CreateDataChannel("headless", nil)
+		if err != nil {
+			return err
+		}
+		s.attachDataChannel(dc)
+	}
+	offer, err := s.pc.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	if err := s.pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	if err := p.client.Offer(peerID, offer.SDP); err != nil {
+		return err
+	}
+	s.markSignaled()
+	return nil
+}
+
+func (p *Peer) handleOffer(from, sdp string) {
+	s, err := p.newSession(from)
+	if err != nil {
+		return
+	}
+	if err := s.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}); err != nil {
+		p.Hangup(from)
+		return
+	}
+	s.flushCandidates()
+	answer, err := s.pc.CreateAnswer(nil)
+	if err != nil {
+		p.Hangup(from)
+		return
+	}
+	if err := s.pc.SetLocalDescription(answer); err != nil {
+		p.Hangup(from)
+		return
+	}
+	if p.client.Answer(from, answer.SDP) == nil {
+		s.markSignaled()
+	}
+}
+
+func (p *Peer) handleAnswer(from, sdp string) {
+	s := p.session(from)
+	if s == nil {
+		return
+	}
+	if err := s.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: sdp}); err != nil {
+		p.Hangup(from)
+		return
+	}
+	s.flushCandidates()
+}
+
+// handleCandidate adds a remote candidate, holding it until the remote
+// description is set.
+func (p *Peer) handleCandidate(from string, c client.ICECandidate) {
+	s := p.session(from)
+	if s == nil {
+		return
+	}
+	init := webrtc.ICECandidateInit{
+		Candidate:        c.Candidate,
+		SDPMid:           c.SDPMid,
+		SDPMLineIndex:    c.SDPMLineIndex,
+		UsernameFragment: c.UsernameFragment,
+	}
+	if s.pc.RemoteDescription() == nil {
+		s.pending = append(s.pending, init)
+		return
+	}
+	s.pc.AddICECandidate(init)
+}
+
+// session is one peer connection. Negotiation fields are only touched by the
+// Peer's worker; counters are atomic.
+type session struct {
+	peer    *Peer
+	remote  string
+	pc      *webrtc.PeerConnection
+	pending []webrtc.ICECandidateInit
+
+	done      chan struct{}
+	closeOnce sync.Once
+	started   atomic.Bool
+
+	audioPackets, audioBytes atomic.Int64
+	videoPackets, videoBytes atomic.Int64
+	dataMessages, dataBytes  atomic.Int64
+
+	// Local media: generated tracks, or echo targets when cfg.Echo.
+	audioTone, videoFrames *webrtc.TrackLocalStaticSample
+	audioEcho, videoEcho   *webrtc.TrackLocalStaticRTP
+
+	// Local candidates are held until the offer or answer has been sent,
+	// so they never overtake it.
+	localMu      sync.Mutex
+	signaled     bool
+	localPending []client.ICECandidate
+}
+
+func (s *session) flushCandidates() {
+	for _, c := range s.pending {
+		s.pc.AddICECandidate(c)
+	}
+	s.pending = nil
+}
+
+func (s *session) stats() Stats {
+	return Stats{
+		State:        s.pc.ConnectionState().String(),
+		AudioPackets: s.audioPackets.Load(),
+		AudioBytes:   s.audioBytes.Load(),
+		VideoPackets: s.videoPackets.Load(),
+		VideoBytes:   s.videoBytes.Load(),
+		DataMessages: s.dataMessages.Load(),
+		DataBytes:    s.dataBytes.Load(),
+	}
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.pc.Close()
+	})
+}
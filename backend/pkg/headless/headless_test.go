@@ -0,0 +1,144 @@
+// Package headless — End-to-end calls over loopback through an in-process hub.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package headless
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/auth"
+	"github.com/faisalhanif/carrier-grade-webrtc/internal/signaling/hub"
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/client"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+const testSecret = "headless-test-secret"
+
+// newSignalingServer mirrors cmd/signaling's /ws/signal handler.
+func newSignalingServer(t *testing.T) string {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	h := hub.NewSignalHub(nil)
+	validator := auth.NewJWTValidator(testSecret)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := validator.Validate(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		peer, err := h.Register(claims.Subject+"-"+claims.SessionID, claims, conn)
+		if err != nil {
+			return
+		}
+		defer h.Unregister(peer)
+		for {
+			var msg hub.SignalMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			h.HandleMessage(peer, msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+var sessions atomic.Int64
+
+func token(user string) client.TokenSource {
+	return func(context.Context) (string, error) {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":        user,
+			"session_id": "s" + strconv.FormatInt(sessions.Add(1), 10),
+			"exp":        time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(testSecret))
+	}
+}
+
+func start(t *testing.T, ctx context.Context, url, user, room string, cfg Config) (*Peer, *client.Joined) {
+	t.Helper()
+	cfg.Loopback = true
+	p, err := New(url, token(user), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	if err := p.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	joined, err := p.Join(ctx, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, joined
+}
+
+func TestCallAgainstEchoBot(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	url := newSignalingServer(t)
+	echo, echoJoined := start(t, ctx, url, "echo-bot", "lobby", Config{Echo: true})
+	caller, _ := start(t, ctx, url, "caller", "lobby", Config{Audio: true, Video: true, DataChannel: true})
+
+	if err := caller.Call(ctx, echoJoined.PeerID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := caller.WaitFor(ctx, echoJoined.PeerID, func(s Stats) bool {
+		return s.AudioPackets >= 10 && s.VideoPackets >= 10 && s.DataMessages >= 3
+	})
+	if err != nil {
+		t.Fatalf("echoed media did not flow: %+v (%v)", got, err)
+	}
+	if got.State != "connected" {
+		t.Errorf("caller state %q", got.State)
+	}
+	if st, err := echo.Stats(caller.Client().PeerID()); err != nil || st.AudioPackets < 10 || st.DataMessages < 3 {
+		t.Errorf("echo bot stats %+v (%v)", st, err)
+	}
+	// 20ms of 8 kHz mu-law per packet.
+	if got.AudioBytes/got.AudioPackets != 160 {
+		t.Errorf("unexpected audio packet size %d", got.AudioBytes/got.AudioPackets)
+	}
+}
+
+func TestToneBotOffersOnJoin(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	url := newSignalingServer(t)
+	bot, botJoined := start(t, ctx, url, "tone-bot", "lobby", Config{Audio: true, OfferOnJoin: true})
+	listener, joined := start(t, ctx, url, "listener", "lobby", Config{})
+
+	if got, err := listener.WaitFor(ctx, botJoined.PeerID, func(s Stats) bool { return s.AudioPackets >= 10 }); err != nil {
+		t.Fatalf("no tone received: %+v (%v)", got, err)
+	}
+	bot.Hangup(joined.PeerID)
+	if _, err := bot.Stats(joined.PeerID); err != ErrNoSession {
+		t.Errorf("expected session to be gone, got %v", err)
+	}
+}
+
+func TestLinearToMulaw(t *testing.T) {
+	for in, want := range map[int16]byte{0: 0xff, -1: 0x7f, 32767: 0x80, -32768: 0x00, 1000: 0xce} {
+		if got := linearToMulaw(in); got != want {
+			t.Errorf("linearToMulaw(%d) = %#x, want %#x", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package headless — Synthetic media, echo and data-channel plumbing.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package headless
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/faisalhanif/carrier-grade-webrtc/pkg/client"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// The only codecs a headless peer negotiates. Echo relies on sending the
+// same codec it receives.
+var (
+	pcmu = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU, ClockRate: 8000, Channels: 1}
+	vp8  = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}
+)
+
+const (
+	toneHz        = 440
+	toneAmplitude = 8000
+	audioFrame    = 20 * time.Millisecond
+	videoFrame    = time.Second / 30
+	videoFrameLen = 1200
+	dataInterval  = 100 * time.Millisecond
+)
+
+// setup wires callbacks and local tracks before negotiation.
+func (s *session) setup() error {
+	cfg := s.peer.cfg
+	s.pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			return
+		}
+		init := c.ToJSON()
+		s.sendCandidate(client.ICECandidate{
+			Candidate:        init.Candidate,
+			SDPMid:           init.SDPMid,
+			SDPMLineIndex:    init.SDPMLineIndex,
+			UsernameFragment: init.UsernameFragment,
+		})
+	})
+	s.pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateConnected && s.started.CompareAndSwap(false, true) {
+			s.startMedia()
+		}
+	})
+	s.pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) { go s.receive(track) })
+	s.pc.OnDataChannel(s.attachDataChannel)
+
+	var err error
+	switch {
+	case cfg.Echo:
+		if s.audioEcho, err = webrtc.NewTrackLocalStaticRTP(pcmu, "audio", "headless-echo"); err != nil {
+			return err
+		}
+		if s.videoEcho, err = webrtc.NewTrackLocalStaticRTP(vp8, "video", "headless-echo"); err != nil {
+			return err
+		}
+		if err = s.addTrack(s.audioEcho); err == nil {
+			err = s.addTrack(s.videoEcho)
+		}
+	default:
+		if cfg.Audio {
+			if s.audioTone, err = webrtc.NewTrackLocalStaticSample(pcmu, "audio", "headless"); err != nil {
+				return err
+			}
+			if err = s.addTrack(s.audioTone); err != nil {
+				return err
+			}
+		}
+		if cfg.Video {
+			if s.videoFrames, err = webrtc.NewTrackLocalStaticSample(vp8, "video", "headless"); err != nil {
+				return err
+			}
+			err = s.addTrack(s.videoFrames)
+		}
+	}
+	return err
+}
+
+// addTrack adds a local track and drains its RTCP so interceptors keep running.
+func (s *session) addTrack(track webrtc.TrackLocal) error {
+	sender, err := s.pc.AddTrack(track)
+	if err != nil {
+		return err
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// ensureReceivers lets an offerer that sends nothing still receive audio and video.
+func (s *session) ensureReceivers() error {
+	kinds := map[webrtc.RTPCodecType]bool{}
+	for _, t := range s.pc.GetTransceivers() {
+		kinds[t.Kind()] = true
+	}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if kinds[kind] {
+			continue
+		}
+		if _, err := s.pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *session) sendCandidate(c client.ICECandidate) {
+	s.localMu.Lock()
+	if !s.signaled {
+		s.localPending = append(s.localPending, c)
+		s.localMu.Unlock()
+		return
+	}
+	s.localMu.Unlock()
+	s.peer.client.Candidate(s.remote, c)
+}
+
+// markSignaled releases candidates gathered before the offer or answer went out.
+func (s *session) markSignaled() {
+	s.localMu.Lock()
+	pending := s.localPending
+	s.localPending, s.signaled = nil, true
+	s.localMu.Unlock()
+	for _, c := range pending {
+		s.peer.client.Candidate(s.remote, c)
+	}
+}
+
+// receive counts inbound RTP and, in echo mode, reflects it.
+func (s *session) receive(track *webrtc.TrackRemote) {
+	packets, bytes, echo := &s.audioPackets, &s.audioBytes, s.audioEcho
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		packets, bytes, echo = &s.videoPackets, &s.videoBytes, s.videoEcho
+	}
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		packets.Add(1)
+		bytes.Add(int64(len(pkt.Payload)))
+		if echo != nil {
+			echo.WriteRTP(pkt)
+		}
+	}
+}
+
+func (s *session) startMedia() {
+	if s.audioTone != nil {
+		go s.pump(s.audioTone, audioFrame, newTone().frame)
+	}
+	if s.videoFrames != nil {
+		frame := make([]byte, videoFrameLen)
+		go s.pump(s.videoFrames, videoFrame, func() []byte { return frame })
+	}
+}
+
+// pump writes one sample per interval until the session closes.
+func (s *session) pump(track *webrtc.TrackLocalStaticSample, interval time.Duration, next func() []byte) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		if err := track.WriteSample(media.Sample{Data: next(), Duration: interval}); err != nil {
+			return
+		}
+	}
+}
+
+func (s *session) attachDataChannel(dc *webrtc.DataChannel) {
+	cfg := s.peer.cfg
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		s.dataMessages.Add(1)
+		s.dataBytes.Add(int64(len(msg.Data)))
+		if cfg.Echo {
+			dc.Send(msg.Data)
+		}
+	})
+	if !cfg.DataChannel || cfg.Echo {
+		return
+	}
+	dc.OnOpen(func() {
+		go func() {
+			ticker := time.NewTicker(dataInterval)
+			defer ticker.Stop()
+			for n := 0; ; n++ {
+				select {
+				case <-s.done:
+					return
+				case <-ticker.C:
+				}
+				if dc.SendText("headless "+strconv.Itoa(n)) != nil {
+					return
+				}
+			}
+		}()
+	})
+}
+
+// tone generates 20ms frames of a sine wave as 8 kHz G.711 mu-law.
+type tone struct{ n int }
+
+func newTone() *tone { return &tone{} }
+
+func (t *tone) frame() []byte {
+	frame := make([]byte, int(pcmu.ClockRate)*int(audioFrame/time.Millisecond)/1000)
+	for i := range frame {
+		v := toneAmplitude * math.Sin(2*math.Pi*toneHz*float64(t.n)/float64(pcmu.ClockRate))
+		frame[i] = linearToMulaw(int16(v))
+		t.n++
+	}
+	return frame
+}
+
+// linearToMulaw encodes one 16-bit PCM sample as G.711 mu-law.
+func linearToMulaw(sample int16) byte {
+	const bias, clip = 0x84, 32635
+	s := int(sample)
+	sign := 0
+	if s < 0 {
+		s, sign = -s, 0x80
+	}
+	if s > clip {
+		s = clip
+	}
+	s += bias
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> (exponent + 3)) & 0x0f
+	return ^byte(sign | exponent<<4 | mantissa)
+}
@@ -0,0 +1,302 @@
+// Signaling gRPC API for backend integrations.
+//
+// The service sits next to /ws/signal and speaks the same protocol with
+// typed messages. Every call carries the JWT the WebSocket endpoint takes,
+// as "authorization: Bearer <jwt>" metadata; rooms and peers are those of
+// the token's tenant. Regenerate pkg/signalingpb with `buf generate` in
+// backend/.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: signaling/v1/signaling.proto
+
+package signalingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Signaling_Signal_FullMethodName     = "/signaling.v1.Signaling/Signal"
+	Signaling_CreateRoom_FullMethodName = "/signaling.v1.Signaling/CreateRoom"
+	Signaling_CloseRoom_FullMethodName  = "/signaling.v1.Signaling/CloseRoom"
+	Signaling_KickPeer_FullMethodName   = "/signaling.v1.Signaling/KickPeer"
+	Signaling_WatchRooms_FullMethodName = "/signaling.v1.Signaling/WatchRooms"
+)
+
+// SignalingClient is the client API for Signaling service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SignalingClient interface {
+	// Signal connects the caller as a signaling peer with the ID a WebSocket
+	// connection with the same token would get, replacing it. Messages in
+	// both directions are those of the WebSocket protocol. When the hub ends
+	// the peer (a kick, an unsupported hello) the call fails with ABORTED and
+	// the WebSocket close code in the "signal-close-code" trailer.
+	Signal(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SignalMessage, SignalMessage], error)
+	// CreateRoom opens an empty room, counted against the tenant's room
+	// quota, that stays open until closed or emptied by its members leaving.
+	CreateRoom(ctx context.Context, in *CreateRoomRequest, opts ...grpc.CallOption) (*CreateRoomResponse, error)
+	// CloseRoom removes every member with a room-closed message. Members
+	// stay connected.
+	CloseRoom(ctx context.Context, in *CloseRoomRequest, opts ...grpc.CallOption) (*CloseRoomResponse, error)
+	// KickPeer disconnects a peer with close code 4002.
+	KickPeer(ctx context.Context, in *KickPeerRequest, opts ...grpc.CallOption) (*KickPeerResponse, error)
+	// WatchRooms streams room lifecycle events until cancelled.
+	WatchRooms(ctx context.Context, in *WatchRoomsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RoomEvent], error)
+}
+
+type signalingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSignalingClient(cc grpc.ClientConnInterface) SignalingClient {
+	return &signalingClient{cc}
+}
+
+func (c *signalingClient) Signal(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SignalMessage, SignalMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Signaling_ServiceDesc.Streams[0], Signaling_Signal_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SignalMessage, SignalMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Signaling_SignalClient = grpc.BidiStreamingClient[SignalMessage, SignalMessage]
+
+func (c *signalingClient) CreateRoom(ctx context.Context, in *CreateRoomRequest, opts ...grpc.CallOption) (*CreateRoomResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateRoomResponse)
+	err := c.cc.Invoke(ctx, Signaling_CreateRoom_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signalingClient) CloseRoom(ctx context.Context, in *CloseRoomRequest, opts ...grpc.CallOption) (*CloseRoomResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CloseRoomResponse)
+	err := c.cc.Invoke(ctx, Signaling_CloseRoom_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signalingClient) KickPeer(ctx context.Context, in *KickPeerRequest, opts ...grpc.CallOption) (*KickPeerResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KickPeerResponse)
+	err := c.cc.Invoke(ctx, Signaling_KickPeer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signalingClient) WatchRooms(ctx context.Context, in *WatchRoomsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RoomEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Signaling_ServiceDesc.Streams[1], Signaling_WatchRooms_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRoomsRequest, RoomEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Signaling_WatchRoomsClient = grpc.ServerStreamingClient[RoomEvent]
+
+// SignalingServer is the server API for Signaling service.
+// All implementations must embed UnimplementedSignalingServer
+// for forward compatibility.
+type SignalingServer interface {
+	// Signal connects the caller as a signaling peer with the ID a WebSocket
+	// connection with the same token would get, replacing it. Messages in
+	// both directions are those of the WebSocket protocol. When the hub ends
+	// the peer (a kick, an unsupported hello) the call fails with ABORTED and
+	// the WebSocket close code in the "signal-close-code" trailer.
+	Signal(grpc.BidiStreamingServer[SignalMessage, SignalMessage]) error
+	// CreateRoom opens an empty room, counted against the tenant's room
+	// quota, that stays open until closed or emptied by its members leaving.
+	CreateRoom(context.Context, *CreateRoomRequest) (*CreateRoomResponse, error)
+	// CloseRoom removes every member with a room-closed message. Members
+	// stay connected.
+	CloseRoom(context.Context, *CloseRoomRequest) (*CloseRoomResponse, error)
+	// KickPeer disconnects a peer with close code 4002.
+	KickPeer(context.Context, *KickPeerRequest) (*KickPeerResponse, error)
+	// WatchRooms streams room lifecycle events until cancelled.
+	WatchRooms(*WatchRoomsRequest, grpc.ServerStreamingServer[RoomEvent]) error
+	mustEmbedUnimplementedSignalingServer()
+}
+
+// UnimplementedSignalingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSignalingServer struct{}
+
+func (UnimplementedSignalingServer) Signal(grpc.BidiStreamingServer[SignalMessage, SignalMessage]) error {
+	return status.Errorf(codes.Unimplemented, "method Signal not implemented")
+}
+func (UnimplementedSignalingServer) CreateRoom(context.Context, *CreateRoomRequest) (*CreateRoomResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRoom not implemented")
+}
+func (UnimplementedSignalingServer) CloseRoom(context.Context, *CloseRoomRequest) (*CloseRoomResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseRoom not implemented")
+}
+func (UnimplementedSignalingServer) KickPeer(context.Context, *KickPeerRequest) (*KickPeerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KickPeer not implemented")
+}
+func (UnimplementedSignalingServer) WatchRooms(*WatchRoomsRequest, grpc.ServerStreamingServer[RoomEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRooms not implemented")
+}
+func (UnimplementedSignalingServer) mustEmbedUnimplementedSignalingServer() {}
+func (UnimplementedSignalingServer) testEmbeddedByValue()                   {}
+
+// UnsafeSignalingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SignalingServer will
+// result in compilation errors.
+type UnsafeSignalingServer interface {
+	mustEmbedUnimplementedSignalingServer()
+}
+
+func RegisterSignalingServer(s grpc.ServiceRegistrar, srv SignalingServer) {
+	// If the following call pancis, it indicates UnimplementedSignalingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Signaling_ServiceDesc, srv)
+}
+
+func _Signaling_Signal_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SignalingServer).Signal(&grpc.GenericServerStream[SignalMessage, SignalMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Signaling_SignalServer = grpc.BidiStreamingServer[SignalMessage, SignalMessage]
+
+func _Signaling_CreateRoom_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRoomRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignalingServer).CreateRoom(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Signaling_CreateRoom_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignalingServer).CreateRoom(ctx, req.(*CreateRoomRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signaling_CloseRoom_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseRoomRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignalingServer).CloseRoom(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Signaling_CloseRoom_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignalingServer).CloseRoom(ctx, req.(*CloseRoomRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signaling_KickPeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KickPeerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignalingServer).KickPeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Signaling_KickPeer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignalingServer).KickPeer(ctx, req.(*KickPeerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signaling_WatchRooms_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRoomsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SignalingServer).WatchRooms(m, &grpc.GenericServerStream[WatchRoomsRequest, RoomEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Signaling_WatchRoomsServer = grpc.ServerStreamingServer[RoomEvent]
+
+// Signaling_ServiceDesc is the grpc.ServiceDesc for Signaling service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Signaling_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "signaling.v1.Signaling",
+	HandlerType: (*SignalingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateRoom",
+			Handler:    _Signaling_CreateRoom_Handler,
+		},
+		{
+			MethodName: "CloseRoom",
+			Handler:    _Signaling_CloseRoom_Handler,
+		},
+		{
+			MethodName: "KickPeer",
+			Handler:    _Signaling_KickPeer_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Signal",
+			Handler:       _Signaling_Signal_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchRooms",
+			Handler:       _Signaling_WatchRooms_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "signaling/v1/signaling.proto",
+}
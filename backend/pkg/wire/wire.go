@@ -0,0 +1,123 @@
+// Package wire — Signaling message encodings selected by WebSocket subprotocol.
+//
+// Clients pick an encoding when they connect by offering a subprotocol:
+// signal.json (the default, also used when none is offered) or
+// signal.msgpack. Both encode the same message structs by their json tags,
+// so JSON and MessagePack peers interoperate in one room; MessagePack
+// carries embedded JSON values, such as ICE candidates, as native maps.
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Subprotocols naming the encodings.
+const (
+	SubprotocolJSON    = "signal.json"
+	SubprotocolMsgPack = "signal.msgpack"
+)
+
+// Subprotocols lists the subprotocols a server accepts, most preferred
+// first.
+var Subprotocols = []string{SubprotocolMsgPack, SubprotocolJSON}
+
+// Codec encodes signaling messages for one subprotocol.
+type Codec interface {
+	// Subprotocol is the name clients offer to select the codec.
+	Subprotocol() string
+	// FrameType is the WebSocket message type frames are sent as.
+	FrameType() int
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// The codecs.
+var (
+	JSON        Codec = jsonCodec{}
+	MessagePack Codec = msgpackCodec{}
+)
+
+// ForSubprotocol returns the codec a connection negotiated; JSON when it
+// negotiated none.
+func ForSubprotocol(name string) Codec {
+	if name == SubprotocolMsgPack {
+		return MessagePack
+	}
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string                        { return SubprotocolJSON }
+func (jsonCodec) FrameType() int                             { return websocket.TextMessage }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Subprotocol() string { return SubprotocolMsgPack }
+func (msgpackCodec) FrameType() int      { return websocket.BinaryMessage }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.GetEncoder()
+	enc.Reset(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	err := enc.Encode(v)
+	msgpack.PutEncoder(enc)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.GetDecoder()
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	err := dec.Decode(v)
+	msgpack.PutDecoder(dec)
+	return err
+}
+
+// Embedded JSON crosses MessagePack as the value it holds rather than as
+// opaque bytes, so binary clients see a candidate as a map.
+func init() {
+	msgpack.Register(json.RawMessage(nil),
+		func(enc *msgpack.Encoder, v reflect.Value) error {
+			raw := v.Bytes()
+			if len(raw) == 0 {
+				return enc.EncodeNil()
+			}
+			var value interface{}
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return err
+			}
+			return enc.Encode(value)
+		},
+		func(dec *msgpack.Decoder, v reflect.Value) error {
+			value, err := dec.DecodeInterface()
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				v.SetBytes(nil)
+				return nil
+			}
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(raw)
+			return nil
+		})
+}
@@ -0,0 +1,74 @@
+// Package wire — Codec round-trip tests.
+//
+// By:- Faisal Hanif | imfanee@gmail.com
+
+package wire
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+type message struct {
+	Type      string          `json:"type"`
+	Peers     []string        `json:"peers,omitempty"`
+	Version   int             `json:"version,omitempty"`
+	Candidate json.RawMessage `json:"candidate,omitempty"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := message{
+		Type:      "ice-candidate",
+		Peers:     []string{"a", "b"},
+		Version:   2,
+		Candidate: json.RawMessage(`{"candidate":"candidate:1 1 udp 1 192.0.2.1 9 typ host","sdpMid":"0","sdpMLineIndex":1}`),
+	}
+	for _, codec := range []Codec{JSON, MessagePack} {
+		data, err := codec.Marshal(in)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.Subprotocol(), err)
+		}
+		var out message
+		if err := codec.Unmarshal(data, &out); err != nil {
+			t.Fatalf("%s: %v", codec.Subprotocol(), err)
+		}
+		var want, got interface{}
+		json.Unmarshal(in.Candidate, &want)
+		json.Unmarshal(out.Candidate, &got)
+		if out.Type != in.Type || !reflect.DeepEqual(out.Peers, in.Peers) || out.Version != in.Version || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: round trip gave %+v", codec.Subprotocol(), out)
+		}
+	}
+}
+
+func TestMessagePackOmitsEmpty(t *testing.T) {
+	data, err := MessagePack.Marshal(message{Type: "leave"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := MessagePack.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 1 || fields["type"] != "leave" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	var out message
+	if err := MessagePack.Unmarshal(data, &out); err != nil || out.Candidate != nil {
+		t.Fatalf("unexpected decode %+v %v", out, err)
+	}
+}
+
+func TestForSubprotocol(t *testing.T) {
+	if ForSubprotocol(SubprotocolMsgPack) != MessagePack || MessagePack.FrameType() != websocket.BinaryMessage {
+		t.Fatal("msgpack subprotocol should select binary MessagePack")
+	}
+	for _, name := range []string{"", SubprotocolJSON, "sip"} {
+		if ForSubprotocol(name) != JSON {
+			t.Fatalf("%q should select JSON", name)
+		}
+	}
+}
@@ -8,7 +8,7 @@
 import { useCallback, useEffect, useRef, useState } from 'react';
 import { SignalingClient } from '@/lib/signaling_client';
 import { WebRTCClient } from '@/lib/webrtc_client';
-import { fetchToken, getSignalingUrl } from '@/lib/auth_client';
+import { fetchIceServers, fetchToken, getSignalingUrl } from '@/lib/auth_client';
 
 export default function Home() {
   const [userId, setUserId] = useState('');
@@ -20,6 +20,7 @@ export default function Home() {
   const signalingRef = useRef<SignalingClient | null>(null);
   const webrtcRef = useRef<WebRTCClient | null>(null);
   const remotePeerIdRef = useRef<string | null>(null);
+  const iceServersRef = useRef<RTCIceServer[] | undefined>(undefined);
 
   const connectAndJoin = useCallback(async () => {
     if (!userId.trim() || !roomId.trim()) {
@@ -30,6 +31,7 @@ export default function Home() {
     setErrorMessage('');
     try {
       const token = await fetchToken(userId.trim());
+      iceServersRef.current = await fetchIceServers(token).catch(() => undefined);
       const signaling = new SignalingClient(getSignalingUrl());
       signalingRef.current = signaling;
 
@@ -74,7 +76,9 @@ export default function Home() {
   const handleOffer = async (peerId: string, sdp: string) => {
     const webrtc = new WebRTCClient();
     webrtcRef.current = webrtc;
-    await webrtc.createPeerConnection();
+    await webrtc.createPeerConnection(
+      iceServersRef.current ? { iceServers: iceServersRef.current } : undefined,
+    );
     await attachLocalStream(webrtc);
     webrtc.onRemoteStream((stream) => {
       if (remoteVideoRef.current) {
@@ -109,7 +113,9 @@ export default function Home() {
     if (!peerId || !signalingRef.current?.isConnected) return;
     const webrtc = new WebRTCClient();
     webrtcRef.current = webrtc;
-    await webrtc.createPeerConnection();
+    await webrtc.createPeerConnection(
+      iceServersRef.current ? { iceServers: iceServersRef.current } : undefined,
+    );
     await attachLocalStream(webrtc);
     webrtc.onRemoteStream((stream) => {
       if (remoteVideoRef.current) {
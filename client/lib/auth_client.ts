@@ -20,10 +20,19 @@ const getSignalingBaseUrl = (): string => {
   return process.env.NEXT_PUBLIC_SIGNALING_URL ?? 'http://localhost:8080';
 };
 
-export async function fetchToken(userId: string): Promise<string> {
+/**
+ * Issues a token for userId. The auth service decides its tenant and role
+ * from the API client apiKey identifies (required when AUTH_CLIENTS_FILE is
+ * set); without one it issues default-tenant tokens only.
+ */
+export async function fetchToken(userId: string, apiKey?: string): Promise<string> {
+  const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+  if (apiKey) {
+    headers['X-API-Key'] = apiKey;
+  }
   const res = await fetch(`${getAuthBaseUrl()}/auth/token`, {
     method: 'POST',
-    headers: { 'Content-Type': 'application/json' },
+    headers,
     body: JSON.stringify({ userId }),
   });
   if (!res.ok) {
@@ -33,6 +42,18 @@ export async function fetchToken(userId: string): Promise<string> {
   return data.token;
 }
 
+export async function fetchIceServers(token: string, region?: string): Promise<RTCIceServer[]> {
+  const query = region ? `?region=${encodeURIComponent(region)}` : '';
+  const res = await fetch(`${getAuthBaseUrl()}/auth/ice-servers${query}`, {
+    headers: { Authorization: `Bearer ${token}` },
+  });
+  if (!res.ok) {
+    throw new Error('Failed to fetch ICE servers');
+  }
+  const data = await res.json();
+  return data.iceServers;
+}
+
 export function getSignalingUrl(): string {
   return getSignalingBaseUrl();
 }
@@ -11,14 +11,42 @@ export interface SignalMessage {
   peers?: string[];
   sdp?: string;
   candidate?: RTCIceCandidateInit;
+  /** "sfu" on joined/room-mode when media goes through the SFU. */
+  mode?: string;
+  /** Simulcast layer (RID) requested by subscribe. */
+  layer?: string;
+  /** Which SFU connection an sfu-candidate belongs to. */
+  role?: 'publish' | 'subscribe';
+  /** Set on recording notices. */
+  recordingId?: string;
+  /** "started" or "stopped" on recording notices. */
+  state?: string;
+  from?: string;
+  message?: string;
+  /** Correlates a message with its ack or error. */
+  id?: string;
+  /** Protocol version on hello/welcome. */
+  version?: number;
+  /** Message types understood (hello) or accepted (welcome). */
+  types?: string[];
+  /** Optional features asked for (hello) or granted (welcome). */
+  features?: string[];
 }
 
+/** Protocol version this client speaks. */
+export const PROTOCOL_VERSION = 2;
+
+/** Close code the server uses for an unsupported protocol version. */
+export const CLOSE_UNSUPPORTED_VERSION = 4001;
+
 export type SignalMessageHandler = (msg: SignalMessage) => void;
 
 export class SignalingClient {
   private webSocket: WebSocket | null = null;
   private messageHandler: SignalMessageHandler | null = null;
   private readonly baseUrl: string;
+  private version = 1;
+  private granted: string[] = [];
 
   constructor(baseUrl: string) {
     this.baseUrl = baseUrl.replace(/^http/, 'ws');
@@ -29,11 +57,34 @@ export class SignalingClient {
       const url = `${this.baseUrl}/ws/signal?token=${encodeURIComponent(token)}`;
       this.webSocket = new WebSocket(url);
 
-      this.webSocket.onopen = () => resolve();
+      let welcomed = false;
+
+      this.webSocket.onopen = () => {
+        // Browsers offer permessage-deflate on every socket.
+        this.send({ type: 'hello', version: PROTOCOL_VERSION, features: ['compression'] });
+      };
       this.webSocket.onerror = () => reject(new Error('WebSocket connection failed'));
+      this.webSocket.onclose = (event) => {
+        if (event.code === CLOSE_UNSUPPORTED_VERSION) {
+          reject(new Error(`Unsupported protocol version: ${event.reason}`));
+        }
+      };
       this.webSocket.onmessage = (event) => {
         try {
           const msg = JSON.parse(event.data) as SignalMessage;
+          if (!welcomed) {
+            // The reply to hello: welcome, or an error from a server that
+            // predates the handshake and speaks version 1.
+            welcomed = true;
+            if (msg.type === 'welcome') {
+              this.version = msg.version ?? 1;
+              this.granted = msg.features ?? [];
+            }
+            resolve();
+            if (msg.type === 'welcome' || msg.type === 'error') {
+              return;
+            }
+          }
           this.messageHandler?.(msg);
         } catch {
           // Ignore parse errors
@@ -68,6 +119,34 @@ export class SignalingClient {
     this.send({ type: 'ice-candidate', peerId, candidate });
   }
 
+  publish(sdp: string): void {
+    this.send({ type: 'publish', sdp });
+  }
+
+  subscribe(publisherId: string, layer?: string): void {
+    this.send({ type: 'subscribe', peerId: publisherId, layer });
+  }
+
+  unsubscribe(publisherId: string): void {
+    this.send({ type: 'unsubscribe', peerId: publisherId });
+  }
+
+  sendSubscribeAnswer(sdp: string): void {
+    this.send({ type: 'subscribe-answer', sdp });
+  }
+
+  sendSfuCandidate(role: 'publish' | 'subscribe', candidate: RTCIceCandidateInit): void {
+    this.send({ type: 'sfu-candidate', role, candidate });
+  }
+
+  startRecording(): void {
+    this.send({ type: 'record-start' });
+  }
+
+  stopRecording(): void {
+    this.send({ type: 'record-stop' });
+  }
+
   leaveRoom(roomId: string): void {
     this.send({ type: 'leave', roomId });
   }
@@ -79,6 +158,15 @@ export class SignalingClient {
     }
   }
 
+  /** Protocol version negotiated with the server. */
+  get protocolVersion(): number {
+    return this.version;
+  }
+
+  hasFeature(name: string): boolean {
+    return this.granted.includes(name);
+  }
+
   get isConnected(): boolean {
     return this.webSocket?.readyState === WebSocket.OPEN;
   }